@@ -19,6 +19,7 @@ require (
 	github.com/golang/protobuf v1.4.0
 	github.com/jinzhu/gorm v1.9.12
 	github.com/leodido/go-urn v1.1.0 // indirect
+	github.com/lib/pq v1.1.1
 	github.com/montanaflynn/stats v0.5.0
 	github.com/opentracing/opentracing-go v1.1.0
 	github.com/otokaze/mock v0.0.0-20190125081256-8282b7a7c7c3
@@ -36,6 +37,7 @@ require (
 	go.uber.org/atomic v1.4.0 // indirect
 	golang.org/x/crypto v0.0.0-20200323165209-0ec3e9974c59 // indirect
 	golang.org/x/net v0.0.0-20200324143707-d3edc9973b7e
+	golang.org/x/sync v0.0.0-20190911185100-cd5d95a43a6e
 	golang.org/x/sys v0.0.0-20201101102859-da207088b7d1 // indirect
 	golang.org/x/tools v0.0.0-20191105231337-689d0f08e67a
 	google.golang.org/appengine v1.6.1 // indirect
@@ -0,0 +1,82 @@
+package hotkey
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DebugPath is the path of the debug endpoint which shows the top keys per cache client.
+const DebugPath = "/debug/cache/hotkey"
+
+var _detectors = struct {
+	sync.RWMutex
+	m map[*Detector]struct{}
+}{m: make(map[*Detector]struct{})}
+
+// Report is the top keys of a detector.
+type Report struct {
+	Name string `json:"name"`
+	// Window is the duration the keys are counted in.
+	Window string `json:"window"`
+	// Threshold is the min count of a hot key.
+	Threshold int64  `json:"threshold"`
+	Keys      []Item `json:"keys"`
+}
+
+// Reports returns the top keys of all alive detectors, sorted by name.
+func Reports() (reports []*Report) {
+	_detectors.RLock()
+	ds := make([]*Detector, 0, len(_detectors.m))
+	for d := range _detectors.m {
+		ds = append(ds, d)
+	}
+	_detectors.RUnlock()
+	for _, d := range ds {
+		reports = append(reports, &Report{
+			Name:      d.name,
+			Window:    time.Duration(d.conf.Window).String(),
+			Threshold: d.conf.Threshold,
+			Keys:      d.TopK(),
+		})
+	}
+	sort.SliceStable(reports, func(i, j int) bool {
+		return reports[i].Name < reports[j].Name
+	})
+	return
+}
+
+// RegisterDebugHandler registers DebugHandler on mux at DebugPath.
+func RegisterDebugHandler(mux *http.ServeMux) {
+	mux.HandleFunc(DebugPath, DebugHandler)
+}
+
+// DebugHandler writes the top keys of all alive detectors as json.
+func DebugHandler(w http.ResponseWriter, r *http.Request) {
+	reports := Reports()
+	if name := r.URL.Query().Get("name"); name != "" {
+		var matched []*Report
+		for _, report := range reports {
+			if report.Name == name {
+				matched = append(matched, report)
+			}
+		}
+		reports = matched
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(reports)
+}
+
+func register(d *Detector) {
+	_detectors.Lock()
+	_detectors.m[d] = struct{}{}
+	_detectors.Unlock()
+}
+
+func unregister(d *Detector) {
+	_detectors.Lock()
+	delete(_detectors.m, d)
+	_detectors.Unlock()
+}
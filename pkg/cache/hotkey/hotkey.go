@@ -0,0 +1,331 @@
+// Package hotkey detects the hot keys of a cache client by sampling its
+// accesses into a count-min sketch of a rolling window, the heaviest keys
+// are kept in a top-K, reported by the debug endpoint and logs, and can be
+// promoted into a short-ttl local cache.
+package hotkey
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/djienet/kratos/pkg/log"
+	xtime "github.com/djienet/kratos/pkg/time"
+
+	farm "github.com/dgryski/go-farm"
+)
+
+// Config hot key detector config.
+type Config struct {
+	// Window is the duration the accesses are counted in, default 10s.
+	Window xtime.Duration
+	// Buckets is the buckets count of the rolling window, default 10.
+	Buckets int
+	// Width is the counters per row of the sketch, which is split into 16
+	// shards and rounded up to the power of 2 per shard, default 2048.
+	Width int
+	// TopK is the number of the heaviest keys kept, default 16.
+	TopK int
+	// Threshold is the min count in Window of a hot key, default 1000.
+	Threshold int64
+	// SampleRate is the ratio of the accesses counted in (0, 1], default 1,
+	// the counts are scaled back by it.
+	SampleRate float64
+	// LogInterval is the interval of logging the hot keys, default 1m,
+	// negative disables.
+	LogInterval xtime.Duration
+	// LocalTTL promotes the values of the hot keys into a local cache for
+	// the ttl, zero disables. The writes of the same client invalidate the
+	// local values, the others are seen after at most LocalTTL.
+	LocalTTL xtime.Duration
+}
+
+func (c *Config) fix() {
+	if c.Window <= 0 {
+		c.Window = xtime.Duration(10 * time.Second)
+	}
+	if c.Buckets <= 0 {
+		c.Buckets = 10
+	}
+	if c.Width <= 0 {
+		c.Width = 2048
+	}
+	if c.TopK <= 0 {
+		c.TopK = 16
+	}
+	if c.Threshold <= 0 {
+		c.Threshold = 1000
+	}
+	if c.SampleRate <= 0 || c.SampleRate > 1 {
+		c.SampleRate = 1
+	}
+	if c.LogInterval == 0 {
+		c.LogInterval = xtime.Duration(time.Minute)
+	}
+}
+
+// Item is a key kept in the top-K.
+type Item struct {
+	Key string `json:"key"`
+	// Count is the estimated accesses in the window.
+	Count uint64 `json:"count"`
+	// Hot reports whether Count reaches the threshold.
+	Hot bool `json:"hot"`
+}
+
+type promoted struct {
+	value  interface{}
+	expire time.Time
+}
+
+const (
+	// _shards is the shards count of a detector, the keys are sharded by the
+	// bits of their hashes which are not used by the sketch columns.
+	_shards     = 16
+	_shardShift = 28
+	// _versions is the invalidation versions per shard, the keys share the
+	// versions by their hashes.
+	_versions = 256
+)
+
+// shard counts the keys hashed to it in its own window and top-K, so the
+// accesses of different keys rarely contend.
+type shard struct {
+	mu     sync.Mutex
+	window *windowSketch
+	top    *topK
+	// local is the promoted values, only the keys in top are kept.
+	local    map[string]*promoted
+	versions [_versions]uint64
+}
+
+// Detector counts the accesses of keys and finds the hot ones, it is safe
+// for concurrent use.
+type Detector struct {
+	name   string
+	conf   *Config
+	weight uint32
+	shards [_shards]*shard
+
+	cancel func()
+}
+
+// New new a detector of the cache client named name.
+func New(name string, c *Config) *Detector {
+	if c == nil {
+		c = &Config{}
+	}
+	c.fix()
+	ctx, cancel := context.WithCancel(context.Background())
+	d := &Detector{
+		name:   name,
+		conf:   c,
+		weight: uint32(1/c.SampleRate + 0.5),
+		cancel: cancel,
+	}
+	width := c.Width / _shards
+	if width < 64 {
+		width = 64
+	}
+	for i := range d.shards {
+		d.shards[i] = &shard{
+			window: newWindowSketch(c.Buckets, width, time.Duration(c.Window)/time.Duration(c.Buckets)),
+			top:    newTopK(c.TopK),
+			local:  make(map[string]*promoted),
+		}
+	}
+	if c.LogInterval > 0 {
+		go d.logproc(ctx)
+	}
+	register(d)
+	return d
+}
+
+// Name returns the name of the cache client.
+func (d *Detector) Name() string {
+	return d.name
+}
+
+func (d *Detector) shard(key string) (*shard, uint64) {
+	h := farm.Hash64([]byte(key))
+	return d.shards[(h>>_shardShift)&(_shards-1)], h
+}
+
+// Add counts an access of key, it is sampled by SampleRate.
+func (d *Detector) Add(key string) {
+	if d.conf.SampleRate < 1 && rand.Float64() >= d.conf.SampleRate {
+		return
+	}
+	s, h := d.shard(key)
+	s.mu.Lock()
+	s.roll(time.Now())
+	if evicted, ok := s.top.offer(key, s.window.add(h, d.weight)); ok {
+		delete(s.local, evicted)
+	}
+	s.mu.Unlock()
+}
+
+// roll rolls the window and recounts the keys of the top-K.
+func (s *shard) roll(now time.Time) {
+	if !s.window.roll(now) {
+		return
+	}
+	for _, key := range s.top.refresh(s.estimate) {
+		delete(s.local, key)
+	}
+}
+
+func (s *shard) estimate(key string) uint64 {
+	return s.window.estimate(farm.Hash64([]byte(key)))
+}
+
+// Hot reports whether key is hot.
+func (d *Detector) Hot(key string) (hot bool) {
+	s, _ := d.shard(key)
+	s.mu.Lock()
+	hot = d.hot(s, key)
+	s.mu.Unlock()
+	return
+}
+
+func (d *Detector) hot(s *shard, key string) bool {
+	count, ok := s.top.get(key)
+	return ok && count >= uint64(d.conf.Threshold)
+}
+
+// TopK returns the keys of the top-K in the window sorted by count.
+func (d *Detector) TopK() (items []Item) {
+	now := time.Now()
+	for _, s := range d.shards {
+		s.mu.Lock()
+		s.roll(now)
+		items = append(items, s.top.list()...)
+		s.mu.Unlock()
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].Count != items[j].Count {
+			return items[i].Count > items[j].Count
+		}
+		return items[i].Key < items[j].Key
+	})
+	if len(items) > d.conf.TopK {
+		items = items[:d.conf.TopK]
+	}
+	for i := range items {
+		items[i].Hot = items[i].Count >= uint64(d.conf.Threshold)
+	}
+	return
+}
+
+// HotKeys returns the hot keys sorted by count.
+func (d *Detector) HotKeys() (items []Item) {
+	for _, item := range d.TopK() {
+		if item.Hot {
+			items = append(items, item)
+		}
+	}
+	return
+}
+
+// Load returns the promoted value of key, the value is shared and must not
+// be modified.
+func (d *Detector) Load(key string) (value interface{}, ok bool) {
+	if d.conf.LocalTTL <= 0 {
+		return
+	}
+	s, _ := d.shard(key)
+	s.mu.Lock()
+	if p, exist := s.local[key]; exist {
+		if time.Now().Before(p.expire) {
+			value, ok = p.value, true
+		} else {
+			delete(s.local, key)
+		}
+	}
+	s.mu.Unlock()
+	return
+}
+
+// Version returns the invalidation version of key, get it before reading the
+// value to be stored, Store drops the value if key is deleted in between.
+func (d *Detector) Version(key string) (v uint64) {
+	s, h := d.shard(key)
+	s.mu.Lock()
+	v = s.versions[h%_versions]
+	s.mu.Unlock()
+	return
+}
+
+// Store promotes value of key into the local cache if key is hot and not
+// deleted since version, the value must not be modified after stored.
+func (d *Detector) Store(key string, value interface{}, version uint64) {
+	if d.conf.LocalTTL <= 0 {
+		return
+	}
+	s, h := d.shard(key)
+	s.mu.Lock()
+	if s.versions[h%_versions] == version && d.hot(s, key) {
+		s.local[key] = &promoted{value: value, expire: time.Now().Add(time.Duration(d.conf.LocalTTL))}
+	}
+	s.mu.Unlock()
+}
+
+// Delete removes the promoted value of key, the values of key read before
+// are not stored any more.
+func (d *Detector) Delete(key string) {
+	if d.conf.LocalTTL <= 0 {
+		return
+	}
+	s, h := d.shard(key)
+	s.mu.Lock()
+	delete(s.local, key)
+	s.versions[h%_versions]++
+	s.mu.Unlock()
+}
+
+// Clear removes all the promoted values, e.g. after FLUSHDB.
+func (d *Detector) Clear() {
+	if d.conf.LocalTTL <= 0 {
+		return
+	}
+	for _, s := range d.shards {
+		s.mu.Lock()
+		s.local = make(map[string]*promoted)
+		for i := range s.versions {
+			s.versions[i]++
+		}
+		s.mu.Unlock()
+	}
+}
+
+// Close stops logging and removes the detector from the debug endpoint.
+func (d *Detector) Close() error {
+	d.cancel()
+	unregister(d)
+	return nil
+}
+
+func (d *Detector) logproc(ctx context.Context) {
+	ticker := time.NewTicker(time.Duration(d.conf.LogInterval))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		items := d.HotKeys()
+		if len(items) == 0 {
+			continue
+		}
+		keys := make([]string, 0, len(items))
+		for _, item := range items {
+			keys = append(keys, fmt.Sprintf("%s:%d", item.Key, item.Count))
+		}
+		log.Warn("hotkey: %s hot keys in %v: %s", d.name, time.Duration(d.conf.Window), strings.Join(keys, ","))
+	}
+}
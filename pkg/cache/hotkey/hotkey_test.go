@@ -0,0 +1,198 @@
+package hotkey
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	xtime "github.com/djienet/kratos/pkg/time"
+)
+
+func TestWindowSketch(t *testing.T) {
+	s := newWindowSketch(2, 1024, time.Hour)
+	s.add(1, 3)
+	if got := s.add(1, 2); got != 5 {
+		t.Fatalf("estimate got %d want 5", got)
+	}
+	if got := s.estimate(2); got != 0 {
+		t.Fatalf("estimate of absent got %d want 0", got)
+	}
+	now := s.lastAppendTime
+	if s.roll(now.Add(time.Minute)) {
+		t.Fatal("rolled within the bucket")
+	}
+	if !s.roll(now.Add(time.Hour)) {
+		t.Fatal("not rolled after the bucket")
+	}
+	s.add(1, 1)
+	if got := s.estimate(1); got != 6 {
+		t.Fatalf("estimate of the window got %d want 6", got)
+	}
+	s.roll(now.Add(2 * time.Hour))
+	if got := s.estimate(1); got != 1 {
+		t.Fatalf("estimate after the first bucket expired got %d want 1", got)
+	}
+	s.roll(now.Add(10 * time.Hour))
+	if got := s.estimate(1); got != 0 {
+		t.Fatalf("estimate after the window expired got %d want 0", got)
+	}
+}
+
+func TestTopK(t *testing.T) {
+	top := newTopK(2)
+	top.offer("a", 1)
+	top.offer("b", 2)
+	if _, ok := top.offer("c", 1); ok {
+		t.Fatal("c evicted a key with the same count")
+	}
+	if evicted, ok := top.offer("c", 3); !ok || evicted != "a" {
+		t.Fatalf("evicted got %q %v want a", evicted, ok)
+	}
+	top.offer("b", 5)
+	items := top.list()
+	if len(items) != 2 || items[0].Key != "b" || items[1].Key != "c" {
+		t.Fatalf("list got %+v", items)
+	}
+	removed := top.refresh(func(key string) uint64 {
+		if key == "b" {
+			return 0
+		}
+		return 1
+	})
+	if len(removed) != 1 || removed[0] != "b" {
+		t.Fatalf("removed got %v want [b]", removed)
+	}
+	if count, ok := top.get("c"); !ok || count != 1 {
+		t.Fatalf("c got %d %v want 1", count, ok)
+	}
+}
+
+func TestDetector(t *testing.T) {
+	d := New("test", &Config{
+		TopK:      4,
+		Threshold: 100,
+		LocalTTL:  xtime.Duration(time.Minute),
+	})
+	defer d.Close()
+	for i := 0; i < 200; i++ {
+		d.Add("hot")
+		d.Add(fmt.Sprintf("cold_%d", i))
+	}
+	if !d.Hot("hot") {
+		t.Fatal("hot is not hot")
+	}
+	if d.Hot("cold_1") {
+		t.Fatal("cold_1 is hot")
+	}
+	items := d.HotKeys()
+	if len(items) != 1 || items[0].Key != "hot" || items[0].Count < 200 {
+		t.Fatalf("hot keys got %+v", items)
+	}
+	d.Store("cold_1", 1, d.Version("cold_1"))
+	if _, ok := d.Load("cold_1"); ok {
+		t.Fatal("cold key promoted")
+	}
+	d.Store("hot", 1, d.Version("hot"))
+	if v, ok := d.Load("hot"); !ok || v != 1 {
+		t.Fatalf("load got %v %v want 1", v, ok)
+	}
+	d.Delete("hot")
+	if _, ok := d.Load("hot"); ok {
+		t.Fatal("load after delete")
+	}
+	d.Store("hot", 2, d.Version("hot"))
+	d.Clear()
+	if _, ok := d.Load("hot"); ok {
+		t.Fatal("load after clear")
+	}
+}
+
+func TestDetectorVersion(t *testing.T) {
+	d := New("version", &Config{Threshold: 1, LocalTTL: xtime.Duration(time.Minute)})
+	defer d.Close()
+	d.Add("key")
+	// a read raced with a write, the value read before the delete is stale.
+	v := d.Version("key")
+	d.Delete("key")
+	d.Store("key", "stale", v)
+	if _, ok := d.Load("key"); ok {
+		t.Fatal("stored the value read before the delete")
+	}
+	d.Store("key", "fresh", d.Version("key"))
+	if got, ok := d.Load("key"); !ok || got != "fresh" {
+		t.Fatalf("load got %v %v want fresh", got, ok)
+	}
+	v = d.Version("key")
+	d.Clear()
+	d.Store("key", "stale", v)
+	if _, ok := d.Load("key"); ok {
+		t.Fatal("stored the value read before the clear")
+	}
+}
+
+func TestDetectorShards(t *testing.T) {
+	d := New("shards", &Config{TopK: 4, Threshold: 10})
+	defer d.Close()
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				for k := 0; k < 20; k++ {
+					if k < 6 || i%10 == 0 {
+						d.Add(fmt.Sprintf("key_%d", k))
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	items := d.TopK()
+	if len(items) != 4 {
+		t.Fatalf("top keys got %+v want 4", items)
+	}
+	for i, item := range items {
+		if item.Count < 800 || !item.Hot || (i > 0 && item.Count > items[i-1].Count) {
+			t.Fatalf("top keys got %+v", items)
+		}
+	}
+}
+
+func TestDetectorSample(t *testing.T) {
+	d := New("sample", &Config{SampleRate: 0.5, Threshold: 100})
+	defer d.Close()
+	for i := 0; i < 1000; i++ {
+		d.Add("hot")
+	}
+	items := d.TopK()
+	if len(items) != 1 || items[0].Count < 700 || items[0].Count > 1300 {
+		t.Fatalf("scaled count got %+v want about 1000", items)
+	}
+}
+
+func TestDebugHandler(t *testing.T) {
+	d := New("debug", &Config{Threshold: 1})
+	d.Add("key")
+	mux := http.NewServeMux()
+	RegisterDebugHandler(mux)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("GET", DebugPath+"?name=debug", nil))
+	var reports []*Report
+	if err := json.Unmarshal(w.Body.Bytes(), &reports); err != nil {
+		t.Fatal(err)
+	}
+	if len(reports) != 1 || len(reports[0].Keys) != 1 || !reports[0].Keys[0].Hot {
+		t.Fatalf("reports got %s", w.Body.String())
+	}
+	d.Close()
+	w = httptest.NewRecorder()
+	DebugHandler(w, httptest.NewRequest("GET", DebugPath+"?name=debug", nil))
+	if w.Body.String() != "null\n" {
+		t.Fatalf("closed detector reported %s", w.Body.String())
+	}
+}
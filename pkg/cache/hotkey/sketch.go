@@ -0,0 +1,98 @@
+package hotkey
+
+import (
+	"math"
+	"time"
+)
+
+const _sketchDepth = 4
+
+// windowSketch is a count-min sketch per bucket of a rolling window, the
+// buckets are rotated like metric.RollingPolicy and the estimate of a key
+// is its counters summed over the buckets.
+type windowSketch struct {
+	// buckets[i] is the depth rows of width counters of the ith bucket.
+	buckets [][]uint32
+	mask    uint64
+	offset  int
+
+	bucketDuration time.Duration
+	lastAppendTime time.Time
+}
+
+func newWindowSketch(size, width int, bucketDuration time.Duration) *windowSketch {
+	n := 1
+	for n < width {
+		n <<= 1
+	}
+	s := &windowSketch{
+		buckets:        make([][]uint32, size),
+		mask:           uint64(n - 1),
+		bucketDuration: bucketDuration,
+		lastAppendTime: time.Now(),
+	}
+	for i := range s.buckets {
+		s.buckets[i] = make([]uint32, _sketchDepth*n)
+	}
+	return s
+}
+
+// index returns the index of the counter of h in the ith row.
+func (s *windowSketch) index(h uint64, i int) uint64 {
+	h1, h2 := h&math.MaxUint32, h>>32
+	return uint64(i)*(s.mask+1) + (h1+uint64(i)*h2)&s.mask
+}
+
+// roll resets the buckets expired at now, it reports whether any was reset.
+func (s *windowSketch) roll(now time.Time) bool {
+	timespan := int(now.Sub(s.lastAppendTime) / s.bucketDuration)
+	if timespan <= 0 {
+		// maybe time backwards
+		if timespan < 0 {
+			s.lastAppendTime = now
+		}
+		return false
+	}
+	s.lastAppendTime = s.lastAppendTime.Add(time.Duration(timespan) * s.bucketDuration)
+	if timespan > len(s.buckets) {
+		timespan = len(s.buckets)
+	}
+	for i := 0; i < timespan; i++ {
+		s.offset = (s.offset + 1) % len(s.buckets)
+		bucket := s.buckets[s.offset]
+		for j := range bucket {
+			bucket[j] = 0
+		}
+	}
+	return true
+}
+
+// add adds n to h in the current bucket and returns the estimate of h.
+func (s *windowSketch) add(h uint64, n uint32) uint64 {
+	bucket := s.buckets[s.offset]
+	for i := 0; i < _sketchDepth; i++ {
+		idx := s.index(h, i)
+		if c := bucket[idx] + n; c > bucket[idx] {
+			bucket[idx] = c
+		} else {
+			bucket[idx] = math.MaxUint32
+		}
+	}
+	return s.estimate(h)
+}
+
+// estimate returns the count of h in the window, it never underestimates.
+func (s *windowSketch) estimate(h uint64) uint64 {
+	min := uint64(math.MaxUint64)
+	for i := 0; i < _sketchDepth; i++ {
+		idx := s.index(h, i)
+		var sum uint64
+		for _, bucket := range s.buckets {
+			sum += uint64(bucket[idx])
+		}
+		if sum < min {
+			min = sum
+		}
+	}
+	return min
+}
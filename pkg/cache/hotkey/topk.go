@@ -0,0 +1,124 @@
+package hotkey
+
+import (
+	"container/heap"
+	"sort"
+)
+
+type entry struct {
+	key   string
+	count uint64
+	index int
+}
+
+// entries is a min heap of the counts.
+type entries []*entry
+
+func (es entries) Len() int           { return len(es) }
+func (es entries) Less(i, j int) bool { return es[i].count < es[j].count }
+func (es entries) Swap(i, j int) {
+	es[i], es[j] = es[j], es[i]
+	es[i].index = i
+	es[j].index = j
+}
+
+func (es *entries) Push(x interface{}) {
+	e := x.(*entry)
+	e.index = len(*es)
+	*es = append(*es, e)
+}
+
+func (es *entries) Pop() interface{} {
+	old := *es
+	e := old[len(old)-1]
+	old[len(old)-1] = nil
+	*es = old[:len(old)-1]
+	return e
+}
+
+// topK keeps the k keys of the largest counts offered, the smallest one is
+// replaced by a larger new key.
+type topK struct {
+	k    int
+	heap entries
+	m    map[string]*entry
+}
+
+func newTopK(k int) *topK {
+	return &topK{
+		k:    k,
+		heap: make(entries, 0, k),
+		m:    make(map[string]*entry, k),
+	}
+}
+
+// offer updates the count of key, evicted is the key replaced by it.
+func (t *topK) offer(key string, count uint64) (evicted string, ok bool) {
+	if e, exist := t.m[key]; exist {
+		e.count = count
+		heap.Fix(&t.heap, e.index)
+		return
+	}
+	if len(t.heap) < t.k {
+		e := &entry{key: key, count: count}
+		heap.Push(&t.heap, e)
+		t.m[key] = e
+		return
+	}
+	min := t.heap[0]
+	if count <= min.count {
+		return
+	}
+	evicted, ok = min.key, true
+	delete(t.m, min.key)
+	min.key, min.count = key, count
+	t.m[key] = min
+	heap.Fix(&t.heap, 0)
+	return
+}
+
+// get returns the count of key if it is kept.
+func (t *topK) get(key string) (uint64, bool) {
+	if e, ok := t.m[key]; ok {
+		return e.count, true
+	}
+	return 0, false
+}
+
+// refresh recounts the keys by estimate after the window rolled, the keys
+// counted zero are removed and returned.
+func (t *topK) refresh(estimate func(key string) uint64) (removed []string) {
+	es := t.heap[:0]
+	for _, e := range t.heap {
+		if e.count = estimate(e.key); e.count == 0 {
+			delete(t.m, e.key)
+			removed = append(removed, e.key)
+			continue
+		}
+		es = append(es, e)
+	}
+	for i := len(es); i < len(t.heap); i++ {
+		t.heap[i] = nil
+	}
+	t.heap = es
+	for i, e := range t.heap {
+		e.index = i
+	}
+	heap.Init(&t.heap)
+	return
+}
+
+// list returns the keys sorted by count in descending order.
+func (t *topK) list() []Item {
+	items := make([]Item, 0, len(t.heap))
+	for _, e := range t.heap {
+		items = append(items, Item{Key: e.key, Count: e.count})
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].Count != items[j].Count {
+			return items[i].Count > items[j].Count
+		}
+		return items[i].Key < items[j].Key
+	})
+	return items
+}
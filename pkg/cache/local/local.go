@@ -0,0 +1,161 @@
+package local
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/djienet/kratos/pkg/log"
+	"github.com/djienet/kratos/pkg/stat/prom"
+	xtime "github.com/djienet/kratos/pkg/time"
+
+	farm "github.com/dgryski/go-farm"
+)
+
+// eviction policies.
+const (
+	PolicyLRU     = "lru"
+	PolicyTinyLFU = "tinylfu"
+)
+
+// Config local cache config.
+type Config struct {
+	Name string // cache name, for metrics, default local.
+	// Policy is lru or tinylfu, default tinylfu. W-TinyLFU keeps the
+	// frequently used keys from being flushed by scans and one-hit keys.
+	Policy string
+	Shards int // shards count, rounded up to the power of 2, default 16.
+	// Capacity is the max total cost of the entries, the cost of []byte and
+	// string is the length, of Sizer is Size() and of others is 1, default
+	// 64M, i.e. 64MB of []byte values. Each shard holds Capacity/Shards.
+	Capacity int64
+	// TTL is the default expiration of Set, zero means never expire.
+	TTL xtime.Duration
+}
+
+func (c *Config) fix() {
+	if c.Name == "" {
+		c.Name = "local"
+	}
+	if c.Policy == "" {
+		c.Policy = PolicyTinyLFU
+	}
+	if c.Shards <= 0 {
+		c.Shards = 16
+	}
+	n := 1
+	for n < c.Shards {
+		n <<= 1
+	}
+	c.Shards = n
+	if c.Capacity <= 0 {
+		c.Capacity = 64 << 20
+	}
+}
+
+// Sizer is the value knows its cost.
+type Sizer interface {
+	Size() int64
+}
+
+// Cache is a sharded in-process cache with ttl and cost based eviction,
+// it is safe for concurrent use.
+type Cache struct {
+	conf   *Config
+	shards []*shard
+	mask   uint64
+	// oversize is set once an oversize value is logged.
+	oversize uint32
+}
+
+// New new a local cache.
+func New(c *Config) *Cache {
+	if c == nil {
+		c = &Config{}
+	}
+	c.fix()
+	cc := &Cache{
+		conf:   c,
+		shards: make([]*shard, c.Shards),
+		mask:   uint64(c.Shards - 1),
+	}
+	capacity := c.Capacity / int64(c.Shards)
+	if capacity < 1 {
+		capacity = 1
+	}
+	for i := range cc.shards {
+		cc.shards[i] = newShard(capacity, c.Policy == PolicyTinyLFU)
+	}
+	return cc
+}
+
+// Get gets the value of key.
+func (c *Cache) Get(key string) (value interface{}, ok bool) {
+	h := farm.Hash64([]byte(key))
+	if value, ok = c.shards[h&c.mask].get(key, h, time.Now().UnixNano()); ok {
+		prom.CacheHit.Incr(c.conf.Name)
+	} else {
+		prom.CacheMiss.Incr(c.conf.Name)
+	}
+	return
+}
+
+// Set sets the value of key with the default ttl, see SetWithTTL.
+func (c *Cache) Set(key string, value interface{}) bool {
+	return c.SetWithTTL(key, value, time.Duration(c.conf.TTL))
+}
+
+// SetWithTTL sets the value of key which expires after ttl, zero ttl means
+// never expire. It returns false if the cost of value is over the shard
+// capacity, the value is not stored and the old value of key is deleted, the
+// oversize sets are counted by go_business_err_count{name="local:oversize:{Name}"}.
+func (c *Cache) SetWithTTL(key string, value interface{}, ttl time.Duration) bool {
+	var expire int64
+	if ttl > 0 {
+		expire = time.Now().Add(ttl).UnixNano()
+	}
+	h := farm.Hash64([]byte(key))
+	s := c.shards[h&c.mask]
+	cost := cost(value)
+	if s.set(key, h, value, cost, expire) {
+		return true
+	}
+	prom.BusinessErrCount.Incr("local:oversize:" + c.conf.Name)
+	if atomic.CompareAndSwapUint32(&c.oversize, 0, 1) {
+		log.Warn("local: cache(%s) value of key(%s) cost(%d) over shard capacity(%d) not stored, raise Capacity", c.conf.Name, key, cost, s.capacity)
+	}
+	return false
+}
+
+// Delete deletes the key.
+func (c *Cache) Delete(key string) {
+	h := farm.Hash64([]byte(key))
+	c.shards[h&c.mask].delete(key)
+}
+
+// Len returns the count of the entries, including the expired ones not
+// evicted yet.
+func (c *Cache) Len() (n int) {
+	for _, s := range c.shards {
+		n += s.len()
+	}
+	return
+}
+
+// Clear deletes all the entries.
+func (c *Cache) Clear() {
+	for _, s := range c.shards {
+		s.clear()
+	}
+}
+
+func cost(value interface{}) int64 {
+	switch v := value.(type) {
+	case []byte:
+		return int64(len(v))
+	case string:
+		return int64(len(v))
+	case Sizer:
+		return v.Size()
+	}
+	return 1
+}
@@ -0,0 +1,99 @@
+package local
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCache(t *testing.T) {
+	c := New(&Config{Name: "test_cache", Capacity: 100})
+	c.Set("a", 1)
+	v, ok := c.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, 1, v)
+	c.Set("a", 2)
+	v, _ = c.Get("a")
+	assert.Equal(t, 2, v)
+	c.Delete("a")
+	_, ok = c.Get("a")
+	assert.False(t, ok)
+
+	c.SetWithTTL("ttl", "v", 10*time.Millisecond)
+	_, ok = c.Get("ttl")
+	assert.True(t, ok)
+	time.Sleep(20 * time.Millisecond)
+	_, ok = c.Get("ttl")
+	assert.False(t, ok)
+
+	c.Set("b", 1)
+	c.Clear()
+	assert.Equal(t, 0, c.Len())
+}
+
+func TestLRU(t *testing.T) {
+	c := New(&Config{Policy: PolicyLRU, Shards: 1, Capacity: 3})
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.Set("c", 3)
+	c.Get("a")
+	c.Set("d", 4)
+	_, ok := c.Get("b")
+	assert.False(t, ok, "least recently used should be evicted")
+	_, ok = c.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, 3, c.Len())
+}
+
+func TestTinyLFUScanResistant(t *testing.T) {
+	c := New(&Config{Shards: 1, Capacity: 100})
+	for i := 0; i < 50; i++ {
+		c.Set(fmt.Sprintf("hot_%d", i), i)
+	}
+	for round := 0; round < 5; round++ {
+		for i := 0; i < 50; i++ {
+			c.Get(fmt.Sprintf("hot_%d", i))
+		}
+	}
+	// a scan of one-hit keys.
+	for i := 0; i < 1000; i++ {
+		c.Set(fmt.Sprintf("scan_%d", i), i)
+	}
+	var hits int
+	for i := 0; i < 50; i++ {
+		if _, ok := c.Get(fmt.Sprintf("hot_%d", i)); ok {
+			hits++
+		}
+	}
+	assert.True(t, hits >= 45, "hot keys should survive the scan, hits(%d)", hits)
+	assert.True(t, c.Len() <= 100)
+}
+
+func TestCost(t *testing.T) {
+	c := New(&Config{Policy: PolicyLRU, Shards: 1, Capacity: 10})
+	c.Set("a", []byte("12345"))
+	c.Set("b", "12345")
+	c.Set("c", "1")
+	_, ok := c.Get("a")
+	assert.False(t, ok)
+	assert.False(t, c.Set("big", make([]byte, 11)), "value over capacity should be refused")
+	_, ok = c.Get("big")
+	assert.False(t, ok)
+	assert.True(t, c.Set("b", "12345"))
+	assert.False(t, c.Set("b", make([]byte, 11)))
+	_, ok = c.Get("b")
+	assert.False(t, ok, "the old value of an oversize set should be deleted")
+	c.Set("b", "12345")
+	_, ok = c.Get("b")
+	assert.True(t, ok)
+}
+
+func TestDefaultCapacity(t *testing.T) {
+	c := New(nil)
+	assert.Equal(t, int64(64<<20), c.conf.Capacity)
+	assert.True(t, c.Set("a", make([]byte, 1<<20)), "a 1MB value should fit a shard")
+	_, ok := c.Get("a")
+	assert.True(t, ok)
+}
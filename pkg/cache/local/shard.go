@@ -0,0 +1,201 @@
+package local
+
+import (
+	"container/list"
+	"sync"
+)
+
+// segments of W-TinyLFU, lru only uses the window.
+const (
+	_segWindow = iota
+	_segProbation
+	_segProtected
+)
+
+type entry struct {
+	key    string
+	hash   uint64
+	value  interface{}
+	cost   int64
+	expire int64
+	seg    int
+}
+
+// shard is a W-TinyLFU cache: new entries go into the window lru, the
+// entries evicted from the window compete with the victims of the main
+// segmented lru by the frequency sketch.
+type shard struct {
+	mu       sync.Mutex
+	items    map[string]*list.Element
+	segs     [3]*list.List
+	costs    [3]int64
+	capacity int64
+	window   int64
+	protect  int64
+	sketch   *sketch
+}
+
+func newShard(capacity int64, tinylfu bool) *shard {
+	s := &shard{
+		items:    make(map[string]*list.Element),
+		capacity: capacity,
+		window:   capacity,
+	}
+	for i := range s.segs {
+		s.segs[i] = list.New()
+	}
+	if tinylfu {
+		s.window = capacity / 100
+		if s.window < 1 {
+			s.window = 1
+		}
+		s.protect = (capacity - s.window) * 8 / 10
+		width := capacity
+		if width > 1<<16 {
+			width = 1 << 16
+		}
+		s.sketch = newSketch(int(width))
+	}
+	return s
+}
+
+func (s *shard) get(key string, h uint64, now int64) (interface{}, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.sketch != nil {
+		s.sketch.add(h)
+	}
+	el, ok := s.items[key]
+	if !ok {
+		return nil, false
+	}
+	e := el.Value.(*entry)
+	if e.expire > 0 && e.expire <= now {
+		s.remove(el)
+		return nil, false
+	}
+	s.access(el)
+	return e.value, true
+}
+
+// set returns false if cost is over the capacity.
+func (s *shard) set(key string, h uint64, value interface{}, cost int64, expire int64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	el, ok := s.items[key]
+	if cost > s.capacity {
+		if ok {
+			s.remove(el)
+		}
+		return false
+	}
+	if s.sketch != nil {
+		s.sketch.add(h)
+	}
+	if ok {
+		e := el.Value.(*entry)
+		s.costs[e.seg] += cost - e.cost
+		e.value, e.cost, e.expire = value, cost, expire
+		s.access(el)
+	} else {
+		e := &entry{key: key, hash: h, value: value, cost: cost, expire: expire, seg: _segWindow}
+		s.items[key] = s.segs[_segWindow].PushFront(e)
+		s.costs[_segWindow] += cost
+	}
+	s.evict()
+	return true
+}
+
+func (s *shard) delete(key string) {
+	s.mu.Lock()
+	if el, ok := s.items[key]; ok {
+		s.remove(el)
+	}
+	s.mu.Unlock()
+}
+
+func (s *shard) len() (n int) {
+	s.mu.Lock()
+	n = len(s.items)
+	s.mu.Unlock()
+	return
+}
+
+func (s *shard) clear() {
+	s.mu.Lock()
+	s.items = make(map[string]*list.Element)
+	for i := range s.segs {
+		s.segs[i].Init()
+		s.costs[i] = 0
+	}
+	s.mu.Unlock()
+}
+
+// access moves the entry to the front, the probation entries are promoted
+// to the protected segment.
+func (s *shard) access(el *list.Element) {
+	e := el.Value.(*entry)
+	if e.seg != _segProbation {
+		s.segs[e.seg].MoveToFront(el)
+		return
+	}
+	s.move(el, _segProtected)
+	for s.costs[_segProtected] > s.protect && s.segs[_segProtected].Len() > 1 {
+		s.move(s.segs[_segProtected].Back(), _segProbation)
+	}
+}
+
+func (s *shard) move(el *list.Element, seg int) {
+	e := el.Value.(*entry)
+	s.segs[e.seg].Remove(el)
+	s.costs[e.seg] -= e.cost
+	e.seg = seg
+	s.items[e.key] = s.segs[seg].PushFront(e)
+	s.costs[seg] += e.cost
+}
+
+func (s *shard) remove(el *list.Element) {
+	e := el.Value.(*entry)
+	s.segs[e.seg].Remove(el)
+	s.costs[e.seg] -= e.cost
+	delete(s.items, e.key)
+}
+
+func (s *shard) evict() {
+	for s.costs[_segWindow] > s.window {
+		el := s.segs[_segWindow].Back()
+		if s.sketch == nil {
+			s.remove(el)
+			continue
+		}
+		cand := el.Value.(*entry)
+		s.move(el, _segProbation)
+		s.admit(cand)
+	}
+	// the main segments may grow by updates.
+	for s.costs[_segProbation]+s.costs[_segProtected] > s.capacity-s.window {
+		el := s.segs[_segProbation].Back()
+		if el == nil {
+			el = s.segs[_segProtected].Back()
+		}
+		s.remove(el)
+	}
+}
+
+// admit evicts the main victims for the candidate if it is used more
+// frequently, otherwise the candidate is evicted.
+func (s *shard) admit(cand *entry) {
+	for s.costs[_segProbation]+s.costs[_segProtected] > s.capacity-s.window {
+		el := s.segs[_segProbation].Back()
+		if el == nil {
+			el = s.segs[_segProtected].Back()
+		}
+		victim := el.Value.(*entry)
+		if victim == cand || s.sketch.estimate(cand.hash) > s.sketch.estimate(victim.hash) {
+			s.remove(el)
+			continue
+		}
+		s.remove(s.items[cand.key])
+		return
+	}
+}
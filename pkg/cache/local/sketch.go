@@ -0,0 +1,63 @@
+package local
+
+const _sketchDepth = 4
+
+// sketch is a count-min sketch of 4 bit counters which are halved
+// periodically, so the old frequencies fade out.
+type sketch struct {
+	rows      [_sketchDepth][]uint8
+	mask      uint64
+	additions int
+	resetAt   int
+}
+
+func newSketch(width int) *sketch {
+	n := 16
+	for n < width {
+		n <<= 1
+	}
+	s := &sketch{mask: uint64(n - 1), resetAt: n * 10}
+	for i := range s.rows {
+		s.rows[i] = make([]uint8, n)
+	}
+	return s
+}
+
+// _sketchSeeds are xored into the hash of each row, the shard is picked by
+// the low bits of the same hash so they are mixed before indexing.
+var _sketchSeeds = [_sketchDepth]uint64{0xc3a5c85c97cb3127, 0xb492b66fbe98f273, 0x9ae16a3b2f90404f, 0xcbf29ce484222325}
+
+func (s *sketch) index(h uint64, i int) uint64 {
+	h = (h ^ _sketchSeeds[i]) * 0x9e3779b97f4a7c15
+	return (h ^ h>>32) & s.mask
+}
+
+func (s *sketch) add(h uint64) {
+	for i := range s.rows {
+		if idx := s.index(h, i); s.rows[i][idx] < 15 {
+			s.rows[i][idx]++
+		}
+	}
+	if s.additions++; s.additions >= s.resetAt {
+		s.reset()
+	}
+}
+
+func (s *sketch) estimate(h uint64) (min uint8) {
+	min = 15
+	for i := range s.rows {
+		if v := s.rows[i][s.index(h, i)]; v < min {
+			min = v
+		}
+	}
+	return
+}
+
+func (s *sketch) reset() {
+	s.additions /= 2
+	for i := range s.rows {
+		for j := range s.rows[i] {
+			s.rows[i][j] >>= 1
+		}
+	}
+}
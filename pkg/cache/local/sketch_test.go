@@ -0,0 +1,32 @@
+package local
+
+import (
+	"strconv"
+	"testing"
+
+	farm "github.com/dgryski/go-farm"
+)
+
+func TestSketchShardSpread(t *testing.T) {
+	// the keys of a shard share the low bits of the hash.
+	const shards = 16
+	s := newSketch(1024)
+	rows := [_sketchDepth]map[uint64]struct{}{}
+	for i := range rows {
+		rows[i] = make(map[uint64]struct{})
+	}
+	for i := 0; i < 100000; i++ {
+		h := farm.Hash64([]byte(strconv.Itoa(i)))
+		if h&(shards-1) != 0 {
+			continue
+		}
+		for j := range rows {
+			rows[j][s.index(h, j)] = struct{}{}
+		}
+	}
+	for i, r := range rows {
+		if len(r) < 1000 {
+			t.Fatalf("row %d: keys of a shard use %d of 1024 counters", i, len(r))
+		}
+	}
+}
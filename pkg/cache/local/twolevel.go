@@ -0,0 +1,266 @@
+package local
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/djienet/kratos/pkg/cache/memcache"
+	"github.com/djienet/kratos/pkg/cache/redis"
+	"github.com/djienet/kratos/pkg/log"
+	"github.com/djienet/kratos/pkg/net/netutil"
+	xtime "github.com/djienet/kratos/pkg/time"
+)
+
+// ErrNotFound is returned by Remote when the key is missing.
+var ErrNotFound = errors.New("local: key not found")
+
+// Remote is the remote tier of TwoLevel.
+type Remote interface {
+	// Get returns ErrNotFound if the key is missing.
+	Get(c context.Context, key string) ([]byte, error)
+	Set(c context.Context, key string, value []byte, ttl time.Duration) error
+	Delete(c context.Context, key string) error
+}
+
+// Memcache returns the Remote of memcache, the values are stored raw.
+func Memcache(mc *memcache.Memcache) Remote {
+	return mcRemote{mc}
+}
+
+type mcRemote struct {
+	mc *memcache.Memcache
+}
+
+func (r mcRemote) Get(c context.Context, key string) (value []byte, err error) {
+	if err = r.mc.Get(c, key).Scan(&value); err == memcache.ErrNotFound {
+		err = ErrNotFound
+	}
+	return
+}
+
+func (r mcRemote) Set(c context.Context, key string, value []byte, ttl time.Duration) error {
+	return r.mc.Set(c, &memcache.Item{Key: key, Value: value, Flags: memcache.FlagRAW, Expiration: int32(ttl / time.Second)})
+}
+
+func (r mcRemote) Delete(c context.Context, key string) (err error) {
+	if err = r.mc.Delete(c, key); err == memcache.ErrNotFound {
+		err = nil
+	}
+	return
+}
+
+// Redis returns the Remote of redis.
+func Redis(r *redis.Redis) Remote {
+	return redisRemote{r}
+}
+
+type redisRemote struct {
+	r *redis.Redis
+}
+
+func (r redisRemote) Get(c context.Context, key string) (value []byte, err error) {
+	if value, err = redis.Bytes(r.r.Do(c, "GET", key)); err == redis.ErrNil {
+		err = ErrNotFound
+	}
+	return
+}
+
+func (r redisRemote) Set(c context.Context, key string, value []byte, ttl time.Duration) (err error) {
+	if ttl > 0 {
+		_, err = r.r.Do(c, "SET", key, value, "PX", int64(ttl/time.Millisecond))
+	} else {
+		_, err = r.r.Do(c, "SET", key, value)
+	}
+	return
+}
+
+func (r redisRemote) Delete(c context.Context, key string) (err error) {
+	_, err = r.r.Do(c, "DEL", key)
+	return
+}
+
+// TwoLevelConfig two level cache config.
+type TwoLevelConfig struct {
+	Local *Config
+	// LocalTTL is the ttl of the local tier, keep it short since the other
+	// instances only see the changes after it, default 1s.
+	LocalTTL xtime.Duration
+	// Invalidate enables the invalidation over redis pub/sub, the keys set or
+	// deleted are removed from the local tier of all the instances.
+	Invalidate *redis.Config
+	// Channel is the pub/sub channel of the invalidation, default
+	// kratos:local:invalidate:{Local.Name}.
+	Channel string
+	// PingInterval is the interval of pinging the subscription, which is
+	// reconnected if no reply is read in twice the interval, default 5s.
+	PingInterval xtime.Duration
+}
+
+func (c *TwoLevelConfig) fix() {
+	if c.Local == nil {
+		c.Local = &Config{}
+	}
+	c.Local.fix()
+	if c.LocalTTL <= 0 {
+		c.LocalTTL = xtime.Duration(time.Second)
+	}
+	if c.Channel == "" {
+		c.Channel = "kratos:local:invalidate:" + c.Local.Name
+	}
+	if c.PingInterval <= 0 {
+		c.PingInterval = xtime.Duration(5 * time.Second)
+	}
+}
+
+// TwoLevel is a cache puts a local tier in front of memcache or redis.
+type TwoLevel struct {
+	conf   *TwoLevelConfig
+	local  *Cache
+	remote Remote
+	pub    *redis.Redis
+	cancel func()
+}
+
+// NewTwoLevel new a two level cache of remote.
+func NewTwoLevel(c *TwoLevelConfig, remote Remote) *TwoLevel {
+	if c == nil {
+		c = &TwoLevelConfig{}
+	}
+	c.fix()
+	t := &TwoLevel{
+		conf:   c,
+		local:  New(c.Local),
+		remote: remote,
+	}
+	if c.Invalidate != nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		t.pub = redis.NewRedis(c.Invalidate)
+		t.cancel = cancel
+		go t.subproc(ctx)
+	}
+	return t
+}
+
+// Get gets the value from the local tier, or from the remote tier and
+// caches it locally for LocalTTL. The value is a copy of the cached one, so
+// the caller may modify it.
+func (t *TwoLevel) Get(c context.Context, key string) (value []byte, err error) {
+	if v, ok := t.local.Get(key); ok {
+		return append([]byte(nil), v.([]byte)...), nil
+	}
+	if value, err = t.remote.Get(c, key); err != nil {
+		return
+	}
+	t.local.SetWithTTL(key, append([]byte(nil), value...), time.Duration(t.conf.LocalTTL))
+	return
+}
+
+// Set sets the value to the remote tier and invalidates the local tiers.
+func (t *TwoLevel) Set(c context.Context, key string, value []byte, ttl time.Duration) (err error) {
+	if err = t.remote.Set(c, key, value, ttl); err != nil {
+		return
+	}
+	t.invalidate(c, key)
+	return
+}
+
+// Delete deletes the key from the remote tier and invalidates the local tiers.
+func (t *TwoLevel) Delete(c context.Context, key string) (err error) {
+	if err = t.remote.Delete(c, key); err != nil {
+		return
+	}
+	t.invalidate(c, key)
+	return
+}
+
+// Close closes the invalidation.
+func (t *TwoLevel) Close() error {
+	if t.cancel == nil {
+		return nil
+	}
+	t.cancel()
+	return t.pub.Close()
+}
+
+func (t *TwoLevel) invalidate(c context.Context, key string) {
+	t.local.Delete(key)
+	if t.pub == nil {
+		return
+	}
+	if _, err := t.pub.Do(c, "PUBLISH", t.conf.Channel, key); err != nil {
+		log.Error("local: publish invalidation of key(%s) error(%v)", key, err)
+	}
+}
+
+// subproc subscribes the invalidations, the local tier is cleared after
+// reconnecting since the messages in between are lost.
+func (t *TwoLevel) subproc(c context.Context) {
+	backoff := &netutil.BackoffConfig{MaxDelay: 5 * time.Second, BaseDelay: 100 * time.Millisecond, Factor: 1.6, Jitter: 0.2}
+	for retries := 0; ; retries++ {
+		err := t.subscribe(c)
+		if c.Err() != nil {
+			return
+		}
+		log.Error("local: subscribe channel(%s) error(%v)", t.conf.Channel, err)
+		t.local.Clear()
+		select {
+		case <-time.After(backoff.Backoff(retries)):
+		case <-c.Done():
+			return
+		}
+	}
+}
+
+func (t *TwoLevel) subscribe(c context.Context) (err error) {
+	rc := t.conf.Invalidate
+	// the read timeout is longer than the ping interval.
+	interval := time.Duration(t.conf.PingInterval)
+	conn, err := redis.Dial(rc.Proto, rc.Addr,
+		redis.DialConnectTimeout(time.Duration(rc.DialTimeout)),
+		redis.DialReadTimeout(interval*2),
+		redis.DialWriteTimeout(time.Duration(rc.WriteTimeout)),
+		redis.DialPassword(rc.Auth),
+	)
+	if err != nil {
+		return
+	}
+	psc := redis.PubSubConn{Conn: conn}
+	defer psc.Close()
+	if err = psc.Subscribe(t.conf.Channel); err != nil {
+		return
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if psc.Ping("") != nil {
+					return
+				}
+			case <-c.Done():
+				// unblocks Receive by the unsubscribe reply, Close races
+				// with the reading.
+				psc.Unsubscribe()
+				return
+			case <-done:
+				return
+			}
+		}
+	}()
+	for {
+		switch msg := psc.Receive().(type) {
+		case redis.Message:
+			t.local.Delete(string(msg.Data))
+		case redis.Subscription:
+			if msg.Count == 0 {
+				return c.Err()
+			}
+		case error:
+			return msg
+		}
+	}
+}
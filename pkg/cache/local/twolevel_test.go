@@ -0,0 +1,179 @@
+package local
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/djienet/kratos/pkg/cache/redis"
+	xtime "github.com/djienet/kratos/pkg/time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type mapRemote struct {
+	m    map[string][]byte
+	gets int
+}
+
+func (r *mapRemote) Get(c context.Context, key string) ([]byte, error) {
+	r.gets++
+	v, ok := r.m[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return v, nil
+}
+
+func (r *mapRemote) Set(c context.Context, key string, value []byte, ttl time.Duration) error {
+	r.m[key] = value
+	return nil
+}
+
+func (r *mapRemote) Delete(c context.Context, key string) error {
+	delete(r.m, key)
+	return nil
+}
+
+func TestTwoLevel(t *testing.T) {
+	remote := &mapRemote{m: make(map[string][]byte)}
+	c := NewTwoLevel(&TwoLevelConfig{Local: &Config{Name: "test_two_level"}}, remote)
+	defer c.Close()
+	ctx := context.Background()
+
+	_, err := c.Get(ctx, "a")
+	assert.Equal(t, ErrNotFound, err)
+	assert.Nil(t, c.Set(ctx, "a", []byte("1"), time.Minute))
+	v, err := c.Get(ctx, "a")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("1"), v)
+	c.Get(ctx, "a")
+	assert.Equal(t, 2, remote.gets, "the second get should hit the local tier")
+
+	assert.Nil(t, c.Set(ctx, "a", []byte("2"), time.Minute))
+	v, _ = c.Get(ctx, "a")
+	assert.Equal(t, []byte("2"), v, "set should invalidate the local tier")
+	assert.Nil(t, c.Delete(ctx, "a"))
+	_, err = c.Get(ctx, "a")
+	assert.Equal(t, ErrNotFound, err)
+}
+
+func TestTwoLevelGetCopy(t *testing.T) {
+	remote := &mapRemote{m: map[string][]byte{"a": []byte("1")}}
+	c := NewTwoLevel(&TwoLevelConfig{Local: &Config{Name: "test_two_level_copy"}}, remote)
+	defer c.Close()
+	ctx := context.Background()
+
+	v, _ := c.Get(ctx, "a")
+	v[0] = '2'
+	v, _ = c.Get(ctx, "a")
+	assert.Equal(t, []byte("1"), v)
+	v[0] = '3'
+	v, _ = c.Get(ctx, "a")
+	assert.Equal(t, []byte("1"), v)
+	assert.Equal(t, 1, remote.gets)
+}
+
+// subServer is a redis server of the subscribe and ping commands, the
+// commands received are sent to cmds.
+type subServer struct {
+	ln    net.Listener
+	cmds  chan string
+	conns chan net.Conn
+}
+
+func newSubServer(t *testing.T) *subServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &subServer{ln: ln, cmds: make(chan string, 100), conns: make(chan net.Conn, 10)}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			s.conns <- conn
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *subServer) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		var n int
+		fmt.Sscanf(line, "*%d", &n)
+		args := make([]string, n)
+		for i := range args {
+			r.ReadString('\n') // the bulk length.
+			arg, _ := r.ReadString('\n')
+			args[i] = strings.TrimSpace(arg)
+		}
+		switch strings.ToUpper(args[0]) {
+		case "SUBSCRIBE":
+			fmt.Fprintf(conn, "*3\r\n$9\r\nsubscribe\r\n$%d\r\n%s\r\n:1\r\n", len(args[1]), args[1])
+		case "PING":
+			fmt.Fprint(conn, "*2\r\n$4\r\npong\r\n$0\r\n\r\n")
+		}
+		s.cmds <- strings.ToUpper(args[0])
+	}
+}
+
+func (s *subServer) publish(conn net.Conn, channel, key string) {
+	fmt.Fprintf(conn, "*3\r\n$7\r\nmessage\r\n$%d\r\n%s\r\n$%d\r\n%s\r\n", len(channel), channel, len(key), key)
+}
+
+func TestTwoLevelSubscribe(t *testing.T) {
+	srv := newSubServer(t)
+	defer srv.ln.Close()
+	// the subscription pings by PingInterval, not the zero ReadTimeout.
+	conf := &TwoLevelConfig{
+		Local:      &Config{Name: "test_subscribe"},
+		Invalidate: &redis.Config{Proto: "tcp", Addr: srv.ln.Addr().String()},
+	}
+	conf.fix()
+	assert.Equal(t, xtime.Duration(5*time.Second), conf.PingInterval)
+	conf.PingInterval = xtime.Duration(10 * time.Millisecond)
+	c := &TwoLevel{conf: conf, local: New(conf.Local), remote: &mapRemote{m: map[string][]byte{"a": []byte("1")}}}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go c.subproc(ctx)
+
+	var conn net.Conn
+	select {
+	case conn = <-srv.conns:
+	case <-time.After(time.Second):
+		t.Fatal("not subscribed")
+	}
+	for _, want := range []string{"SUBSCRIBE", "PING"} {
+		select {
+		case cmd := <-srv.cmds:
+			assert.Equal(t, want, cmd)
+		case <-time.After(time.Second):
+			t.Fatalf("%s not received", want)
+		}
+	}
+	_, err := c.Get(context.Background(), "a")
+	assert.Nil(t, err)
+	srv.publish(conn, conf.Channel, "a")
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if _, ok := c.local.Get("a"); !ok {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatal("the published key is not invalidated")
+}
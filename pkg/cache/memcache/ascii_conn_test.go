@@ -9,6 +9,7 @@ import (
 )
 
 func TestASCIIConnAdd(t *testing.T) {
+	skipWithoutMemcache(t)
 	tests := []struct {
 		name string
 		a    *Item
@@ -60,6 +61,7 @@ func TestASCIIConnAdd(t *testing.T) {
 }
 
 func TestASCIIConnGet(t *testing.T) {
+	skipWithoutMemcache(t)
 	tests := []struct {
 		name string
 		a    *Item
@@ -124,6 +126,7 @@ func TestASCIIConnGet(t *testing.T) {
 //}
 
 func TestASCIIConnGetMulti(t *testing.T) {
+	skipWithoutMemcache(t)
 	tests := []struct {
 		name string
 		a    []*Item
@@ -174,6 +177,7 @@ func TestASCIIConnGetMulti(t *testing.T) {
 }
 
 func TestASCIIConnSet(t *testing.T) {
+	skipWithoutMemcache(t)
 	tests := []struct {
 		name string
 		a    *Item
@@ -263,6 +267,7 @@ func TestASCIIConnSet(t *testing.T) {
 }
 
 func TestASCIIConnCompareAndSwap(t *testing.T) {
+	skipWithoutMemcache(t)
 	tests := []struct {
 		name string
 		a    *Item
@@ -371,6 +376,7 @@ func TestASCIIConnCompareAndSwap(t *testing.T) {
 }
 
 func TestASCIIConnReplace(t *testing.T) {
+	skipWithoutMemcache(t)
 	tests := []struct {
 		name string
 		a    *Item
@@ -432,6 +438,7 @@ func TestASCIIConnReplace(t *testing.T) {
 }
 
 func TestASCIIConnIncrDecr(t *testing.T) {
+	skipWithoutMemcache(t)
 	tests := []struct {
 		fn   func(key string, delta uint64) (uint64, error)
 		name string
@@ -488,6 +495,7 @@ func TestASCIIConnIncrDecr(t *testing.T) {
 }
 
 func TestASCIIConnTouch(t *testing.T) {
+	skipWithoutMemcache(t)
 	tests := []struct {
 		name string
 		k    string
@@ -524,6 +532,7 @@ func TestASCIIConnTouch(t *testing.T) {
 }
 
 func TestASCIIConnDelete(t *testing.T) {
+	skipWithoutMemcache(t)
 	tests := []struct {
 		name string
 		k    string
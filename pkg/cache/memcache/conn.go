@@ -5,8 +5,11 @@ import (
 	"fmt"
 	"net"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/djienet/kratos/pkg/cache"
+
 	pkgerr "github.com/pkg/errors"
 )
 
@@ -36,6 +39,8 @@ type dialOptions struct {
 	readTimeout  time.Duration
 	writeTimeout time.Duration
 	protocol     string
+	recache      time.Duration
+	name         string
 	dial         func(network, addr string) (net.Conn, error)
 }
 
@@ -70,8 +75,36 @@ func DialNetDial(dial func(network, addr string) (net.Conn, error)) DialOption {
 	}}
 }
 
+// DialProtocol specifies the protocol talking with the Memcache server,
+// "ascii" (default) or "meta".
+func DialProtocol(protocol string) DialOption {
+	return DialOption{func(do *dialOptions) {
+		do.protocol = protocol
+	}}
+}
+
+// DialRecache specifies the remaining ttl under which only one client wins
+// the recache of an item, and deletes mark the item stale for d instead of
+// removing it. The winner gets ErrNotFound and should set the item again,
+// the others get the old value meanwhile. It only works with the meta
+// protocol.
+func DialRecache(d time.Duration) DialOption {
+	return DialOption{func(do *dialOptions) {
+		do.recache = d
+	}}
+}
+
+// DialName specifies the name of the client, the sizes of the values set are
+// reported with it.
+func DialName(name string) DialOption {
+	return DialOption{func(do *dialOptions) {
+		do.name = name
+	}}
+}
+
 // Dial connects to the Memcache server at the given network and
-// address using the specified options.
+// address using the specified options. The network prefixed with "meta",
+// e.g. "meta" or "meta+unix", uses the meta protocol over tcp or unix.
 func Dial(network, address string, options ...DialOption) (Conn, error) {
 	do := dialOptions{
 		dial: net.Dial,
@@ -79,18 +112,46 @@ func Dial(network, address string, options ...DialOption) (Conn, error) {
 	for _, option := range options {
 		option.f(&do)
 	}
+	if n, p := splitProto(network); p != "" {
+		network, do.protocol = n, p
+	}
 	netConn, err := do.dial(network, address)
 	if err != nil {
 		return nil, pkgerr.WithStack(err)
 	}
-	pconn, err := newASCIIConn(netConn, do.readTimeout, do.writeTimeout)
-	return &conn{pconn: pconn, ed: newEncodeDecoder()}, nil
+	var pconn protocolConn
+	switch do.protocol {
+	case "", "ascii":
+		pconn, err = newASCIIConn(netConn, do.readTimeout, do.writeTimeout)
+	case "meta":
+		pconn, err = newMetaConn(netConn, do.readTimeout, do.writeTimeout, do.recache)
+	default:
+		err = pkgerr.Errorf("memcache: unknown protocol %s", do.protocol)
+	}
+	if err != nil {
+		netConn.Close()
+		return nil, err
+	}
+	return &conn{pconn: pconn, ed: newEncodeDecoder(), name: do.name}, nil
+}
+
+// splitProto splits proto like "meta+unix" into network and protocol.
+func splitProto(proto string) (network, protocol string) {
+	if proto == "meta" {
+		return "tcp", "meta"
+	}
+	if strings.HasPrefix(proto, "meta+") {
+		return proto[len("meta+"):], "meta"
+	}
+	return proto, ""
 }
 
 type conn struct {
 	// low level connection.
 	pconn protocolConn
 	ed    *encodeDecode
+	// name of the client for metrics.
+	name string
 }
 
 func (c *conn) Close() error {
@@ -126,6 +187,10 @@ func (c *conn) populate(ctx context.Context, cmd string, item *Item) error {
 		return err
 	}
 	length := len(data)
+	cache.StatValueSize(ctx, c.name, cmd, length)
+	if item.Flags&FlagGzip == FlagGzip {
+		cache.StatCompress(ctx, c.name, c.ed.raw, length)
+	}
 	if length < _largeValue {
 		return c.pconn.Populate(ctx, cmd, item.Key, item.Flags, item.Expiration, item.cas, data)
 	}
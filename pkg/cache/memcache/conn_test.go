@@ -10,6 +10,7 @@ import (
 )
 
 func TestConnRaw(t *testing.T) {
+	skipWithoutMemcache(t)
 	item := &Item{
 		Key:        "test",
 		Value:      []byte("test"),
@@ -23,6 +24,7 @@ func TestConnRaw(t *testing.T) {
 }
 
 func TestConnSerialization(t *testing.T) {
+	skipWithoutMemcache(t)
 	type TestObj struct {
 		Name string
 		Age  int32
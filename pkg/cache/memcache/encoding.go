@@ -35,6 +35,8 @@ type encodeDecode struct {
 	je *json.Encoder
 	// protobuffer
 	ped *proto.Buffer
+	// raw is the size of the last encoded value before compression.
+	raw int
 }
 
 func newEncodeDecoder() *encodeDecode {
@@ -86,6 +88,7 @@ func (ed *encodeDecode) encode(item *Item) (data []byte, err error) {
 	default:
 		data = item.Value
 	}
+	ed.raw = len(data)
 	// compress
 	if item.Flags&FlagGzip == FlagGzip {
 		ed.cb.Reset()
@@ -2,6 +2,7 @@ package memcache
 
 import (
 	"bytes"
+	"reflect"
 	"testing"
 
 	mt "github.com/djienet/kratos/pkg/cache/memcache/test"
@@ -118,7 +119,7 @@ func TestEncode(t *testing.T) {
 				t.Fatal(err)
 			} else {
 				if err == nil {
-					if !bytes.Equal(r, test.r) {
+					if !bytes.Equal(r, test.r) && !decodedEqual(test.a.Flags, r, test.r) {
 						t.Fatalf("not equal, expect %v\n got %v", test.r, r)
 					}
 				}
@@ -127,6 +128,32 @@ func TestEncode(t *testing.T) {
 	}
 }
 
+// decodedEqual reports whether the gob or gzip encoded a and b are decoded
+// equally, their bytes vary by the go versions.
+func decodedEqual(flags uint32, a, b []byte) bool {
+	if flags&(FlagGOB|FlagGzip) == 0 {
+		return false
+	}
+	decode := func(value []byte) (v interface{}, err error) {
+		if flags&FlagGOB == FlagGOB {
+			v = &struct {
+				Name string
+				Age  int32
+			}{}
+		} else {
+			v = new([]byte)
+		}
+		err = newEncodeDecoder().decode(&Item{Value: value, Flags: flags}, v)
+		return
+	}
+	va, err := decode(a)
+	if err != nil {
+		return false
+	}
+	vb, err := decode(b)
+	return err == nil && reflect.DeepEqual(va, vb)
+}
+
 func TestDecode(t *testing.T) {
 	type TestObj struct {
 		Name string
@@ -14,6 +14,7 @@ var testConnASCII Conn
 var testMemcache *Memcache
 var testPool *Pool
 var testMemcacheAddr string
+var testMetaServer *fakeMetaServer
 
 func setupTestConnASCII(addr string) {
 	var err error
@@ -67,12 +68,24 @@ func setupTestPool(addr string) {
 	testPool = NewPool(config)
 }
 
+// skipWithoutMemcache skips the tests need a memcache server when
+// TEST_MEMCACHE_ADDR is not provided.
+func skipWithoutMemcache(tb testing.TB) {
+	if testMemcacheAddr == "" {
+		tb.Skip("TEST_MEMCACHE_ADDR not provide")
+	}
+}
+
 func TestMain(m *testing.M) {
+	var err error
+	if testMetaServer, err = newFakeMetaServer(); err != nil {
+		log.Fatal(err)
+	}
 	testMemcacheAddr = os.Getenv("TEST_MEMCACHE_ADDR")
-	if testExampleAddr == "" {
-		log.Print("TEST_MEMCACHE_ADDR not provide skip test.")
-		// ignored test.
-		os.Exit(0)
+	if testMemcacheAddr == "" {
+		log.Print("TEST_MEMCACHE_ADDR not provide, skip the tests of memcache and run the examples with the fake server.")
+		testExampleAddr = testMetaServer.Addr()
+		os.Exit(m.Run())
 	}
 	setupTestConnASCII(testMemcacheAddr)
 	setupTestMemcache(testMemcacheAddr)
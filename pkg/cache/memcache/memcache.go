@@ -3,8 +3,12 @@ package memcache
 import (
 	"context"
 
+	"github.com/djienet/kratos/pkg/cache"
+	"github.com/djienet/kratos/pkg/cache/hotkey"
 	"github.com/djienet/kratos/pkg/container/pool"
 	xtime "github.com/djienet/kratos/pkg/time"
+
+	pkgerr "github.com/pkg/errors"
 )
 
 const (
@@ -50,6 +54,15 @@ type Item struct {
 
 	// Compare and swap ID.
 	cas uint64
+
+	// stale is set by the meta protocol if the item is marked stale.
+	stale bool
+}
+
+// Stale reports whether the item was marked stale by a delete with recache
+// and is being recached by another client.
+func (i *Item) Stale() bool {
+	return i.stale
 }
 
 // Conn represents a connection to a Memcache server.
@@ -186,12 +199,22 @@ type Conn interface {
 type Config struct {
 	*pool.Config
 
-	Name         string // memcache name, for trace
+	Name string // memcache name, for trace
+	// Proto is the network "tcp" or "unix" with the ascii protocol, or
+	// "meta", "meta+unix" with the meta protocol.
 	Proto        string
 	Addr         string
 	DialTimeout  xtime.Duration
 	ReadTimeout  xtime.Duration
 	WriteTimeout xtime.Duration
+	// Recache is the remaining ttl under which one client wins the recache
+	// of a hot item while the others still get it, and deletes mark items
+	// stale for Recache instead. Only for the meta protocol, zero disables.
+	Recache xtime.Duration
+	// HotKey samples the accessed keys to find the hot ones, nil disables.
+	// The hot keys are reported by hotkey.DebugPath and logs, and the
+	// items got by Get and GetMulti are promoted if LocalTTL is set.
+	HotKey *hotkey.Config
 }
 
 // Memcache memcache client
@@ -236,6 +259,7 @@ func (mc *Memcache) Set(ctx context.Context, item *Item) (err error) {
 	conn := mc.pool.Get(ctx)
 	err = conn.SetContext(ctx, item)
 	conn.Close()
+	mc.pool.invalidate(item.Key)
 	return
 }
 
@@ -245,6 +269,7 @@ func (mc *Memcache) Add(ctx context.Context, item *Item) (err error) {
 	conn := mc.pool.Get(ctx)
 	err = conn.AddContext(ctx, item)
 	conn.Close()
+	mc.pool.invalidate(item.Key)
 	return
 }
 
@@ -253,6 +278,7 @@ func (mc *Memcache) Replace(ctx context.Context, item *Item) (err error) {
 	conn := mc.pool.Get(ctx)
 	err = conn.ReplaceContext(ctx, item)
 	conn.Close()
+	mc.pool.invalidate(item.Key)
 	return
 }
 
@@ -261,15 +287,25 @@ func (mc *Memcache) CompareAndSwap(ctx context.Context, item *Item) (err error)
 	conn := mc.pool.Get(ctx)
 	err = conn.CompareAndSwapContext(ctx, item)
 	conn.Close()
+	mc.pool.invalidate(item.Key)
 	return
 }
 
 // Get sends a command to the server for gets data.
 func (mc *Memcache) Get(ctx context.Context, key string) *Reply {
+	item, version, ok := mc.pool.load(key)
+	if ok {
+		mc.statGets(ctx, 1, map[string]*Item{key: item}, nil)
+		return &Reply{item: item, conn: localConn{}}
+	}
 	conn := mc.pool.Get(ctx)
 	item, err := conn.GetContext(ctx, key)
 	if err != nil {
 		conn.Close()
+		mc.statGets(ctx, 1, nil, err)
+	} else {
+		mc.pool.store(item, version)
+		mc.statGets(ctx, 1, map[string]*Item{key: item}, nil)
 	}
 	return &Reply{err: err, item: item, conn: conn}
 }
@@ -294,8 +330,43 @@ func (r *Reply) Scan(v interface{}) (err error) {
 
 // GetMulti is a batch version of Get
 func (mc *Memcache) GetMulti(ctx context.Context, keys []string) (*Replies, error) {
+	var (
+		locals   map[string]*Item
+		versions map[string]uint64
+	)
+	if mc.pool.hot != nil {
+		misses := make([]string, 0, len(keys))
+		versions = make(map[string]uint64, len(keys))
+		for _, key := range keys {
+			if item, version, ok := mc.pool.load(key); ok {
+				if locals == nil {
+					locals = make(map[string]*Item)
+				}
+				locals[key] = item
+			} else {
+				misses = append(misses, key)
+				versions[key] = version
+			}
+		}
+		if len(misses) == 0 {
+			mc.statGets(ctx, len(keys), locals, nil)
+			rs := &Replies{items: locals, conn: localConn{}, usedItems: make(map[string]struct{}, len(keys))}
+			return rs, nil
+		}
+		keys = misses
+	}
 	conn := mc.pool.Get(ctx)
 	items, err := conn.GetMultiContext(ctx, keys)
+	mc.statGets(ctx, len(keys), items, err)
+	mc.statGets(ctx, len(locals), locals, nil)
+	if err == nil {
+		for key, item := range items {
+			mc.pool.store(item, versions[key])
+		}
+		for key, item := range locals {
+			items[key] = item
+		}
+	}
 	rs := &Replies{err: err, items: items, conn: conn, usedItems: make(map[string]struct{}, len(keys))}
 	if (err != nil) || (len(items) == 0) {
 		rs.Close()
@@ -303,6 +374,20 @@ func (mc *Memcache) GetMulti(ctx context.Context, keys []string) (*Replies, erro
 	return rs, err
 }
 
+// statGets reports the hits and misses of the n keys got, or the errors of
+// them if err is not ErrNotFound.
+func (mc *Memcache) statGets(ctx context.Context, n int, items map[string]*Item, err error) {
+	name := mc.pool.c.Name
+	if err != nil && pkgerr.Cause(err) != ErrNotFound {
+		cache.StatErrors(ctx, name, n)
+		return
+	}
+	cache.StatGets(ctx, name, len(items), n-len(items))
+	for _, item := range items {
+		cache.StatValueSize(ctx, name, "get", len(item.Value))
+	}
+}
+
 // Close close rows.
 func (rs *Replies) Close() (err error) {
 	if !rs.closed {
@@ -357,6 +442,7 @@ func (mc *Memcache) Delete(ctx context.Context, key string) (err error) {
 	conn := mc.pool.Get(ctx)
 	err = conn.DeleteContext(ctx, key)
 	conn.Close()
+	mc.pool.invalidate(key)
 	return
 }
 
@@ -365,6 +451,7 @@ func (mc *Memcache) Increment(ctx context.Context, key string, delta uint64) (ne
 	conn := mc.pool.Get(ctx)
 	newValue, err = conn.IncrementContext(ctx, key, delta)
 	conn.Close()
+	mc.pool.invalidate(key)
 	return
 }
 
@@ -373,5 +460,6 @@ func (mc *Memcache) Decrement(ctx context.Context, key string, delta uint64) (ne
 	conn := mc.pool.Get(ctx)
 	newValue, err = conn.DecrementContext(ctx, key, delta)
 	conn.Close()
+	mc.pool.invalidate(key)
 	return
 }
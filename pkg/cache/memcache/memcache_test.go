@@ -9,6 +9,7 @@ import (
 )
 
 func Test_client_Set(t *testing.T) {
+	skipWithoutMemcache(t)
 	type args struct {
 		c    context.Context
 		item *Item
@@ -30,6 +31,7 @@ func Test_client_Set(t *testing.T) {
 }
 
 func Test_client_Add(t *testing.T) {
+	skipWithoutMemcache(t)
 	type args struct {
 		c    context.Context
 		item *Item
@@ -53,6 +55,7 @@ func Test_client_Add(t *testing.T) {
 }
 
 func Test_client_Replace(t *testing.T) {
+	skipWithoutMemcache(t)
 	key := fmt.Sprintf("Test_client_Replace_%d", time.Now().Unix())
 	ekey := "Test_client_Replace_exist"
 	testMemcache.Set(context.Background(), &Item{Key: ekey, Value: []byte("ok")})
@@ -78,6 +81,7 @@ func Test_client_Replace(t *testing.T) {
 }
 
 func Test_client_CompareAndSwap(t *testing.T) {
+	skipWithoutMemcache(t)
 	key := fmt.Sprintf("Test_client_CompareAndSwap_%d", time.Now().Unix())
 	ekey := "Test_client_CompareAndSwap_k"
 	testMemcache.Set(context.Background(), &Item{Key: ekey, Value: []byte("old")})
@@ -104,6 +108,7 @@ func Test_client_CompareAndSwap(t *testing.T) {
 }
 
 func Test_client_Get(t *testing.T) {
+	skipWithoutMemcache(t)
 	key := fmt.Sprintf("Test_client_Get_%d", time.Now().Unix())
 	ekey := "Test_client_Get_k"
 	testMemcache.Set(context.Background(), &Item{Key: ekey, Value: []byte("old")})
@@ -131,6 +136,7 @@ func Test_client_Get(t *testing.T) {
 }
 
 func Test_client_Touch(t *testing.T) {
+	skipWithoutMemcache(t)
 	key := fmt.Sprintf("Test_client_Touch_%d", time.Now().Unix())
 	ekey := "Test_client_Touch_k"
 	testMemcache.Set(context.Background(), &Item{Key: ekey, Value: []byte("old")})
@@ -157,6 +163,7 @@ func Test_client_Touch(t *testing.T) {
 }
 
 func Test_client_Delete(t *testing.T) {
+	skipWithoutMemcache(t)
 	key := fmt.Sprintf("Test_client_Delete_%d", time.Now().Unix())
 	ekey := "Test_client_Delete_k"
 	testMemcache.Set(context.Background(), &Item{Key: ekey, Value: []byte("old")})
@@ -182,6 +189,7 @@ func Test_client_Delete(t *testing.T) {
 }
 
 func Test_client_Increment(t *testing.T) {
+	skipWithoutMemcache(t)
 	key := fmt.Sprintf("Test_client_Increment_%d", time.Now().Unix())
 	ekey := "Test_client_Increment_k"
 	testMemcache.Set(context.Background(), &Item{Key: ekey, Value: []byte("1")})
@@ -214,6 +222,7 @@ func Test_client_Increment(t *testing.T) {
 }
 
 func Test_client_Decrement(t *testing.T) {
+	skipWithoutMemcache(t)
 	key := fmt.Sprintf("Test_client_Decrement_%d", time.Now().Unix())
 	ekey := "Test_client_Decrement_k"
 	testMemcache.Set(context.Background(), &Item{Key: ekey, Value: []byte("100")})
@@ -246,6 +255,7 @@ func Test_client_Decrement(t *testing.T) {
 }
 
 func Test_client_GetMulti(t *testing.T) {
+	skipWithoutMemcache(t)
 	key := fmt.Sprintf("Test_client_GetMulti_%d", time.Now().Unix())
 	ekey1 := "Test_client_GetMulti_k1"
 	ekey2 := "Test_client_GetMulti_k2"
@@ -292,6 +302,7 @@ func Test_client_GetMulti(t *testing.T) {
 }
 
 func Test_client_Conn(t *testing.T) {
+	skipWithoutMemcache(t)
 	conn := testMemcache.Conn(context.Background())
 	defer conn.Close()
 	if conn == nil {
@@ -0,0 +1,333 @@
+package memcache
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+
+	pkgerr "github.com/pkg/errors"
+)
+
+var (
+	metaReplyValue    = []byte("VA")
+	metaReplyHead     = []byte("HD")
+	metaReplyMiss     = []byte("EN")
+	metaReplyNotStore = []byte("NS")
+	metaReplyExists   = []byte("EX")
+	metaReplyNotFound = []byte("NF")
+	metaReplyEnd      = []byte("MN")
+)
+
+// the mode flags of ms.
+var _metaSetModes = map[string]string{
+	"set":     "S",
+	"add":     "E",
+	"replace": "R",
+}
+
+var _ protocolConn = &metaConn{}
+
+// metaConn is the implementation of protocolConn by the meta commands, see
+// https://github.com/memcached/memcached/wiki/MetaCommands.
+type metaConn struct {
+	err  error
+	conn net.Conn
+	// Read & Write
+	readTimeout  time.Duration
+	writeTimeout time.Duration
+	rw           *bufio.ReadWriter
+	// recache in seconds, zero disables.
+	recache int64
+}
+
+// newMetaConn returns a new memcache connection talking the meta protocol.
+func newMetaConn(netConn net.Conn, readTimeout, writeTimeout, recache time.Duration) (protocolConn, error) {
+	if writeTimeout <= 0 || readTimeout <= 0 {
+		return nil, pkgerr.Errorf("readTimeout writeTimeout can't be zero")
+	}
+	c := &metaConn{
+		conn: netConn,
+		rw: bufio.NewReadWriter(bufio.NewReader(netConn),
+			bufio.NewWriter(netConn)),
+		readTimeout:  readTimeout,
+		writeTimeout: writeTimeout,
+		recache:      int64(recache / time.Second),
+	}
+	return c, nil
+}
+
+func (c *metaConn) Close() error {
+	if c.err == nil {
+		c.err = pkgerr.New("memcache: closed")
+	}
+	return c.conn.Close()
+}
+
+func (c *metaConn) fatal(err error) error {
+	if c.err == nil {
+		c.err = pkgerr.WithStack(err)
+		// Close connection to force errors on subsequent calls and to unblock
+		// other reader or writer.
+		c.conn.Close()
+	}
+	return c.err
+}
+
+func (c *metaConn) Err() error {
+	return c.err
+}
+
+func metaReplyToError(line []byte) error {
+	switch {
+	case bytes.HasPrefix(line, metaReplyHead):
+		return nil
+	case bytes.HasPrefix(line, metaReplyNotStore):
+		return ErrNotStored
+	case bytes.HasPrefix(line, metaReplyExists):
+		return ErrCASConflict
+	case bytes.HasPrefix(line, metaReplyNotFound), bytes.HasPrefix(line, metaReplyMiss):
+		return ErrNotFound
+	}
+	return pkgerr.WithStack(protocolError(string(line)))
+}
+
+func (c *metaConn) Populate(ctx context.Context, cmd string, key string, flags uint32, expiration int32, cas uint64, data []byte) error {
+	var err error
+	c.conn.SetWriteDeadline(shrinkDeadline(ctx, c.writeTimeout))
+	// ms <key> <datalen> <flags>*\r\n
+	if cmd == "cas" {
+		_, err = fmt.Fprintf(c.rw, "ms %s %d F%d T%d C%d\r\n", key, len(data), flags, expiration, cas)
+	} else {
+		mode, ok := _metaSetModes[cmd]
+		if !ok {
+			return pkgerr.Errorf("memcache: unknown command %s", cmd)
+		}
+		_, err = fmt.Fprintf(c.rw, "ms %s %d F%d T%d M%s\r\n", key, len(data), flags, expiration, mode)
+	}
+	if err != nil {
+		return c.fatal(err)
+	}
+	c.rw.Write(data)
+	c.rw.Write(crlf)
+	if err = c.rw.Flush(); err != nil {
+		return c.fatal(err)
+	}
+	line, err := c.readLine(ctx)
+	if err != nil {
+		return err
+	}
+	return metaReplyToError(line)
+}
+
+// writeGet buffers a mg of key, the quiet mg has no reply on miss and the
+// opaque is echoed back to match the replies of the pipelined mg.
+func (c *metaConn) writeGet(key string, opaque int, quiet bool) (err error) {
+	// mg <key> <flags>*\r\n
+	if _, err = fmt.Fprintf(c.rw, "mg %s v f c", key); err != nil {
+		return
+	}
+	if quiet {
+		if _, err = fmt.Fprintf(c.rw, " O%d q", opaque); err != nil {
+			return
+		}
+	}
+	if c.recache > 0 {
+		if _, err = fmt.Fprintf(c.rw, " R%d", c.recache); err != nil {
+			return
+		}
+	}
+	_, err = c.rw.Write(crlf)
+	return
+}
+
+func (c *metaConn) Get(ctx context.Context, key string) (*Item, error) {
+	c.conn.SetWriteDeadline(shrinkDeadline(ctx, c.writeTimeout))
+	if err := c.writeGet(key, 0, false); err != nil {
+		return nil, c.fatal(err)
+	}
+	if err := c.rw.Flush(); err != nil {
+		return nil, c.fatal(err)
+	}
+	c.conn.SetReadDeadline(shrinkDeadline(ctx, c.readTimeout))
+	it, _, _, err := c.parseGetReply()
+	if err != nil {
+		return nil, err
+	}
+	if it == nil {
+		return nil, ErrNotFound
+	}
+	it.Key = key
+	return it, nil
+}
+
+// GetMulti pipelines the quiet mg of keys ended by a mn, only the hits are
+// replied and matched to the keys by the opaque.
+func (c *metaConn) GetMulti(ctx context.Context, keys ...string) (map[string]*Item, error) {
+	c.conn.SetWriteDeadline(shrinkDeadline(ctx, c.writeTimeout))
+	for i, key := range keys {
+		if err := c.writeGet(key, i, true); err != nil {
+			return nil, c.fatal(err)
+		}
+	}
+	if _, err := c.rw.WriteString("mn\r\n"); err != nil {
+		return nil, c.fatal(err)
+	}
+	if err := c.rw.Flush(); err != nil {
+		return nil, c.fatal(err)
+	}
+	c.conn.SetReadDeadline(shrinkDeadline(ctx, c.readTimeout))
+	results := make(map[string]*Item, len(keys))
+	for {
+		it, opaque, end, err := c.parseGetReply()
+		if err != nil {
+			return nil, err
+		}
+		if end {
+			return results, nil
+		}
+		if it == nil {
+			continue
+		}
+		if opaque < 0 || opaque >= len(keys) {
+			return nil, c.fatal(protocolError(fmt.Sprintf("unexpected opaque %d in mg response", opaque)))
+		}
+		it.Key = keys[opaque]
+		results[it.Key] = it
+	}
+}
+
+// parseGetReply reads a reply of mg, the item is nil on miss or if this
+// client won the recache of it.
+func (c *metaConn) parseGetReply() (it *Item, opaque int, end bool, err error) {
+	line, err := c.rw.ReadSlice('\n')
+	if err != nil {
+		return nil, 0, false, c.fatal(err)
+	}
+	fields := bytes.Fields(line)
+	switch {
+	case len(fields) == 0:
+	case bytes.Equal(fields[0], metaReplyEnd):
+		return nil, 0, true, nil
+	case bytes.Equal(fields[0], metaReplyMiss):
+		return nil, 0, false, nil
+	case bytes.Equal(fields[0], metaReplyValue) && len(fields) >= 2:
+		var size int
+		if size, err = strconv.Atoi(string(fields[1])); err != nil {
+			break
+		}
+		it = new(Item)
+		var won bool
+		if opaque, won, err = scanMetaFlags(fields[2:], it); err != nil {
+			break
+		}
+		it.Value = make([]byte, size+2)
+		if _, err = io.ReadFull(c.rw, it.Value); err != nil {
+			return nil, 0, false, c.fatal(err)
+		}
+		if !bytes.HasSuffix(it.Value, crlf) {
+			return nil, 0, false, c.fatal(protocolError("corrupt get reply, no except CRLF"))
+		}
+		it.Value = it.Value[:size]
+		if won {
+			// reported as a miss to make the caller set it again.
+			it = nil
+		}
+		return it, opaque, false, nil
+	}
+	return nil, 0, false, c.fatal(protocolError(fmt.Sprintf("unexpected line in mg response: %q", line)))
+}
+
+// scanMetaFlags scans the return flags of mg into item.
+func scanMetaFlags(fields [][]byte, item *Item) (opaque int, won bool, err error) {
+	for _, f := range fields {
+		switch f[0] {
+		case 'f':
+			var flags uint64
+			flags, err = strconv.ParseUint(string(f[1:]), 10, 32)
+			item.Flags = uint32(flags)
+		case 'c':
+			item.cas, err = strconv.ParseUint(string(f[1:]), 10, 64)
+		case 'O':
+			opaque, err = strconv.Atoi(string(f[1:]))
+		case 'W':
+			won = true
+		case 'X':
+			item.stale = true
+		}
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (c *metaConn) Touch(ctx context.Context, key string, expire int32) error {
+	line, err := c.writeReadLine(ctx, "mg %s T%d\r\n", key, expire)
+	if err != nil {
+		return err
+	}
+	return metaReplyToError(line)
+}
+
+func (c *metaConn) IncrDecr(ctx context.Context, cmd, key string, delta uint64) (uint64, error) {
+	mode := "I"
+	if cmd == "decr" {
+		mode = "D"
+	}
+	line, err := c.writeReadLine(ctx, "ma %s v D%d M%s\r\n", key, delta, mode)
+	if err != nil {
+		return 0, err
+	}
+	if !bytes.HasPrefix(line, metaReplyValue) {
+		if err = metaReplyToError(line); err == nil {
+			err = pkgerr.WithStack(protocolError(string(line)))
+		}
+		return 0, err
+	}
+	if line, err = c.rw.ReadSlice('\n'); err != nil {
+		return 0, c.fatal(err)
+	}
+	return strconv.ParseUint(string(bytes.TrimSpace(line)), 10, 64)
+}
+
+func (c *metaConn) Delete(ctx context.Context, key string) error {
+	var (
+		line []byte
+		err  error
+	)
+	if c.recache > 0 {
+		// marks it stale, the next mg wins the recache.
+		line, err = c.writeReadLine(ctx, "md %s I T%d\r\n", key, c.recache)
+	} else {
+		line, err = c.writeReadLine(ctx, "md %s\r\n", key)
+	}
+	if err != nil {
+		return err
+	}
+	return metaReplyToError(line)
+}
+
+func (c *metaConn) readLine(ctx context.Context) ([]byte, error) {
+	c.conn.SetReadDeadline(shrinkDeadline(ctx, c.readTimeout))
+	line, err := c.rw.ReadSlice('\n')
+	if err != nil {
+		return line, c.fatal(err)
+	}
+	return line, nil
+}
+
+func (c *metaConn) writeReadLine(ctx context.Context, format string, args ...interface{}) ([]byte, error) {
+	c.conn.SetWriteDeadline(shrinkDeadline(ctx, c.writeTimeout))
+	if _, err := fmt.Fprintf(c.rw, format, args...); err != nil {
+		return nil, c.fatal(err)
+	}
+	if err := c.rw.Flush(); err != nil {
+		return nil, c.fatal(err)
+	}
+	return c.readLine(ctx)
+}
@@ -0,0 +1,631 @@
+package memcache
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/djienet/kratos/pkg/cache"
+	"github.com/djienet/kratos/pkg/cache/hotkey"
+	"github.com/djienet/kratos/pkg/container/pool"
+	xtime "github.com/djienet/kratos/pkg/time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type fakeMetaItem struct {
+	value  []byte
+	flags  uint64
+	cas    uint64
+	expire time.Time
+	stale  bool
+	won    bool
+}
+
+// fakeMetaServer implements the meta commands used by metaConn in memory,
+// and the set and gets of the text protocol for the examples.
+type fakeMetaServer struct {
+	ln    net.Listener
+	mu    sync.Mutex
+	cas   uint64
+	items map[string]*fakeMetaItem
+}
+
+func newFakeMetaServer() (*fakeMetaServer, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	s := &fakeMetaServer{ln: ln, items: make(map[string]*fakeMetaItem)}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s, nil
+}
+
+func (s *fakeMetaServer) Addr() string {
+	return s.ln.Addr().String()
+}
+
+func (s *fakeMetaServer) serve(conn net.Conn) {
+	defer conn.Close()
+	rw := bufio.NewReadWriter(bufio.NewReader(conn), bufio.NewWriter(conn))
+	for {
+		line, err := rw.ReadString('\n')
+		if err != nil {
+			return
+		}
+		fields := bytes.Fields([]byte(line))
+		if len(fields) == 0 || (len(fields) < 2 && string(fields[0]) != "mn") {
+			rw.WriteString("ERROR\r\n")
+			rw.Flush()
+			continue
+		}
+		cmd := string(fields[0])
+		if cmd == "set" || cmd == "gets" {
+			if err = s.text(rw, cmd, fields); err != nil {
+				return
+			}
+			rw.Flush()
+			continue
+		}
+		flags := make(map[byte]string)
+		var data []byte
+		if cmd == "ms" {
+			size, _ := strconv.Atoi(string(fields[2]))
+			data = make([]byte, size+2)
+			if _, err = io.ReadFull(rw, data); err != nil {
+				return
+			}
+			data = data[:size]
+			fields = fields[1:]
+		}
+		for i := 2; i < len(fields); i++ {
+			flags[fields[i][0]] = string(fields[i][1:])
+		}
+		s.mu.Lock()
+		switch cmd {
+		case "mg":
+			s.get(rw, string(fields[1]), flags)
+		case "ms":
+			rw.WriteString(s.set(string(fields[0]), data, flags))
+		case "md":
+			rw.WriteString(s.delete(string(fields[1]), flags))
+		case "ma":
+			rw.WriteString(s.arithmetic(string(fields[1]), flags))
+		case "mn":
+			rw.WriteString("MN\r\n")
+		default:
+			rw.WriteString("ERROR\r\n")
+		}
+		s.mu.Unlock()
+		// flushes like the server does at the end of the pipeline.
+		if rw.Reader.Buffered() == 0 {
+			rw.Flush()
+		}
+	}
+}
+
+func (s *fakeMetaServer) text(rw *bufio.ReadWriter, cmd string, fields [][]byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if cmd == "gets" {
+		for _, key := range fields[1:] {
+			if it := s.lookup(string(key)); it != nil {
+				fmt.Fprintf(rw, "VALUE %s %d %d %d\r\n%s\r\n", key, it.flags, len(it.value), it.cas, it.value)
+			}
+		}
+		rw.WriteString("END\r\n")
+		return nil
+	}
+	if len(fields) < 5 {
+		rw.WriteString("ERROR\r\n")
+		return nil
+	}
+	size, _ := strconv.Atoi(string(fields[4]))
+	data := make([]byte, size+2)
+	if _, err := io.ReadFull(rw, data); err != nil {
+		return err
+	}
+	f, _ := strconv.ParseUint(string(fields[2]), 10, 32)
+	s.cas++
+	s.items[string(fields[1])] = &fakeMetaItem{value: data[:size], flags: f, cas: s.cas, expire: ttlOf(string(fields[3]))}
+	rw.WriteString("STORED\r\n")
+	return nil
+}
+
+func (s *fakeMetaServer) lookup(key string) *fakeMetaItem {
+	it, ok := s.items[key]
+	if ok && !it.expire.IsZero() && time.Now().After(it.expire) {
+		delete(s.items, key)
+		return nil
+	}
+	return it
+}
+
+func ttlOf(t string) time.Time {
+	n, _ := strconv.Atoi(t)
+	if n == 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(time.Duration(n) * time.Second)
+}
+
+func (s *fakeMetaServer) get(w *bufio.ReadWriter, key string, flags map[byte]string) {
+	_, quiet := flags['q']
+	it := s.lookup(key)
+	if it == nil {
+		if !quiet {
+			w.WriteString("EN\r\n")
+		}
+		return
+	}
+	if t, ok := flags['T']; ok {
+		it.expire = ttlOf(t)
+	}
+	var ret string
+	if v, ok := flags['O']; ok {
+		ret += " O" + v
+	}
+	if r, ok := flags['R']; ok {
+		n, _ := strconv.Atoi(r)
+		recache := it.stale || (!it.expire.IsZero() && time.Until(it.expire) < time.Duration(n)*time.Second)
+		if it.won {
+			ret += " Z"
+		} else if recache {
+			it.won = true
+			ret += " W"
+		}
+	}
+	if it.stale {
+		ret += " X"
+	}
+	if _, ok := flags['v']; !ok {
+		w.WriteString("HD" + ret + "\r\n")
+		return
+	}
+	fmt.Fprintf(w, "VA %d f%d c%d%s\r\n%s\r\n", len(it.value), it.flags, it.cas, ret, it.value)
+}
+
+func (s *fakeMetaServer) set(key string, data []byte, flags map[byte]string) string {
+	it := s.lookup(key)
+	if c, ok := flags['C']; ok {
+		if it == nil {
+			return "NF\r\n"
+		}
+		if c != strconv.FormatUint(it.cas, 10) {
+			return "EX\r\n"
+		}
+	}
+	switch flags['M'] {
+	case "E":
+		if it != nil {
+			return "NS\r\n"
+		}
+	case "R":
+		if it == nil {
+			return "NS\r\n"
+		}
+	}
+	s.cas++
+	f, _ := strconv.ParseUint(flags['F'], 10, 32)
+	s.items[key] = &fakeMetaItem{value: data, flags: f, cas: s.cas, expire: ttlOf(flags['T'])}
+	return "HD\r\n"
+}
+
+func (s *fakeMetaServer) delete(key string, flags map[byte]string) string {
+	it := s.lookup(key)
+	if it == nil {
+		return "NF\r\n"
+	}
+	if _, ok := flags['I']; ok {
+		it.stale, it.won = true, false
+		it.expire = ttlOf(flags['T'])
+		return "HD\r\n"
+	}
+	delete(s.items, key)
+	return "HD\r\n"
+}
+
+func (s *fakeMetaServer) arithmetic(key string, flags map[byte]string) string {
+	it := s.lookup(key)
+	if it == nil {
+		return "NF\r\n"
+	}
+	n, err := strconv.ParseUint(string(it.value), 10, 64)
+	if err != nil {
+		return "CLIENT_ERROR cannot increment or decrement non-numeric value\r\n"
+	}
+	delta, _ := strconv.ParseUint(flags['D'], 10, 64)
+	if flags['M'] == "D" {
+		if delta > n {
+			delta = n
+		}
+		n -= delta
+	} else {
+		n += delta
+	}
+	it.value = []byte(strconv.FormatUint(n, 10))
+	return fmt.Sprintf("VA %d\r\n%s\r\n", len(it.value), it.value)
+}
+
+func dialTestMeta(t *testing.T, options ...DialOption) Conn {
+	options = append(options, DialReadTimeout(time.Second), DialWriteTimeout(time.Second))
+	conn, err := Dial("meta", testMetaServer.Addr(), options...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
+
+func TestMetaConnPopulate(t *testing.T) {
+	conn := dialTestMeta(t)
+	defer conn.Close()
+	conn.Delete("meta_populate")
+	if err := conn.Replace(&Item{Key: "meta_populate", Value: []byte("0")}); err != ErrNotStored {
+		t.Fatalf("want ErrNotStored, got %v", err)
+	}
+	if err := conn.Add(&Item{Key: "meta_populate", Value: []byte("1")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.Add(&Item{Key: "meta_populate", Value: []byte("2")}); err != ErrNotStored {
+		t.Fatalf("want ErrNotStored, got %v", err)
+	}
+	it, err := conn.Get("meta_populate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(it.Value) != "1" || it.Key != "meta_populate" {
+		t.Fatalf("unexpected item %+v", it)
+	}
+	if err = conn.Set(&Item{Key: "meta_populate", Value: []byte("3")}); err != nil {
+		t.Fatal(err)
+	}
+	it.Value = []byte("4")
+	if err = conn.CompareAndSwap(it); err != ErrCASConflict {
+		t.Fatalf("want ErrCASConflict, got %v", err)
+	}
+	if it, err = conn.Get("meta_populate"); err != nil {
+		t.Fatal(err)
+	}
+	it.Value = []byte("5")
+	if err = conn.CompareAndSwap(it); err != nil {
+		t.Fatal(err)
+	}
+	if err = conn.Replace(&Item{Key: "meta_populate", Value: []byte("6")}); err != nil {
+		t.Fatal(err)
+	}
+	if it, err = conn.Get("meta_populate"); err != nil || string(it.Value) != "6" {
+		t.Fatalf("want 6, got %v %v", it, err)
+	}
+	if _, err = conn.Get("meta_missing"); err != ErrNotFound {
+		t.Fatalf("want ErrNotFound, got %v", err)
+	}
+}
+
+func TestMetaConnGetMulti(t *testing.T) {
+	conn := dialTestMeta(t)
+	defer conn.Close()
+	var keys []string
+	for i := 0; i < 1000; i++ {
+		key := "meta_multi_" + strconv.Itoa(i)
+		keys = append(keys, key)
+		if i%3 == 0 {
+			conn.Delete(key)
+			continue
+		}
+		if err := conn.Set(&Item{Key: key, Object: i, Flags: FlagJSON}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	res, err := conn.GetMulti(keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 666 {
+		t.Fatalf("want 666 items, got %d", len(res))
+	}
+	for i, key := range keys {
+		it, ok := res[key]
+		if ok != (i%3 != 0) {
+			t.Fatalf("unexpected item of %s: %v", key, it)
+		}
+		if !ok {
+			continue
+		}
+		var v int
+		if err = conn.Scan(it, &v); err != nil || v != i {
+			t.Fatalf("want %d, got %d %v", i, v, err)
+		}
+	}
+	// the conn is still in sync after the pipeline.
+	if _, err = conn.Get("meta_multi_1"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMetaConnLargeValue(t *testing.T) {
+	conn := dialTestMeta(t)
+	defer conn.Close()
+	value := bytes.Repeat([]byte("x"), _largeValue*2+10)
+	if err := conn.Set(&Item{Key: "meta_large", Value: value}); err != nil {
+		t.Fatal(err)
+	}
+	it, err := conn.Get("meta_large")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(it.Value, value) {
+		t.Fatalf("want %d bytes, got %d", len(value), len(it.Value))
+	}
+	res, err := conn.GetMulti([]string{"meta_large"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(res["meta_large"].Value, value) {
+		t.Fatal("large value of GetMulti mismatched")
+	}
+}
+
+func TestMetaConnIncrDecr(t *testing.T) {
+	conn := dialTestMeta(t)
+	defer conn.Close()
+	conn.Delete("meta_counter")
+	if _, err := conn.Increment("meta_counter", 1); err != ErrNotFound {
+		t.Fatalf("want ErrNotFound, got %v", err)
+	}
+	conn.Set(&Item{Key: "meta_counter", Value: []byte("10")})
+	if n, err := conn.Increment("meta_counter", 5); err != nil || n != 15 {
+		t.Fatalf("want 15, got %d %v", n, err)
+	}
+	if n, err := conn.Decrement("meta_counter", 20); err != nil || n != 0 {
+		t.Fatalf("want 0, got %d %v", n, err)
+	}
+	conn.Set(&Item{Key: "meta_counter", Value: []byte("abc")})
+	if _, err := conn.Increment("meta_counter", 1); err == nil {
+		t.Fatal("want error of non-numeric value")
+	}
+	if err := conn.Err(); err != nil {
+		t.Fatalf("conn should not be broken, got %v", err)
+	}
+}
+
+func TestMetaConnTouchDelete(t *testing.T) {
+	conn := dialTestMeta(t)
+	defer conn.Close()
+	conn.Set(&Item{Key: "meta_touch", Value: []byte("1")})
+	if err := conn.Touch("meta_touch", 100); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.Delete("meta_touch"); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.Touch("meta_touch", 100); err != ErrNotFound {
+		t.Fatalf("want ErrNotFound, got %v", err)
+	}
+	if err := conn.Delete("meta_touch"); err != ErrNotFound {
+		t.Fatalf("want ErrNotFound, got %v", err)
+	}
+}
+
+func TestMetaConnRecache(t *testing.T) {
+	conn1 := dialTestMeta(t, DialRecache(10*time.Second))
+	defer conn1.Close()
+	conn2 := dialTestMeta(t, DialRecache(10*time.Second))
+	defer conn2.Close()
+	// about to expire, only the first get wins the recache.
+	conn1.Set(&Item{Key: "meta_recache", Value: []byte("1"), Expiration: 5})
+	if _, err := conn1.Get("meta_recache"); err != ErrNotFound {
+		t.Fatalf("the winner want ErrNotFound, got %v", err)
+	}
+	it, err := conn2.Get("meta_recache")
+	if err != nil || string(it.Value) != "1" || it.Stale() {
+		t.Fatalf("the others want the value, got %v %v", it, err)
+	}
+	conn1.Set(&Item{Key: "meta_recache", Value: []byte("2"), Expiration: 100})
+	if it, err = conn2.Get("meta_recache"); err != nil || string(it.Value) != "2" {
+		t.Fatalf("want the recached value, got %v %v", it, err)
+	}
+	// deleted items are stale until recached.
+	if err = conn1.Delete("meta_recache"); err != nil {
+		t.Fatal(err)
+	}
+	res, err := conn2.GetMulti([]string{"meta_recache"})
+	if err != nil || len(res) != 0 {
+		t.Fatalf("the winner want miss, got %v %v", res, err)
+	}
+	if it, err = conn1.Get("meta_recache"); err != nil || !it.Stale() || string(it.Value) != "2" {
+		t.Fatalf("the others want the stale value, got %v %v", it, err)
+	}
+	conn2.Set(&Item{Key: "meta_recache", Value: []byte("3")})
+	if it, err = conn1.Get("meta_recache"); err != nil || it.Stale() || string(it.Value) != "3" {
+		t.Fatalf("want the recached value, got %v %v", it, err)
+	}
+}
+
+func TestMetaMemcache(t *testing.T) {
+	mc := New(&Config{
+		Config: &pool.Config{
+			Active:      10,
+			Idle:        5,
+			IdleTimeout: xtime.Duration(time.Second),
+		},
+		Name:         "test_meta",
+		Proto:        "meta",
+		Addr:         testMetaServer.Addr(),
+		DialTimeout:  xtime.Duration(time.Second),
+		ReadTimeout:  xtime.Duration(time.Second),
+		WriteTimeout: xtime.Duration(time.Second),
+	})
+	defer mc.Close()
+	ctx := context.Background()
+	if err := mc.Set(ctx, &Item{Key: "meta_mc", Object: "hello", Flags: FlagJSON}); err != nil {
+		t.Fatal(err)
+	}
+	var v string
+	if err := mc.Get(ctx, "meta_mc").Scan(&v); err != nil || v != "hello" {
+		t.Fatalf("want hello, got %s %v", v, err)
+	}
+	rs, err := mc.GetMulti(ctx, []string{"meta_mc", "meta_mc_missing"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keys := rs.Keys(); len(keys) != 1 || keys[0] != "meta_mc" {
+		t.Fatalf("unexpected keys %v", keys)
+	}
+	rs.Close()
+}
+
+func TestMetaHotKey(t *testing.T) {
+	mc := New(&Config{
+		Config: &pool.Config{
+			Active:      10,
+			Idle:        5,
+			IdleTimeout: xtime.Duration(time.Second),
+		},
+		Name:         "test_meta_hotkey",
+		Proto:        "meta",
+		Addr:         testMetaServer.Addr(),
+		DialTimeout:  xtime.Duration(time.Second),
+		ReadTimeout:  xtime.Duration(time.Second),
+		WriteTimeout: xtime.Duration(time.Second),
+		HotKey: &hotkey.Config{
+			Threshold: 10,
+			LocalTTL:  xtime.Duration(time.Minute),
+		},
+	})
+	defer mc.Close()
+	ctx := context.Background()
+	if err := mc.Set(ctx, &Item{Key: "meta_hot", Value: []byte("v1")}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		if err := mc.Get(ctx, "meta_hot").Scan(new([]byte)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !mc.pool.hot.Hot("meta_hot") {
+		t.Fatalf("meta_hot not hot, top keys %+v", mc.pool.hot.TopK())
+	}
+	// promoted by this get.
+	mc.Get(ctx, "meta_hot").Scan(new([]byte))
+	other := dialTestMeta(t)
+	defer other.Close()
+	if err := other.Set(&Item{Key: "meta_hot", Value: []byte("v2")}); err != nil {
+		t.Fatal(err)
+	}
+	var v []byte
+	if err := mc.Get(ctx, "meta_hot").Scan(&v); err != nil || string(v) != "v1" {
+		t.Fatalf("want the local v1, got %s %v", v, err)
+	}
+	rs, err := mc.GetMulti(ctx, []string{"meta_hot"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = rs.Scan("meta_hot", &v); err != nil || string(v) != "v1" {
+		t.Fatalf("want the local v1 of GetMulti, got %s %v", v, err)
+	}
+	if err = mc.Set(ctx, &Item{Key: "meta_hot", Value: []byte("v3")}); err != nil {
+		t.Fatal(err)
+	}
+	if err = mc.Get(ctx, "meta_hot").Scan(&v); err != nil || string(v) != "v3" {
+		t.Fatalf("want v3 after set, got %s %v", v, err)
+	}
+}
+
+func TestMetaStat(t *testing.T) {
+	mc := New(&Config{
+		Config: &pool.Config{
+			Active:      10,
+			Idle:        5,
+			IdleTimeout: xtime.Duration(time.Second),
+		},
+		Name:         "test_meta_stat",
+		Proto:        "meta",
+		Addr:         testMetaServer.Addr(),
+		DialTimeout:  xtime.Duration(time.Second),
+		ReadTimeout:  xtime.Duration(time.Second),
+		WriteTimeout: xtime.Duration(time.Second),
+	})
+	defer mc.Close()
+	labels := map[string]string{"name": "test_meta_stat", "prefix": "stat"}
+	before := make(map[string]float64)
+	for _, name := range []string{"cache_client_hits_total", "cache_client_misses_total", "cache_client_compress_ratio_percent", "cache_client_value_size_bytes"} {
+		before[name] = gatherMetric(t, name, labels)
+	}
+	ctx := cache.WithKeyPrefix(context.Background(), "stat")
+	if err := mc.Set(ctx, &Item{Key: "meta_stat", Object: "hello", Flags: FlagJSON | FlagGzip}); err != nil {
+		t.Fatal(err)
+	}
+	mc.Get(ctx, "meta_stat").Scan(new(string))
+	mc.Get(ctx, "meta_stat_missing").Scan(new(string))
+	rs, err := mc.GetMulti(ctx, []string{"meta_stat", "meta_stat_missing"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs.Close()
+	for name, want := range map[string]float64{
+		"cache_client_hits_total":             2,
+		"cache_client_misses_total":           2,
+		"cache_client_compress_ratio_percent": 1,
+		"cache_client_value_size_bytes":       3,
+	} {
+		if got := gatherMetric(t, name, labels) - before[name]; got != want {
+			t.Errorf("%s want %v, got %v", name, want, got)
+		}
+	}
+}
+
+// gatherMetric returns the counter value or the histogram sample count of
+// the metric name with labels.
+func gatherMetric(t *testing.T, name string, labels map[string]string) (v float64) {
+	mfs, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, mf := range mfs {
+		if mf.GetName() != name {
+			continue
+		}
+	next:
+		for _, m := range mf.GetMetric() {
+			for _, lp := range m.GetLabel() {
+				if lv, ok := labels[lp.GetName()]; ok && lv != lp.GetValue() {
+					continue next
+				}
+			}
+			if h := m.GetHistogram(); h != nil {
+				v += float64(h.GetSampleCount())
+			} else {
+				v += m.GetCounter().GetValue()
+			}
+		}
+	}
+	return
+}
+
+func TestMetaSplitProto(t *testing.T) {
+	for proto, want := range map[string][2]string{
+		"tcp":       {"tcp", ""},
+		"unix":      {"unix", ""},
+		"meta":      {"tcp", "meta"},
+		"meta+unix": {"unix", "meta"},
+	} {
+		if n, p := splitProto(proto); n != want[0] || p != want[1] {
+			t.Errorf("splitProto(%s) want %v, got %s %s", proto, want, n, p)
+		}
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"io"
 	"time"
 
+	"github.com/djienet/kratos/pkg/cache/hotkey"
 	"github.com/djienet/kratos/pkg/container/pool"
 )
 
@@ -14,6 +15,8 @@ import (
 type Pool struct {
 	p pool.Pool
 	c *Config
+	// hot is nil if Config.HotKey is not set.
+	hot *hotkey.Detector
 }
 
 // NewPool new a memcache conn pool.
@@ -26,11 +29,16 @@ func NewPool(cfg *Config) (p *Pool) {
 	cnop := DialConnectTimeout(time.Duration(cfg.DialTimeout))
 	rdop := DialReadTimeout(time.Duration(cfg.ReadTimeout))
 	wrop := DialWriteTimeout(time.Duration(cfg.WriteTimeout))
+	rcop := DialRecache(time.Duration(cfg.Recache))
+	nmop := DialName(cfg.Name)
 	p1.New = func(ctx context.Context) (io.Closer, error) {
-		conn, err := Dial(cfg.Proto, cfg.Addr, cnop, rdop, wrop)
+		conn, err := Dial(cfg.Proto, cfg.Addr, cnop, rdop, wrop, rcop, nmop)
 		return newTraceConn(conn, fmt.Sprintf("%s://%s", cfg.Proto, cfg.Addr)), err
 	}
 	p = &Pool{p: p1, c: cfg}
+	if cfg.HotKey != nil {
+		p.hot = hotkey.New(cfg.Name, cfg.HotKey)
+	}
 	return
 }
 
@@ -50,15 +58,64 @@ func (p *Pool) Get(ctx context.Context) Conn {
 
 // Close release the resources used by the pool.
 func (p *Pool) Close() error {
+	if p.hot != nil {
+		p.hot.Close()
+	}
 	return p.p.Close()
 }
 
+// load returns a copy of the promoted item of key, the access is counted
+// here as it never reaches a connection. The version of key is returned on
+// miss to store the item read.
+func (p *Pool) load(key string) (*Item, uint64, bool) {
+	if p.hot == nil {
+		return nil, 0, false
+	}
+	v, ok := p.hot.Load(key)
+	if !ok {
+		return nil, p.hot.Version(key), false
+	}
+	p.hot.Add(key)
+	return copyItem(v.(*Item)), 0, true
+}
+
+// store promotes a copy of item if its key is hot and not invalidated since
+// version, the stale items are left to be recached.
+func (p *Pool) store(item *Item, version uint64) {
+	if p.hot == nil || item.stale {
+		return
+	}
+	p.hot.Store(item.Key, copyItem(item), version)
+}
+
+// copyItem copies item and its value, the promoted items are shared.
+func copyItem(item *Item) *Item {
+	it := *item
+	if item.Value != nil {
+		it.Value = append(make([]byte, 0, len(item.Value)), item.Value...)
+	}
+	return &it
+}
+
+func (p *Pool) invalidate(key string) {
+	if p.hot != nil {
+		p.hot.Delete(key)
+	}
+}
+
 type poolConn struct {
 	c   Conn
 	p   *Pool
 	ctx context.Context
 }
 
+// sample counts the access of key for the hot key detection.
+func (pc *poolConn) sample(key string) {
+	if pc.p.hot != nil {
+		pc.p.hot.Add(key)
+	}
+}
+
 func (pc *poolConn) pstat(key string, t time.Time, err error) {
 	_metricReqDur.Observe(int64(time.Since(t)/time.Millisecond), pc.p.c.Name, pc.p.c.Addr, key)
 	if err != nil {
@@ -129,6 +186,7 @@ func (pc *poolConn) Decrement(key string, delta uint64) (newValue uint64, err er
 }
 
 func (pc *poolConn) AddContext(ctx context.Context, item *Item) error {
+	pc.sample(item.Key)
 	now := time.Now()
 	err := pc.c.AddContext(ctx, item)
 	pc.pstat("add", now, err)
@@ -136,6 +194,7 @@ func (pc *poolConn) AddContext(ctx context.Context, item *Item) error {
 }
 
 func (pc *poolConn) SetContext(ctx context.Context, item *Item) error {
+	pc.sample(item.Key)
 	now := time.Now()
 	err := pc.c.SetContext(ctx, item)
 	pc.pstat("set", now, err)
@@ -143,6 +202,7 @@ func (pc *poolConn) SetContext(ctx context.Context, item *Item) error {
 }
 
 func (pc *poolConn) ReplaceContext(ctx context.Context, item *Item) error {
+	pc.sample(item.Key)
 	now := time.Now()
 	err := pc.c.ReplaceContext(ctx, item)
 	pc.pstat("replace", now, err)
@@ -150,6 +210,7 @@ func (pc *poolConn) ReplaceContext(ctx context.Context, item *Item) error {
 }
 
 func (pc *poolConn) GetContext(ctx context.Context, key string) (*Item, error) {
+	pc.sample(key)
 	now := time.Now()
 	item, err := pc.c.Get(key)
 	pc.pstat("get", now, err)
@@ -161,6 +222,9 @@ func (pc *poolConn) GetMultiContext(ctx context.Context, keys []string) (map[str
 	if len(keys) == 0 {
 		return make(map[string]*Item), nil
 	}
+	for _, key := range keys {
+		pc.sample(key)
+	}
 	now := time.Now()
 	items, err := pc.c.GetMulti(keys)
 	pc.pstat("gets", now, err)
@@ -168,6 +232,7 @@ func (pc *poolConn) GetMultiContext(ctx context.Context, keys []string) (map[str
 }
 
 func (pc *poolConn) DeleteContext(ctx context.Context, key string) error {
+	pc.sample(key)
 	now := time.Now()
 	err := pc.c.Delete(key)
 	pc.pstat("delete", now, err)
@@ -175,6 +240,7 @@ func (pc *poolConn) DeleteContext(ctx context.Context, key string) error {
 }
 
 func (pc *poolConn) IncrementContext(ctx context.Context, key string, delta uint64) (uint64, error) {
+	pc.sample(key)
 	now := time.Now()
 	newValue, err := pc.c.IncrementContext(ctx, key, delta)
 	pc.pstat("increment", now, err)
@@ -182,6 +248,7 @@ func (pc *poolConn) IncrementContext(ctx context.Context, key string, delta uint
 }
 
 func (pc *poolConn) DecrementContext(ctx context.Context, key string, delta uint64) (uint64, error) {
+	pc.sample(key)
 	now := time.Now()
 	newValue, err := pc.c.DecrementContext(ctx, key, delta)
 	pc.pstat("decrement", now, err)
@@ -189,6 +256,7 @@ func (pc *poolConn) DecrementContext(ctx context.Context, key string, delta uint
 }
 
 func (pc *poolConn) CompareAndSwapContext(ctx context.Context, item *Item) error {
+	pc.sample(item.Key)
 	now := time.Now()
 	err := pc.c.CompareAndSwap(item)
 	pc.pstat("cas", now, err)
@@ -196,6 +264,7 @@ func (pc *poolConn) CompareAndSwapContext(ctx context.Context, item *Item) error
 }
 
 func (pc *poolConn) TouchContext(ctx context.Context, key string, seconds int32) error {
+	pc.sample(key)
 	now := time.Now()
 	err := pc.c.Touch(key, seconds)
 	pc.pstat("touch", now, err)
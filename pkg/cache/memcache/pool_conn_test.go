@@ -46,6 +46,7 @@ var largeValueBoundary = &Item{
 }
 
 func TestPoolSet(t *testing.T) {
+	skipWithoutMemcache(t)
 	conn := testPool.Get(context.Background())
 	defer conn.Close()
 	// set
@@ -60,6 +61,7 @@ func TestPoolSet(t *testing.T) {
 }
 
 func TestPoolGet(t *testing.T) {
+	skipWithoutMemcache(t)
 	key := "testpool"
 	conn := testPool.Get(context.Background())
 	defer conn.Close()
@@ -78,6 +80,7 @@ func TestPoolGet(t *testing.T) {
 }
 
 func TestPoolGetMulti(t *testing.T) {
+	skipWithoutMemcache(t)
 	conn := testPool.Get(context.Background())
 	defer conn.Close()
 	s := []string{"testpool", "test1"}
@@ -93,6 +96,7 @@ func TestPoolGetMulti(t *testing.T) {
 }
 
 func TestPoolTouch(t *testing.T) {
+	skipWithoutMemcache(t)
 	key := "testpool"
 	conn := testPool.Get(context.Background())
 	defer conn.Close()
@@ -106,6 +110,7 @@ func TestPoolTouch(t *testing.T) {
 }
 
 func TestPoolIncrement(t *testing.T) {
+	skipWithoutMemcache(t)
 	key := "test_count"
 	conn := testPool.Get(context.Background())
 	defer conn.Close()
@@ -139,6 +144,7 @@ func TestPoolIncrement(t *testing.T) {
 }
 
 func TestPoolErr(t *testing.T) {
+	skipWithoutMemcache(t)
 	conn := testPool.Get(context.Background())
 	defer conn.Close()
 	if err := conn.Close(); err != nil {
@@ -152,6 +158,7 @@ func TestPoolErr(t *testing.T) {
 }
 
 func TestPoolCompareAndSwap(t *testing.T) {
+	skipWithoutMemcache(t)
 	conn := testPool.Get(context.Background())
 	defer conn.Close()
 	key := "testpool"
@@ -174,6 +181,7 @@ func TestPoolCompareAndSwap(t *testing.T) {
 }
 
 func TestPoolDel(t *testing.T) {
+	skipWithoutMemcache(t)
 	key := "testpool"
 	conn := testPool.Get(context.Background())
 	defer conn.Close()
@@ -189,6 +197,7 @@ func TestPoolDel(t *testing.T) {
 }
 
 func BenchmarkMemcache(b *testing.B) {
+	skipWithoutMemcache(b)
 	c := &Config{
 		Name:         "test",
 		Proto:        "tcp",
@@ -218,6 +227,7 @@ func BenchmarkMemcache(b *testing.B) {
 }
 
 func TestPoolSetLargeValue(t *testing.T) {
+	skipWithoutMemcache(t)
 	var b bytes.Buffer
 	for i := 0; i < 4000000; i++ {
 		b.WriteByte(1)
@@ -238,6 +248,7 @@ func TestPoolSetLargeValue(t *testing.T) {
 }
 
 func TestPoolGetLargeValue(t *testing.T) {
+	skipWithoutMemcache(t)
 	key := largeValue.Key
 	conn := testPool.Get(context.Background())
 	defer conn.Close()
@@ -249,6 +260,7 @@ func TestPoolGetLargeValue(t *testing.T) {
 }
 
 func TestPoolGetMultiLargeValue(t *testing.T) {
+	skipWithoutMemcache(t)
 	conn := testPool.Get(context.Background())
 	defer conn.Close()
 	s := []string{largeValue.Key, largeValue.Key}
@@ -264,6 +276,7 @@ func TestPoolGetMultiLargeValue(t *testing.T) {
 }
 
 func TestPoolSetLargeValueBoundary(t *testing.T) {
+	skipWithoutMemcache(t)
 	var b bytes.Buffer
 	for i := 0; i < _largeValue; i++ {
 		b.WriteByte(1)
@@ -284,6 +297,7 @@ func TestPoolSetLargeValueBoundary(t *testing.T) {
 }
 
 func TestPoolGetLargeValueBoundary(t *testing.T) {
+	skipWithoutMemcache(t)
 	key := largeValueBoundary.Key
 	conn := testPool.Get(context.Background())
 	defer conn.Close()
@@ -295,6 +309,7 @@ func TestPoolGetLargeValueBoundary(t *testing.T) {
 }
 
 func TestPoolAdd(t *testing.T) {
+	skipWithoutMemcache(t)
 	var (
 		key  = "test_add"
 		item = &Item{
@@ -317,6 +332,7 @@ func TestPoolAdd(t *testing.T) {
 }
 
 func TestNewPool(t *testing.T) {
+	skipWithoutMemcache(t)
 	type args struct {
 		cfg *Config
 	}
@@ -404,6 +420,7 @@ func TestNewPool(t *testing.T) {
 }
 
 func TestPool_Get(t *testing.T) {
+	skipWithoutMemcache(t)
 
 	type args struct {
 		ctx context.Context
@@ -474,6 +491,7 @@ func TestPool_Get(t *testing.T) {
 }
 
 func TestPool_Close(t *testing.T) {
+	skipWithoutMemcache(t)
 
 	type args struct {
 		ctx context.Context
@@ -29,6 +29,14 @@ type traceConn struct {
 	tags []trace.Tag
 }
 
+// valueContext keeps the values of the context for metrics but drops its
+// deadline and cancellation, the timeouts of the connection are used.
+type valueContext struct{ context.Context }
+
+func (valueContext) Deadline() (deadline time.Time, ok bool) { return }
+func (valueContext) Done() <-chan struct{}                   { return nil }
+func (valueContext) Err() error                              { return nil }
+
 func (t *traceConn) setTrace(ctx context.Context, action, statement string) func(error) error {
 	now := time.Now()
 	parent, ok := trace.FromContext(ctx)
@@ -50,17 +58,17 @@ func (t *traceConn) setTrace(ctx context.Context, action, statement string) func
 
 func (t *traceConn) AddContext(ctx context.Context, item *Item) error {
 	finishFn := t.setTrace(ctx, "Add", item.Key)
-	return finishFn(t.Conn.Add(item))
+	return finishFn(t.Conn.AddContext(valueContext{ctx}, item))
 }
 
 func (t *traceConn) SetContext(ctx context.Context, item *Item) error {
 	finishFn := t.setTrace(ctx, "Set", item.Key)
-	return finishFn(t.Conn.Set(item))
+	return finishFn(t.Conn.SetContext(valueContext{ctx}, item))
 }
 
 func (t *traceConn) ReplaceContext(ctx context.Context, item *Item) error {
 	finishFn := t.setTrace(ctx, "Replace", item.Key)
-	return finishFn(t.Conn.Replace(item))
+	return finishFn(t.Conn.ReplaceContext(valueContext{ctx}, item))
 }
 
 func (t *traceConn) GetContext(ctx context.Context, key string) (*Item, error) {
@@ -94,7 +102,7 @@ func (t *traceConn) DecrementContext(ctx context.Context, key string, delta uint
 
 func (t *traceConn) CompareAndSwapContext(ctx context.Context, item *Item) error {
 	finishFn := t.setTrace(ctx, "CompareAndSwap", item.Key)
-	return finishFn(t.Conn.CompareAndSwap(item))
+	return finishFn(t.Conn.CompareAndSwapContext(valueContext{ctx}, item))
 }
 
 func (t *traceConn) TouchContext(ctx context.Context, key string, seconds int32) (err error) {
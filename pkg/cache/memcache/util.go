@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/gogo/protobuf/proto"
+	pkgerr "github.com/pkg/errors"
 )
 
 func legalKey(key string) bool {
@@ -52,6 +53,13 @@ func (c errConn) GetMultiContext(context.Context, []string) (map[string]*Item, e
 	return nil, c.err
 }
 
+// localConn scans the items promoted into the local cache of the hot keys.
+type localConn struct{ errConn }
+
+func (localConn) Scan(item *Item, v interface{}) error {
+	return pkgerr.WithStack(newEncodeDecoder().decode(item, v))
+}
+
 // RawItem item with FlagRAW flag.
 //
 // Expiration is the cache expiration time, in seconds: either a relative
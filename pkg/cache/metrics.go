@@ -20,4 +20,53 @@ var (
 		Help:      "cache misses total.",
 		Labels:    []string{"name"},
 	})
+	MetricRefreshes = metric.NewCounterVec(&metric.CounterVecOpts{
+		Namespace: _metricNamespace,
+		Subsystem: "",
+		Name:      "refreshes_total",
+		Help:      "cache early refreshes total.",
+		Labels:    []string{"name"},
+	})
+
+	// be used by the memcache and redis clients, labeled by the Config.Name
+	// of the client and the key prefix set by WithKeyPrefix.
+	MetricKeyHits = metric.NewCounterVec(&metric.CounterVecOpts{
+		Namespace: _metricNamespace,
+		Subsystem: "client",
+		Name:      "hits_total",
+		Help:      "cache client key hits total.",
+		Labels:    []string{"name", "prefix"},
+	})
+	MetricKeyMisses = metric.NewCounterVec(&metric.CounterVecOpts{
+		Namespace: _metricNamespace,
+		Subsystem: "client",
+		Name:      "misses_total",
+		Help:      "cache client key misses total.",
+		Labels:    []string{"name", "prefix"},
+	})
+	MetricKeyErrors = metric.NewCounterVec(&metric.CounterVecOpts{
+		Namespace: _metricNamespace,
+		Subsystem: "client",
+		Name:      "errors_total",
+		Help:      "cache client key errors total.",
+		Labels:    []string{"name", "prefix"},
+	})
+	MetricValueSize = metric.NewHistogramVec(&metric.HistogramVecOpts{
+		Namespace: _metricNamespace,
+		Subsystem: "client",
+		Name:      "value_size_bytes",
+		Help:      "cache client value size(bytes).",
+		Labels:    []string{"name", "prefix", "command"},
+		Buckets:   []float64{64, 256, 1024, 4096, 16384, 65536, 262144, 1048576},
+	})
+	// MetricCompressRatio is the percent of the gzip compressed size to the
+	// raw size.
+	MetricCompressRatio = metric.NewHistogramVec(&metric.HistogramVecOpts{
+		Namespace: _metricNamespace,
+		Subsystem: "client",
+		Name:      "compress_ratio_percent",
+		Help:      "cache client gzip compressed size to raw size(percent).",
+		Labels:    []string{"name", "prefix"},
+		Buckets:   []float64{10, 20, 30, 40, 50, 60, 70, 80, 90, 100},
+	})
 )
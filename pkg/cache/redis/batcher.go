@@ -0,0 +1,143 @@
+package redis
+
+import (
+	"context"
+	"sync"
+
+	pkgerr "github.com/pkg/errors"
+)
+
+// ErrBatcherClosed is returned by Batcher.Do after Close.
+var ErrBatcherClosed = pkgerr.New("redis: batcher closed")
+
+// BatcherConfig batcher config.
+type BatcherConfig struct {
+	// Conns is the number of the shared connections, default 1.
+	Conns int
+	// MaxBatch is the max commands written in a round trip, default 128.
+	MaxBatch int
+}
+
+func (c *BatcherConfig) fix() {
+	if c.Conns <= 0 {
+		c.Conns = 1
+	}
+	if c.MaxBatch <= 0 {
+		c.MaxBatch = 128
+	}
+}
+
+// Batcher pipelines the concurrent Do of many goroutines on a few shared
+// connections, the commands arriving while a round trip is in flight are
+// written together in the next one. The blocking commands, pub/sub and
+// transactions must not be used with it, and the deadline of ctx only
+// bounds the wait of Do, the round trips use the timeouts of Config.
+type Batcher struct {
+	r    *Redis
+	conf *BatcherConfig
+	reqs chan *batchCmd
+	ctx  context.Context
+	// cancel closes the batcher.
+	cancel func()
+	wg     sync.WaitGroup
+}
+
+type batchCmd struct {
+	Cmd
+	// done is closed once the reply is received.
+	done chan struct{}
+}
+
+// NewBatcher new a batcher on the connections of r.
+func NewBatcher(r *Redis, c *BatcherConfig) *Batcher {
+	if c == nil {
+		c = &BatcherConfig{}
+	}
+	c.fix()
+	ctx, cancel := context.WithCancel(context.Background())
+	b := &Batcher{
+		r:      r,
+		conf:   c,
+		reqs:   make(chan *batchCmd),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+	b.wg.Add(c.Conns)
+	for i := 0; i < c.Conns; i++ {
+		go b.proc()
+	}
+	return b
+}
+
+// Do sends the command with the others and waits for its reply.
+func (b *Batcher) Do(ctx context.Context, commandName string, args ...interface{}) (interface{}, error) {
+	req := &batchCmd{
+		Cmd:  Cmd{commandName: commandName, args: args},
+		done: make(chan struct{}),
+	}
+	select {
+	case b.reqs <- req:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-b.ctx.Done():
+		return nil, ErrBatcherClosed
+	}
+	select {
+	case <-req.done:
+		return req.reply, req.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Close stops the batcher after the round trips in flight.
+func (b *Batcher) Close() error {
+	b.cancel()
+	b.wg.Wait()
+	return nil
+}
+
+func (b *Batcher) proc() {
+	defer b.wg.Done()
+	var conn Conn
+	defer func() {
+		if conn != nil {
+			conn.Close()
+		}
+	}()
+	reqs := make([]*batchCmd, 0, b.conf.MaxBatch)
+	cmds := make([]*Cmd, 0, b.conf.MaxBatch)
+	for {
+		reqs, cmds = reqs[:0], cmds[:0]
+		select {
+		case req := <-b.reqs:
+			reqs = append(reqs, req)
+		case <-b.ctx.Done():
+			return
+		}
+		// takes the commands queued meanwhile without waiting.
+	collect:
+		for len(reqs) < b.conf.MaxBatch {
+			select {
+			case req := <-b.reqs:
+				reqs = append(reqs, req)
+			default:
+				break collect
+			}
+		}
+		if conn != nil && conn.Err() != nil {
+			conn.Close()
+			conn = nil
+		}
+		if conn == nil {
+			conn = b.r.pool.Get(context.Background())
+		}
+		for _, req := range reqs {
+			cmds = append(cmds, &req.Cmd)
+		}
+		execCmds(conn, cmds, b.conf.MaxBatch)
+		for _, req := range reqs {
+			close(req.done)
+		}
+	}
+}
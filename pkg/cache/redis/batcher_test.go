@@ -0,0 +1,36 @@
+package redis
+
+import (
+	"context"
+	"sync"
+	"testing"
+)
+
+func TestBatcher(t *testing.T) {
+	r := NewRedis(testConfig)
+	defer r.Close()
+	r.Do(context.TODO(), "DEL", "batcher_counter")
+
+	b := NewBatcher(r, &BatcherConfig{Conns: 2, MaxBatch: 8})
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := Int64(b.Do(context.TODO(), "INCR", "batcher_counter")); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if n, err := Int64(b.Do(context.TODO(), "GET", "batcher_counter")); err != nil || n != 100 {
+		t.Fatalf("want 100, got %d %v", n, err)
+	}
+	if _, err := b.Do(context.TODO(), "HGET", "batcher_counter", "f"); err == nil {
+		t.Fatal("want the error reply of WRONGTYPE")
+	}
+	b.Close()
+	if _, err := b.Do(context.TODO(), "GET", "batcher_counter"); err != ErrBatcherClosed {
+		t.Fatalf("want ErrBatcherClosed, got %v", err)
+	}
+}
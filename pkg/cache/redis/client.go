@@ -0,0 +1,553 @@
+package redis
+
+import (
+	"context"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/djienet/kratos/pkg/cache"
+
+	pkgerr "github.com/pkg/errors"
+)
+
+var (
+	errMapDest = pkgerr.New("redis: dest must be a pointer to map[string]T")
+)
+
+// Client is the typed commands of Redis, the values are encoded by the codec
+// and the commands go through the pooled and traced connections of Redis.
+// The members of sets, sorted sets and the fields of streams are strings.
+type Client struct {
+	r     *Redis
+	codec Codec
+}
+
+// NewClient new a typed client of r, codec is json if nil.
+func NewClient(r *Redis, codec Codec) *Client {
+	if codec == nil {
+		codec = NewCodec(FlagJSON)
+	}
+	return &Client{r: r, codec: codec}
+}
+
+// Redis returns the underlying Redis.
+func (cli *Client) Redis() *Redis {
+	return cli.r
+}
+
+// Z is a member of sorted set.
+type Z struct {
+	Member string
+	Score  float64
+}
+
+// XMessage is a message of stream.
+type XMessage struct {
+	ID     string
+	Values map[string]string
+}
+
+func ttlArgs(args Args, ttl time.Duration) Args {
+	if ttl > 0 {
+		args = append(args, "PX", int64(ttl/time.Millisecond))
+	}
+	return args
+}
+
+// Get gets the value of key into v, ErrNil is returned if key is missing.
+func (cli *Client) Get(c context.Context, key string, v interface{}) error {
+	data, err := Bytes(cli.r.Do(c, "GET", key))
+	cli.statGets(c, "get", 1, [][]byte{data}, err)
+	if err != nil {
+		return err
+	}
+	return cli.codec.Decode(data, v)
+}
+
+// Set sets the value of key, zero ttl means never expire.
+func (cli *Client) Set(c context.Context, key string, v interface{}, ttl time.Duration) error {
+	data, err := cli.encode(c, "set", v)
+	if err != nil {
+		return err
+	}
+	_, err = cli.r.Do(c, "SET", ttlArgs(Args{key, data}, ttl)...)
+	return err
+}
+
+// SetNX sets the value of key only if key is missing, it reports whether
+// the value is set.
+func (cli *Client) SetNX(c context.Context, key string, v interface{}, ttl time.Duration) (bool, error) {
+	data, err := cli.encode(c, "set", v)
+	if err != nil {
+		return false, err
+	}
+	_, err = String(cli.r.Do(c, "SET", append(ttlArgs(Args{key, data}, ttl), "NX")...))
+	if err == ErrNil {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// MGet gets the values of keys into dest which is a pointer to map[string]T,
+// the missing keys are not in dest.
+func (cli *Client) MGet(c context.Context, keys []string, dest interface{}) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	values, err := ByteSlices(cli.r.Do(c, "MGET", Args{}.AddFlat(keys)...))
+	cli.statGets(c, "mget", len(keys), values, err)
+	if err != nil {
+		return err
+	}
+	return cli.decodeMap(keys, values, dest)
+}
+
+// MSet sets the values of keys, zero ttl means never expire.
+func (cli *Client) MSet(c context.Context, values map[string]interface{}, ttl time.Duration) (err error) {
+	if len(values) == 0 {
+		return
+	}
+	if ttl <= 0 {
+		args := make(Args, 0, len(values)*2)
+		for key, v := range values {
+			data, err := cli.encode(c, "mset", v)
+			if err != nil {
+				return err
+			}
+			args = append(args, key, data)
+		}
+		_, err = cli.r.Do(c, "MSET", args...)
+		return
+	}
+	conn := cli.r.Conn(c)
+	defer conn.Close()
+	for key, v := range values {
+		data, err := cli.encode(c, "mset", v)
+		if err != nil {
+			return err
+		}
+		if err = conn.Send("SET", key, data, "PX", int64(ttl/time.Millisecond)); err != nil {
+			return err
+		}
+	}
+	if err = conn.Flush(); err != nil {
+		return
+	}
+	for range values {
+		if _, err = conn.Receive(); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// Del deletes the keys, it returns the count of the deleted keys.
+func (cli *Client) Del(c context.Context, keys ...string) (int64, error) {
+	return Int64(cli.r.Do(c, "DEL", Args{}.AddFlat(keys)...))
+}
+
+// Exists reports whether key exists.
+func (cli *Client) Exists(c context.Context, key string) (bool, error) {
+	return Bool(cli.r.Do(c, "EXISTS", key))
+}
+
+// Expire sets the ttl of key, it reports whether key exists.
+func (cli *Client) Expire(c context.Context, key string, ttl time.Duration) (bool, error) {
+	return Bool(cli.r.Do(c, "PEXPIRE", key, int64(ttl/time.Millisecond)))
+}
+
+// TTL returns the ttl of key, -1 if key never expires, ErrNil is returned
+// if key is missing.
+func (cli *Client) TTL(c context.Context, key string) (time.Duration, error) {
+	ms, err := Int64(cli.r.Do(c, "PTTL", key))
+	switch {
+	case err != nil:
+		return 0, err
+	case ms == -2:
+		return 0, ErrNil
+	case ms == -1:
+		return -1, nil
+	}
+	return time.Duration(ms) * time.Millisecond, nil
+}
+
+// IncrBy increments the integer value of key by delta.
+func (cli *Client) IncrBy(c context.Context, key string, delta int64) (int64, error) {
+	return Int64(cli.r.Do(c, "INCRBY", key, delta))
+}
+
+// HGet gets the value of the hash field into v, ErrNil is returned if the
+// field is missing.
+func (cli *Client) HGet(c context.Context, key, field string, v interface{}) error {
+	data, err := Bytes(cli.r.Do(c, "HGET", key, field))
+	cli.statGets(c, "hget", 1, [][]byte{data}, err)
+	if err != nil {
+		return err
+	}
+	return cli.codec.Decode(data, v)
+}
+
+// HSet sets the value of the hash field.
+func (cli *Client) HSet(c context.Context, key, field string, v interface{}) error {
+	data, err := cli.encode(c, "hset", v)
+	if err != nil {
+		return err
+	}
+	_, err = cli.r.Do(c, "HSET", key, field, data)
+	return err
+}
+
+// HMGet gets the values of the hash fields into dest which is a pointer to
+// map[string]T, the missing fields are not in dest.
+func (cli *Client) HMGet(c context.Context, key string, fields []string, dest interface{}) error {
+	if len(fields) == 0 {
+		return nil
+	}
+	values, err := ByteSlices(cli.r.Do(c, "HMGET", Args{key}.AddFlat(fields)...))
+	cli.statGets(c, "hmget", len(fields), values, err)
+	if err != nil {
+		return err
+	}
+	return cli.decodeMap(fields, values, dest)
+}
+
+// HMSet sets the values of the hash fields.
+func (cli *Client) HMSet(c context.Context, key string, values map[string]interface{}) error {
+	if len(values) == 0 {
+		return nil
+	}
+	args := make(Args, 0, len(values)*2+1)
+	args = append(args, key)
+	for field, v := range values {
+		data, err := cli.encode(c, "hmset", v)
+		if err != nil {
+			return err
+		}
+		args = append(args, field, data)
+	}
+	_, err := cli.r.Do(c, "HMSET", args...)
+	return err
+}
+
+// HGetAll gets all the values of the hash into dest which is a pointer to
+// map[string]T.
+func (cli *Client) HGetAll(c context.Context, key string, dest interface{}) error {
+	values, err := ByteSlices(cli.r.Do(c, "HGETALL", key))
+	if err != nil {
+		cli.statGets(c, "hgetall", 1, nil, err)
+		return err
+	}
+	fields := make([]string, 0, len(values)/2)
+	datas := make([][]byte, 0, len(values)/2)
+	for i := 0; i+1 < len(values); i += 2 {
+		fields = append(fields, string(values[i]))
+		datas = append(datas, values[i+1])
+	}
+	cli.statGets(c, "hgetall", 1, datas, nil)
+	return cli.decodeMap(fields, datas, dest)
+}
+
+// HGetStruct scans the raw hash into the struct pointed by dest by the
+// redis tags, see ScanStruct. ErrNil is returned if key is missing.
+func (cli *Client) HGetStruct(c context.Context, key string, dest interface{}) error {
+	values, err := Values(cli.r.Do(c, "HGETALL", key))
+	if err == nil && len(values) == 0 {
+		err = ErrNil
+	}
+	if err != nil {
+		cli.statGets(c, "hgetall", 1, nil, err)
+		return err
+	}
+	cache.StatGets(c, cli.r.conf.Name, 1, 0)
+	return ScanStruct(values, dest)
+}
+
+// HSetStruct sets the fields of the struct src to the raw hash, see
+// Args.AddFlat.
+func (cli *Client) HSetStruct(c context.Context, key string, src interface{}) error {
+	_, err := cli.r.Do(c, "HMSET", Args{key}.AddFlat(src)...)
+	return err
+}
+
+// HDel deletes the hash fields, it returns the count of the deleted fields.
+func (cli *Client) HDel(c context.Context, key string, fields ...string) (int64, error) {
+	return Int64(cli.r.Do(c, "HDEL", Args{key}.AddFlat(fields)...))
+}
+
+// HIncrBy increments the integer value of the hash field by delta.
+func (cli *Client) HIncrBy(c context.Context, key, field string, delta int64) (int64, error) {
+	return Int64(cli.r.Do(c, "HINCRBY", key, field, delta))
+}
+
+// HLen returns the count of the hash fields.
+func (cli *Client) HLen(c context.Context, key string) (int64, error) {
+	return Int64(cli.r.Do(c, "HLEN", key))
+}
+
+// SAdd adds the members to the set, it returns the count of the new members.
+func (cli *Client) SAdd(c context.Context, key string, members ...string) (int64, error) {
+	return Int64(cli.r.Do(c, "SADD", Args{key}.AddFlat(members)...))
+}
+
+// SRem removes the members from the set, it returns the count of the removed
+// members.
+func (cli *Client) SRem(c context.Context, key string, members ...string) (int64, error) {
+	return Int64(cli.r.Do(c, "SREM", Args{key}.AddFlat(members)...))
+}
+
+// SMembers returns all the members of the set.
+func (cli *Client) SMembers(c context.Context, key string) ([]string, error) {
+	return Strings(cli.r.Do(c, "SMEMBERS", key))
+}
+
+// SIsMember reports whether member is in the set.
+func (cli *Client) SIsMember(c context.Context, key, member string) (bool, error) {
+	return Bool(cli.r.Do(c, "SISMEMBER", key, member))
+}
+
+// SCard returns the count of the set members.
+func (cli *Client) SCard(c context.Context, key string) (int64, error) {
+	return Int64(cli.r.Do(c, "SCARD", key))
+}
+
+// ZAdd adds the members to the sorted set or updates their scores, it
+// returns the count of the new members.
+func (cli *Client) ZAdd(c context.Context, key string, zs ...Z) (int64, error) {
+	args := make(Args, 0, len(zs)*2+1)
+	args = append(args, key)
+	for _, z := range zs {
+		args = append(args, z.Score, z.Member)
+	}
+	return Int64(cli.r.Do(c, "ZADD", args...))
+}
+
+// ZRem removes the members from the sorted set, it returns the count of the
+// removed members.
+func (cli *Client) ZRem(c context.Context, key string, members ...string) (int64, error) {
+	return Int64(cli.r.Do(c, "ZREM", Args{key}.AddFlat(members)...))
+}
+
+// ZScore returns the score of member, ErrNil is returned if member is missing.
+func (cli *Client) ZScore(c context.Context, key, member string) (float64, error) {
+	return Float64(cli.r.Do(c, "ZSCORE", key, member))
+}
+
+// ZIncrBy increments the score of member by delta.
+func (cli *Client) ZIncrBy(c context.Context, key, member string, delta float64) (float64, error) {
+	return Float64(cli.r.Do(c, "ZINCRBY", key, delta, member))
+}
+
+// ZCard returns the count of the sorted set members.
+func (cli *Client) ZCard(c context.Context, key string) (int64, error) {
+	return Int64(cli.r.Do(c, "ZCARD", key))
+}
+
+// ZRange returns the members in [start, stop] ordered by score ascending.
+func (cli *Client) ZRange(c context.Context, key string, start, stop int64) ([]Z, error) {
+	return zs(cli.r.Do(c, "ZRANGE", key, start, stop, "WITHSCORES"))
+}
+
+// ZRevRange returns the members in [start, stop] ordered by score descending.
+func (cli *Client) ZRevRange(c context.Context, key string, start, stop int64) ([]Z, error) {
+	return zs(cli.r.Do(c, "ZREVRANGE", key, start, stop, "WITHSCORES"))
+}
+
+// ZRangeByScore returns the members with score in [min, max] ordered by
+// score ascending, min and max can be -inf, +inf or exclusive like (1,
+// count <= 0 means no limit.
+func (cli *Client) ZRangeByScore(c context.Context, key, min, max string, offset, count int64) ([]Z, error) {
+	args := Args{key, min, max, "WITHSCORES"}
+	if count > 0 {
+		args = append(args, "LIMIT", offset, count)
+	}
+	return zs(cli.r.Do(c, "ZRANGEBYSCORE", args...))
+}
+
+// ZRevRangeByScore returns the members with score in [min, max] ordered by
+// score descending, count <= 0 means no limit.
+func (cli *Client) ZRevRangeByScore(c context.Context, key, max, min string, offset, count int64) ([]Z, error) {
+	args := Args{key, max, min, "WITHSCORES"}
+	if count > 0 {
+		args = append(args, "LIMIT", offset, count)
+	}
+	return zs(cli.r.Do(c, "ZREVRANGEBYSCORE", args...))
+}
+
+// XAdd appends a message to the stream and returns its id, the stream is
+// trimmed to about maxLen messages if maxLen > 0.
+func (cli *Client) XAdd(c context.Context, stream string, maxLen int64, values map[string]interface{}) (string, error) {
+	args := Args{stream}
+	if maxLen > 0 {
+		args = append(args, "MAXLEN", "~", maxLen)
+	}
+	args = append(args, "*")
+	for field, v := range values {
+		args = append(args, field, v)
+	}
+	return String(cli.r.Do(c, "XADD", args...))
+}
+
+// XLen returns the count of the stream messages.
+func (cli *Client) XLen(c context.Context, stream string) (int64, error) {
+	return Int64(cli.r.Do(c, "XLEN", stream))
+}
+
+// XDel deletes the messages, it returns the count of the deleted messages.
+func (cli *Client) XDel(c context.Context, stream string, ids ...string) (int64, error) {
+	return Int64(cli.r.Do(c, "XDEL", Args{stream}.AddFlat(ids)...))
+}
+
+// XTrim trims the stream to about maxLen messages, it returns the count of
+// the deleted messages.
+func (cli *Client) XTrim(c context.Context, stream string, maxLen int64) (int64, error) {
+	return Int64(cli.r.Do(c, "XTRIM", stream, "MAXLEN", "~", maxLen))
+}
+
+// XRange returns the messages with id in [start, end], start and end can be
+// - and +, count <= 0 means no limit.
+func (cli *Client) XRange(c context.Context, stream, start, end string, count int64) ([]XMessage, error) {
+	args := Args{stream, start, end}
+	if count > 0 {
+		args = append(args, "COUNT", count)
+	}
+	return XMessages(cli.r.Do(c, "XRANGE", args...))
+}
+
+// XRevRange returns the messages with id in [start, end] in reverse order.
+func (cli *Client) XRevRange(c context.Context, stream, end, start string, count int64) ([]XMessage, error) {
+	args := Args{stream, end, start}
+	if count > 0 {
+		args = append(args, "COUNT", count)
+	}
+	return XMessages(cli.r.Do(c, "XREVRANGE", args...))
+}
+
+// encode encodes v and reports the size of the value of command.
+func (cli *Client) encode(c context.Context, command string, v interface{}) (data []byte, err error) {
+	var (
+		raw  int
+		gzip bool
+	)
+	if f, ok := cli.codec.(codec); ok {
+		data, raw, err = f.encode(v)
+		gzip = uint32(f)&FlagGzip == FlagGzip
+	} else {
+		data, err = cli.codec.Encode(v)
+	}
+	if err != nil {
+		return
+	}
+	name := cli.r.conf.Name
+	cache.StatValueSize(c, name, command, len(data))
+	if gzip {
+		cache.StatCompress(c, name, raw, len(data))
+	}
+	return
+}
+
+// statGets reports the hits and misses of the n keys got by command, the
+// nil values are missed, or the errors of them if err is not ErrNil.
+func (cli *Client) statGets(c context.Context, command string, n int, values [][]byte, err error) {
+	name := cli.r.conf.Name
+	if err != nil && err != ErrNil {
+		cache.StatErrors(c, name, n)
+		return
+	}
+	hits := 0
+	for _, value := range values {
+		if value != nil {
+			hits++
+			cache.StatValueSize(c, name, command, len(value))
+		}
+	}
+	if hits > n {
+		// the fields of a hash.
+		hits = n
+	}
+	cache.StatGets(c, name, hits, n-hits)
+}
+
+// decodeMap decodes the non nil values into the map pointed by dest.
+func (cli *Client) decodeMap(keys []string, values [][]byte, dest interface{}) error {
+	rv := reflect.ValueOf(dest)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Map || rv.Elem().Type().Key().Kind() != reflect.String {
+		return errMapDest
+	}
+	m := rv.Elem()
+	if m.IsNil() {
+		m.Set(reflect.MakeMap(m.Type()))
+	}
+	kt, et := m.Type().Key(), m.Type().Elem()
+	for i, key := range keys {
+		if i >= len(values) || values[i] == nil {
+			continue
+		}
+		var ev reflect.Value
+		if et.Kind() == reflect.Ptr {
+			ev = reflect.New(et.Elem())
+			if err := cli.codec.Decode(values[i], ev.Interface()); err != nil {
+				return err
+			}
+		} else {
+			ev = reflect.New(et)
+			if err := cli.codec.Decode(values[i], ev.Interface()); err != nil {
+				return err
+			}
+			ev = ev.Elem()
+		}
+		m.SetMapIndex(reflect.ValueOf(key).Convert(kt), ev)
+	}
+	return nil
+}
+
+// zs is a helper that converts a WITHSCORES reply to []Z.
+func zs(reply interface{}, err error) ([]Z, error) {
+	values, err := Strings(reply, err)
+	if err != nil {
+		return nil, err
+	}
+	if len(values)%2 != 0 {
+		return nil, pkgerr.New("redis: zs expects even number of values result")
+	}
+	res := make([]Z, 0, len(values)/2)
+	for i := 0; i < len(values); i += 2 {
+		score, err := strconv.ParseFloat(values[i+1], 64)
+		if err != nil {
+			return nil, pkgerr.WithStack(err)
+		}
+		res = append(res, Z{Member: values[i], Score: score})
+	}
+	return res, nil
+}
+
+// XMessages is a helper that converts the reply of XRANGE to []XMessage.
+func XMessages(reply interface{}, err error) ([]XMessage, error) {
+	values, err := Values(reply, err)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]XMessage, 0, len(values))
+	for _, v := range values {
+		entry, err := Values(v, nil)
+		if err != nil {
+			return nil, err
+		}
+		if len(entry) != 2 {
+			return nil, pkgerr.New("redis: XMessages expects pairs of id and values")
+		}
+		id, err := String(entry[0], nil)
+		if err != nil {
+			return nil, err
+		}
+		// the values of the deleted messages pending in a group are nil.
+		msg := XMessage{ID: id}
+		if entry[1] != nil {
+			if msg.Values, err = StringMap(entry[1], nil); err != nil {
+				return nil, err
+			}
+		}
+		res = append(res, msg)
+	}
+	return res, nil
+}
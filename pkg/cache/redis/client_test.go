@@ -0,0 +1,114 @@
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/djienet/kratos/pkg/cache"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClient(t *testing.T) {
+	r := NewRedis(testConfig)
+	defer r.Close()
+	cli := NewClient(r, NewCodec(FlagJSON|FlagGzip))
+	c := context.Background()
+	cli.Del(c, "client_str", "client_hash", "client_set", "client_zset", "client_stream")
+
+	var u codecUser
+	assert.Equal(t, ErrNil, cli.Get(c, "client_str", &u))
+	assert.Nil(t, cli.Set(c, "client_str", &codecUser{ID: 1, Name: "kratos"}, time.Minute))
+	assert.Nil(t, cli.Get(c, "client_str", &u))
+	assert.Equal(t, "kratos", u.Name)
+	ok, err := cli.SetNX(c, "client_str", &u, time.Minute)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	ttl, err := cli.TTL(c, "client_str")
+	assert.Nil(t, err)
+	assert.True(t, ttl > 0)
+	var users map[string]*codecUser
+	assert.Nil(t, cli.MGet(c, []string{"client_str", "client_missing"}, &users))
+	assert.Len(t, users, 1)
+
+	assert.Nil(t, cli.HMSet(c, "client_hash", map[string]interface{}{"a": 1, "b": 2}))
+	var fields map[string]int
+	assert.Nil(t, cli.HGetAll(c, "client_hash", &fields))
+	assert.Equal(t, map[string]int{"a": 1, "b": 2}, fields)
+
+	n, err := cli.SAdd(c, "client_set", "a", "b")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), n)
+	ok, _ = cli.SIsMember(c, "client_set", "a")
+	assert.True(t, ok)
+
+	cli.ZAdd(c, "client_zset", Z{Member: "a", Score: 1}, Z{Member: "b", Score: 2})
+	zs, err := cli.ZRevRange(c, "client_zset", 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, []Z{{Member: "b", Score: 2}, {Member: "a", Score: 1}}, zs)
+
+	id, err := cli.XAdd(c, "client_stream", 100, map[string]interface{}{"k": "v"})
+	assert.Nil(t, err)
+	msgs, err := cli.XRange(c, "client_stream", "-", "+", 10)
+	assert.Nil(t, err)
+	assert.Equal(t, []XMessage{{ID: id, Values: map[string]string{"k": "v"}}}, msgs)
+}
+
+func TestClientStat(t *testing.T) {
+	c := getTestConfig(testRedisAddr)
+	c.Config = testConfig.Config
+	c.Name = "test_client_stat"
+	r := NewRedis(c)
+	defer r.Close()
+	cli := NewClient(r, NewCodec(FlagJSON|FlagGzip))
+	ctx := cache.WithKeyPrefix(context.Background(), "stat")
+	cli.Del(ctx, "client_stat", "client_stat_hash")
+
+	var u codecUser
+	assert.Equal(t, ErrNil, cli.Get(ctx, "client_stat", &u))
+	assert.Nil(t, cli.Set(ctx, "client_stat", &codecUser{ID: 1, Name: "kratos"}, 0))
+	assert.Nil(t, cli.Get(ctx, "client_stat", &u))
+	assert.Nil(t, cli.HSet(ctx, "client_stat_hash", "a", 1))
+	assert.NotNil(t, cli.HGet(ctx, "client_stat", "a", &u))
+
+	labels := map[string]string{"name": "test_client_stat", "prefix": "stat"}
+	for name, want := range map[string]float64{
+		"cache_client_hits_total":             1,
+		"cache_client_misses_total":           1,
+		"cache_client_errors_total":           1,
+		"cache_client_compress_ratio_percent": 2,
+		"cache_client_value_size_bytes":       3,
+	} {
+		assert.Equal(t, want, gatherMetric(t, name, labels), name)
+	}
+}
+
+// gatherMetric returns the counter value or the histogram sample count of
+// the metric name with labels.
+func gatherMetric(t *testing.T, name string, labels map[string]string) (v float64) {
+	mfs, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, mf := range mfs {
+		if mf.GetName() != name {
+			continue
+		}
+	next:
+		for _, m := range mf.GetMetric() {
+			for _, lp := range m.GetLabel() {
+				if lv, ok := labels[lp.GetName()]; ok && lv != lp.GetValue() {
+					continue next
+				}
+			}
+			if h := m.GetHistogram(); h != nil {
+				v += float64(h.GetSampleCount())
+			} else {
+				v += m.GetCounter().GetValue()
+			}
+		}
+	}
+	return
+}
@@ -0,0 +1,128 @@
+package redis
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/gob"
+	"encoding/json"
+	"io/ioutil"
+
+	"github.com/gogo/protobuf/proto"
+	pkgerr "github.com/pkg/errors"
+)
+
+// Codec flags, the same as the memcache flags.
+const (
+	// FlagRAW stores []byte and string as is.
+	FlagRAW = uint32(0)
+	// FlagGOB gob encoding.
+	FlagGOB = uint32(1) << 0
+	// FlagJSON json encoding.
+	FlagJSON = uint32(1) << 1
+	// FlagProtobuf protobuf encoding.
+	FlagProtobuf = uint32(1) << 2
+	// FlagGzip gzip compress, it can be combined with the encodings.
+	FlagGzip = uint32(1) << 15
+)
+
+var (
+	errCodecValue = pkgerr.New("redis: value not supported by codec")
+)
+
+// Codec encodes and decodes the values of Client.
+type Codec interface {
+	Encode(v interface{}) ([]byte, error)
+	Decode(data []byte, v interface{}) error
+}
+
+// NewCodec returns the codec of the memcache style flags, e.g.
+// FlagJSON|FlagGzip.
+func NewCodec(flags uint32) Codec {
+	return codec(flags)
+}
+
+type codec uint32
+
+func (f codec) Encode(v interface{}) (data []byte, err error) {
+	data, _, err = f.encode(v)
+	return
+}
+
+// encode returns the encoded data and its size before compression.
+func (f codec) encode(v interface{}) (data []byte, raw int, err error) {
+	flags := uint32(f)
+	switch {
+	case flags&FlagGOB == FlagGOB:
+		var buf bytes.Buffer
+		err = gob.NewEncoder(&buf).Encode(v)
+		data = buf.Bytes()
+	case flags&FlagProtobuf == FlagProtobuf:
+		pb, ok := v.(proto.Message)
+		if !ok {
+			return nil, 0, errCodecValue
+		}
+		data, err = proto.Marshal(pb)
+	case flags&FlagJSON == FlagJSON:
+		data, err = json.Marshal(v)
+	default:
+		switch vv := v.(type) {
+		case []byte:
+			data = vv
+		case string:
+			data = []byte(vv)
+		default:
+			return nil, 0, errCodecValue
+		}
+	}
+	if err != nil {
+		return nil, 0, pkgerr.WithStack(err)
+	}
+	raw = len(data)
+	if flags&FlagGzip == FlagGzip {
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		if _, err = w.Write(data); err == nil {
+			err = w.Close()
+		}
+		if err != nil {
+			return nil, 0, pkgerr.WithStack(err)
+		}
+		data = buf.Bytes()
+	}
+	return
+}
+
+func (f codec) Decode(data []byte, v interface{}) (err error) {
+	flags := uint32(f)
+	if flags&FlagGzip == FlagGzip {
+		r, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return pkgerr.WithStack(err)
+		}
+		if data, err = ioutil.ReadAll(r); err != nil {
+			return pkgerr.WithStack(err)
+		}
+	}
+	switch {
+	case flags&FlagGOB == FlagGOB:
+		err = gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+	case flags&FlagProtobuf == FlagProtobuf:
+		pb, ok := v.(proto.Message)
+		if !ok {
+			return errCodecValue
+		}
+		err = proto.Unmarshal(data, pb)
+	case flags&FlagJSON == FlagJSON:
+		err = json.Unmarshal(data, v)
+	default:
+		switch vv := v.(type) {
+		case *[]byte:
+			*vv = data
+		case *string:
+			*vv = string(data)
+		default:
+			return errCodecValue
+		}
+	}
+	return pkgerr.WithStack(err)
+}
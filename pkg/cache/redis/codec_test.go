@@ -0,0 +1,70 @@
+package redis
+
+import (
+	"testing"
+
+	pb "github.com/djienet/kratos/pkg/cache/memcache/test"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type codecUser struct {
+	ID   int64
+	Name string
+}
+
+func TestCodec(t *testing.T) {
+	for _, flags := range []uint32{FlagJSON, FlagGOB, FlagJSON | FlagGzip, FlagGOB | FlagGzip} {
+		codec := NewCodec(flags)
+		data, err := codec.Encode(&codecUser{ID: 1, Name: "kratos"})
+		assert.Nil(t, err)
+		var u codecUser
+		assert.Nil(t, codec.Decode(data, &u))
+		assert.Equal(t, codecUser{ID: 1, Name: "kratos"}, u, "flags(%d)", flags)
+	}
+	for _, flags := range []uint32{FlagProtobuf, FlagProtobuf | FlagGzip} {
+		codec := NewCodec(flags)
+		data, err := codec.Encode(&pb.TestItem{Name: "kratos", Age: 10})
+		assert.Nil(t, err)
+		var item pb.TestItem
+		assert.Nil(t, codec.Decode(data, &item))
+		assert.Equal(t, "kratos", item.Name)
+		_, err = codec.Encode(codecUser{})
+		assert.NotNil(t, err)
+	}
+	codec := NewCodec(FlagRAW | FlagGzip)
+	data, err := codec.Encode("raw")
+	assert.Nil(t, err)
+	var s string
+	assert.Nil(t, codec.Decode(data, &s))
+	assert.Equal(t, "raw", s)
+	_, err = codec.Encode(1)
+	assert.NotNil(t, err)
+}
+
+func TestDecodeMap(t *testing.T) {
+	cli := NewClient(nil, nil)
+	var users map[string]*codecUser
+	assert.Nil(t, cli.decodeMap([]string{"a", "b"}, [][]byte{[]byte(`{"ID":1}`), nil}, &users))
+	assert.Len(t, users, 1)
+	assert.Equal(t, int64(1), users["a"].ID)
+	var ids map[string]int64
+	assert.Nil(t, cli.decodeMap([]string{"a"}, [][]byte{[]byte(`2`)}, &ids))
+	assert.Equal(t, int64(2), ids["a"])
+	assert.NotNil(t, cli.decodeMap(nil, nil, ids))
+}
+
+func TestReplyHelpers(t *testing.T) {
+	res, err := zs([]interface{}{[]byte("a"), []byte("1.5"), []byte("b"), []byte("2")}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []Z{{Member: "a", Score: 1.5}, {Member: "b", Score: 2}}, res)
+
+	msgs, err := XMessages([]interface{}{
+		[]interface{}{[]byte("1-0"), []interface{}{[]byte("k"), []byte("v")}},
+		[]interface{}{[]byte("2-0"), nil},
+	}, nil)
+	assert.Nil(t, err)
+	assert.Len(t, msgs, 2)
+	assert.Equal(t, "v", msgs[0].Values["k"])
+	assert.Nil(t, msgs[1].Values)
+}
@@ -0,0 +1,288 @@
+package redis
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// _keylessCommands are the commands whose arguments are not keys.
+var _keylessCommands = map[string]struct{}{
+	"AUTH": {}, "SELECT": {}, "PING": {}, "ECHO": {}, "QUIT": {},
+	"MULTI": {}, "EXEC": {}, "DISCARD": {}, "UNWATCH": {}, "SCRIPT": {},
+	"SUBSCRIBE": {}, "PSUBSCRIBE": {}, "UNSUBSCRIBE": {}, "PUNSUBSCRIBE": {}, "PUBLISH": {},
+	"INFO": {}, "CONFIG": {}, "CLIENT": {}, "CLUSTER": {}, "COMMAND": {}, "DEBUG": {},
+	"MEMORY": {}, "OBJECT": {}, "SLOWLOG": {}, "MONITOR": {}, "ROLE": {}, "TIME": {},
+	"DBSIZE": {}, "FLUSHDB": {}, "FLUSHALL": {}, "KEYS": {}, "SCAN": {}, "RANDOMKEY": {},
+	"WAIT": {}, "READONLY": {}, "READWRITE": {}, "XREAD": {}, "XREADGROUP": {},
+}
+
+// _readCommands are the commands which never modify their keys, the others
+// with keys invalidate the promoted replies of all their keys.
+var _readCommands = map[string]struct{}{
+	"GET": {}, "MGET": {}, "STRLEN": {}, "GETRANGE": {}, "GETBIT": {}, "BITCOUNT": {}, "BITPOS": {},
+	"EXISTS": {}, "TYPE": {}, "TTL": {}, "PTTL": {}, "DUMP": {}, "WATCH": {},
+	"HGET": {}, "HMGET": {}, "HGETALL": {}, "HEXISTS": {}, "HLEN": {}, "HKEYS": {}, "HVALS": {}, "HSTRLEN": {}, "HSCAN": {},
+	"LRANGE": {}, "LLEN": {}, "LINDEX": {},
+	"SMEMBERS": {}, "SISMEMBER": {}, "SCARD": {}, "SRANDMEMBER": {}, "SINTER": {}, "SUNION": {}, "SDIFF": {}, "SSCAN": {},
+	"ZRANGE": {}, "ZREVRANGE": {}, "ZRANGEBYSCORE": {}, "ZREVRANGEBYSCORE": {}, "ZRANGEBYLEX": {}, "ZREVRANGEBYLEX": {},
+	"ZSCORE": {}, "ZCARD": {}, "ZCOUNT": {}, "ZLEXCOUNT": {}, "ZRANK": {}, "ZREVRANK": {}, "ZSCAN": {},
+	"GEOPOS": {}, "GEODIST": {}, "GEOHASH": {}, "XRANGE": {}, "XREVRANGE": {}, "XLEN": {},
+}
+
+// _localCommands are the read commands whose replies of the hot keys are
+// promoted into the local cache by Redis.Do.
+var _localCommands = map[string]struct{}{
+	"GET": {}, "HGET": {}, "HMGET": {}, "HGETALL": {},
+	"LRANGE": {}, "SMEMBERS": {}, "SISMEMBER": {}, "ZRANGE": {}, "ZREVRANGE": {}, "ZSCORE": {},
+}
+
+// keySpec locates the keys of a command in its arguments, the keys are the
+// arguments of [first, last] by step, a negative last counts from the end.
+// If numkeys is set, the count of the keys following it is the numkeys-1th
+// argument.
+type keySpec struct {
+	first, last, step int
+	numkeys           int
+}
+
+// _keySpecs are the commands whose keys are not just the first argument.
+var _keySpecs = map[string]keySpec{
+	"DEL": {0, -1, 1, 0}, "UNLINK": {0, -1, 1, 0}, "TOUCH": {0, -1, 1, 0}, "EXISTS": {0, -1, 1, 0},
+	"MGET": {0, -1, 1, 0}, "WATCH": {0, -1, 1, 0}, "PFCOUNT": {0, -1, 1, 0}, "PFMERGE": {0, -1, 1, 0},
+	"SINTER": {0, -1, 1, 0}, "SUNION": {0, -1, 1, 0}, "SDIFF": {0, -1, 1, 0},
+	"SINTERSTORE": {0, -1, 1, 0}, "SUNIONSTORE": {0, -1, 1, 0}, "SDIFFSTORE": {0, -1, 1, 0},
+	"MSET": {0, -1, 2, 0}, "MSETNX": {0, -1, 2, 0},
+	"RENAME": {0, 1, 1, 0}, "RENAMENX": {0, 1, 1, 0}, "SMOVE": {0, 1, 1, 0}, "COPY": {0, 1, 1, 0},
+	"RPOPLPUSH": {0, 1, 1, 0}, "BRPOPLPUSH": {0, 1, 1, 0}, "LMOVE": {0, 1, 1, 0}, "BLMOVE": {0, 1, 1, 0},
+	"BITOP": {1, -1, 1, 0},
+	"BLPOP": {0, -2, 1, 0}, "BRPOP": {0, -2, 1, 0}, "BZPOPMIN": {0, -2, 1, 0}, "BZPOPMAX": {0, -2, 1, 0},
+	"ZUNIONSTORE": {0, 0, 1, 2}, "ZINTERSTORE": {0, 0, 1, 2}, "ZDIFFSTORE": {0, 0, 1, 2},
+	"EVAL": {0, 0, 0, 2}, "EVALSHA": {0, 0, 0, 2}, "EVAL_RO": {0, 0, 0, 2}, "EVALSHA_RO": {0, 0, 0, 2},
+}
+
+func init() {
+	for _, m := range []map[string]struct{}{_keylessCommands, _readCommands, _localCommands} {
+		for n := range m {
+			m[strings.ToLower(n)] = struct{}{}
+		}
+	}
+	for n, spec := range _keySpecs {
+		_keySpecs[strings.ToLower(n)] = spec
+	}
+}
+
+func lookupCommand(m map[string]struct{}, commandName string) (ok bool) {
+	if _, ok = m[commandName]; !ok {
+		_, ok = m[strings.ToUpper(commandName)]
+	}
+	return
+}
+
+func argString(arg interface{}) string {
+	switch arg := arg.(type) {
+	case string:
+		return arg
+	case []byte:
+		return string(arg)
+	}
+	return fmt.Sprint(arg)
+}
+
+// commandKey returns the first key of the command.
+func commandKey(commandName string, args []interface{}) (key string, ok bool) {
+	if keys := commandKeys(commandName, args); len(keys) > 0 {
+		return keys[0], true
+	}
+	return
+}
+
+// commandKeys returns all the keys of the command.
+func commandKeys(commandName string, args []interface{}) (keys []string) {
+	if len(args) == 0 || lookupCommand(_keylessCommands, commandName) {
+		return
+	}
+	spec, ok := _keySpecs[commandName]
+	if !ok {
+		if spec, ok = _keySpecs[strings.ToUpper(commandName)]; !ok {
+			return []string{argString(args[0])}
+		}
+	}
+	if spec.step > 0 {
+		last := spec.last
+		if last < 0 {
+			last += len(args)
+		}
+		for i := spec.first; i <= last && i < len(args); i += spec.step {
+			keys = append(keys, argString(args[i]))
+		}
+	}
+	if spec.numkeys > 0 && spec.numkeys <= len(args) {
+		n, err := strconv.Atoi(argString(args[spec.numkeys-1]))
+		if err != nil {
+			return
+		}
+		for i := spec.numkeys; i < spec.numkeys+n && i < len(args); i++ {
+			keys = append(keys, argString(args[i]))
+		}
+	}
+	return
+}
+
+// localReplies is the promoted replies of a hot key by the command and
+// arguments, it is copied on write.
+type localReplies map[string]interface{}
+
+func commandSignature(commandName string, args []interface{}) string {
+	var b strings.Builder
+	b.WriteString(strings.ToUpper(commandName))
+	for _, arg := range args {
+		b.WriteByte(0)
+		switch arg := arg.(type) {
+		case string:
+			b.WriteString(arg)
+		case []byte:
+			b.Write(arg)
+		default:
+			fmt.Fprint(&b, arg)
+		}
+	}
+	return b.String()
+}
+
+// cloneReply deep copies the bulk strings of reply, the promoted replies are
+// shared by the callers.
+func cloneReply(reply interface{}) interface{} {
+	switch reply := reply.(type) {
+	case []byte:
+		return append(make([]byte, 0, len(reply)), reply...)
+	case []interface{}:
+		rs := make([]interface{}, len(reply))
+		for i, r := range reply {
+			rs[i] = cloneReply(r)
+		}
+		return rs
+	}
+	return reply
+}
+
+// sample counts the accesses of the keys of the command for the hot key
+// detection.
+func (p *Pool) sample(commandName string, args []interface{}) {
+	if p.hot == nil {
+		return
+	}
+	for _, key := range commandKeys(commandName, args) {
+		p.hot.Add(key)
+	}
+}
+
+// invalidation is the promoted replies to remove after a write command.
+type invalidation struct {
+	keys []string
+	// all removes all the replies, e.g. FLUSHDB.
+	all bool
+}
+
+func (inv *invalidation) merge(o invalidation) {
+	inv.keys = append(inv.keys, o.keys...)
+	inv.all = inv.all || o.all
+}
+
+// invalidation returns the keys the command writes if the replies are
+// promoted.
+func (p *Pool) invalidation(commandName string, args []interface{}) (inv invalidation) {
+	if p.hot == nil || p.c.HotKey.LocalTTL <= 0 || lookupCommand(_readCommands, commandName) {
+		return
+	}
+	switch strings.ToUpper(commandName) {
+	case "FLUSHDB", "FLUSHALL":
+		inv.all = true
+		return
+	}
+	inv.keys = commandKeys(commandName, args)
+	return
+}
+
+func (p *Pool) invalidate(inv invalidation) {
+	if inv.all {
+		p.hot.Clear()
+		return
+	}
+	for _, key := range inv.keys {
+		p.hot.Delete(key)
+	}
+}
+
+// pendingWrite is a command sent whose invalidation waits for its reply, as
+// the replies read before the write is done must not be promoted.
+type pendingWrite struct {
+	commandName string
+	inv         invalidation
+	// multi reports whether the command is queued in MULTI.
+	multi bool
+}
+
+// written invalidates the replies of a command done, the commands queued in
+// MULTI invalidate on EXEC.
+func (pc *pooledConnection) written(w pendingWrite) {
+	if ci := LookupCommandInfo(w.commandName); ci.Clear&MultiState != 0 {
+		if strings.EqualFold(w.commandName, "EXEC") {
+			pc.p.invalidate(pc.multi)
+		}
+		pc.multi = invalidation{}
+		return
+	}
+	if w.multi {
+		pc.multi.merge(w.inv)
+		return
+	}
+	pc.p.invalidate(w.inv)
+}
+
+// abandon invalidates the replies of the commands whose replies are not
+// read, they may be done or not.
+func (pc *pooledConnection) abandon() {
+	for _, w := range pc.writes {
+		pc.p.invalidate(w.inv)
+	}
+	pc.p.invalidate(pc.multi)
+	pc.writes, pc.multi = nil, invalidation{}
+}
+
+// doLocal is Do on the promoted replies of the hot keys, the read commands
+// of a single key are served by the local cache. The writes invalidate the
+// replies of their keys on the pooled connections.
+func (r *Redis) doLocal(do func() (interface{}, error), commandName string, args []interface{}) (reply interface{}, err error) {
+	if !lookupCommand(_localCommands, commandName) {
+		return do()
+	}
+	key, ok := commandKey(commandName, args)
+	if !ok {
+		return do()
+	}
+	hot := r.pool.hot
+	sig := commandSignature(commandName, args)
+	// the version is got first, so the old replies loaded are not stored
+	// back if they are invalidated.
+	version := hot.Version(key)
+	v, ok := hot.Load(key)
+	if ok {
+		if reply, ok = v.(localReplies)[sig]; ok {
+			// counted here as it never reaches a connection.
+			hot.Add(key)
+			return cloneReply(reply), nil
+		}
+	}
+	if reply, err = do(); err != nil {
+		return
+	}
+	old, _ := v.(localReplies)
+	replies := make(localReplies, len(old)+1)
+	for s, rp := range old {
+		replies[s] = rp
+	}
+	replies[sig] = cloneReply(reply)
+	hot.Store(key, replies, version)
+	return
+}
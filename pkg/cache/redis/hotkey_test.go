@@ -0,0 +1,202 @@
+package redis
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/djienet/kratos/pkg/cache/hotkey"
+	xtime "github.com/djienet/kratos/pkg/time"
+)
+
+func TestCommandKey(t *testing.T) {
+	for _, tc := range []struct {
+		cmd  string
+		args []interface{}
+		key  string
+		ok   bool
+	}{
+		{"GET", []interface{}{"a"}, "a", true},
+		{"hget", []interface{}{[]byte("b"), "f"}, "b", true},
+		{"INCRBY", []interface{}{1, 2}, "1", true},
+		{"auth", []interface{}{"password"}, "", false},
+		{"EVALSHA", []interface{}{"sha", 1, "a"}, "a", true},
+		{"EVAL", []interface{}{"return 1", 0}, "", false},
+		{"PING", nil, "", false},
+	} {
+		if key, ok := commandKey(tc.cmd, tc.args); key != tc.key || ok != tc.ok {
+			t.Errorf("commandKey(%s, %v) want %q %v, got %q %v", tc.cmd, tc.args, tc.key, tc.ok, key, ok)
+		}
+	}
+	if commandSignature("get", []interface{}{"a"}) != commandSignature("GET", []interface{}{[]byte("a")}) {
+		t.Error("signatures of the same command differ")
+	}
+	if commandSignature("HGET", []interface{}{"a", "f1"}) == commandSignature("HGET", []interface{}{"a", "f2"}) {
+		t.Error("signatures of the different fields equal")
+	}
+}
+
+func TestCommandKeys(t *testing.T) {
+	for _, tc := range []struct {
+		cmd  string
+		args []interface{}
+		keys []string
+	}{
+		{"DEL", []interface{}{"k1", "k2"}, []string{"k1", "k2"}},
+		{"mset", []interface{}{"k1", "v1", "k2", "v2"}, []string{"k1", "k2"}},
+		{"EVAL", []interface{}{"script", 2, "k1", "k2", "arg"}, []string{"k1", "k2"}},
+		{"EVALSHA", []interface{}{"sha", "x", "k1"}, nil},
+		{"ZUNIONSTORE", []interface{}{"dst", 2, "k1", "k2", "WEIGHTS", 1, 2}, []string{"dst", "k1", "k2"}},
+		{"BITOP", []interface{}{"AND", "dst", "k1", "k2"}, []string{"dst", "k1", "k2"}},
+		{"BLPOP", []interface{}{"k1", "k2", 0}, []string{"k1", "k2"}},
+		{"RENAME", []interface{}{"k1", "k2"}, []string{"k1", "k2"}},
+		{"SET", []interface{}{"k1", "v1"}, []string{"k1"}},
+	} {
+		if keys := commandKeys(tc.cmd, tc.args); !reflect.DeepEqual(keys, tc.keys) {
+			t.Errorf("commandKeys(%s, %v) want %q, got %q", tc.cmd, tc.args, tc.keys, keys)
+		}
+	}
+}
+
+func TestCloneReply(t *testing.T) {
+	reply := []interface{}{[]byte("a"), int64(1), []interface{}{[]byte("b")}}
+	clone := cloneReply(reply).([]interface{})
+	if !reflect.DeepEqual(clone, reply) {
+		t.Fatalf("clone %v want %v", clone, reply)
+	}
+	clone[0].([]byte)[0] = 'x'
+	clone[2].([]interface{})[0].([]byte)[0] = 'y'
+	if string(reply[0].([]byte)) != "a" || string(reply[2].([]interface{})[0].([]byte)) != "b" {
+		t.Fatalf("modified the reply by its clone %v", reply)
+	}
+}
+
+// okConn replies OK to every command without a server.
+type okConn struct{}
+
+func (okConn) Close() error                                   { return nil }
+func (okConn) Err() error                                     { return nil }
+func (okConn) Do(string, ...interface{}) (interface{}, error) { return "OK", nil }
+func (okConn) Send(string, ...interface{}) error              { return nil }
+func (okConn) Flush() error                                   { return nil }
+func (okConn) Receive() (interface{}, error)                  { return "OK", nil }
+func (c okConn) WithContext(ctx context.Context) Conn         { return c }
+
+func TestPooledConnInvalidate(t *testing.T) {
+	c := &Config{HotKey: &hotkey.Config{Threshold: 1, LocalTTL: xtime.Duration(time.Minute)}}
+	p := &Pool{c: c, hot: hotkey.New("test_invalidate", c.HotKey)}
+	defer p.hot.Close()
+	promote := func(keys ...string) {
+		for _, key := range keys {
+			p.hot.Add(key)
+			p.hot.Store(key, "v", p.hot.Version(key))
+		}
+	}
+	promoted := func(key string) bool {
+		_, ok := p.hot.Load(key)
+		return ok
+	}
+	pc := &pooledConnection{p: p, c: okConn{}, rc: okConn{}, now: beginTime}
+
+	promote("k1", "k2")
+	pc.Send("DEL", "k1", "k2")
+	if !promoted("k1") {
+		t.Fatal("invalidated before the reply of DEL")
+	}
+	pc.Flush()
+	pc.Receive()
+	if promoted("k1") || promoted("k2") {
+		t.Fatal("not invalidated all the keys of DEL")
+	}
+
+	promote("k1")
+	pc.Send("MSET", "k1", "v1", "k2", "v2")
+	// Do reads the pending replies.
+	pc.Do("GET", "k3")
+	if promoted("k1") {
+		t.Fatal("not invalidated the keys of MSET by Do")
+	}
+
+	promote("k1")
+	pc.Do("MULTI")
+	pc.Do("SET", "k1", "v1")
+	if !promoted("k1") {
+		t.Fatal("invalidated by the command queued in MULTI")
+	}
+	pc.Do("EXEC")
+	if promoted("k1") {
+		t.Fatal("not invalidated on EXEC")
+	}
+
+	promote("k1")
+	pc.Do("MULTI")
+	pc.Do("SET", "k1", "v1")
+	pc.Do("DISCARD")
+	if !promoted("k1") {
+		t.Fatal("invalidated by the commands discarded")
+	}
+
+	promote("k1", "k2")
+	pc.Send("INCR", "k1")
+	pc.Do("EVAL", "script", 1, "k2")
+	if promoted("k1") || promoted("k2") {
+		t.Fatal("not invalidated the keys of EVAL")
+	}
+
+	promote("k1", "k2")
+	pc.Send("SET", "k1", "v1")
+	pc.Send("GET", "k2")
+	pc.abandon()
+	if promoted("k1") || !promoted("k2") {
+		t.Fatal("not invalidated the writes whose replies are not read")
+	}
+
+	// a read raced with a write is not promoted.
+	version := p.hot.Version("k3")
+	pc.Do("SET", "k3", "v3")
+	p.hot.Store("k3", "v", version)
+	if promoted("k3") {
+		t.Fatal("promoted the read raced with a write")
+	}
+}
+
+func TestRedisHotKey(t *testing.T) {
+	c := getTestConfig(testRedisAddr)
+	c.Config = testConfig.Config
+	c.Name = "test_hotkey"
+	c.HotKey = &hotkey.Config{
+		Threshold: 10,
+		LocalTTL:  xtime.Duration(time.Minute),
+	}
+	r := NewRedis(c)
+	defer r.Close()
+	ctx := context.TODO()
+	if _, err := r.Do(ctx, "SET", "hotkey", "v1"); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		if _, err := r.Do(ctx, "GET", "hotkey"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !r.pool.hot.Hot("hotkey") {
+		t.Fatalf("hotkey not hot, top keys %+v", r.pool.hot.TopK())
+	}
+	// promoted by this get.
+	r.Do(ctx, "GET", "hotkey")
+	other := NewRedis(testConfig)
+	defer other.Close()
+	if _, err := other.Do(ctx, "SET", "hotkey", "v2"); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := String(r.Do(ctx, "GET", "hotkey")); err != nil || v != "v1" {
+		t.Fatalf("want the local v1, got %s %v", v, err)
+	}
+	if _, err := r.Do(ctx, "SET", "hotkey", "v3"); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := String(r.Do(ctx, "GET", "hotkey")); err != nil || v != "v3" {
+		t.Fatalf("want v3 after set, got %s %v", v, err)
+	}
+}
@@ -0,0 +1,314 @@
+package redis
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	mrand "math/rand"
+	"sync"
+	"time"
+
+	"github.com/djienet/kratos/pkg/log"
+	xtime "github.com/djienet/kratos/pkg/time"
+
+	pkgerr "github.com/pkg/errors"
+)
+
+var (
+	// ErrLockNotObtained is returned by TryLock if the lock is held by others.
+	ErrLockNotObtained = pkgerr.New("redis: lock not obtained")
+	// ErrLockNotHeld is returned by Unlock if the lock expired or was taken
+	// by others.
+	ErrLockNotHeld = pkgerr.New("redis: lock not held")
+)
+
+var (
+	// KEYS[1] lock, KEYS[2] fencing counter, ARGV[1] owner, ARGV[2] ttl(ms).
+	_lockScript = NewScript(2, `
+if redis.call('SET', KEYS[1], ARGV[1], 'NX', 'PX', ARGV[2]) then
+	return redis.call('INCR', KEYS[2])
+end
+return 0`)
+	// KEYS[1] lock, ARGV[1] owner, ARGV[2] ttl(ms).
+	_renewScript = NewScript(1, `
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return 0`)
+	// KEYS[1] lock, ARGV[1] owner.
+	_unlockScript = NewScript(1, `
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0`)
+	// KEYS[1] fencing counter, ARGV[1] token.
+	_fenceScript = NewScript(1, `
+if tonumber(redis.call('GET', KEYS[1]) or '0') < tonumber(ARGV[1]) then
+	redis.call('SET', KEYS[1], ARGV[1])
+end
+return 1`)
+)
+
+// MutexConfig mutex config.
+type MutexConfig struct {
+	// TTL is the expiration of the lock, it is renewed every TTL/3 while
+	// held, default 10s.
+	TTL xtime.Duration
+	// RetryDelay is the average delay between the attempts of Lock,
+	// default 50ms.
+	RetryDelay xtime.Duration
+}
+
+func (c *MutexConfig) fix() {
+	if c.TTL <= 0 {
+		c.TTL = xtime.Duration(10 * time.Second)
+	}
+	if c.RetryDelay <= 0 {
+		c.RetryDelay = xtime.Duration(50 * time.Millisecond)
+	}
+}
+
+// Mutex is a distributed lock of key. With several independent redis it
+// works in the Redlock mode, the lock is held if the majority of them are
+// locked within the TTL.
+type Mutex struct {
+	key    string
+	fence  string
+	conf   *MutexConfig
+	rs     []*Redis
+	quorum int
+}
+
+// NewMutex new a mutex of key over rs, the fencing counter is stored in
+// the key suffixed with :fence.
+func NewMutex(key string, c *MutexConfig, rs ...*Redis) *Mutex {
+	if len(rs) == 0 {
+		panic("redis: mutex needs at least one redis")
+	}
+	if c == nil {
+		c = &MutexConfig{}
+	}
+	c.fix()
+	return &Mutex{
+		key:    key,
+		fence:  key + ":fence",
+		conf:   c,
+		rs:     rs,
+		quorum: len(rs)/2 + 1,
+	}
+}
+
+// Lock blocks until the lock is obtained or ctx is done.
+func (m *Mutex) Lock(c context.Context) (*Lock, error) {
+	delay := int64(m.conf.RetryDelay)
+	for {
+		l, err := m.TryLock(c)
+		if err != ErrLockNotObtained {
+			return l, err
+		}
+		select {
+		case <-time.After(time.Duration(delay/2 + mrand.Int63n(delay))):
+		case <-c.Done():
+			return nil, c.Err()
+		}
+	}
+}
+
+// TryLock tries to obtain the lock once, ErrLockNotObtained is returned if
+// it is held by others.
+func (m *Mutex) TryLock(c context.Context) (*Lock, error) {
+	owner, err := lockOwner()
+	if err != nil {
+		return nil, err
+	}
+	ttl := time.Duration(m.conf.TTL)
+	start := time.Now()
+	tokens := make([]int64, len(m.rs))
+	errs := m.each(func(i int, r *Redis) (err error) {
+		tokens[i], err = Int64(m.eval(c, r, _lockScript, m.key, m.fence, owner, int64(ttl/time.Millisecond)))
+		return
+	})
+	var (
+		n     int
+		token int64
+		err1  error
+	)
+	for i, t := range tokens {
+		if errs[i] != nil {
+			err1 = errs[i]
+			continue
+		}
+		if t > 0 {
+			n++
+		}
+		if t > token {
+			token = t
+		}
+	}
+	// the clock drift of redis is taken into account as Redlock does.
+	drift := ttl/100 + 2*time.Millisecond
+	validity := ttl - time.Since(start) - drift
+	if n < m.quorum || validity <= 0 {
+		m.release(c, owner)
+		if n == 0 && err1 != nil {
+			return nil, err1
+		}
+		return nil, ErrLockNotObtained
+	}
+	if len(m.rs) > 1 {
+		// raises the counters of the quorum, the next quorum overlaps one of
+		// them at least so its token is greater.
+		m.each(func(i int, r *Redis) (err error) {
+			if tokens[i] > 0 {
+				_, err = m.eval(c, r, _fenceScript, m.fence, token)
+			}
+			return
+		})
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	l := &Lock{
+		m:      m,
+		owner:  owner,
+		token:  token,
+		lost:   make(chan struct{}),
+		cancel: cancel,
+	}
+	l.wg.Add(1)
+	go l.renewproc(ctx)
+	return l, nil
+}
+
+func (m *Mutex) eval(c context.Context, r *Redis, s *Script, keysAndArgs ...interface{}) (interface{}, error) {
+	conn := r.Conn(c)
+	defer conn.Close()
+	return s.Do(conn, keysAndArgs...)
+}
+
+// each calls f on all the redis concurrently.
+func (m *Mutex) each(f func(i int, r *Redis) error) []error {
+	errs := make([]error, len(m.rs))
+	if len(m.rs) == 1 {
+		errs[0] = f(0, m.rs[0])
+		return errs
+	}
+	var wg sync.WaitGroup
+	for i, r := range m.rs {
+		wg.Add(1)
+		go func(i int, r *Redis) {
+			defer wg.Done()
+			errs[i] = f(i, r)
+		}(i, r)
+	}
+	wg.Wait()
+	return errs
+}
+
+// count runs the script on all the redis and counts the positive replies.
+func (m *Mutex) count(c context.Context, s *Script, keysAndArgs ...interface{}) (n int, err error) {
+	var mu sync.Mutex
+	errs := m.each(func(i int, r *Redis) error {
+		v, err := Int64(m.eval(c, r, s, keysAndArgs...))
+		if err == nil && v > 0 {
+			mu.Lock()
+			n++
+			mu.Unlock()
+		}
+		return err
+	})
+	for _, e := range errs {
+		if e != nil {
+			err = e
+		}
+	}
+	return
+}
+
+func (m *Mutex) release(c context.Context, owner string) (n int, err error) {
+	return m.count(c, _unlockScript, m.key, owner)
+}
+
+func lockOwner() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", pkgerr.WithStack(err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Lock is an obtained lock of Mutex, it is renewed in the background until
+// Unlock or it is lost.
+type Lock struct {
+	m      *Mutex
+	owner  string
+	token  int64
+	lost   chan struct{}
+	cancel func()
+	wg     sync.WaitGroup
+}
+
+// Token returns the fencing token, it increases monotonically with each
+// lock of the key, the storages guarded by the lock should reject the
+// writes with a token less than the one seen.
+func (l *Lock) Token() int64 {
+	return l.token
+}
+
+// Owner returns the random owner of the lock.
+func (l *Lock) Owner() string {
+	return l.owner
+}
+
+// Lost returns a channel which is closed if the lock is lost since the
+// renewal failed, the work under the lock should be stopped.
+func (l *Lock) Lost() <-chan struct{} {
+	return l.lost
+}
+
+// Unlock stops the renewal and releases the lock, ErrLockNotHeld is
+// returned if the lock was lost.
+func (l *Lock) Unlock(c context.Context) error {
+	l.cancel()
+	l.wg.Wait()
+	n, err := l.m.release(c, l.owner)
+	if n >= l.m.quorum {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return ErrLockNotHeld
+}
+
+func (l *Lock) renewproc(c context.Context) {
+	defer l.wg.Done()
+	ttl := time.Duration(l.m.conf.TTL)
+	ticker := time.NewTicker(ttl / 3)
+	defer ticker.Stop()
+	deadline := time.Now().Add(ttl)
+	for {
+		select {
+		case <-ticker.C:
+		case <-c.Done():
+			return
+		}
+		start := time.Now()
+		rc, cancel := context.WithTimeout(c, ttl/3)
+		n, err := l.m.count(rc, _renewScript, l.m.key, l.owner, int64(ttl/time.Millisecond))
+		cancel()
+		if c.Err() != nil {
+			return
+		}
+		if n >= l.m.quorum {
+			deadline = start.Add(ttl)
+			continue
+		}
+		// retries on the errors until the lock expires.
+		if err != nil && time.Until(deadline) > ttl/3 {
+			log.Warn("redis: renew lock(%s) error(%v)", l.m.key, err)
+			continue
+		}
+		log.Error("redis: lock(%s) lost, renewed(%d) quorum(%d) error(%v)", l.m.key, n, l.m.quorum, err)
+		close(l.lost)
+		return
+	}
+}
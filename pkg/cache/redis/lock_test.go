@@ -0,0 +1,84 @@
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	xtime "github.com/djienet/kratos/pkg/time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMutex(t *testing.T) {
+	r := NewRedis(testConfig)
+	defer r.Close()
+	c := context.Background()
+	r.Do(c, "DEL", "mutex", "mutex:fence")
+	conf := &MutexConfig{TTL: xtime.Duration(300 * time.Millisecond), RetryDelay: xtime.Duration(10 * time.Millisecond)}
+	m := NewMutex("mutex", conf, r)
+
+	l, err := m.Lock(c)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), l.Token())
+	_, err = m.TryLock(c)
+	assert.Equal(t, ErrLockNotObtained, err)
+
+	// held longer than the ttl by the renewal.
+	time.Sleep(time.Second)
+	ctx, cancel := context.WithTimeout(c, 50*time.Millisecond)
+	_, err = m.Lock(ctx)
+	cancel()
+	assert.Equal(t, context.DeadlineExceeded, err)
+	select {
+	case <-l.Lost():
+		t.Fatal("lock lost")
+	default:
+	}
+	assert.Nil(t, l.Unlock(c))
+	assert.Equal(t, ErrLockNotHeld, l.Unlock(c))
+
+	l, err = m.TryLock(c)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), l.Token())
+	// taken by others.
+	r.Do(c, "SET", "mutex", "other")
+	select {
+	case <-l.Lost():
+	case <-time.After(time.Second):
+		t.Fatal("lock not lost")
+	}
+	assert.Equal(t, ErrLockNotHeld, l.Unlock(c))
+}
+
+func TestRedlock(t *testing.T) {
+	var rs []*Redis
+	for db := 1; db <= 3; db++ {
+		r := NewRedis(testConfig, DialDatabase(db))
+		defer r.Close()
+		r.Do(context.Background(), "DEL", "redlock", "redlock:fence")
+		rs = append(rs, r)
+	}
+	c := context.Background()
+	m := NewMutex("redlock", nil, rs...)
+	// the fencing counter of one of them is ahead.
+	rs[0].Do(c, "SET", "redlock:fence", 10)
+	l, err := m.Lock(c)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(11), l.Token())
+	assert.Nil(t, l.Unlock(c))
+
+	// the minority is held by others.
+	rs[0].Do(c, "SET", "redlock", "other")
+	l, err = m.TryLock(c)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(12), l.Token())
+	assert.Nil(t, l.Unlock(c))
+
+	// the majority is held by others.
+	rs[1].Do(c, "SET", "redlock", "other")
+	_, err = m.TryLock(c)
+	assert.Equal(t, ErrLockNotObtained, err)
+	owner, _ := String(rs[2].Do(c, "GET", "redlock"))
+	assert.Equal(t, "", owner)
+}
@@ -5,21 +5,44 @@ import (
 	"errors"
 )
 
+const _defaultPipelineBatch = 1000
+
 type Pipeliner interface {
 	// Send writes the command to the client's output buffer.
 	Send(commandName string, args ...interface{})
 
-	// Exec executes all commands and get replies.
+	// SendCmd is Send returning the future of the reply, which is resolved
+	// by Exec. The typed versions convert the reply like the reply helpers.
+	SendCmd(commandName string, args ...interface{}) *Cmd
+	SendString(commandName string, args ...interface{}) *StringCmd
+	SendBytes(commandName string, args ...interface{}) *BytesCmd
+	SendInt(commandName string, args ...interface{}) *IntCmd
+	SendFloat(commandName string, args ...interface{}) *FloatCmd
+	SendBool(commandName string, args ...interface{}) *BoolCmd
+	SendStrings(commandName string, args ...interface{}) *StringsCmd
+	SendStringMap(commandName string, args ...interface{}) *StringMapCmd
+
+	// Exec executes all commands and get replies. The commands are written
+	// in batches of Config.PipelineBatch, each batch is a round trip.
 	Exec(ctx context.Context) (rs *Replies, err error)
 }
 
 var (
 	ErrNoReply = errors.New("redis: no reply in result set")
+	// ErrNotExecuted is returned by the futures of the commands not executed.
+	ErrNotExecuted = errors.New("redis: command not executed")
+	// ErrTxFailed is returned by the transactional pipeline if the watched
+	// keys were modified before EXEC.
+	ErrTxFailed = errors.New("redis: transaction failed")
 )
 
 type pipeliner struct {
 	pool *Pool
-	cmds []*cmd
+	// conn is used instead of pool if not nil.
+	conn  Conn
+	tx    bool
+	batch int
+	cmds  []*Cmd
 }
 
 type Replies struct {
@@ -44,42 +67,234 @@ func (rs *Replies) Scan() (reply interface{}, err error) {
 	return
 }
 
-type cmd struct {
+// Cmd is the future reply of a pipelined command.
+type Cmd struct {
 	commandName string
 	args        []interface{}
+	reply       interface{}
+	err         error
+	done        bool
+}
+
+// Reply returns the reply and the error of the command, a redis error reply
+// is returned as Error.
+func (c *Cmd) Reply() (interface{}, error) {
+	if !c.done {
+		return nil, ErrNotExecuted
+	}
+	return c.reply, c.err
 }
 
+// Err returns the error of the command.
+func (c *Cmd) Err() error {
+	_, err := c.Reply()
+	return err
+}
+
+// StringCmd is the future of a string reply.
+type StringCmd struct{ *Cmd }
+
+// Result returns the reply converted by String.
+func (c *StringCmd) Result() (string, error) { return String(c.Reply()) }
+
+// BytesCmd is the future of a bulk string reply.
+type BytesCmd struct{ *Cmd }
+
+// Result returns the reply converted by Bytes.
+func (c *BytesCmd) Result() ([]byte, error) { return Bytes(c.Reply()) }
+
+// IntCmd is the future of an integer reply.
+type IntCmd struct{ *Cmd }
+
+// Result returns the reply converted by Int64.
+func (c *IntCmd) Result() (int64, error) { return Int64(c.Reply()) }
+
+// FloatCmd is the future of a float reply.
+type FloatCmd struct{ *Cmd }
+
+// Result returns the reply converted by Float64.
+func (c *FloatCmd) Result() (float64, error) { return Float64(c.Reply()) }
+
+// BoolCmd is the future of a boolean reply.
+type BoolCmd struct{ *Cmd }
+
+// Result returns the reply converted by Bool.
+func (c *BoolCmd) Result() (bool, error) { return Bool(c.Reply()) }
+
+// StringsCmd is the future of a multi bulk reply of strings.
+type StringsCmd struct{ *Cmd }
+
+// Result returns the reply converted by Strings.
+func (c *StringsCmd) Result() ([]string, error) { return Strings(c.Reply()) }
+
+// StringMapCmd is the future of a multi bulk reply of key value pairs.
+type StringMapCmd struct{ *Cmd }
+
+// Result returns the reply converted by StringMap.
+func (c *StringMapCmd) Result() (map[string]string, error) { return StringMap(c.Reply()) }
+
 func (p *pipeliner) Send(commandName string, args ...interface{}) {
-	p.cmds = append(p.cmds, &cmd{commandName: commandName, args: args})
-	return
+	p.SendCmd(commandName, args...)
+}
+
+func (p *pipeliner) SendCmd(commandName string, args ...interface{}) *Cmd {
+	c := &Cmd{commandName: commandName, args: args}
+	p.cmds = append(p.cmds, c)
+	return c
+}
+
+func (p *pipeliner) SendString(commandName string, args ...interface{}) *StringCmd {
+	return &StringCmd{p.SendCmd(commandName, args...)}
+}
+
+func (p *pipeliner) SendBytes(commandName string, args ...interface{}) *BytesCmd {
+	return &BytesCmd{p.SendCmd(commandName, args...)}
+}
+
+func (p *pipeliner) SendInt(commandName string, args ...interface{}) *IntCmd {
+	return &IntCmd{p.SendCmd(commandName, args...)}
+}
+
+func (p *pipeliner) SendFloat(commandName string, args ...interface{}) *FloatCmd {
+	return &FloatCmd{p.SendCmd(commandName, args...)}
+}
+
+func (p *pipeliner) SendBool(commandName string, args ...interface{}) *BoolCmd {
+	return &BoolCmd{p.SendCmd(commandName, args...)}
+}
+
+func (p *pipeliner) SendStrings(commandName string, args ...interface{}) *StringsCmd {
+	return &StringsCmd{p.SendCmd(commandName, args...)}
+}
+
+func (p *pipeliner) SendStringMap(commandName string, args ...interface{}) *StringMapCmd {
+	return &StringMapCmd{p.SendCmd(commandName, args...)}
 }
 
 func (p *pipeliner) Exec(ctx context.Context) (rs *Replies, err error) {
-	n := len(p.cmds)
-	if n == 0 {
+	cmds := p.cmds
+	p.cmds = nil
+	if len(cmds) == 0 {
 		return &Replies{}, nil
 	}
-	c := p.pool.Get(ctx)
-	defer c.Close()
-	for len(p.cmds) > 0 {
-		cmd := p.cmds[0]
-		p.cmds = p.cmds[1:]
-		if err := c.Send(cmd.commandName, cmd.args...); err != nil {
-			p.cmds = p.cmds[:0]
-			return nil, err
+	c := p.conn
+	if c == nil {
+		c = p.pool.Get(ctx)
+		defer c.Close()
+	}
+	if p.tx {
+		err = execTx(c, cmds, p.batch)
+	} else {
+		err = execCmds(c, cmds, p.batch)
+	}
+	rps := make([]*reply, 0, len(cmds))
+	for _, cmd := range cmds {
+		rps = append(rps, &reply{reply: cmd.reply, err: cmd.err})
+	}
+	return &Replies{replies: rps}, err
+}
+
+// execCmds writes cmds in batches and receives the replies of each batch.
+func execCmds(c Conn, cmds []*Cmd, batch int) error {
+	if batch <= 0 {
+		batch = _defaultPipelineBatch
+	}
+	for len(cmds) > 0 {
+		n := batch
+		if n > len(cmds) {
+			n = len(cmds)
+		}
+		chunk := cmds[:n]
+		for _, cmd := range chunk {
+			if err := c.Send(cmd.commandName, cmd.args...); err != nil {
+				failCmds(cmds, err)
+				return err
+			}
+		}
+		if err := c.Flush(); err != nil {
+			failCmds(cmds, err)
+			return err
 		}
+		for _, cmd := range chunk {
+			cmd.reply, cmd.err = c.Receive()
+			cmd.done = true
+		}
+		cmds = cmds[n:]
 	}
-	if err = c.Flush(); err != nil {
-		p.cmds = p.cmds[:0]
-		return nil, err
+	return nil
+}
+
+// execTx executes cmds wrapped in MULTI/EXEC, the replies of cmds are taken
+// from the reply of EXEC.
+func execTx(c Conn, cmds []*Cmd, batch int) error {
+	multi, exec := &Cmd{commandName: "MULTI"}, &Cmd{commandName: "EXEC"}
+	queued := make([]*Cmd, 0, len(cmds)+2)
+	queued = append(queued, multi)
+	for _, cmd := range cmds {
+		queued = append(queued, &Cmd{commandName: cmd.commandName, args: cmd.args})
 	}
-	rps := make([]*reply, 0, n)
-	for i := 0; i < n; i++ {
-		rp, err := c.Receive()
-		rps = append(rps, &reply{reply: rp, err: err})
+	queued = append(queued, exec)
+	if err := execCmds(c, queued, batch); err != nil {
+		failCmds(cmds, err)
+		return err
 	}
-	rs = &Replies{
-		replies: rps,
+	if exec.err != nil {
+		// EXECABORT, the errors of queueing are more helpful.
+		for i, cmd := range cmds {
+			if cmd.err = queued[i+1].err; cmd.err == nil {
+				cmd.err = exec.err
+			}
+			cmd.done = true
+		}
+		return exec.err
 	}
-	return
+	if exec.reply == nil {
+		failCmds(cmds, ErrTxFailed)
+		return ErrTxFailed
+	}
+	values, err := Values(exec.reply, nil)
+	if err == nil && len(values) != len(cmds) {
+		err = protocolError("unexpected EXEC reply length")
+	}
+	if err != nil {
+		failCmds(cmds, err)
+		return err
+	}
+	for i, cmd := range cmds {
+		if e, ok := values[i].(Error); ok {
+			cmd.err = e
+		} else {
+			cmd.reply = values[i]
+		}
+		cmd.done = true
+	}
+	return nil
+}
+
+func failCmds(cmds []*Cmd, err error) {
+	for _, cmd := range cmds {
+		if !cmd.done {
+			cmd.err = err
+			cmd.done = true
+		}
+	}
+}
+
+// Tx is a transaction on a connection watching keys.
+type Tx struct {
+	conn  Conn
+	batch int
+}
+
+// Do executes the command on the connection of the transaction, usually to
+// read the watched keys.
+func (tx *Tx) Do(commandName string, args ...interface{}) (interface{}, error) {
+	return tx.conn.Do(commandName, args...)
+}
+
+// Pipeline returns a pipeline executed in MULTI/EXEC on the connection of
+// the transaction, its Exec returns ErrTxFailed if the watched keys were
+// modified.
+func (tx *Tx) Pipeline() Pipeliner {
+	return &pipeliner{conn: tx.conn, tx: true, batch: tx.batch}
 }
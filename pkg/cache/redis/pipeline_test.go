@@ -55,6 +55,111 @@ func TestRedis_Pipeline(t *testing.T) {
 	}
 }
 
+func TestPipelineFutures(t *testing.T) {
+	conf := *testConfig
+	conf.PipelineBatch = 3
+	r := NewRedis(&conf)
+	defer r.Close()
+	r.Do(context.TODO(), "DEL", "pipe_a", "pipe_h")
+
+	p := r.Pipeline()
+	set := p.SendString("SET", "pipe_a", "1")
+	get := p.SendString("GET", "pipe_a")
+	var incrs []*IntCmd
+	for i := 0; i < 5; i++ {
+		incrs = append(incrs, p.SendInt("INCR", "pipe_a"))
+	}
+	p.Send("HSET", "pipe_h", "f", "v")
+	wrong := p.SendInt("INCR", "pipe_h")
+	hget := p.SendBytes("HGET", "pipe_h", "f")
+	if _, err := get.Result(); err != ErrNotExecuted {
+		t.Fatalf("want ErrNotExecuted before Exec, got %v", err)
+	}
+	rs, err := p.Exec(context.TODO())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s, err := set.Result(); err != nil || s != "OK" {
+		t.Fatalf("SET want OK, got %s %v", s, err)
+	}
+	if s, err := get.Result(); err != nil || s != "1" {
+		t.Fatalf("GET want 1, got %s %v", s, err)
+	}
+	for i, incr := range incrs {
+		if n, err := incr.Result(); err != nil || n != int64(i+2) {
+			t.Fatalf("INCR want %d, got %d %v", i+2, n, err)
+		}
+	}
+	if _, ok := wrong.Err().(Error); !ok {
+		t.Fatalf("want the error reply, got %v", wrong.Err())
+	}
+	if b, err := hget.Result(); err != nil || string(b) != "v" {
+		t.Fatalf("HGET want v, got %s %v", b, err)
+	}
+	// the replies are in order as well.
+	var n int
+	for rs.Next() {
+		rs.Scan()
+		n++
+	}
+	if n != 10 {
+		t.Fatalf("want 10 replies, got %d", n)
+	}
+}
+
+func TestTxPipeline(t *testing.T) {
+	r := NewRedis(testConfig)
+	defer r.Close()
+	r.Do(context.TODO(), "DEL", "pipe_tx")
+
+	p := r.TxPipeline()
+	first := p.SendInt("INCR", "pipe_tx")
+	second := p.SendInt("INCR", "pipe_tx")
+	if _, err := p.Exec(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := first.Result(); err != nil || n != 1 {
+		t.Fatalf("want 1, got %d %v", n, err)
+	}
+	if n, err := second.Result(); err != nil || n != 2 {
+		t.Fatalf("want 2, got %d %v", n, err)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	r := NewRedis(testConfig)
+	defer r.Close()
+	r.Do(context.TODO(), "SET", "pipe_watch", "1")
+
+	var set *StringCmd
+	err := r.Watch(context.TODO(), func(tx *Tx) error {
+		if _, err := String(tx.Do("GET", "pipe_watch")); err != nil {
+			return err
+		}
+		// modified by others.
+		r.Do(context.TODO(), "SET", "pipe_watch", "2")
+		p := tx.Pipeline()
+		set = p.SendString("SET", "pipe_watch", "3")
+		_, err := p.Exec(context.TODO())
+		return err
+	}, "pipe_watch")
+	if err != ErrTxFailed || set.Err() != ErrTxFailed {
+		t.Fatalf("want ErrTxFailed, got %v %v", err, set.Err())
+	}
+	err = r.Watch(context.TODO(), func(tx *Tx) error {
+		p := tx.Pipeline()
+		set = p.SendString("SET", "pipe_watch", "3")
+		_, err := p.Exec(context.TODO())
+		return err
+	}, "pipe_watch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s, _ := String(r.Do(context.TODO(), "GET", "pipe_watch")); s != "3" {
+		t.Fatalf("want 3, got %s", s)
+	}
+}
+
 func ExamplePipeliner() {
 	r := NewRedis(testConfig)
 	defer r.Close()
@@ -25,6 +25,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/djienet/kratos/pkg/cache/hotkey"
 	"github.com/djienet/kratos/pkg/container/pool"
 	"github.com/djienet/kratos/pkg/net/trace"
 	xtime "github.com/djienet/kratos/pkg/time"
@@ -43,6 +44,8 @@ type Pool struct {
 	c *Config
 	// statfunc
 	statfunc func(name, addr, cmd string, t time.Time, err error) func()
+	// hot is nil if Config.HotKey is not set.
+	hot *hotkey.Detector
 }
 
 // NewPool creates a new pool.
@@ -75,6 +78,9 @@ func NewPool(c *Config, options ...DialOption) (p *Pool) {
 		}, nil
 	}
 	p = &Pool{Slice: p1, c: c, statfunc: pstat}
+	if c.HotKey != nil {
+		p.hot = hotkey.New(c.Name, c.HotKey)
+	}
 	return
 }
 
@@ -94,6 +100,9 @@ func (p *Pool) Get(ctx context.Context) Conn {
 
 // Close releases the resources used by the pool.
 func (p *Pool) Close() error {
+	if p.hot != nil {
+		p.hot.Close()
+	}
 	return p.Slice.Close()
 }
 
@@ -105,6 +114,11 @@ type pooledConnection struct {
 
 	now  time.Time
 	cmds []string
+	// writes are the commands sent whose replies are not read yet, only kept
+	// if the replies of the hot keys are promoted.
+	writes []pendingWrite
+	// multi is the invalidation of the commands queued in MULTI.
+	multi invalidation
 }
 
 var (
@@ -176,6 +190,7 @@ func (pc *pooledConnection) Close() error {
 		}
 	}
 	_, err := c.Do("")
+	pc.abandon()
 	pc.p.Slice.Put(context.Background(), pc.rc, pc.state != 0 || c.Err() != nil)
 	return err
 }
@@ -187,15 +202,26 @@ func (pc *pooledConnection) Err() error {
 func (pc *pooledConnection) Do(commandName string, args ...interface{}) (reply interface{}, err error) {
 	now := time.Now()
 	ci := LookupCommandInfo(commandName)
+	w := pendingWrite{commandName: commandName, inv: pc.p.invalidation(commandName, args), multi: pc.state&MultiState != 0}
 	pc.state = (pc.state | ci.Set) &^ ci.Clear
+	pc.p.sample(commandName, args)
 	reply, err = pc.c.Do(commandName, args...)
 	if pc.p.statfunc != nil {
 		pc.p.statfunc(pc.p.c.Name, pc.p.c.Addr, commandName, now, err)()
 	}
+	if pc.p.hot != nil {
+		// Do reads the replies of the commands sent before.
+		for _, sent := range pc.writes {
+			pc.written(sent)
+		}
+		pc.writes = pc.writes[:0]
+		pc.written(w)
+	}
 	return
 }
 
 func (pc *pooledConnection) Send(commandName string, args ...interface{}) (err error) {
+	multi := pc.state&MultiState != 0
 	ci := LookupCommandInfo(commandName)
 	pc.state = (pc.state | ci.Set) &^ ci.Clear
 	if pc.now.Equal(beginTime) {
@@ -203,6 +229,10 @@ func (pc *pooledConnection) Send(commandName string, args ...interface{}) (err e
 		pc.now = time.Now()
 	}
 	pc.cmds = append(pc.cmds, commandName)
+	pc.p.sample(commandName, args)
+	if pc.p.hot != nil {
+		pc.writes = append(pc.writes, pendingWrite{commandName: commandName, inv: pc.p.invalidation(commandName, args), multi: multi})
+	}
 	return pc.c.Send(commandName, args...)
 }
 
@@ -219,6 +249,11 @@ func (pc *pooledConnection) Receive() (reply interface{}, err error) {
 			pc.p.statfunc(pc.p.c.Name, pc.p.c.Addr, cmd, pc.now, err)()
 		}
 	}
+	if len(pc.writes) > 0 {
+		w := pc.writes[0]
+		pc.writes = pc.writes[1:]
+		pc.written(w)
+	}
 	return
 }
 
@@ -17,6 +17,7 @@ package redis
 import (
 	"context"
 
+	"github.com/djienet/kratos/pkg/cache/hotkey"
 	"github.com/djienet/kratos/pkg/container/pool"
 	xtime "github.com/djienet/kratos/pkg/time"
 )
@@ -38,6 +39,12 @@ type Config struct {
 	ReadTimeout  xtime.Duration
 	WriteTimeout xtime.Duration
 	SlowLog      xtime.Duration
+	// PipelineBatch is the max commands of a round trip in Pipeline, default 1000.
+	PipelineBatch int
+	// HotKey samples the keys of the commands to find the hot ones, nil
+	// disables. The hot keys are reported by hotkey.DebugPath and logs, and
+	// the replies of the read commands by Do are promoted if LocalTTL is set.
+	HotKey *hotkey.Config
 }
 
 type Redis struct {
@@ -55,6 +62,15 @@ func NewRedis(c *Config, options ...DialOption) *Redis {
 // Do gets a new conn from pool, then execute Do with this conn, finally close this conn.
 // ATTENTION: Don't use this method with transaction command like MULTI etc. Because every Do will close conn automatically, use r.Conn to get a raw conn for this situation.
 func (r *Redis) Do(ctx context.Context, commandName string, args ...interface{}) (reply interface{}, err error) {
+	if r.pool.hot != nil {
+		return r.doLocal(func() (interface{}, error) {
+			return r.do(ctx, commandName, args...)
+		}, commandName, args)
+	}
+	return r.do(ctx, commandName, args...)
+}
+
+func (r *Redis) do(ctx context.Context, commandName string, args ...interface{}) (reply interface{}, err error) {
 	conn := r.pool.Get(ctx)
 	defer conn.Close()
 	reply, err = conn.Do(commandName, args...)
@@ -73,6 +89,36 @@ func (r *Redis) Conn(ctx context.Context) Conn {
 
 func (r *Redis) Pipeline() (p Pipeliner) {
 	return &pipeliner{
-		pool: r.pool,
+		pool:  r.pool,
+		batch: r.conf.PipelineBatch,
+	}
+}
+
+// TxPipeline returns a pipeline executed in MULTI/EXEC, the replies of the
+// commands are taken from EXEC.
+func (r *Redis) TxPipeline() (p Pipeliner) {
+	return &pipeliner{
+		pool:  r.pool,
+		tx:    true,
+		batch: r.conf.PipelineBatch,
 	}
 }
+
+// Watch watches keys on a connection and calls fn with the transaction on
+// it, the Exec of tx.Pipeline() returns ErrTxFailed if any of keys was
+// modified by others after WATCH, fn can be retried then.
+func (r *Redis) Watch(ctx context.Context, fn func(tx *Tx) error, keys ...string) (err error) {
+	conn := r.pool.Get(ctx)
+	defer conn.Close()
+	args := make(Args, 0, len(keys))
+	for _, key := range keys {
+		args = append(args, key)
+	}
+	if _, err = conn.Do("WATCH", args...); err != nil {
+		return
+	}
+	err = fn(&Tx{conn: conn, batch: r.conf.PipelineBatch})
+	// EXEC unwatches the keys, but fn may return before it.
+	conn.Do("UNWATCH")
+	return
+}
@@ -0,0 +1,37 @@
+package stream
+
+import "github.com/djienet/kratos/pkg/stat/metric"
+
+const namespace = "redis_stream"
+
+var (
+	_metricHandleDur = metric.NewHistogramVec(&metric.HistogramVecOpts{
+		Namespace: namespace,
+		Subsystem: "messages",
+		Name:      "duration_ms",
+		Help:      "redis stream messages handle duration(ms).",
+		Labels:    []string{"stream", "group"},
+		Buckets:   []float64{5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000},
+	})
+	_metricHandled = metric.NewCounterVec(&metric.CounterVecOpts{
+		Namespace: namespace,
+		Subsystem: "messages",
+		Name:      "total",
+		Help:      "redis stream messages handled count by result of ok, error and dead.",
+		Labels:    []string{"stream", "group", "result"},
+	})
+	_metricPending = metric.NewGaugeVec(&metric.GaugeVecOpts{
+		Namespace: namespace,
+		Subsystem: "group",
+		Name:      "pending",
+		Help:      "redis stream messages delivered but not acked in the group.",
+		Labels:    []string{"stream", "group"},
+	})
+	_metricLag = metric.NewGaugeVec(&metric.GaugeVecOpts{
+		Namespace: namespace,
+		Subsystem: "group",
+		Name:      "lag",
+		Help:      "redis stream messages not delivered to the group yet.",
+		Labels:    []string{"stream", "group"},
+	})
+)
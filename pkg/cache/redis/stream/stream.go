@@ -0,0 +1,442 @@
+package stream
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/djienet/kratos/pkg/cache/redis"
+	"github.com/djienet/kratos/pkg/conf/env"
+	"github.com/djienet/kratos/pkg/log"
+	"github.com/djienet/kratos/pkg/net/netutil"
+	"github.com/djienet/kratos/pkg/sync/errgroup"
+	xtime "github.com/djienet/kratos/pkg/time"
+
+	pkgerr "github.com/pkg/errors"
+)
+
+const _pendingBatch = 100
+
+// Redis is the redis used by Worker, *redis.Redis implements it.
+type Redis interface {
+	Do(c context.Context, command string, args ...interface{}) (interface{}, error)
+}
+
+// Handler handles a message, the message is acked if it returns nil,
+// otherwise it is delivered again after Config.ClaimIdle.
+type Handler func(c context.Context, msg *redis.XMessage) error
+
+// Config stream worker config.
+type Config struct {
+	Stream string
+	Group  string
+	// Consumer is the consumer name in the group, keep it stable across the
+	// restarts so the pending messages are picked up again, default hostname.
+	Consumer string
+	// StartID is the id the group starts from if it is created by the
+	// worker, default $ which means the new messages only.
+	StartID string
+	// Concurrency is the number of messages handled concurrently, default 10.
+	Concurrency int
+	// Block is the block time of XREADGROUP, it must be shorter than the
+	// ReadTimeout of redis, default 100ms.
+	Block xtime.Duration
+	// MaxDeliveries is the deliveries after which a failed message is moved
+	// to the dead letter stream, default 5.
+	MaxDeliveries int64
+	// DeadLetter is the dead letter stream, default {Stream}:dead.
+	DeadLetter string
+	// ClaimIdle is the idle time after which a pending message is claimed
+	// and delivered again, from this consumer or a dead one, default 1m.
+	ClaimIdle xtime.Duration
+	// ClaimInterval is the interval of claiming and reporting the lag and
+	// pending metrics, default 10s.
+	ClaimInterval xtime.Duration
+}
+
+func (c *Config) fix() {
+	if c.Consumer == "" {
+		c.Consumer = env.Hostname
+	}
+	if c.StartID == "" {
+		c.StartID = "$"
+	}
+	if c.Concurrency <= 0 {
+		c.Concurrency = 10
+	}
+	if c.Block <= 0 {
+		c.Block = xtime.Duration(100 * time.Millisecond)
+	}
+	if c.MaxDeliveries <= 0 {
+		c.MaxDeliveries = 5
+	}
+	if c.DeadLetter == "" {
+		c.DeadLetter = c.Stream + ":dead"
+	}
+	if c.ClaimIdle <= 0 {
+		c.ClaimIdle = xtime.Duration(time.Minute)
+	}
+	if c.ClaimInterval <= 0 {
+		c.ClaimInterval = xtime.Duration(10 * time.Second)
+	}
+}
+
+// Worker consumes a stream as a consumer of the group.
+type Worker struct {
+	conf    *Config
+	r       Redis
+	handler Handler
+	// sem holds a slot for each message read or claimed but not handled.
+	sem    chan struct{}
+	g      *errgroup.Group
+	procs  sync.WaitGroup
+	ctx    context.Context
+	cancel func()
+}
+
+// New new a stream worker, it starts consuming after Start.
+func New(r Redis, c *Config, h Handler) *Worker {
+	c.fix()
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Worker{
+		conf:    c,
+		r:       r,
+		handler: h,
+		sem:     make(chan struct{}, c.Concurrency),
+		g:       errgroup.WithContext(context.Background()),
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+}
+
+// Start creates the group if it does not exist and starts consuming.
+func (w *Worker) Start() (err error) {
+	if _, err = w.r.Do(w.ctx, "XGROUP", "CREATE", w.conf.Stream, w.conf.Group, w.conf.StartID, "MKSTREAM"); err != nil {
+		if !strings.Contains(err.Error(), "BUSYGROUP") {
+			return pkgerr.WithStack(err)
+		}
+		err = nil
+	}
+	w.procs.Add(2)
+	go w.readproc()
+	go w.claimproc()
+	return
+}
+
+// Close stops reading and claiming, and waits for the messages in flight.
+func (w *Worker) Close() error {
+	w.cancel()
+	w.procs.Wait()
+	return w.g.Wait()
+}
+
+// acquire blocks for a free slot and takes up to max slots.
+func (w *Worker) acquire(max int) (n int, ok bool) {
+	select {
+	case w.sem <- struct{}{}:
+		n++
+	case <-w.ctx.Done():
+		return 0, false
+	}
+	for n < max {
+		select {
+		case w.sem <- struct{}{}:
+			n++
+		default:
+			return n, true
+		}
+	}
+	return n, true
+}
+
+func (w *Worker) release(n int) {
+	for i := 0; i < n; i++ {
+		<-w.sem
+	}
+}
+
+func (w *Worker) readproc() {
+	defer w.procs.Done()
+	backoff := &netutil.BackoffConfig{MaxDelay: 5 * time.Second, BaseDelay: 100 * time.Millisecond, Factor: 1.6, Jitter: 0.2}
+	for retries := 0; ; {
+		n, ok := w.acquire(w.conf.Concurrency)
+		if !ok {
+			return
+		}
+		msgs, err := w.read(n)
+		w.release(n - len(msgs))
+		if err != nil {
+			if w.ctx.Err() != nil {
+				return
+			}
+			log.Error("stream: XREADGROUP stream(%s) group(%s) error(%v)", w.conf.Stream, w.conf.Group, err)
+			select {
+			case <-time.After(backoff.Backoff(retries)):
+			case <-w.ctx.Done():
+				return
+			}
+			retries++
+			continue
+		}
+		retries = 0
+		for i := range msgs {
+			w.dispatch(msgs[i])
+		}
+	}
+}
+
+func (w *Worker) read(count int) ([]redis.XMessage, error) {
+	reply, err := w.r.Do(w.ctx, "XREADGROUP", "GROUP", w.conf.Group, w.conf.Consumer,
+		"COUNT", count, "BLOCK", int64(time.Duration(w.conf.Block)/time.Millisecond),
+		"STREAMS", w.conf.Stream, ">")
+	if err != nil || reply == nil {
+		return nil, err
+	}
+	streams, err := redis.Values(reply, nil)
+	if err != nil || len(streams) == 0 {
+		return nil, err
+	}
+	stream, err := redis.Values(streams[0], nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(stream) != 2 {
+		return nil, pkgerr.New("stream: XREADGROUP expects pairs of stream and messages")
+	}
+	return redis.XMessages(stream[1], nil)
+}
+
+// dispatch handles the message with the slot acquired for it.
+func (w *Worker) dispatch(msg redis.XMessage) {
+	w.g.Go(func(c context.Context) error {
+		defer w.release(1)
+		w.handle(c, &msg)
+		return nil
+	})
+}
+
+func (w *Worker) handle(c context.Context, msg *redis.XMessage) {
+	// the message was deleted while pending.
+	if msg.Values == nil {
+		w.ack(c, msg.ID)
+		return
+	}
+	now := time.Now()
+	err := w.call(c, msg)
+	_metricHandleDur.Observe(int64(time.Since(now)/time.Millisecond), w.conf.Stream, w.conf.Group)
+	if err != nil {
+		_metricHandled.Inc(w.conf.Stream, w.conf.Group, "error")
+		log.Error("stream: handle message(%s) of stream(%s) group(%s) error(%v)", msg.ID, w.conf.Stream, w.conf.Group, err)
+		return
+	}
+	_metricHandled.Inc(w.conf.Stream, w.conf.Group, "ok")
+	w.ack(c, msg.ID)
+}
+
+func (w *Worker) call(c context.Context, msg *redis.XMessage) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			buf := make([]byte, 64<<10)
+			buf = buf[:runtime.Stack(buf, false)]
+			err = fmt.Errorf("stream: panic recovered: %v\n%s", r, buf)
+		}
+	}()
+	return w.handler(c, msg)
+}
+
+func (w *Worker) ack(c context.Context, id string) {
+	if _, err := w.r.Do(c, "XACK", w.conf.Stream, w.conf.Group, id); err != nil {
+		log.Error("stream: XACK message(%s) of stream(%s) group(%s) error(%v)", id, w.conf.Stream, w.conf.Group, err)
+	}
+}
+
+// claimproc claims the idle pending messages and reports the metrics.
+func (w *Worker) claimproc() {
+	defer w.procs.Done()
+	ticker := time.NewTicker(time.Duration(w.conf.ClaimInterval))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			w.claim()
+			w.stat()
+		case <-w.ctx.Done():
+			return
+		}
+	}
+}
+
+type pending struct {
+	id         string
+	idle       time.Duration
+	deliveries int64
+}
+
+// claim walks the pending list of the group, the idle messages delivered
+// MaxDeliveries times are moved to the dead letter stream, the others are
+// claimed by this consumer and delivered again.
+func (w *Worker) claim() {
+	for start := "-"; w.ctx.Err() == nil; {
+		ps, err := w.pending(start)
+		if err != nil {
+			log.Error("stream: XPENDING stream(%s) group(%s) error(%v)", w.conf.Stream, w.conf.Group, err)
+			return
+		}
+		var ids []string
+		for _, p := range ps {
+			if p.idle < time.Duration(w.conf.ClaimIdle) {
+				continue
+			}
+			if p.deliveries >= w.conf.MaxDeliveries {
+				w.dead(p)
+				continue
+			}
+			ids = append(ids, p.id)
+		}
+		for len(ids) > 0 {
+			n, ok := w.acquire(len(ids))
+			if !ok {
+				return
+			}
+			msgs, err := w.xclaim(ids[:n])
+			w.release(n - len(msgs))
+			if err != nil {
+				log.Error("stream: XCLAIM stream(%s) group(%s) error(%v)", w.conf.Stream, w.conf.Group, err)
+				return
+			}
+			for i := range msgs {
+				w.dispatch(msgs[i])
+			}
+			ids = ids[n:]
+		}
+		if len(ps) < _pendingBatch {
+			return
+		}
+		last := ps[len(ps)-1].id
+		if start = nextID(last); start == last {
+			return
+		}
+	}
+}
+
+func (w *Worker) pending(start string) (ps []pending, err error) {
+	values, err := redis.Values(w.r.Do(w.ctx, "XPENDING", w.conf.Stream, w.conf.Group, start, "+", _pendingBatch))
+	if err != nil {
+		return
+	}
+	for _, v := range values {
+		var (
+			entry []interface{}
+			p     pending
+			idle  int64
+		)
+		if entry, err = redis.Values(v, nil); err != nil {
+			return
+		}
+		if len(entry) != 4 {
+			return nil, pkgerr.New("stream: XPENDING expects id, consumer, idle and deliveries")
+		}
+		if p.id, err = redis.String(entry[0], nil); err != nil {
+			return
+		}
+		if idle, err = redis.Int64(entry[2], nil); err != nil {
+			return
+		}
+		if p.deliveries, err = redis.Int64(entry[3], nil); err != nil {
+			return
+		}
+		p.idle = time.Duration(idle) * time.Millisecond
+		ps = append(ps, p)
+	}
+	return
+}
+
+// xclaim claims the messages still idle, the other consumers may have
+// claimed them in between.
+func (w *Worker) xclaim(ids []string) ([]redis.XMessage, error) {
+	args := redis.Args{}.Add(w.conf.Stream, w.conf.Group, w.conf.Consumer, int64(time.Duration(w.conf.ClaimIdle)/time.Millisecond))
+	for _, id := range ids {
+		args = args.Add(id)
+	}
+	return redis.XMessages(w.r.Do(w.ctx, "XCLAIM", args...))
+}
+
+// dead moves the message to the dead letter stream with the source stream,
+// id and deliveries, and acks it.
+func (w *Worker) dead(p pending) {
+	msgs, err := redis.XMessages(w.r.Do(w.ctx, "XRANGE", w.conf.Stream, p.id, p.id))
+	if err != nil {
+		log.Error("stream: XRANGE message(%s) of stream(%s) error(%v)", p.id, w.conf.Stream, err)
+		return
+	}
+	if len(msgs) > 0 {
+		args := redis.Args{}.Add(w.conf.DeadLetter, "*")
+		for k, v := range msgs[0].Values {
+			args = args.Add(k, v)
+		}
+		args = args.Add("_stream", w.conf.Stream, "_id", p.id, "_deliveries", p.deliveries)
+		if _, err = w.r.Do(w.ctx, "XADD", args...); err != nil {
+			log.Error("stream: XADD message(%s) to dead letter(%s) error(%v)", p.id, w.conf.DeadLetter, err)
+			return
+		}
+	}
+	w.ack(w.ctx, p.id)
+	_metricHandled.Inc(w.conf.Stream, w.conf.Group, "dead")
+	log.Warn("stream: message(%s) of stream(%s) group(%s) moved to dead letter(%s) after %d deliveries", p.id, w.conf.Stream, w.conf.Group, w.conf.DeadLetter, p.deliveries)
+}
+
+// stat reports the pending count and the lag of the group, the lag is only
+// available since redis 7.0.
+func (w *Worker) stat() {
+	summary, err := redis.Values(w.r.Do(w.ctx, "XPENDING", w.conf.Stream, w.conf.Group))
+	if err == nil && len(summary) > 0 {
+		var count int64
+		if count, err = redis.Int64(summary[0], nil); err == nil {
+			_metricPending.Set(float64(count), w.conf.Stream, w.conf.Group)
+		}
+	}
+	if err != nil {
+		log.Error("stream: XPENDING stream(%s) group(%s) error(%v)", w.conf.Stream, w.conf.Group, err)
+		return
+	}
+	groups, err := redis.Values(w.r.Do(w.ctx, "XINFO", "GROUPS", w.conf.Stream))
+	if err != nil {
+		log.Error("stream: XINFO GROUPS stream(%s) error(%v)", w.conf.Stream, err)
+		return
+	}
+	for _, g := range groups {
+		info, err := redis.Values(g, nil)
+		if err != nil {
+			return
+		}
+		fields := make(map[string]interface{}, len(info)/2)
+		for i := 0; i+1 < len(info); i += 2 {
+			k, _ := redis.String(info[i], nil)
+			fields[k] = info[i+1]
+		}
+		if name, _ := redis.String(fields["name"], nil); name != w.conf.Group {
+			continue
+		}
+		if lag, err := redis.Int64(fields["lag"], nil); err == nil {
+			_metricLag.Set(float64(lag), w.conf.Stream, w.conf.Group)
+		}
+		return
+	}
+}
+
+// nextID returns the smallest id after the stream id.
+func nextID(id string) string {
+	i := strings.IndexByte(id, '-')
+	if i < 0 {
+		return id
+	}
+	seq, err := strconv.ParseUint(id[i+1:], 10, 64)
+	if err != nil {
+		return id
+	}
+	return id[:i+1] + strconv.FormatUint(seq+1, 10)
+}
@@ -0,0 +1,368 @@
+package stream
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/djienet/kratos/pkg/cache/redis"
+	xtime "github.com/djienet/kratos/pkg/time"
+)
+
+type fakePending struct {
+	consumer  string
+	delivered time.Time
+	count     int64
+}
+
+type fakeGroup struct {
+	next int
+	pel  map[string]*fakePending
+}
+
+type fakeStream struct {
+	ids    []string
+	values map[string][]interface{}
+	groups map[string]*fakeGroup
+}
+
+// fakeRedis implements the stream commands used by Worker in memory.
+type fakeRedis struct {
+	mu      sync.Mutex
+	seq     int
+	streams map[string]*fakeStream
+}
+
+func newFakeRedis() *fakeRedis {
+	return &fakeRedis{streams: make(map[string]*fakeStream)}
+}
+
+func (f *fakeRedis) stream(key string) *fakeStream {
+	s, ok := f.streams[key]
+	if !ok {
+		s = &fakeStream{values: make(map[string][]interface{}), groups: make(map[string]*fakeGroup)}
+		f.streams[key] = s
+	}
+	return s
+}
+
+func (f *fakeRedis) add(key string, kvs ...interface{}) string {
+	f.seq++
+	id := "0-" + strconv.Itoa(f.seq)
+	s := f.stream(key)
+	s.ids = append(s.ids, id)
+	values := make([]interface{}, 0, len(kvs))
+	for _, v := range kvs {
+		values = append(values, []byte(fmt.Sprint(v)))
+	}
+	s.values[id] = values
+	return id
+}
+
+func (f *fakeRedis) entry(s *fakeStream, id string) []interface{} {
+	return []interface{}{[]byte(id), s.values[id]}
+}
+
+func seqOf(id string) int {
+	seq, _ := strconv.Atoi(id[2:])
+	return seq
+}
+
+func (f *fakeRedis) Do(c context.Context, command string, args ...interface{}) (interface{}, error) {
+	a := make([]string, len(args))
+	for i, v := range args {
+		a[i] = fmt.Sprint(v)
+	}
+	if command == "XREADGROUP" {
+		block, _ := strconv.Atoi(a[6])
+		reply := f.readGroup(a[1], a[2], a[4], a[8])
+		if reply == nil {
+			time.Sleep(time.Duration(block) * time.Millisecond)
+		}
+		return reply, nil
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch command {
+	case "XGROUP":
+		s := f.stream(a[1])
+		if _, ok := s.groups[a[2]]; ok {
+			return nil, redis.Error("BUSYGROUP Consumer Group name already exists")
+		}
+		g := &fakeGroup{pel: make(map[string]*fakePending)}
+		if a[3] == "$" {
+			g.next = len(s.ids)
+		}
+		s.groups[a[2]] = g
+		return "OK", nil
+	case "XADD":
+		return []byte(f.add(a[0], args[2:]...)), nil
+	case "XACK":
+		g := f.stream(a[0]).groups[a[1]]
+		if _, ok := g.pel[a[2]]; !ok {
+			return int64(0), nil
+		}
+		delete(g.pel, a[2])
+		return int64(1), nil
+	case "XPENDING":
+		return f.pending(a), nil
+	case "XCLAIM":
+		s := f.stream(a[0])
+		g := s.groups[a[1]]
+		minIdle, _ := strconv.Atoi(a[3])
+		res := []interface{}{}
+		for _, id := range a[4:] {
+			p, ok := g.pel[id]
+			if !ok || time.Since(p.delivered) < time.Duration(minIdle)*time.Millisecond {
+				continue
+			}
+			p.consumer, p.delivered = a[2], time.Now()
+			p.count++
+			res = append(res, f.entry(s, id))
+		}
+		return res, nil
+	case "XRANGE":
+		s := f.stream(a[0])
+		if _, ok := s.values[a[1]]; !ok {
+			return []interface{}{}, nil
+		}
+		return []interface{}{f.entry(s, a[1])}, nil
+	case "XINFO":
+		s := f.stream(a[1])
+		res := []interface{}{}
+		for name, g := range s.groups {
+			res = append(res, []interface{}{
+				[]byte("name"), []byte(name),
+				[]byte("pending"), int64(len(g.pel)),
+				[]byte("lag"), int64(len(s.ids) - g.next),
+			})
+		}
+		return res, nil
+	}
+	return nil, redis.Error("ERR unknown command " + command)
+}
+
+func (f *fakeRedis) readGroup(group, consumer, count, key string) interface{} {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	s := f.stream(key)
+	g := s.groups[group]
+	n, _ := strconv.Atoi(count)
+	var entries []interface{}
+	for ; g.next < len(s.ids) && len(entries) < n; g.next++ {
+		id := s.ids[g.next]
+		g.pel[id] = &fakePending{consumer: consumer, delivered: time.Now(), count: 1}
+		entries = append(entries, f.entry(s, id))
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+	return []interface{}{[]interface{}{[]byte(key), entries}}
+}
+
+func (f *fakeRedis) pending(a []string) interface{} {
+	g := f.stream(a[0]).groups[a[1]]
+	if len(a) == 2 {
+		return []interface{}{int64(len(g.pel)), nil, nil, nil}
+	}
+	var ids []string
+	for id := range g.pel {
+		if a[2] == "-" || seqOf(id) >= seqOf(a[2]) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return seqOf(ids[i]) < seqOf(ids[j]) })
+	count, _ := strconv.Atoi(a[4])
+	if len(ids) > count {
+		ids = ids[:count]
+	}
+	res := []interface{}{}
+	for _, id := range ids {
+		p := g.pel[id]
+		res = append(res, []interface{}{[]byte(id), []byte(p.consumer), int64(time.Since(p.delivered) / time.Millisecond), p.count})
+	}
+	return res
+}
+
+func (f *fakeRedis) pendingCount(key, group string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.stream(key).groups[group].pel)
+}
+
+func (f *fakeRedis) messages(key string) (msgs []redis.XMessage) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	s := f.stream(key)
+	for _, id := range s.ids {
+		m, _ := redis.StringMap(s.values[id], nil)
+		msgs = append(msgs, redis.XMessage{ID: id, Values: m})
+	}
+	return
+}
+
+func testConfig() *Config {
+	return &Config{
+		Stream:        "test_stream",
+		Group:         "test_group",
+		Consumer:      "test_consumer",
+		StartID:       "0",
+		Concurrency:   4,
+		Block:         xtime.Duration(5 * time.Millisecond),
+		MaxDeliveries: 3,
+		ClaimIdle:     xtime.Duration(20 * time.Millisecond),
+		ClaimInterval: xtime.Duration(10 * time.Millisecond),
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	for deadline := time.Now().Add(3 * time.Second); !cond(); {
+		if time.Now().After(deadline) {
+			t.Fatal("timeout")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestWorkerAck(t *testing.T) {
+	f := newFakeRedis()
+	for i := 0; i < 50; i++ {
+		f.add("test_stream", "n", i)
+	}
+	// the group exists already.
+	f.Do(context.TODO(), "XGROUP", "CREATE", "test_stream", "test_group", "0")
+	var handled, running, maxRunning int32
+	w := New(f, testConfig(), func(c context.Context, msg *redis.XMessage) error {
+		n := atomic.AddInt32(&running, 1)
+		for {
+			max := atomic.LoadInt32(&maxRunning)
+			if n <= max || atomic.CompareAndSwapInt32(&maxRunning, max, n) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond)
+		atomic.AddInt32(&running, -1)
+		atomic.AddInt32(&handled, 1)
+		return nil
+	})
+	if err := w.Start(); err != nil {
+		t.Fatalf("BUSYGROUP should be ignored: %v", err)
+	}
+	waitFor(t, func() bool { return atomic.LoadInt32(&handled) == 50 })
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if n := f.pendingCount("test_stream", "test_group"); n != 0 {
+		t.Fatalf("want no pending, got %d", n)
+	}
+	if max := atomic.LoadInt32(&maxRunning); max > 4 {
+		t.Fatalf("want concurrency at most 4, got %d", max)
+	}
+}
+
+func TestWorkerDeadLetter(t *testing.T) {
+	f := newFakeRedis()
+	f.add("test_stream", "n", "good")
+	bad := f.add("test_stream", "n", "bad")
+	var mu sync.Mutex
+	calls := make(map[string]int)
+	w := New(f, testConfig(), func(c context.Context, msg *redis.XMessage) error {
+		mu.Lock()
+		calls[msg.Values["n"]]++
+		mu.Unlock()
+		if msg.Values["n"] == "bad" {
+			panic("bad message")
+		}
+		return nil
+	})
+	if err := w.Start(); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool { return len(f.messages("test_stream:dead")) == 1 })
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	dead := f.messages("test_stream:dead")[0].Values
+	if dead["n"] != "bad" || dead["_stream"] != "test_stream" || dead["_id"] != bad || dead["_deliveries"] != "3" {
+		t.Fatalf("unexpected dead letter %v", dead)
+	}
+	if calls["good"] != 1 || calls["bad"] != 3 {
+		t.Fatalf("unexpected calls %v", calls)
+	}
+	if n := f.pendingCount("test_stream", "test_group"); n != 0 {
+		t.Fatalf("want no pending, got %d", n)
+	}
+}
+
+func TestWorkerReclaim(t *testing.T) {
+	f := newFakeRedis()
+	id := f.add("test_stream", "n", 1)
+	f.Do(context.TODO(), "XGROUP", "CREATE", "test_stream", "test_group", "0")
+	// delivered to a consumer which died before acking.
+	f.readGroup("test_group", "dead_consumer", "10", "test_stream")
+	handled := make(chan string, 1)
+	w := New(f, testConfig(), func(c context.Context, msg *redis.XMessage) error {
+		handled <- msg.ID
+		return nil
+	})
+	if err := w.Start(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case got := <-handled:
+		if got != id {
+			t.Fatalf("want %s, got %s", id, got)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("pending message not reclaimed")
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if n := f.pendingCount("test_stream", "test_group"); n != 0 {
+		t.Fatalf("want no pending, got %d", n)
+	}
+}
+
+func TestWorkerDrain(t *testing.T) {
+	f := newFakeRedis()
+	f.add("test_stream", "n", 1)
+	started := make(chan struct{})
+	var done int32
+	w := New(f, testConfig(), func(c context.Context, msg *redis.XMessage) error {
+		close(started)
+		time.Sleep(50 * time.Millisecond)
+		atomic.StoreInt32(&done, 1)
+		return nil
+	})
+	if err := w.Start(); err != nil {
+		t.Fatal(err)
+	}
+	<-started
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if atomic.LoadInt32(&done) != 1 {
+		t.Fatal("Close returned before the message was handled")
+	}
+	if n := f.pendingCount("test_stream", "test_group"); n != 0 {
+		t.Fatalf("want the message acked, got %d pending", n)
+	}
+}
+
+func TestNextID(t *testing.T) {
+	for id, want := range map[string]string{
+		"1526985054069-0": "1526985054069-1",
+		"0-9":             "0-10",
+		"bad":             "bad",
+	} {
+		if got := nextID(id); got != want {
+			t.Errorf("nextID(%s) want %s, got %s", id, want, got)
+		}
+	}
+}
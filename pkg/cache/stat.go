@@ -0,0 +1,49 @@
+package cache
+
+import "context"
+
+type keyPrefixKey struct{}
+
+// WithKeyPrefix returns a copy of ctx whose cache requests are reported with
+// the key prefix, e.g. the business of the keys. The prefix is a label of
+// the metrics, so it must be of the few fixed values instead of the keys.
+func WithKeyPrefix(ctx context.Context, prefix string) context.Context {
+	return context.WithValue(ctx, keyPrefixKey{}, prefix)
+}
+
+// KeyPrefix returns the key prefix set by WithKeyPrefix, empty if not set.
+func KeyPrefix(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	prefix, _ := ctx.Value(keyPrefixKey{}).(string)
+	return prefix
+}
+
+// StatGets reports the hits and misses of the keys got by the client name.
+func StatGets(ctx context.Context, name string, hits, misses int) {
+	prefix := KeyPrefix(ctx)
+	if hits > 0 {
+		MetricKeyHits.Add(float64(hits), name, prefix)
+	}
+	if misses > 0 {
+		MetricKeyMisses.Add(float64(misses), name, prefix)
+	}
+}
+
+// StatErrors reports the keys failed to get by the client name.
+func StatErrors(ctx context.Context, name string, keys int) {
+	MetricKeyErrors.Add(float64(keys), name, KeyPrefix(ctx))
+}
+
+// StatValueSize reports the size of a value of command by the client name.
+func StatValueSize(ctx context.Context, name, command string, size int) {
+	MetricValueSize.Observe(int64(size), name, KeyPrefix(ctx), command)
+}
+
+// StatCompress reports the ratio of the gzip compressed size to the raw size.
+func StatCompress(ctx context.Context, name string, raw, compressed int) {
+	if raw > 0 {
+		MetricCompressRatio.Observe(int64(compressed*100/raw), name, KeyPrefix(ctx))
+	}
+}
@@ -0,0 +1,64 @@
+package cache
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// gather returns the counter value or the histogram sample count of the
+// metric name with labels.
+func gather(t *testing.T, name string, labels map[string]string) float64 {
+	mfs, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, mf := range mfs {
+		if mf.GetName() != name {
+			continue
+		}
+	next:
+		for _, m := range mf.GetMetric() {
+			for _, lp := range m.GetLabel() {
+				if v, ok := labels[lp.GetName()]; ok && v != lp.GetValue() {
+					continue next
+				}
+			}
+			if h := m.GetHistogram(); h != nil {
+				return float64(h.GetSampleCount())
+			}
+			return m.GetCounter().GetValue()
+		}
+	}
+	return 0
+}
+
+func TestKeyPrefix(t *testing.T) {
+	if p := KeyPrefix(context.Background()); p != "" {
+		t.Fatalf("want empty prefix, got %s", p)
+	}
+	if p := KeyPrefix(WithKeyPrefix(context.Background(), "user")); p != "user" {
+		t.Fatalf("want user, got %s", p)
+	}
+}
+
+func TestStat(t *testing.T) {
+	ctx := WithKeyPrefix(context.Background(), "stat")
+	StatGets(ctx, "test_stat", 3, 1)
+	StatErrors(ctx, "test_stat", 2)
+	StatValueSize(ctx, "test_stat", "get", 100)
+	StatCompress(ctx, "test_stat", 100, 30)
+	StatCompress(ctx, "test_stat", 0, 0)
+	for name, want := range map[string]float64{
+		"cache_client_hits_total":             3,
+		"cache_client_misses_total":           1,
+		"cache_client_errors_total":           2,
+		"cache_client_value_size_bytes":       1,
+		"cache_client_compress_ratio_percent": 1,
+	} {
+		if got := gather(t, name, map[string]string{"name": "test_stat", "prefix": "stat"}); got != want {
+			t.Errorf("%s want %v, got %v", name, want, got)
+		}
+	}
+}
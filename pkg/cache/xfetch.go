@@ -0,0 +1,45 @@
+package cache
+
+import (
+	"math"
+	"math/rand"
+	"time"
+)
+
+// XFetcher is implemented by the values of the kratos-gen-bts methods with
+// -xfetch, usually by embedding XFetch.
+type XFetcher interface {
+	SetXFetch(delta, ttl time.Duration)
+	XFetchRefresh(beta float64) bool
+}
+
+var _ XFetcher = &XFetch{}
+
+// XFetch keeps the compute cost and the expiry next to the cached value, so
+// that the value can be recomputed before it expires with a probability
+// growing as the expiry approaches, which spreads the refreshes of hot keys.
+// See "Optimal Probabilistic Cache Stampede Prevention" (Vattani et al.).
+type XFetch struct {
+	// XFetchDelta is the compute cost in milliseconds.
+	XFetchDelta int64 `json:"xfetch_delta,omitempty"`
+	// XFetchExpiry is the expiry in unix milliseconds.
+	XFetchExpiry int64 `json:"xfetch_expiry,omitempty"`
+}
+
+// SetXFetch sets the compute cost delta and the ttl of the value.
+func (x *XFetch) SetXFetch(delta, ttl time.Duration) {
+	x.XFetchDelta = int64((delta + time.Millisecond - 1) / time.Millisecond)
+	x.XFetchExpiry = time.Now().Add(ttl).UnixNano() / int64(time.Millisecond)
+}
+
+// XFetchRefresh reports whether the value should be recomputed now, a beta
+// greater than 1 favors earlier refreshes. It is always false if SetXFetch
+// was never called.
+func (x *XFetch) XFetchRefresh(beta float64) bool {
+	if x.XFetchExpiry == 0 {
+		return false
+	}
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	gap := -float64(x.XFetchDelta) * beta * math.Log(rand.Float64())
+	return float64(now)+gap >= float64(x.XFetchExpiry)
+}
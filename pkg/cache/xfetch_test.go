@@ -0,0 +1,37 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestXFetch(t *testing.T) {
+	var x XFetch
+	if x.XFetchRefresh(1) {
+		t.Fatal("want no refresh without SetXFetch")
+	}
+	x.SetXFetch(time.Microsecond, time.Hour)
+	if x.XFetchDelta != 1 {
+		t.Fatalf("want the delta rounded up to 1ms, got %d", x.XFetchDelta)
+	}
+	for i := 0; i < 1000; i++ {
+		if x.XFetchRefresh(1) {
+			t.Fatal("want no refresh long before the expiry")
+		}
+	}
+	x.SetXFetch(time.Second, -time.Millisecond)
+	if !x.XFetchRefresh(1) {
+		t.Fatal("want refresh after the expiry")
+	}
+	// the expiry is 1 delta away, about 1/e of the fetches refresh.
+	x.SetXFetch(time.Second, time.Second)
+	var n int
+	for i := 0; i < 10000; i++ {
+		if x.XFetchRefresh(1) {
+			n++
+		}
+	}
+	if n < 3000 || n > 4400 {
+		t.Fatalf("want about 3679 refreshes, got %d", n)
+	}
+}
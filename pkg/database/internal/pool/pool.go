@@ -0,0 +1,101 @@
+// Package pool is the connection pool statistics and leak detection shared
+// by database/sql and database/tidb.
+package pool
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/djienet/kratos/pkg/log"
+	"github.com/djienet/kratos/pkg/stat/metric"
+)
+
+const _defaultStatInterval = 10 * time.Second
+
+// StatProc calls stat every interval until c is done, interval is 10s by
+// default.
+func StatProc(c context.Context, interval time.Duration, stat func()) {
+	if interval <= 0 {
+		interval = _defaultStatInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-c.Done():
+			return
+		}
+		stat()
+	}
+}
+
+// LeakDetector records the stacks where Rows and Tx are created, the ones
+// not closed within threshold are reported once.
+type LeakDetector struct {
+	family    string
+	threshold time.Duration
+	metric    metric.CounterVec
+	mu        sync.Mutex
+	records   map[*leakRecord]struct{}
+}
+
+type leakRecord struct {
+	kind     string
+	query    string
+	stack    []byte
+	start    time.Time
+	reported bool
+}
+
+// NewLeakDetector new a leak detector, the leaks are logged with family and
+// counted by leak with the labels name, addr and kind. It returns nil, which
+// tracks nothing, if threshold is not positive.
+func NewLeakDetector(family string, threshold time.Duration, leak metric.CounterVec) *LeakDetector {
+	if threshold <= 0 {
+		return nil
+	}
+	return &LeakDetector{family: family, threshold: threshold, metric: leak, records: make(map[*leakRecord]struct{})}
+}
+
+// Track records the caller stack and returns the func to call on close.
+func (d *LeakDetector) Track(kind, query string) func() {
+	if d == nil {
+		return nil
+	}
+	buf := make([]byte, 4096)
+	r := &leakRecord{kind: kind, query: query, stack: buf[:runtime.Stack(buf, false)], start: time.Now()}
+	d.mu.Lock()
+	d.records[r] = struct{}{}
+	d.mu.Unlock()
+	return func() {
+		d.mu.Lock()
+		delete(d.records, r)
+		d.mu.Unlock()
+	}
+}
+
+// Check reports the records not closed within threshold, it returns the
+// count of the new leaks.
+func (d *LeakDetector) Check(addr string) (n int) {
+	if d == nil {
+		return
+	}
+	now := time.Now()
+	var leaks []*leakRecord
+	d.mu.Lock()
+	for r := range d.records {
+		if !r.reported && now.Sub(r.start) >= d.threshold {
+			r.reported = true
+			leaks = append(leaks, r)
+		}
+	}
+	d.mu.Unlock()
+	for _, r := range leaks {
+		d.metric.Inc(addr, addr, r.kind)
+		log.Error("%s %s(%s) of %s not closed after %v, created at:\n%s", d.family, r.kind, r.query, addr, now.Sub(r.start), r.stack)
+	}
+	return len(leaks)
+}
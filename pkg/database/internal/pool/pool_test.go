@@ -0,0 +1,53 @@
+package pool
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/djienet/kratos/pkg/stat/metric"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var _metricTestLeak = metric.NewCounterVec(&metric.CounterVecOpts{
+	Namespace: "pool_test",
+	Subsystem: "pool",
+	Name:      "leak_total",
+	Help:      "pool test leaks.",
+	Labels:    []string{"name", "addr", "kind"},
+})
+
+func TestLeakDetector(t *testing.T) {
+	assert.Nil(t, NewLeakDetector("test", 0, _metricTestLeak))
+	d := NewLeakDetector("test", time.Millisecond, _metricTestLeak)
+	leaked := d.Track("rows", "SELECT 1")
+	closed := d.Track("tx", "")
+	closed()
+
+	time.Sleep(5 * time.Millisecond)
+	assert.Equal(t, 1, d.Check("fake"))
+	// reported only once
+	assert.Equal(t, 0, d.Check("fake"))
+	leaked()
+	assert.Len(t, d.records, 0)
+
+	var nilDetector *LeakDetector
+	assert.Nil(t, nilDetector.Track("rows", ""))
+	assert.Equal(t, 0, nilDetector.Check("fake"))
+}
+
+func TestStatProc(t *testing.T) {
+	c, cancel := context.WithCancel(context.Background())
+	var n int64
+	done := make(chan struct{})
+	go func() {
+		StatProc(c, time.Millisecond, func() { atomic.AddInt64(&n, 1) })
+		close(done)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+	<-done
+	assert.True(t, atomic.LoadInt64(&n) > 0)
+}
@@ -0,0 +1,134 @@
+// Package transact is the transaction helpers shared by database/sql and
+// database/tidb: the options, the retry with backoff, the attempt of a
+// transaction and the nested transaction by savepoint.
+package transact
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/djienet/kratos/pkg/net/netutil"
+	"github.com/djienet/kratos/pkg/net/trace"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultBackoff is the backoff between two attempts by default.
+var DefaultBackoff = &netutil.BackoffConfig{
+	MaxDelay:  200 * time.Millisecond,
+	BaseDelay: 10 * time.Millisecond,
+	Factor:    2,
+	Jitter:    0.2,
+}
+
+// Options is the options of a transaction.
+type Options struct {
+	sql.TxOptions
+	Retries int
+	Backoff netutil.Backoff
+}
+
+// Option sets the options of a transaction.
+type Option func(*Options)
+
+// Isolation sets the isolation level of the transaction.
+func Isolation(level sql.IsolationLevel) Option {
+	return func(o *Options) {
+		o.Isolation = level
+	}
+}
+
+// ReadOnly makes the transaction read only.
+func ReadOnly() Option {
+	return func(o *Options) {
+		o.ReadOnly = true
+	}
+}
+
+// Retry sets the max retries on retryable errors and the backoff between
+// two attempts, retries is 3 by default.
+func Retry(retries int, backoff netutil.Backoff) Option {
+	return func(o *Options) {
+		o.Retries = retries
+		if backoff != nil {
+			o.Backoff = backoff
+		}
+	}
+}
+
+// Run runs attempt until it succeeds, returns an error not retryable, the
+// retries are used up or c is done, with backoff between two attempts.
+func Run(c context.Context, opts []Option, attempt func(attempt int, opts *sql.TxOptions) error, retryable func(error) bool) (err error) {
+	o := &Options{Retries: 3, Backoff: DefaultBackoff}
+	for _, opt := range opts {
+		opt(o)
+	}
+	for i := 0; ; i++ {
+		if err = attempt(i, &o.TxOptions); err == nil || i >= o.Retries || !retryable(err) {
+			return
+		}
+		select {
+		case <-time.After(o.Backoff.Backoff(i)):
+		case <-c.Done():
+			return
+		}
+	}
+}
+
+// Tx is the transaction of Attempt.
+type Tx interface {
+	Commit() error
+	Rollback() error
+}
+
+// Attempt begins a transaction by begin and runs fn in it, the transaction is
+// committed if fn returns nil, otherwise it is rolled back, also when fn
+// panics. Each attempt is traced as transact of family.
+func Attempt(c context.Context, family, addr string, attempt int, begin func(c context.Context) (Tx, error), fn func(tx Tx) error) (err error) {
+	if t, ok := trace.FromContext(c); ok {
+		t = t.Fork(family, "transact")
+		t.SetTag(trace.String(trace.TagAddress, addr), trace.Int("attempt", attempt))
+		c = trace.NewContext(c, t)
+		defer t.Finish(&err)
+	}
+	tx, err := begin(c)
+	if err != nil {
+		return
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		}
+	}()
+	if err = fn(tx); err != nil {
+		tx.Rollback()
+		return
+	}
+	return tx.Commit()
+}
+
+// Savepoint runs fn in the nested transaction of the savepoint seq, exec
+// executes the savepoint statements in the outer transaction. The changes
+// of fn are rolled back to the savepoint if fn returns an error or panics.
+func Savepoint(seq int, exec func(query string) error, fn func() error) (err error) {
+	sp := fmt.Sprintf("kratos_sp_%d", seq)
+	if err = exec("SAVEPOINT " + sp); err != nil {
+		return
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			exec("ROLLBACK TO SAVEPOINT " + sp)
+			panic(p)
+		}
+	}()
+	if err = fn(); err != nil {
+		if e := exec("ROLLBACK TO SAVEPOINT " + sp); e != nil {
+			err = errors.Wrapf(err, "rollback to savepoint %s error(%v)", sp, e)
+		}
+		return
+	}
+	return exec("RELEASE SAVEPOINT " + sp)
+}
@@ -0,0 +1,75 @@
+package transact
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/djienet/kratos/pkg/net/netutil"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+var _errRetry = errors.New("retry")
+
+func retryable(err error) bool {
+	return err == _errRetry
+}
+
+func TestRun(t *testing.T) {
+	backoff := &netutil.BackoffConfig{MaxDelay: time.Millisecond, BaseDelay: time.Millisecond, Factor: 1}
+	var opts *sql.TxOptions
+	attempts := 0
+	err := Run(context.Background(), []Option{Isolation(sql.LevelSerializable), ReadOnly(), Retry(5, backoff)}, func(attempt int, o *sql.TxOptions) error {
+		assert.Equal(t, attempts, attempt)
+		attempts++
+		opts = o
+		if attempt < 2 {
+			return _errRetry
+		}
+		return nil
+	}, retryable)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, attempts)
+	assert.Equal(t, sql.LevelSerializable, opts.Isolation)
+	assert.True(t, opts.ReadOnly)
+
+	// retries are used up.
+	attempts = 0
+	err = Run(context.Background(), []Option{Retry(1, backoff)}, func(int, *sql.TxOptions) error {
+		attempts++
+		return _errRetry
+	}, retryable)
+	assert.Equal(t, _errRetry, err)
+	assert.Equal(t, 2, attempts)
+
+	// not retryable.
+	attempts = 0
+	want := errors.New("fn error")
+	err = Run(context.Background(), nil, func(int, *sql.TxOptions) error {
+		attempts++
+		return want
+	}, retryable)
+	assert.Equal(t, want, err)
+	assert.Equal(t, 1, attempts)
+
+	// context done while backing off.
+	c, cancel := context.WithCancel(context.Background())
+	cancel()
+	attempts = 0
+	err = Run(c, []Option{Retry(3, &netutil.BackoffConfig{MaxDelay: time.Hour, BaseDelay: time.Hour, Factor: 1})}, func(int, *sql.TxOptions) error {
+		attempts++
+		return _errRetry
+	}, retryable)
+	assert.Equal(t, _errRetry, err)
+	assert.Equal(t, 1, attempts)
+}
+
+func TestRetryOption(t *testing.T) {
+	o := &Options{Retries: 3, Backoff: DefaultBackoff}
+	Retry(5, nil)(o)
+	assert.Equal(t, 5, o.Retries)
+	assert.Equal(t, DefaultBackoff, o.Backoff)
+}
@@ -0,0 +1,364 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/djienet/kratos/pkg/log"
+	xtime "github.com/djienet/kratos/pkg/time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/pkg/errors"
+)
+
+// _unlockTimeout bounds the renewal and unlock, which run with fresh contexts
+// as the context of the migration may be canceled or timed out.
+const _unlockTimeout = 5 * time.Second
+
+var (
+	// ErrLocked is returned when another migration is running.
+	ErrLocked = errors.New("migrate: locked by another migration")
+	// ErrChecksum is returned when an applied migration file is modified.
+	ErrChecksum = errors.New("migrate: checksum mismatch")
+)
+
+// Config migrate config.
+type Config struct {
+	Table     string // history table, default schema_migrations.
+	LockTable string // lock table, default schema_migrations_lock.
+	// LockExpire is the duration after which a lock is regarded as leaked
+	// by a crashed migration, default 10m. The lock is renewed every third
+	// of it while migrating.
+	LockExpire xtime.Duration
+}
+
+func (c *Config) fix() {
+	if c.Table == "" {
+		c.Table = "schema_migrations"
+	}
+	if c.LockTable == "" {
+		c.LockTable = c.Table + "_lock"
+	}
+	if c.LockExpire == 0 {
+		c.LockExpire = xtime.Duration(10 * time.Minute)
+	}
+}
+
+// Status is the status of a migration.
+type Status struct {
+	Version   int64
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+	// Modified reports whether the up file is changed after applied.
+	Modified bool
+	// Missing reports whether the applied migration has no file.
+	Missing bool
+}
+
+// Migrator applies the migrations of a source to the database.
+type Migrator struct {
+	db    *sql.DB
+	src   Source
+	conf  *Config
+	owner string
+}
+
+// New new a migrator.
+func New(db *sql.DB, src Source, c *Config) *Migrator {
+	if c == nil {
+		c = &Config{}
+	}
+	c.fix()
+	host, _ := os.Hostname()
+	return &Migrator{
+		db:    db,
+		src:   src,
+		conf:  c,
+		owner: fmt.Sprintf("%s:%d:%d", host, os.Getpid(), time.Now().UnixNano()),
+	}
+}
+
+type record struct {
+	version   int64
+	name      string
+	checksum  string
+	appliedAt time.Time
+}
+
+func (m *Migrator) init(c context.Context) (err error) {
+	if _, err = m.db.ExecContext(c, fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s ("+
+		"version BIGINT NOT NULL PRIMARY KEY,"+
+		"name VARCHAR(255) NOT NULL,"+
+		"checksum CHAR(64) NOT NULL,"+
+		"applied_at DATETIME NOT NULL)", m.conf.Table)); err != nil {
+		return errors.WithStack(err)
+	}
+	_, err = m.db.ExecContext(c, fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s ("+
+		"id INT NOT NULL PRIMARY KEY,"+
+		"owner VARCHAR(255) NOT NULL,"+
+		"locked_at DATETIME NOT NULL)", m.conf.LockTable))
+	return errors.WithStack(err)
+}
+
+// lock takes the lock and renews it until unlock is called. The context
+// returned is canceled if the lock is lost, e.g. removed as expired after the
+// database was unreachable longer than LockExpire, so the migrations left are
+// not applied.
+func (m *Migrator) lock(c context.Context) (lc context.Context, unlock func(), err error) {
+	if err = m.init(c); err != nil {
+		return
+	}
+	res, err := m.db.ExecContext(c, fmt.Sprintf("DELETE FROM %s WHERE id=1 AND locked_at<DATE_SUB(NOW(), INTERVAL ? SECOND)", m.conf.LockTable),
+		int64(time.Duration(m.conf.LockExpire)/time.Second))
+	if err != nil {
+		err = errors.WithStack(err)
+		return
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		log.Warn("migrate: expired lock of %s removed", m.conf.LockTable)
+	}
+	if _, err = m.db.ExecContext(c, fmt.Sprintf("INSERT INTO %s (id, owner, locked_at) VALUES (1, ?, NOW())", m.conf.LockTable), m.owner); err != nil {
+		if e, ok := err.(*mysql.MySQLError); ok && e.Number == 1062 {
+			err = ErrLocked
+			return
+		}
+		err = errors.WithStack(err)
+		return
+	}
+	lc, cancel := context.WithCancel(c)
+	done, exited := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(exited)
+		m.renewproc(cancel, done)
+	}()
+	unlock = func() {
+		close(done)
+		<-exited
+		cancel()
+		m.unlock()
+	}
+	return
+}
+
+// renewproc renews the lock until done is closed, lost is called if the lock
+// is owned by others.
+func (m *Migrator) renewproc(lost context.CancelFunc, done chan struct{}) {
+	ticker := time.NewTicker(time.Duration(m.conf.LockExpire) / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-done:
+			return
+		}
+		ok, err := m.renew()
+		if err != nil {
+			log.Error("migrate: renew lock %s error(%v)", m.conf.LockTable, err)
+			continue
+		}
+		if !ok {
+			log.Error("migrate: lock %s lost, the migrations left are canceled", m.conf.LockTable)
+			lost()
+			return
+		}
+	}
+}
+
+// renew renews the lock, ok is false if the lock is owned by others.
+func (m *Migrator) renew() (ok bool, err error) {
+	c, cancel := context.WithTimeout(context.Background(), _unlockTimeout)
+	defer cancel()
+	res, err := m.db.ExecContext(c, fmt.Sprintf("UPDATE %s SET locked_at=NOW() WHERE id=1 AND owner=?", m.conf.LockTable), m.owner)
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		return true, nil
+	}
+	// mysql reports no rows affected if locked_at is not changed in a second.
+	var owner string
+	if err = m.db.QueryRowContext(c, fmt.Sprintf("SELECT owner FROM %s WHERE id=1", m.conf.LockTable)).Scan(&owner); err != nil {
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		return false, errors.WithStack(err)
+	}
+	return owner == m.owner, nil
+}
+
+func (m *Migrator) unlock() {
+	c, cancel := context.WithTimeout(context.Background(), _unlockTimeout)
+	defer cancel()
+	if _, err := m.db.ExecContext(c, fmt.Sprintf("DELETE FROM %s WHERE id=1 AND owner=?", m.conf.LockTable), m.owner); err != nil {
+		log.Error("migrate: unlock %s error(%v)", m.conf.LockTable, err)
+	}
+}
+
+func (m *Migrator) records(c context.Context) (rs map[int64]*record, err error) {
+	rows, err := m.db.QueryContext(c, fmt.Sprintf("SELECT version, name, checksum, applied_at FROM %s", m.conf.Table))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer rows.Close()
+	rs = make(map[int64]*record)
+	for rows.Next() {
+		var (
+			r  = new(record)
+			at mysql.NullTime // scans DATETIME without parseTime of dsn.
+		)
+		if err = rows.Scan(&r.version, &r.name, &r.checksum, &at); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		r.appliedAt = at.Time
+		rs[r.version] = r
+	}
+	return rs, errors.WithStack(rows.Err())
+}
+
+// Up applies at most n pending migrations in version order, n <= 0 means all.
+// Each migration is applied and recorded in a transaction, note that mysql
+// commits the DDL statements implicitly.
+func (m *Migrator) Up(c context.Context, n int) (applied []*Migration, err error) {
+	ms, err := load(m.src)
+	if err != nil {
+		return
+	}
+	c, unlock, err := m.lock(c)
+	if err != nil {
+		return
+	}
+	defer unlock()
+	rs, err := m.records(c)
+	if err != nil {
+		return
+	}
+	for _, mg := range ms {
+		if r, ok := rs[mg.Version]; ok && r.checksum != mg.Checksum {
+			return nil, errors.Wrapf(ErrChecksum, "version %d %s", mg.Version, mg.Name)
+		}
+	}
+	for _, mg := range ms {
+		if _, ok := rs[mg.Version]; ok {
+			continue
+		}
+		if n > 0 && len(applied) >= n {
+			break
+		}
+		if err = m.apply(c, mg.Up, func(tx *sql.Tx) error {
+			_, err := tx.ExecContext(c, fmt.Sprintf("INSERT INTO %s (version, name, checksum, applied_at) VALUES (?, ?, ?, NOW())", m.conf.Table),
+				mg.Version, mg.Name, mg.Checksum)
+			return err
+		}); err != nil {
+			return applied, errors.Wrapf(err, "up version %d %s", mg.Version, mg.Name)
+		}
+		log.Info("migrate: version %d %s applied", mg.Version, mg.Name)
+		applied = append(applied, mg)
+	}
+	return
+}
+
+// Down reverts the last n applied migrations, n <= 0 means 1. It fails on the
+// applied version whose migration file is missing.
+func (m *Migrator) Down(c context.Context, n int) (reverted []*Migration, err error) {
+	if n <= 0 {
+		n = 1
+	}
+	ms, err := load(m.src)
+	if err != nil {
+		return
+	}
+	c, unlock, err := m.lock(c)
+	if err != nil {
+		return
+	}
+	defer unlock()
+	rs, err := m.records(c)
+	if err != nil {
+		return
+	}
+	files := make(map[int64]*Migration, len(ms))
+	for _, mg := range ms {
+		files[mg.Version] = mg
+	}
+	versions := make([]int64, 0, len(rs))
+	for v := range rs {
+		versions = append(versions, v)
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i] > versions[j] })
+	for _, v := range versions {
+		if len(reverted) >= n {
+			break
+		}
+		mg, ok := files[v]
+		if !ok {
+			return reverted, errors.Errorf("migrate: applied version %d %s has no migration file", v, rs[v].name)
+		}
+		if mg.Down == "" {
+			return reverted, errors.Errorf("migrate: version %d %s has no down file", mg.Version, mg.Name)
+		}
+		if err = m.apply(c, mg.Down, func(tx *sql.Tx) error {
+			_, err := tx.ExecContext(c, fmt.Sprintf("DELETE FROM %s WHERE version=?", m.conf.Table), mg.Version)
+			return err
+		}); err != nil {
+			return reverted, errors.Wrapf(err, "down version %d %s", mg.Version, mg.Name)
+		}
+		log.Info("migrate: version %d %s reverted", mg.Version, mg.Name)
+		reverted = append(reverted, mg)
+	}
+	return
+}
+
+func (m *Migrator) apply(c context.Context, script string, record func(tx *sql.Tx) error) (err error) {
+	tx, err := m.db.BeginTx(c, nil)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+	for _, stmt := range statements(script) {
+		if _, err = tx.ExecContext(c, stmt); err != nil {
+			return errors.Wrapf(err, "exec:%s", stmt)
+		}
+	}
+	if err = record(tx); err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(tx.Commit())
+}
+
+// Status returns the status of all migrations sorted by version, including
+// the applied ones whose files are missing.
+func (m *Migrator) Status(c context.Context) (ss []*Status, err error) {
+	ms, err := load(m.src)
+	if err != nil {
+		return
+	}
+	if err = m.init(c); err != nil {
+		return
+	}
+	rs, err := m.records(c)
+	if err != nil {
+		return
+	}
+	for _, mg := range ms {
+		s := &Status{Version: mg.Version, Name: mg.Name}
+		if r, ok := rs[mg.Version]; ok {
+			s.Applied, s.AppliedAt, s.Modified = true, r.appliedAt, r.checksum != mg.Checksum
+			delete(rs, mg.Version)
+		}
+		ss = append(ss, s)
+	}
+	for _, r := range rs {
+		ss = append(ss, &Status{Version: r.version, Name: r.name, Applied: true, AppliedAt: r.appliedAt, Missing: true})
+	}
+	sort.Slice(ss, func(i, j int) bool { return ss[i].Version < ss[j].Version })
+	return
+}
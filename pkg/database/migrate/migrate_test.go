@@ -0,0 +1,295 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	xtime "github.com/djienet/kratos/pkg/time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+// testDB is the state of the fake mysql of a dsn, the history and lock
+// tables are kept in memory and the other statements are logged.
+type testDB struct {
+	mu      sync.Mutex
+	owner   string // the owner of the lock.
+	unlocks int
+	// renewals is the count of the lock renewals.
+	renewals int
+	records  map[int64][]driver.Value
+	execs    []string
+	onExec   func(query string)
+}
+
+var (
+	_testDBs   sync.Map
+	_testDSNID int
+)
+
+type testDriver struct{}
+
+func init() {
+	sql.Register("migrate_test", testDriver{})
+}
+
+func (testDriver) Open(dsn string) (driver.Conn, error) {
+	d, _ := _testDBs.Load(dsn)
+	return &testConn{db: d.(*testDB)}, nil
+}
+
+type testConn struct {
+	db *testDB
+}
+
+func (c *testConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("prepare not supported")
+}
+
+func (c *testConn) Close() error              { return nil }
+func (c *testConn) Begin() (driver.Tx, error) { return c, nil }
+func (c *testConn) Commit() error             { return nil }
+func (c *testConn) Rollback() error           { return nil }
+
+func (c *testConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	d := c.db
+	d.mu.Lock()
+	var onExec func(string)
+	defer func() {
+		d.mu.Unlock()
+		// called unlocked, it may change the state of the db.
+		if onExec != nil {
+			onExec(query)
+		}
+	}()
+	switch {
+	case strings.HasPrefix(query, "CREATE TABLE IF NOT EXISTS schema_migrations"):
+	case strings.HasPrefix(query, "DELETE FROM schema_migrations_lock WHERE id=1 AND locked_at"):
+	case strings.HasPrefix(query, "INSERT INTO schema_migrations_lock"):
+		if d.owner != "" {
+			return nil, &mysql.MySQLError{Number: 1062, Message: "Duplicate entry '1' for key 'PRIMARY'"}
+		}
+		d.owner = args[0].Value.(string)
+	case strings.HasPrefix(query, "DELETE FROM schema_migrations_lock WHERE id=1 AND owner"):
+		if d.owner == args[0].Value.(string) {
+			d.owner = ""
+			d.unlocks++
+		}
+	case strings.HasPrefix(query, "UPDATE schema_migrations_lock SET locked_at"):
+		if d.owner != args[0].Value.(string) {
+			return driver.RowsAffected(0), nil
+		}
+		d.renewals++
+	case strings.HasPrefix(query, "INSERT INTO schema_migrations "):
+		d.records[args[0].Value.(int64)] = []driver.Value{args[0].Value, args[1].Value, args[2].Value, time.Now()}
+	case strings.HasPrefix(query, "DELETE FROM schema_migrations WHERE version"):
+		delete(d.records, args[0].Value.(int64))
+	default:
+		d.execs = append(d.execs, query)
+		onExec = d.onExec
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (c *testConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	d := c.db
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if strings.HasPrefix(query, "SELECT owner") {
+		rows := &testRows{cols: []string{"owner"}}
+		if d.owner != "" {
+			rows.vals = append(rows.vals, []driver.Value{d.owner})
+		}
+		return rows, nil
+	}
+	rows := &testRows{}
+	for _, r := range d.records {
+		rows.vals = append(rows.vals, r)
+	}
+	return rows, nil
+}
+
+type testRows struct {
+	cols []string
+	vals [][]driver.Value
+}
+
+func (r *testRows) Columns() []string {
+	if r.cols != nil {
+		return r.cols
+	}
+	return []string{"version", "name", "checksum", "applied_at"}
+}
+func (r *testRows) Close() error { return nil }
+
+func (r *testRows) Next(dest []driver.Value) error {
+	if len(r.vals) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.vals[0])
+	r.vals = r.vals[1:]
+	return nil
+}
+
+func newTestMigrator(t *testing.T, src testBox) (*Migrator, *testDB) {
+	d := &testDB{records: make(map[int64][]driver.Value)}
+	_testDSNID++
+	dsn := fmt.Sprintf("%s_%d", t.Name(), _testDSNID)
+	_testDBs.Store(dsn, d)
+	db, err := sql.Open("migrate_test", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return New(db, Box(src), nil), d
+}
+
+func (d *testDB) versions() (vs []int64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for v := range d.records {
+		vs = append(vs, v)
+	}
+	sort.Slice(vs, func(i, j int) bool { return vs[i] < vs[j] })
+	return
+}
+
+var _testMigrations = testBox{
+	"1_create_user.up.sql":   "CREATE TABLE user (id BIGINT);",
+	"1_create_user.down.sql": "DROP TABLE user;",
+	"2_add_age.up.sql":       "ALTER TABLE user ADD age INT;\nALTER TABLE user ADD KEY ix_age (age);",
+	"2_add_age.down.sql":     "ALTER TABLE user DROP age;",
+}
+
+func TestUpDown(t *testing.T) {
+	m, d := newTestMigrator(t, _testMigrations)
+	c := context.Background()
+	applied, err := m.Up(c, 1)
+	assert.Nil(t, err)
+	assert.Len(t, applied, 1)
+	assert.Equal(t, []int64{1}, d.versions())
+	applied, err = m.Up(c, 0)
+	assert.Nil(t, err)
+	assert.Len(t, applied, 1)
+	assert.Equal(t, []int64{1, 2}, d.versions())
+	assert.Equal(t, []string{
+		"CREATE TABLE user (id BIGINT)",
+		"ALTER TABLE user ADD age INT",
+		"ALTER TABLE user ADD KEY ix_age (age)",
+	}, d.execs)
+	assert.Equal(t, "", d.owner)
+	assert.Equal(t, 2, d.unlocks)
+
+	ss, err := m.Status(c)
+	assert.Nil(t, err)
+	assert.Len(t, ss, 2)
+	assert.True(t, ss[0].Applied && ss[1].Applied && !ss[1].Modified)
+
+	reverted, err := m.Down(c, 0)
+	assert.Nil(t, err)
+	assert.Len(t, reverted, 1)
+	assert.Equal(t, int64(2), reverted[0].Version)
+	assert.Equal(t, []int64{1}, d.versions())
+	assert.Equal(t, "ALTER TABLE user DROP age", d.execs[len(d.execs)-1])
+}
+
+func TestLocked(t *testing.T) {
+	m, d := newTestMigrator(t, _testMigrations)
+	d.owner = "other"
+	_, err := m.Up(context.Background(), 0)
+	assert.Equal(t, ErrLocked, err)
+	_, err = m.Down(context.Background(), 0)
+	assert.Equal(t, ErrLocked, err)
+	assert.Equal(t, "other", d.owner)
+	assert.Empty(t, d.execs)
+	assert.Empty(t, d.versions())
+}
+
+func TestLockRenew(t *testing.T) {
+	m, d := newTestMigrator(t, _testMigrations)
+	m.conf.LockExpire = xtime.Duration(30 * time.Millisecond)
+	d.onExec = func(string) { time.Sleep(50 * time.Millisecond) }
+	applied, err := m.Up(context.Background(), 0)
+	assert.Nil(t, err)
+	assert.Len(t, applied, 2)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	assert.True(t, d.renewals > 0)
+	assert.Equal(t, "", d.owner)
+}
+
+func TestLockLost(t *testing.T) {
+	m, d := newTestMigrator(t, _testMigrations)
+	m.conf.LockExpire = xtime.Duration(30 * time.Millisecond)
+	d.onExec = func(query string) {
+		if query == "CREATE TABLE user (id BIGINT)" {
+			// the lock expired and taken by another migration.
+			d.mu.Lock()
+			d.owner = "other"
+			d.mu.Unlock()
+			time.Sleep(50 * time.Millisecond)
+		}
+	}
+	applied, err := m.Up(context.Background(), 0)
+	assert.Equal(t, context.Canceled, errors.Cause(err))
+	assert.Empty(t, applied)
+	assert.Empty(t, d.versions())
+	assert.Equal(t, []string{"CREATE TABLE user (id BIGINT)"}, d.execs)
+	assert.Equal(t, "other", d.owner)
+}
+
+func TestDownMissingFile(t *testing.T) {
+	m, d := newTestMigrator(t, _testMigrations)
+	_, err := m.Up(context.Background(), 0)
+	assert.Nil(t, err)
+	d.records[3] = []driver.Value{int64(3), "removed", "checksum", time.Now()}
+	reverted, err := m.Down(context.Background(), 1)
+	assert.NotNil(t, err)
+	assert.Empty(t, reverted)
+	assert.Equal(t, []int64{1, 2, 3}, d.versions())
+}
+
+func TestChecksumMismatch(t *testing.T) {
+	m, d := newTestMigrator(t, _testMigrations)
+	_, err := m.Up(context.Background(), 1)
+	assert.Nil(t, err)
+	modified := testBox{}
+	for name, content := range _testMigrations {
+		modified[name] = content
+	}
+	modified["1_create_user.up.sql"] = "CREATE TABLE user (id BIGINT, name VARCHAR(32));"
+	m.src = Box(modified)
+	execs := len(d.execs)
+	_, err = m.Up(context.Background(), 0)
+	assert.Equal(t, ErrChecksum, errors.Cause(err))
+	assert.Len(t, d.execs, execs)
+	assert.Equal(t, []int64{1}, d.versions())
+	assert.Equal(t, "", d.owner)
+
+	ss, err := m.Status(context.Background())
+	assert.Nil(t, err)
+	assert.True(t, ss[0].Modified)
+}
+
+func TestUnlockCanceled(t *testing.T) {
+	m, d := newTestMigrator(t, _testMigrations)
+	c, cancel := context.WithCancel(context.Background())
+	// canceled while migrating, the lock must still be released.
+	d.onExec = func(string) { cancel() }
+	_, err := m.Up(c, 0)
+	assert.NotNil(t, err)
+	assert.Equal(t, "", d.owner)
+	assert.Equal(t, 1, d.unlocks)
+}
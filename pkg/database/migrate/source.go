@@ -0,0 +1,208 @@
+package migrate
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var _fileRegexp = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Source provides the migration files named like 20191001150405_create_user.up.sql
+// and 20191001150405_create_user.down.sql.
+type Source interface {
+	// List returns the file names.
+	List() ([]string, error)
+	// Read returns the content of the file.
+	Read(name string) ([]byte, error)
+}
+
+type dirSource string
+
+// Dir returns the source of the migration files in dir.
+func Dir(dir string) Source {
+	return dirSource(dir)
+}
+
+func (d dirSource) List() (names []string, err error) {
+	fis, err := ioutil.ReadDir(string(d))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	for _, fi := range fis {
+		if !fi.IsDir() {
+			names = append(names, fi.Name())
+		}
+	}
+	return
+}
+
+func (d dirSource) Read(name string) ([]byte, error) {
+	b, err := ioutil.ReadFile(filepath.Join(string(d), name))
+	return b, errors.WithStack(err)
+}
+
+// box is the packr box, e.g. packr.New("migrations", "./migrations").
+type box interface {
+	List() []string
+	Find(name string) ([]byte, error)
+}
+
+type boxSource struct {
+	box box
+}
+
+// Box returns the source of the migration files embedded in a packr box.
+func Box(b box) Source {
+	return boxSource{box: b}
+}
+
+func (b boxSource) List() ([]string, error) {
+	return b.box.List(), nil
+}
+
+func (b boxSource) Read(name string) ([]byte, error) {
+	c, err := b.box.Find(name)
+	return c, errors.WithStack(err)
+}
+
+// Migration is a versioned schema change.
+type Migration struct {
+	Version  int64
+	Name     string
+	Up       string
+	Down     string
+	Checksum string // sha256 of Up.
+}
+
+// load loads the migrations from src sorted by version.
+func load(src Source) (ms []*Migration, err error) {
+	names, err := src.List()
+	if err != nil {
+		return
+	}
+	versions := make(map[int64]*Migration)
+	for _, name := range names {
+		match := _fileRegexp.FindStringSubmatch(filepath.Base(name))
+		if match == nil {
+			continue
+		}
+		version, _ := strconv.ParseInt(match[1], 10, 64)
+		m, ok := versions[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			versions[version] = m
+			ms = append(ms, m)
+		} else if m.Name != match[2] {
+			return nil, errors.Errorf("migrate: duplicate version %d: %s and %s", version, m.Name, match[2])
+		}
+		content, err := src.Read(name)
+		if err != nil {
+			return nil, err
+		}
+		if match[3] == "up" {
+			m.Up = string(content)
+			m.Checksum = checksum(content)
+		} else {
+			m.Down = string(content)
+		}
+	}
+	for _, m := range ms {
+		if m.Up == "" {
+			return nil, errors.Errorf("migrate: version %d %s has no up file", m.Version, m.Name)
+		}
+	}
+	sort.Slice(ms, func(i, j int) bool { return ms[i].Version < ms[j].Version })
+	return
+}
+
+func checksum(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// Create creates the up and down files of a new migration in dir, the version
+// is the current time.
+func Create(dir, name string) (up, down string, err error) {
+	name = strings.ToLower(strings.Join(strings.Fields(name), "_"))
+	if !regexp.MustCompile(`^\w+$`).MatchString(name) {
+		return "", "", errors.Errorf("migrate: invalid name %s", name)
+	}
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return "", "", errors.WithStack(err)
+	}
+	base := fmt.Sprintf("%s_%s", time.Now().Format("20060102150405"), name)
+	up = filepath.Join(dir, base+".up.sql")
+	down = filepath.Join(dir, base+".down.sql")
+	if err = ioutil.WriteFile(up, []byte("-- "+name+" up\n"), 0644); err != nil {
+		return "", "", errors.WithStack(err)
+	}
+	if err = ioutil.WriteFile(down, []byte("-- "+name+" down\n"), 0644); err != nil {
+		return "", "", errors.WithStack(err)
+	}
+	return
+}
+
+// statements splits the sql script into statements by the semicolons out of
+// quotes and comments, the -- comments need no trailing space.
+func statements(script string) (stmts []string) {
+	var (
+		b     strings.Builder
+		quote byte
+	)
+	flush := func() {
+		if s := strings.TrimSpace(b.String()); s != "" {
+			stmts = append(stmts, s)
+		}
+		b.Reset()
+	}
+	for i := 0; i < len(script); i++ {
+		ch := script[i]
+		if quote != 0 {
+			b.WriteByte(ch)
+			if ch == '\\' && i+1 < len(script) {
+				i++
+				b.WriteByte(script[i])
+			} else if ch == quote {
+				quote = 0
+			}
+			continue
+		}
+		switch {
+		case ch == '\'' || ch == '"' || ch == '`':
+			quote = ch
+			b.WriteByte(ch)
+		case ch == '-' && strings.HasPrefix(script[i:], "--"), ch == '#':
+			// skip the line comment.
+			for i < len(script) && script[i] != '\n' {
+				i++
+			}
+			b.WriteByte('\n')
+		case ch == '/' && strings.HasPrefix(script[i:], "/*") && !strings.HasPrefix(script[i:], "/*!"):
+			// the mysql executable comments /*! ... */ are kept.
+			end := strings.Index(script[i+2:], "*/")
+			if end < 0 {
+				i = len(script)
+			} else {
+				i += end + 3
+			}
+			b.WriteByte(' ')
+		case ch == ';':
+			flush()
+		default:
+			b.WriteByte(ch)
+		}
+	}
+	flush()
+	return
+}
@@ -0,0 +1,79 @@
+package migrate
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testBox map[string]string
+
+func (b testBox) List() (names []string) {
+	for name := range b {
+		names = append(names, name)
+	}
+	return
+}
+
+func (b testBox) Find(name string) ([]byte, error) {
+	return []byte(b[name]), nil
+}
+
+func TestLoad(t *testing.T) {
+	ms, err := load(Box(testBox{
+		"2_add_age.up.sql":       "ALTER TABLE user ADD age INT;",
+		"1_create_user.up.sql":   "CREATE TABLE user (id BIGINT);",
+		"1_create_user.down.sql": "DROP TABLE user;",
+		"README.md":              "ignored",
+	}))
+	assert.Nil(t, err)
+	assert.Len(t, ms, 2)
+	assert.Equal(t, int64(1), ms[0].Version)
+	assert.Equal(t, "create_user", ms[0].Name)
+	assert.Equal(t, "DROP TABLE user;", ms[0].Down)
+	assert.Equal(t, checksum([]byte("CREATE TABLE user (id BIGINT);")), ms[0].Checksum)
+	assert.Equal(t, "", ms[1].Down)
+
+	_, err = load(Box(testBox{"1_a.up.sql": "", "1_b.up.sql": ""}))
+	assert.NotNil(t, err)
+	_, err = load(Box(testBox{"1_a.down.sql": "DROP TABLE a;"}))
+	assert.NotNil(t, err)
+}
+
+func TestCreate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "migrate")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	up, down, err := Create(dir, "Create User")
+	assert.Nil(t, err)
+	assert.Regexp(t, `^\d{14}_create_user\.up\.sql$`, filepath.Base(up))
+	assert.Regexp(t, `^\d{14}_create_user\.down\.sql$`, filepath.Base(down))
+	ms, err := load(Dir(dir))
+	assert.Nil(t, err)
+	assert.Len(t, ms, 1)
+
+	_, _, err = Create(dir, "drop-user")
+	assert.NotNil(t, err)
+}
+
+func TestStatements(t *testing.T) {
+	stmts := statements(`-- create user
+CREATE TABLE user (
+	id BIGINT NOT NULL, # primary key
+	--name; comment without space
+	--
+	name VARCHAR(32) NOT NULL DEFAULT ';' /* name; */
+);
+/*!40101 SET NAMES utf8mb4 */;
+INSERT INTO user VALUES (1, 'it\'s; ok');
+`)
+	assert.Len(t, stmts, 3)
+	assert.Contains(t, stmts[0], "DEFAULT ';'")
+	assert.NotContains(t, stmts[0], "primary key")
+	assert.NotContains(t, stmts[0], "without space")
+	assert.Equal(t, "/*!40101 SET NAMES utf8mb4 */", stmts[1])
+	assert.Equal(t, `INSERT INTO user VALUES (1, 'it\'s; ok')`, stmts[2])
+}
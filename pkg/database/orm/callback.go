@@ -0,0 +1,65 @@
+package orm
+
+import (
+	"context"
+
+	"github.com/djienet/kratos/pkg/net/trace"
+
+	"github.com/jinzhu/gorm"
+)
+
+const (
+	_contextKey = "kratos:context"
+	_traceKey   = "kratos:trace"
+)
+
+// registerCallbacks registers the callbacks which trace the gorm operations
+// and pass their contexts to the statements, the breaker, metrics and
+// timeouts are done by the conn per statement.
+func registerCallbacks(db *gorm.DB) {
+	cb := db.Callback()
+	cb.Create().Before("gorm:begin_transaction").Register("kratos:before_create", before("create"))
+	cb.Create().After("gorm:commit_or_rollback_transaction").Register("kratos:after_create", after)
+	cb.Update().Before("gorm:assign_updating_attributes").Register("kratos:before_update", before("update"))
+	cb.Update().After("gorm:commit_or_rollback_transaction").Register("kratos:after_update", after)
+	cb.Delete().Before("gorm:begin_transaction").Register("kratos:before_delete", before("delete"))
+	cb.Delete().After("gorm:commit_or_rollback_transaction").Register("kratos:after_delete", after)
+	cb.Query().Before("gorm:query").Register("kratos:before_query", before("query"))
+	cb.Query().After("gorm:after_query").Register("kratos:after_query", after)
+	cb.RowQuery().Before("gorm:row_query").Register("kratos:before_row_query", before("row"))
+	cb.RowQuery().After("gorm:row_query").Register("kratos:after_row_query", after)
+}
+
+func before(command string) func(scope *gorm.Scope) {
+	return func(scope *gorm.Scope) {
+		c := context.Background()
+		if v, ok := scope.Get(_contextKey); ok {
+			c = v.(context.Context)
+		}
+		if err := c.Err(); err != nil {
+			scope.Err(err)
+			scope.SkipLeft()
+			return
+		}
+		if t, ok := trace.FromContext(c); ok {
+			scope.InstanceSet(_traceKey, t.Fork(_family, command))
+		}
+		// gorm sends the statements without context, pass c to the conn as
+		// the first argument.
+		scope.SQLVars = append(scope.SQLVars, ctxArg{c})
+	}
+}
+
+func after(scope *gorm.Scope) {
+	v, ok := scope.InstanceGet(_traceKey)
+	if !ok {
+		return
+	}
+	err := scope.DB().Error
+	if gorm.IsRecordNotFoundError(err) {
+		err = nil
+	}
+	t := v.(trace.Trace)
+	t.SetTag(trace.String(trace.TagComment, scope.SQL))
+	t.Finish(&err)
+}
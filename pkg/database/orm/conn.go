@@ -0,0 +1,462 @@
+package orm
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"sync/atomic"
+	"time"
+
+	"github.com/djienet/kratos/pkg/ecode"
+	"github.com/djienet/kratos/pkg/log"
+	"github.com/djienet/kratos/pkg/net/netutil/breaker"
+	xtime "github.com/djienet/kratos/pkg/time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/pkg/errors"
+)
+
+const (
+	_family          = "orm_client"
+	_slowLogDuration = time.Millisecond * 250
+)
+
+// connector opens the conns of the *sql.DB used by gorm, which are the conns
+// of the write instance. The queries out of transactions are sent to the read
+// instances, every statement is guarded by breaker and timeout.
+type connector struct {
+	driver driver.Driver
+	dsn    string
+	conf   *Config
+	write  *node
+	read   []*node
+	idx    int64
+}
+
+// node database instance, the read ones have their own *sql.DB.
+type node struct {
+	*sql.DB
+	breaker breaker.Breaker
+	conf    *Config
+	addr    string
+}
+
+func open(c *Config, driverName string) (db *sql.DB, err error) {
+	// database/sql has no driver lookup, get it by a db never connected.
+	d, err := sql.Open(driverName, c.DSN)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	drv := d.Driver()
+	d.Close()
+	brkGroup := breaker.NewGroup(c.Breaker)
+	addr := parseDSNAddr(c.DSN)
+	cn := &connector{
+		driver: drv,
+		dsn:    c.DSN,
+		conf:   c,
+		write:  &node{breaker: brkGroup.Get(addr), conf: c, addr: addr},
+	}
+	for _, rd := range c.ReadDSN {
+		r, err := connect(c, driverName, rd, brkGroup)
+		if err != nil {
+			cn.Close()
+			return nil, err
+		}
+		cn.read = append(cn.read, r)
+	}
+	db = sql.OpenDB(cn)
+	db.SetMaxOpenConns(c.Active)
+	db.SetMaxIdleConns(c.Idle)
+	db.SetConnMaxLifetime(time.Duration(c.IdleTimeout))
+	return
+}
+
+func connect(c *Config, driverName, dataSourceName string, brkGroup *breaker.Group) (*node, error) {
+	d, err := sql.Open(driverName, dataSourceName)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	d.SetMaxOpenConns(c.Active)
+	d.SetMaxIdleConns(c.Idle)
+	d.SetConnMaxLifetime(time.Duration(c.IdleTimeout))
+	addr := parseDSNAddr(dataSourceName)
+	return &node{DB: d, breaker: brkGroup.Get(addr), conf: c, addr: addr}, nil
+}
+
+// Connect opens a conn of the write instance.
+func (cn *connector) Connect(c context.Context) (driver.Conn, error) {
+	dc, err := cn.driver.Open(cn.dsn)
+	if err != nil {
+		return nil, err
+	}
+	return &conn{Conn: dc, cn: cn}, nil
+}
+
+// Driver returns the driver of the write instance.
+func (cn *connector) Driver() driver.Driver {
+	return cn.driver
+}
+
+// Close closes the read databases, it is called by the Close of the *sql.DB.
+func (cn *connector) Close() (err error) {
+	for _, rd := range cn.read {
+		if e := rd.Close(); e != nil {
+			err = errors.WithStack(e)
+		}
+	}
+	return
+}
+
+func (cn *connector) readIndex() int {
+	if len(cn.read) == 0 {
+		return 0
+	}
+	v := atomic.AddInt64(&cn.idx, 1)
+	return int(v) % len(cn.read)
+}
+
+// ctxArg carries the context of a statement from the callbacks to the conn,
+// gorm sends the statements without context. It is the first argument of the
+// statement and never sent to the driver.
+type ctxArg struct {
+	context.Context
+}
+
+// statementContext returns the context carried by args and the arguments of
+// the statement, c if args carry none.
+func statementContext(c context.Context, args []driver.NamedValue) (context.Context, []driver.NamedValue) {
+	if len(args) == 0 {
+		return c, args
+	}
+	a, ok := args[0].Value.(ctxArg)
+	if !ok {
+		return c, args
+	}
+	nvs := make([]driver.NamedValue, len(args)-1)
+	for i := range nvs {
+		nvs[i] = args[i+1]
+		nvs[i].Ordinal = i + 1
+	}
+	return a.Context, nvs
+}
+
+// conn is a conn of the write instance.
+type conn struct {
+	driver.Conn
+	cn *connector
+	// tx reports whether a transaction is running on the conn, its queries
+	// are not sent to the read instances.
+	tx bool
+}
+
+// CheckNamedValue accepts ctxArg, the others are checked by the driver.
+func (cc *conn) CheckNamedValue(nv *driver.NamedValue) error {
+	if _, ok := nv.Value.(ctxArg); ok {
+		return nil
+	}
+	if c, ok := cc.Conn.(driver.NamedValueChecker); ok {
+		return c.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+// Ping pings the write instance.
+func (cc *conn) Ping(c context.Context) error {
+	if p, ok := cc.Conn.(driver.Pinger); ok {
+		return p.Ping(c)
+	}
+	return nil
+}
+
+// ResetSession resets the session of the conn before reused.
+func (cc *conn) ResetSession(c context.Context) error {
+	if r, ok := cc.Conn.(driver.SessionResetter); ok {
+		return r.ResetSession(c)
+	}
+	return nil
+}
+
+// Begin starts a transaction, it is used by gorm for the implicit
+// transactions of create/update/delete whose statements carry the context.
+func (cc *conn) Begin() (driver.Tx, error) {
+	return cc.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+// BeginTx starts a transaction on the write instance, the begin is bounded by
+// TranTimeout.
+func (cc *conn) BeginTx(c context.Context, opts driver.TxOptions) (tx driver.Tx, err error) {
+	w := cc.cn.write
+	now := time.Now()
+	defer slowLog("Begin", now)
+	if err = w.breaker.Allow(); err != nil {
+		_metricReqErr.Inc(w.addr, w.addr, "begin", "breaker")
+		return
+	}
+	c, cancel := shrink(c, cc.cn.conf.TranTimeout)
+	if b, ok := cc.Conn.(driver.ConnBeginTx); ok {
+		tx, err = b.BeginTx(c, opts)
+	} else {
+		tx, err = cc.Conn.Begin()
+	}
+	cancel()
+	w.onBreaker(&err)
+	_metricReqDur.Observe(int64(time.Since(now)/time.Millisecond), w.addr, w.addr, "begin")
+	if err != nil {
+		return
+	}
+	cc.tx = true
+	return &connTx{Tx: tx, cc: cc}, nil
+}
+
+// ExecContext executes a query on the write instance.
+func (cc *conn) ExecContext(c context.Context, query string, args []driver.NamedValue) (res driver.Result, err error) {
+	c, args = statementContext(c, args)
+	w := cc.cn.write
+	now := time.Now()
+	defer slowLog(fmt.Sprintf("Exec query(%s) args(%+v)", query, args), now)
+	if err = w.breaker.Allow(); err != nil {
+		_metricReqErr.Inc(w.addr, w.addr, "exec", "breaker")
+		return
+	}
+	c, cancel := shrink(c, cc.cn.conf.ExecTimeout)
+	res, err = execConn(c, cc.Conn, query, args)
+	cancel()
+	w.onBreaker(&err)
+	_metricReqDur.Observe(int64(time.Since(now)/time.Millisecond), w.addr, w.addr, "exec")
+	return
+}
+
+// QueryContext executes a query on the read instances unless in a
+// transaction, it falls back to the next instance when the breaker is open
+// and finally to the write instance.
+func (cc *conn) QueryContext(c context.Context, query string, args []driver.NamedValue) (rows driver.Rows, err error) {
+	c, args = statementContext(c, args)
+	if cn := cc.cn; !cc.tx {
+		idx := cn.readIndex()
+		for i := range cn.read {
+			if rows, err = cn.read[(idx+i)%len(cn.read)].query(c, query, args); !ecode.EqualError(ecode.ServiceUnavailable, err) {
+				return
+			}
+		}
+	}
+	w := cc.cn.write
+	now := time.Now()
+	defer slowLog(fmt.Sprintf("Query query(%s) args(%+v)", query, args), now)
+	if err = w.breaker.Allow(); err != nil {
+		_metricReqErr.Inc(w.addr, w.addr, "query", "breaker")
+		return
+	}
+	c, cancel := shrink(c, cc.cn.conf.QueryTimeout)
+	if rows, err = queryConn(c, cc.Conn, query, args); err != nil {
+		cancel()
+	} else {
+		rows = &closeRows{Rows: rows, cancel: cancel}
+	}
+	w.onBreaker(&err)
+	_metricReqDur.Observe(int64(time.Since(now)/time.Millisecond), w.addr, w.addr, "query")
+	return
+}
+
+// connTx marks the end of the transaction on the conn.
+type connTx struct {
+	driver.Tx
+	cc *conn
+}
+
+func (t *connTx) Commit() error {
+	t.cc.tx = false
+	return t.Tx.Commit()
+}
+
+func (t *connTx) Rollback() error {
+	t.cc.tx = false
+	return t.Tx.Rollback()
+}
+
+func (n *node) onBreaker(err *error) {
+	if err != nil && *err != nil && *err != sql.ErrNoRows && *err != sql.ErrTxDone {
+		n.breaker.MarkFailed()
+	} else {
+		n.breaker.MarkSuccess()
+	}
+}
+
+// query executes a query on the read instance, the context bounded by
+// QueryTimeout is released when the rows are closed.
+func (n *node) query(c context.Context, query string, args []driver.NamedValue) (rows driver.Rows, err error) {
+	now := time.Now()
+	defer slowLog(fmt.Sprintf("Query query(%s) args(%+v)", query, args), now)
+	if err = n.breaker.Allow(); err != nil {
+		_metricReqErr.Inc(n.addr, n.addr, "query", "breaker")
+		return
+	}
+	c, cancel := shrink(c, n.conf.QueryTimeout)
+	rs, err := n.QueryContext(c, query, namedArgs(args)...)
+	n.onBreaker(&err)
+	_metricReqDur.Observe(int64(time.Since(now)/time.Millisecond), n.addr, n.addr, "query")
+	if err != nil {
+		cancel()
+		return
+	}
+	cols, err := rs.Columns()
+	if err != nil {
+		rs.Close()
+		cancel()
+		return
+	}
+	return &closeRows{Rows: &sqlRows{rs: rs, cols: cols}, cancel: cancel}, nil
+}
+
+// execConn executes a query on the driver conn, the query is prepared if the
+// driver can't execute it directly.
+func execConn(c context.Context, dc driver.Conn, query string, args []driver.NamedValue) (driver.Result, error) {
+	if e, ok := dc.(driver.ExecerContext); ok {
+		if res, err := e.ExecContext(c, query, args); err != driver.ErrSkip {
+			return res, err
+		}
+	}
+	st, err := prepare(c, dc, query)
+	if err != nil {
+		return nil, err
+	}
+	defer st.Close()
+	if s, ok := st.(driver.StmtExecContext); ok {
+		return s.ExecContext(c, args)
+	}
+	return st.Exec(values(args))
+}
+
+// queryConn executes a query on the driver conn, the query is prepared if the
+// driver can't execute it directly and closed with the rows.
+func queryConn(c context.Context, dc driver.Conn, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if q, ok := dc.(driver.QueryerContext); ok {
+		if rows, err := q.QueryContext(c, query, args); err != driver.ErrSkip {
+			return rows, err
+		}
+	}
+	st, err := prepare(c, dc, query)
+	if err != nil {
+		return nil, err
+	}
+	var rows driver.Rows
+	if s, ok := st.(driver.StmtQueryContext); ok {
+		rows, err = s.QueryContext(c, args)
+	} else {
+		rows, err = st.Query(values(args))
+	}
+	if err != nil {
+		st.Close()
+		return nil, err
+	}
+	return &closeRows{Rows: rows, stmt: st}, nil
+}
+
+func prepare(c context.Context, dc driver.Conn, query string) (driver.Stmt, error) {
+	if p, ok := dc.(driver.ConnPrepareContext); ok {
+		return p.PrepareContext(c, query)
+	}
+	return dc.Prepare(query)
+}
+
+func values(args []driver.NamedValue) []driver.Value {
+	vs := make([]driver.Value, len(args))
+	for i, arg := range args {
+		vs[i] = arg.Value
+	}
+	return vs
+}
+
+func namedArgs(args []driver.NamedValue) []interface{} {
+	vs := make([]interface{}, len(args))
+	for i, arg := range args {
+		if arg.Name != "" {
+			vs[i] = sql.Named(arg.Name, arg.Value)
+		} else {
+			vs[i] = arg.Value
+		}
+	}
+	return vs
+}
+
+// closeRows releases the statement and the context of the rows on Close.
+type closeRows struct {
+	driver.Rows
+	stmt   driver.Stmt
+	cancel context.CancelFunc
+}
+
+func (r *closeRows) Close() error {
+	err := r.Rows.Close()
+	if r.stmt != nil {
+		r.stmt.Close()
+	}
+	if r.cancel != nil {
+		r.cancel()
+	}
+	return err
+}
+
+// sqlRows is the driver.Rows of the rows of a read instance.
+type sqlRows struct {
+	rs   *sql.Rows
+	cols []string
+}
+
+func (r *sqlRows) Columns() []string {
+	return r.cols
+}
+
+func (r *sqlRows) Close() error {
+	return r.rs.Close()
+}
+
+func (r *sqlRows) Next(dest []driver.Value) error {
+	if !r.rs.Next() {
+		if err := r.rs.Err(); err != nil {
+			return err
+		}
+		return io.EOF
+	}
+	// scanning into *interface{} keeps the values of the driver.
+	vs := make([]interface{}, len(dest))
+	ptrs := make([]interface{}, len(dest))
+	for i := range vs {
+		ptrs[i] = &vs[i]
+	}
+	if err := r.rs.Scan(ptrs...); err != nil {
+		return err
+	}
+	for i, v := range vs {
+		dest[i] = v
+	}
+	return nil
+}
+
+// shrink returns a context with the timeout, the zero timeout means no timeout.
+func shrink(c context.Context, timeout xtime.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return c, func() {}
+	}
+	_, c, cancel := timeout.Shrink(c)
+	return c, cancel
+}
+
+// parseDSNAddr parse dsn name and return addr.
+func parseDSNAddr(dsn string) (addr string) {
+	cfg, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		// just ignore parseDSN error, mysql client will return error for us when connect.
+		return ""
+	}
+	return cfg.Addr
+}
+
+func slowLog(statement string, now time.Time) {
+	du := time.Since(now)
+	if du > _slowLogDuration {
+		log.Warn("%s slow log statement: %s time: %v", _family, statement, du)
+	}
+}
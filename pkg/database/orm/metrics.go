@@ -0,0 +1,23 @@
+package orm
+
+import "github.com/djienet/kratos/pkg/stat/metric"
+
+const namespace = "orm_client"
+
+var (
+	_metricReqDur = metric.NewHistogramVec(&metric.HistogramVecOpts{
+		Namespace: namespace,
+		Subsystem: "requests",
+		Name:      "duration_ms",
+		Help:      "orm client requests duration(ms).",
+		Labels:    []string{"name", "addr", "command"},
+		Buckets:   []float64{5, 10, 25, 50, 100, 250, 500, 1000, 2500},
+	})
+	_metricReqErr = metric.NewCounterVec(&metric.CounterVecOpts{
+		Namespace: namespace,
+		Subsystem: "requests",
+		Name:      "error_total",
+		Help:      "orm client requests error count.",
+		Labels:    []string{"name", "addr", "command", "error"},
+	})
+)
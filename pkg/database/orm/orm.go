@@ -1,11 +1,12 @@
 package orm
 
 import (
+	"context"
 	"strings"
-	"time"
 
 	"github.com/djienet/kratos/pkg/ecode"
 	"github.com/djienet/kratos/pkg/log"
+	"github.com/djienet/kratos/pkg/net/netutil/breaker"
 	xtime "github.com/djienet/kratos/pkg/time"
 
 	// database driver
@@ -15,10 +16,15 @@ import (
 
 // Config mysql config.
 type Config struct {
-	DSN         string         // data source name.
-	Active      int            // pool
-	Idle        int            // pool
-	IdleTimeout xtime.Duration // connect max life time.
+	DSN          string          // write data source name.
+	ReadDSN      []string        // read data source name.
+	Active       int             // pool
+	Idle         int             // pool
+	IdleTimeout  xtime.Duration  // connect max life time.
+	QueryTimeout xtime.Duration  // query sql timeout, zero means no timeout.
+	ExecTimeout  xtime.Duration  // execute sql timeout, zero means no timeout.
+	TranTimeout  xtime.Duration  // transaction sql timeout, zero means no timeout.
+	Breaker      *breaker.Config // breaker
 }
 
 type ormLog struct{}
@@ -32,15 +38,30 @@ func init() {
 }
 
 // NewMySQL new db and retry connection when has error.
+// Queries out of transactions are sent to ReadDSN if configured, db.DB()
+// returns the *sql.DB of the write instance. The operations are traced with
+// the context set by WithContext.
 func NewMySQL(c *Config) (db *gorm.DB) {
-	db, err := gorm.Open("mysql", c.DSN)
+	d, err := open(c, "mysql")
 	if err != nil {
 		log.Error("db dsn(%s) error: %v", c.DSN, err)
 		panic(err)
 	}
-	db.DB().SetMaxIdleConns(c.Idle)
-	db.DB().SetMaxOpenConns(c.Active)
-	db.DB().SetConnMaxLifetime(time.Duration(c.IdleTimeout) / time.Second)
+	if db, err = gorm.Open("mysql", d); err != nil {
+		log.Error("db dsn(%s) error: %v", c.DSN, err)
+		panic(err)
+	}
 	db.SetLogger(ormLog{})
+	registerCallbacks(db)
 	return
 }
+
+// WithContext returns a db whose operations are traced by c and rejected once
+// c is done. The statements are sent with c and bounded by QueryTimeout or
+// ExecTimeout, including the ones of create/update/delete in the implicit
+// transactions of gorm, e.g.
+//
+//	orm.WithContext(ctx, d.db).Where("id = ?", id).First(&user)
+func WithContext(c context.Context, db *gorm.DB) *gorm.DB {
+	return db.Set(_contextKey, c)
+}
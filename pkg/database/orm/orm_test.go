@@ -0,0 +1,226 @@
+package orm
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/djienet/kratos/pkg/ecode"
+	"github.com/djienet/kratos/pkg/net/netutil/breaker"
+
+	"github.com/jinzhu/gorm"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeDriver records the statements per dsn and returns one row for queries.
+type fakeDriver struct {
+	sync.Mutex
+	stmts map[string][]string
+	// values is the values of ctxKey of the contexts of the statements.
+	values []interface{}
+}
+
+type ctxKey struct{}
+
+type fakeConn struct {
+	d   *fakeDriver
+	dsn string
+}
+
+type fakeStmt struct {
+	c     *fakeConn
+	query string
+}
+
+type fakeRows struct {
+	count bool
+	done  bool
+}
+
+type fakeResult struct{}
+
+var _fake = &fakeDriver{stmts: make(map[string][]string)}
+
+func init() {
+	sql.Register("orm_fake", _fake)
+}
+
+func (d *fakeDriver) Open(dsn string) (driver.Conn, error) { return &fakeConn{d: d, dsn: dsn}, nil }
+
+func (d *fakeDriver) reset() {
+	d.Lock()
+	d.stmts = make(map[string][]string)
+	d.values = nil
+	d.Unlock()
+}
+
+func (d *fakeDriver) count(dsn string) int {
+	d.Lock()
+	defer d.Unlock()
+	return len(d.stmts[dsn])
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	c.d.Lock()
+	c.d.stmts[c.dsn] = append(c.d.stmts[c.dsn], query)
+	c.d.Unlock()
+	return &fakeStmt{c: c, query: query}, nil
+}
+func (c *fakeConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	c.d.Lock()
+	c.d.values = append(c.d.values, ctx.Value(ctxKey{}))
+	c.d.Unlock()
+	return c.Prepare(query)
+}
+func (c *fakeConn) Close() error              { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error) { return c, nil }
+func (c *fakeConn) Commit() error             { return nil }
+func (c *fakeConn) Rollback() error           { return nil }
+
+func (s *fakeStmt) Close() error                                    { return nil }
+func (s *fakeStmt) NumInput() int                                   { return -1 }
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) { return fakeResult{}, nil }
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return &fakeRows{count: strings.Contains(s.query, "count(*)")}, nil
+}
+
+func (fakeResult) LastInsertId() (int64, error) { return 1, nil }
+func (fakeResult) RowsAffected() (int64, error) { return 1, nil }
+
+func (r *fakeRows) Columns() []string {
+	if r.count {
+		return []string{"count(*)"}
+	}
+	return []string{"id", "name"}
+}
+func (r *fakeRows) Close() error { return nil }
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	r.done = true
+	if r.count {
+		dest[0] = int64(1)
+		return nil
+	}
+	dest[0], dest[1] = int64(1), "kratos"
+	return nil
+}
+
+type user struct {
+	ID   int64
+	Name string
+}
+
+func newTestNode(t *testing.T, dsn string, brk breaker.Breaker) *node {
+	d, err := sql.Open("orm_fake", dsn)
+	assert.Nil(t, err)
+	return &node{DB: d, breaker: brk, conf: &Config{}, addr: dsn}
+}
+
+func newTestDB(t *testing.T, read ...breaker.Breaker) *gorm.DB {
+	brkGroup := breaker.NewGroup(nil)
+	c := &Config{}
+	cn := &connector{driver: _fake, dsn: "write", conf: c, write: &node{breaker: brkGroup.Get("write"), conf: c, addr: "write"}}
+	for i, brk := range read {
+		cn.read = append(cn.read, newTestNode(t, []string{"read0", "read1"}[i], brk))
+	}
+	db, err := gorm.Open("mysql", sql.OpenDB(cn))
+	assert.Nil(t, err)
+	db.SetLogger(ormLog{})
+	registerCallbacks(db)
+	return db
+}
+
+type openBreaker struct{}
+
+func (openBreaker) Allow() error { return ecode.ServiceUnavailable }
+func (openBreaker) MarkSuccess() {}
+func (openBreaker) MarkFailed()  {}
+
+func TestReadWriteSplit(t *testing.T) {
+	_fake.reset()
+	brkGroup := breaker.NewGroup(nil)
+	db := newTestDB(t, brkGroup.Get("read0"), brkGroup.Get("read1"))
+	u := new(user)
+	assert.Nil(t, db.First(u).Error)
+	assert.Equal(t, "kratos", u.Name)
+	assert.Nil(t, db.First(u).Error)
+	assert.Equal(t, 1, _fake.count("read0"))
+	assert.Equal(t, 1, _fake.count("read1"))
+	assert.Equal(t, 0, _fake.count("write"))
+
+	assert.Nil(t, db.Model(u).Update("name", "warden").Error)
+	assert.Nil(t, db.Exec("DELETE FROM users").Error)
+	assert.Equal(t, 2, _fake.count("write"))
+}
+
+func TestReadBreaker(t *testing.T) {
+	_fake.reset()
+	db := newTestDB(t, openBreaker{}, openBreaker{})
+	var n int
+	assert.Nil(t, db.Model(&user{}).Count(&n).Error)
+	assert.Nil(t, db.Find(&[]*user{}).Error)
+	assert.Equal(t, 0, _fake.count("read0"))
+	assert.Equal(t, 2, _fake.count("write"))
+}
+
+func TestWithContext(t *testing.T) {
+	_fake.reset()
+	db := newTestDB(t)
+	c, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := WithContext(c, db).Create(&user{Name: "kratos"}).Error
+	assert.Equal(t, context.Canceled, err)
+	err = WithContext(c, db).First(&user{}).Error
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, 0, _fake.count("write"))
+
+	assert.Nil(t, WithContext(context.Background(), db).Create(&user{Name: "kratos"}).Error)
+	assert.Equal(t, 1, _fake.count("write"))
+}
+
+func TestStatementContext(t *testing.T) {
+	_fake.reset()
+	brkGroup := breaker.NewGroup(nil)
+	db := newTestDB(t, brkGroup.Get("read0"))
+	c := context.WithValue(context.Background(), ctxKey{}, "request")
+	u := new(user)
+	assert.Nil(t, WithContext(c, db).First(u).Error)
+	assert.Equal(t, "kratos", u.Name)
+	var n int
+	assert.Nil(t, WithContext(c, db).Raw("SELECT count(*) FROM users").Row().Scan(&n))
+	assert.Equal(t, 1, n)
+	assert.Nil(t, db.First(u).Error)
+	assert.Equal(t, []interface{}{"request", "request", nil}, _fake.values)
+}
+
+func TestTransactionContext(t *testing.T) {
+	_fake.reset()
+	brkGroup := breaker.NewGroup(nil)
+	db := newTestDB(t, brkGroup.Get("read0"))
+	c := context.WithValue(context.Background(), ctxKey{}, "request")
+	// the insert of the implicit transaction is sent with c.
+	assert.Nil(t, WithContext(c, db).Create(&user{Name: "kratos"}).Error)
+	tx := db.Begin()
+	assert.Nil(t, tx.First(&user{}).Error)
+	assert.Nil(t, tx.Commit().Error)
+	assert.Equal(t, 0, _fake.count("read0"))
+	assert.Equal(t, 2, _fake.count("write"))
+	assert.Equal(t, []interface{}{"request", nil}, _fake.values)
+	// the queries out of the transaction go to the read instance again.
+	assert.Nil(t, db.First(&user{}).Error)
+	assert.Equal(t, 1, _fake.count("read0"))
+}
+
+func TestSQLDB(t *testing.T) {
+	db := newTestDB(t)
+	db.DB().SetMaxIdleConns(2)
+	assert.Nil(t, db.DB().Ping())
+	assert.Equal(t, 1, db.DB().Stats().OpenConnections)
+	assert.Nil(t, db.Close())
+}
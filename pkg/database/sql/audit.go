@@ -0,0 +1,146 @@
+package sql
+
+import (
+	"context"
+	"database/sql"
+	"math/rand"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/djienet/kratos/pkg/log"
+	"github.com/djienet/kratos/pkg/net/trace"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/pkg/errors"
+)
+
+// Audit is the audit record of a statement.
+type Audit struct {
+	Addr        string
+	Command     string
+	Fingerprint string
+	Query       string
+	// ArgNames is the names of Args, see Fingerprint.
+	ArgNames []string
+	Args     []interface{}
+	// RowsAffected is -1 for queries.
+	RowsAffected int64
+	Duration     time.Duration
+	TraceID      string
+	Err          error
+}
+
+// AuditHandler handles the sampled audit records.
+type AuditHandler func(c context.Context, a *Audit)
+
+// LogAudit is the default AuditHandler, it logs the args keyed by the column
+// names, so the sensitive columns in the log Filter are masked.
+func LogAudit(c context.Context, a *Audit) {
+	d := make([]log.D, 0, len(a.Args)+6)
+	d = append(d,
+		log.KVString("sql_addr", a.Addr),
+		log.KVString("sql_command", a.Command),
+		log.KVString("sql_fingerprint", a.Fingerprint),
+		log.KVInt64("sql_rows_affected", a.RowsAffected),
+		log.KVDuration("sql_duration", a.Duration),
+	)
+	for i, arg := range a.Args {
+		name := "arg" + strconv.Itoa(i)
+		if i < len(a.ArgNames) {
+			name = a.ArgNames[i]
+		}
+		d = append(d, log.KV(name, arg))
+	}
+	if a.Err != nil {
+		d = append(d, log.KVString("sql_error", a.Err.Error()))
+	}
+	log.Infov(c, d...)
+}
+
+// auditor samples the statements for the audit handler.
+type auditor struct {
+	sample  float64
+	handler atomic.Value
+}
+
+func newAuditor(sample float64) *auditor {
+	a := &auditor{sample: sample}
+	a.handler.Store(AuditHandler(LogAudit))
+	return a
+}
+
+// SetAuditHandler sets the handler of the sampled audit records, LogAudit is
+// used by default. The audit log is enabled by Config.AuditSample.
+func (db *DB) SetAuditHandler(h AuditHandler) {
+	if h == nil {
+		h = LogAudit
+	}
+	if db.write.audit != nil {
+		db.write.audit.handler.Store(h)
+	}
+}
+
+// record records the fingerprint metrics and samples the audit record of a
+// statement.
+func (db *conn) record(c context.Context, command, query string, args []interface{}, now time.Time, res sql.Result, err error) {
+	dur := time.Since(now)
+	st := parse(query)
+	fp := db.label(st.fingerprint)
+	_metricFingerprintDur.Observe(int64(dur/time.Millisecond), db.addr, fp)
+	if err != nil && errors.Cause(err) != ErrNoRows {
+		_metricFingerprintErr.Inc(db.addr, fp, errCode(err))
+	}
+	if db.audit == nil || db.audit.sample <= 0 || rand.Float64() >= db.audit.sample {
+		return
+	}
+	a := &Audit{
+		Addr:         db.addr,
+		Command:      command,
+		Fingerprint:  st.fingerprint,
+		Query:        query,
+		ArgNames:     st.argNames,
+		Args:         args,
+		RowsAffected: -1,
+		Duration:     dur,
+		Err:          err,
+	}
+	if res != nil {
+		if n, e := res.RowsAffected(); e == nil {
+			a.RowsAffected = n
+		}
+	}
+	if t, ok := trace.FromContext(c); ok {
+		a.TraceID = t.TraceID()
+	}
+	db.audit.handler.Load().(AuditHandler)(c, a)
+}
+
+// recordErr records the error of a statement returned after the query, e.g.
+// Row.Scan.
+func (db *conn) recordErr(query string, err error) {
+	_metricFingerprintErr.Inc(db.addr, db.label(parse(query).fingerprint), errCode(err))
+}
+
+func (db *conn) label(fp string) string {
+	max := db.conf.MaxFingerprints
+	if max <= 0 {
+		max = _defaultMaxFingerprints
+	}
+	return label(fp, max)
+}
+
+func errCode(err error) string {
+	switch e := errors.Cause(err).(type) {
+	case *mysql.MySQLError:
+		return strconv.Itoa(int(e.Number))
+	default:
+		if e == context.DeadlineExceeded {
+			return "timeout"
+		}
+		if e == context.Canceled {
+			return "canceled"
+		}
+		return "error"
+	}
+}
@@ -0,0 +1,200 @@
+package sql
+
+import (
+	"database/sql/driver"
+	"reflect"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var _valuerType = reflect.TypeOf((*driver.Valuer)(nil)).Elem()
+
+// Named compiles the :name parameters of query to ? and returns the args
+// bound from arg, which is a struct (or pointer) mapped like QueryStructs or
+// a map with string keys. The :name in the quoted strings and comments and
+// the :: (e.g. the casts of postgres x::int) are kept as is. e.g.
+//
+//	query, args, err := sql.Named("SELECT id FROM user WHERE name=:name AND age>:age", u)
+func Named(query string, arg interface{}) (string, []interface{}, error) {
+	lookup, err := namedLookup(arg)
+	if err != nil {
+		return "", nil, err
+	}
+	var (
+		b    strings.Builder
+		args []interface{}
+	)
+	b.Grow(len(query))
+	for i := 0; i < len(query); i++ {
+		ch := query[i]
+		if j := skipLiteral(query, i); j > i {
+			b.WriteString(query[i:j])
+			i = j - 1
+			continue
+		}
+		switch {
+		case ch == ':' && i+1 < len(query) && query[i+1] == ':':
+			b.WriteString("::")
+			i++
+		case ch == ':' && i+1 < len(query) && isNameStart(query[i+1]):
+			j := i + 1
+			for j < len(query) && isNameChar(query[j]) {
+				j++
+			}
+			name := query[i+1 : j]
+			v, ok := lookup(name)
+			if !ok {
+				return "", nil, errors.Errorf("sql: could not find name %s in %T", name, arg)
+			}
+			args = append(args, v)
+			b.WriteByte('?')
+			i = j - 1
+		default:
+			b.WriteByte(ch)
+		}
+	}
+	return b.String(), args, nil
+}
+
+func namedLookup(arg interface{}) (func(name string) (interface{}, bool), error) {
+	v := reflect.ValueOf(arg)
+	for v.Kind() == reflect.Ptr && !v.IsNil() {
+		v = v.Elem()
+	}
+	switch {
+	case v.Kind() == reflect.Map && v.Type().Key().Kind() == reflect.String:
+		return func(name string) (interface{}, bool) {
+			e := v.MapIndex(reflect.ValueOf(name).Convert(v.Type().Key()))
+			if !e.IsValid() {
+				return nil, false
+			}
+			return e.Interface(), true
+		}, nil
+	case v.Kind() == reflect.Struct:
+		fields := fieldsOf(v.Type())
+		return func(name string) (interface{}, bool) {
+			index, ok := fields[name]
+			if !ok {
+				return nil, false
+			}
+			f, ok := valueByIndex(v, index)
+			if !ok {
+				// the embedded struct pointer is nil.
+				return nil, true
+			}
+			return f.Interface(), true
+		}, nil
+	}
+	return nil, errors.Errorf("sql: named args must be a struct or map, got %T", arg)
+}
+
+// valueByIndex returns the nested field of v without allocating the nil
+// embedded struct pointers.
+func valueByIndex(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return v, false
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
+
+// skipLiteral returns the end of the quoted string or the comment starting
+// at i of query, or i if there is none.
+func skipLiteral(query string, i int) int {
+	switch ch := query[i]; {
+	case ch == '\'' || ch == '"' || ch == '`':
+		return quoted(query, i)
+	case ch == '-' && strings.HasPrefix(query[i:], "--"):
+		if j := strings.IndexByte(query[i:], '\n'); j >= 0 {
+			return i + j
+		}
+		return len(query)
+	case ch == '/' && strings.HasPrefix(query[i:], "/*"):
+		if j := strings.Index(query[i+2:], "*/"); j >= 0 {
+			return i + j + 4
+		}
+		return len(query)
+	}
+	return i
+}
+
+func isNameStart(ch byte) bool {
+	return ch == '_' || ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z'
+}
+
+func isNameChar(ch byte) bool {
+	return isNameStart(ch) || ch >= '0' && ch <= '9'
+}
+
+// In expands the ? of the slice args to ?, ?, ? and flattens the args, e.g.
+//
+//	query, args, err := sql.In("SELECT name FROM user WHERE id IN (?) AND age>?", []int64{1, 2, 3}, 18)
+//
+// unlike joining the values into query, the values are still bound as args.
+// []byte and driver.Valuer args are not expanded, the ? in the quoted strings
+// and comments are kept as is.
+func In(query string, args ...interface{}) (string, []interface{}, error) {
+	var (
+		b   strings.Builder
+		res = make([]interface{}, 0, len(args))
+		n   int
+	)
+	b.Grow(len(query))
+	for i := 0; i < len(query); i++ {
+		ch := query[i]
+		if j := skipLiteral(query, i); j > i {
+			b.WriteString(query[i:j])
+			i = j - 1
+			continue
+		}
+		switch ch {
+		case '?':
+			if n >= len(args) {
+				return "", nil, errors.Errorf("sql: too few args for query %s", query)
+			}
+			arg := args[n]
+			n++
+			v := reflect.ValueOf(arg)
+			if !expandable(v) {
+				res = append(res, arg)
+				b.WriteByte('?')
+				continue
+			}
+			if v.Len() == 0 {
+				return "", nil, errors.Errorf("sql: empty slice for the %dth arg of query %s", n, query)
+			}
+			for j := 0; j < v.Len(); j++ {
+				if j > 0 {
+					b.WriteString(", ")
+				}
+				b.WriteByte('?')
+				res = append(res, v.Index(j).Interface())
+			}
+		default:
+			b.WriteByte(ch)
+		}
+	}
+	if n != len(args) {
+		return "", nil, errors.Errorf("sql: too many args for query %s", query)
+	}
+	return b.String(), res, nil
+}
+
+func expandable(v reflect.Value) bool {
+	if !v.IsValid() || v.Type().Implements(_valuerType) {
+		return false
+	}
+	switch v.Kind() {
+	case reflect.Slice:
+		return v.Type().Elem().Kind() != reflect.Uint8
+	case reflect.Array:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,78 @@
+package sql
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type bindUser struct {
+	ID   int64 `db:"id"`
+	Name string
+	Age  int
+	*BindExtra
+}
+
+type BindExtra struct {
+	Email string
+}
+
+func TestNamed(t *testing.T) {
+	u := &bindUser{ID: 1, Name: "kratos", Age: 18}
+	query, args, err := Named("SELECT id FROM user WHERE id=:id AND name=:name AND note=':age' AND age>:age", u)
+	assert.Nil(t, err)
+	assert.Equal(t, "SELECT id FROM user WHERE id=? AND name=? AND note=':age' AND age>?", query)
+	assert.Equal(t, []interface{}{int64(1), "kratos", 18}, args)
+
+	query, args, err = Named("SELECT id FROM user WHERE email=:email", u)
+	assert.Nil(t, err)
+	assert.Equal(t, "SELECT id FROM user WHERE email=?", query)
+	assert.Equal(t, []interface{}{nil}, args)
+
+	query, args, err = Named("SELECT '2019-01-01 00::00' FROM user WHERE id IN (:ids)", map[string]interface{}{"ids": []int{1, 2}})
+	assert.Nil(t, err)
+	assert.Equal(t, "SELECT '2019-01-01 00::00' FROM user WHERE id IN (?)", query)
+	assert.Equal(t, []interface{}{[]int{1, 2}}, args)
+
+	query, args, err = Named("SELECT id::text FROM user -- :note\nWHERE /* :uid */ age>:age::int", u)
+	assert.Nil(t, err)
+	assert.Equal(t, "SELECT id::text FROM user -- :note\nWHERE /* :uid */ age>?::int", query)
+	assert.Equal(t, []interface{}{18}, args)
+
+	_, _, err = Named("SELECT id FROM user WHERE id=:uid", u)
+	assert.NotNil(t, err)
+	_, _, err = Named("SELECT id FROM user WHERE id=:id", 1)
+	assert.NotNil(t, err)
+}
+
+func TestIn(t *testing.T) {
+	query, args, err := In("SELECT name FROM user WHERE id IN (?) AND name<>'?' AND age>? AND data=?", []int64{1, 2, 3}, 18, []byte("x"))
+	assert.Nil(t, err)
+	assert.Equal(t, "SELECT name FROM user WHERE id IN (?, ?, ?) AND name<>'?' AND age>? AND data=?", query)
+	assert.Equal(t, []interface{}{int64(1), int64(2), int64(3), 18, []byte("x")}, args)
+
+	query, args, err = In("SELECT name FROM user -- age>?\nWHERE /* name=? */ id IN (?)", []int64{1, 2})
+	assert.Nil(t, err)
+	assert.Equal(t, "SELECT name FROM user -- age>?\nWHERE /* name=? */ id IN (?, ?)", query)
+	assert.Equal(t, []interface{}{int64(1), int64(2)}, args)
+
+	_, _, err = In("SELECT name FROM user WHERE id IN (?)", []int64{})
+	assert.NotNil(t, err)
+	_, _, err = In("SELECT name FROM user WHERE id IN (?)")
+	assert.NotNil(t, err)
+	_, _, err = In("SELECT name FROM user WHERE id=?", 1, 2)
+	assert.NotNil(t, err)
+}
+
+func TestSnakeCase(t *testing.T) {
+	for name, want := range map[string]string{
+		"ID":         "id",
+		"UserID":     "user_id",
+		"CreatedAt":  "created_at",
+		"HTTPServer": "http_server",
+		"Mid2Name":   "mid2_name",
+		"name":       "name",
+	} {
+		assert.Equal(t, want, snakeCase(name), name)
+	}
+}
@@ -0,0 +1,62 @@
+package sql
+
+import (
+	"github.com/pkg/errors"
+)
+
+// drivers supported by Config.Driver.
+const (
+	DriverMySQL    = "mysql"
+	DriverPostgres = "postgres"
+)
+
+// dialect is the differences between the drivers.
+type dialect struct {
+	name string
+	// addr parses the address of a dsn.
+	addr func(dsn string) string
+	// rebind rewrites the ? placeholders of a query, nil means no rewriting.
+	rebind func(query string) string
+	// translate maps the driver errors to ecodes, nil means no mapping.
+	translate func(err error) error
+	// lagQuery returns the replication lag query of the heartbeat table, nil
+	// means the mysql way.
+	lagQuery func(table string) string
+}
+
+var _dialects = map[string]*dialect{
+	DriverMySQL: {name: DriverMySQL, addr: parseDSNAddr},
+	DriverPostgres: {
+		name:      DriverPostgres,
+		addr:      parsePostgresAddr,
+		rebind:    rebindDollar,
+		translate: translatePostgres,
+		lagQuery:  postgresLagQuery,
+	},
+}
+
+func dialectOf(c *Config) (*dialect, error) {
+	name := c.Driver
+	if name == "" {
+		name = DriverMySQL
+	}
+	d, ok := _dialects[name]
+	if !ok {
+		return nil, errors.Errorf("sql: unknown driver %s", name)
+	}
+	return d, nil
+}
+
+func (db *conn) rebind(query string) string {
+	if db.dialect == nil || db.dialect.rebind == nil {
+		return query
+	}
+	return db.dialect.rebind(query)
+}
+
+func (db *conn) translate(err error) error {
+	if err == nil || db.dialect == nil || db.dialect.translate == nil {
+		return err
+	}
+	return db.dialect.translate(err)
+}
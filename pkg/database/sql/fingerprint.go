@@ -0,0 +1,274 @@
+package sql
+
+import (
+	"container/list"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+const (
+	_tokenWord = iota
+	_tokenLiteral
+	_tokenParam
+	_tokenPunct
+)
+
+const (
+	_defaultMaxFingerprints = 500
+	_maxStatementCache      = 10000
+	// _otherFingerprint is the label of the fingerprints over MaxFingerprints.
+	_otherFingerprint = "other"
+)
+
+var (
+	_inList     = regexp.MustCompile(`in\(\?(?:, \?)*\)`)
+	_valuesList = regexp.MustCompile(`values\(\?(?:, \?)*\)(?:, \(\?(?:, \?)*\))*`)
+
+	// _statements is the lru of the parsed statements by query, the queries
+	// with literals are not cached since they are rarely run twice.
+	_statements = struct {
+		sync.Mutex
+		m   map[string]*list.Element
+		lru *list.List
+	}{m: make(map[string]*list.Element), lru: list.New()}
+
+	// _fingerprints is the fingerprints used as metric labels.
+	_fingerprints = struct {
+		sync.RWMutex
+		m map[string]struct{}
+	}{m: make(map[string]struct{})}
+)
+
+type token struct {
+	kind int
+	text string
+}
+
+// statement is the parsed info of a query.
+type statement struct {
+	query       string
+	fingerprint string
+	argNames    []string
+}
+
+// Fingerprint returns the shape of a query: comments are removed, literals
+// are replaced with ?, keywords and identifiers are lower cased, IN lists and
+// multi-row VALUES are collapsed, e.g.
+//
+//	SELECT * FROM user WHERE id IN (1, 2, 3) AND name='kratos'
+//
+// is fingerprinted to
+//
+//	select * from user where id in(?+) and name = ?
+func Fingerprint(query string) string {
+	return parse(query).fingerprint
+}
+
+func parse(query string) *statement {
+	_statements.Lock()
+	if e, ok := _statements.m[query]; ok {
+		_statements.lru.MoveToFront(e)
+		_statements.Unlock()
+		return e.Value.(*statement)
+	}
+	_statements.Unlock()
+	tokens := tokenize(query)
+	st := &statement{query: query, fingerprint: fingerprint(tokens), argNames: argNames(tokens)}
+	for _, tk := range tokens {
+		if tk.kind == _tokenLiteral {
+			return st
+		}
+	}
+	_statements.Lock()
+	if _, ok := _statements.m[query]; !ok {
+		_statements.m[query] = _statements.lru.PushFront(st)
+		if _statements.lru.Len() > _maxStatementCache {
+			e := _statements.lru.Back()
+			_statements.lru.Remove(e)
+			delete(_statements.m, e.Value.(*statement).query)
+		}
+	}
+	_statements.Unlock()
+	return st
+}
+
+func fingerprint(tokens []token) string {
+	var b strings.Builder
+	var prev string
+	for i, tk := range tokens {
+		text := tk.text
+		switch tk.kind {
+		case _tokenLiteral, _tokenParam:
+			text = "?"
+		case _tokenWord:
+			text = strings.ToLower(strings.Trim(text, "`"))
+		}
+		if i > 0 && prev != "(" && prev != "." && text != ")" && text != "," && text != "." &&
+			!(text == "(" && tokens[i-1].kind == _tokenWord) {
+			b.WriteByte(' ')
+		}
+		b.WriteString(text)
+		prev = text
+	}
+	fp := _inList.ReplaceAllString(b.String(), "in(?+)")
+	return _valuesList.ReplaceAllString(fp, "values(?+)")
+}
+
+// argNames names the placeholders by the compared columns or the columns of
+// INSERT, the others are named argN.
+func argNames(tokens []token) (names []string) {
+	var (
+		cols   []string
+		values = -1
+	)
+	for i, tk := range tokens {
+		if tk.kind == _tokenWord {
+			switch strings.ToLower(tk.text) {
+			case "values", "value":
+				// INSERT INTO t (a, b) VALUES (?, ?)
+				if values < 0 && i > 0 && tokens[i-1].text == ")" {
+					for j := i - 2; j >= 0 && tokens[j].text != "("; j-- {
+						if tokens[j].kind == _tokenWord {
+							cols = append([]string{column(tokens[j].text)}, cols...)
+						}
+					}
+					values = 0
+				}
+			}
+			continue
+		}
+		if tk.kind != _tokenParam {
+			continue
+		}
+		name := fmt.Sprintf("arg%d", len(names))
+		if values >= 0 && len(cols) > 0 {
+			name = cols[values%len(cols)]
+			values++
+		} else if i >= 2 && tokens[i-2].kind == _tokenWord && isComparison(tokens[i-1].text) {
+			name = column(tokens[i-2].text)
+		}
+		names = append(names, name)
+	}
+	return
+}
+
+func column(ident string) string {
+	if i := strings.LastIndexByte(ident, '.'); i >= 0 {
+		ident = ident[i+1:]
+	}
+	return strings.ToLower(strings.Trim(ident, "`"))
+}
+
+func isComparison(op string) bool {
+	switch strings.ToLower(op) {
+	case "=", "<", ">", "<=", ">=", "!=", "<>", "<=>", "like":
+		return true
+	}
+	return false
+}
+
+func tokenize(query string) (tokens []token) {
+	for i := 0; i < len(query); {
+		ch := query[i]
+		switch {
+		case ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r':
+			i++
+		case ch == '#' || (ch == '-' && strings.HasPrefix(query[i:], "-- ")):
+			for i < len(query) && query[i] != '\n' {
+				i++
+			}
+		case ch == '/' && strings.HasPrefix(query[i:], "/*"):
+			if j := strings.Index(query[i+2:], "*/"); j >= 0 {
+				i += j + 4
+			} else {
+				i = len(query)
+			}
+		case ch == '\'' || ch == '"':
+			j := quoted(query, i)
+			tokens = append(tokens, token{_tokenLiteral, query[i:j]})
+			i = j
+		case ch == '`':
+			j := quoted(query, i)
+			for j < len(query) && (query[j] == '.' || isWord(query[j])) {
+				j++
+			}
+			tokens = append(tokens, token{_tokenWord, query[i:j]})
+			i = j
+		case ch == '?':
+			tokens = append(tokens, token{_tokenParam, "?"})
+			i++
+		case ch >= '0' && ch <= '9':
+			j := i
+			for j < len(query) && (isWord(query[j]) || query[j] == '.') {
+				j++
+			}
+			tokens = append(tokens, token{_tokenLiteral, query[i:j]})
+			i = j
+		case isWord(ch):
+			j := i
+			for j < len(query) && (isWord(query[j]) || query[j] == '.' || query[j] == '`') {
+				j++
+			}
+			tokens = append(tokens, token{_tokenWord, query[i:j]})
+			i = j
+		case ch == '<' || ch == '>' || ch == '=' || ch == '!':
+			j := i
+			for j < len(query) && strings.IndexByte("<>=!", query[j]) >= 0 {
+				j++
+			}
+			tokens = append(tokens, token{_tokenPunct, query[i:j]})
+			i = j
+		default:
+			tokens = append(tokens, token{_tokenPunct, query[i : i+1]})
+			i++
+		}
+	}
+	return
+}
+
+// quoted returns the end of the quoted text starts at i.
+func quoted(query string, i int) int {
+	q := query[i]
+	for j := i + 1; j < len(query); j++ {
+		switch query[j] {
+		case '\\':
+			j++
+		case q:
+			if j+1 < len(query) && query[j+1] == q {
+				j++
+				continue
+			}
+			return j + 1
+		}
+	}
+	return len(query)
+}
+
+func isWord(ch byte) bool {
+	return ch == '_' || ch == '$' || (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z') || (ch >= '0' && ch <= '9') || ch >= 0x80
+}
+
+// label returns the fingerprint as a metric label, the fingerprints over
+// max are labeled as other.
+func label(fp string, max int) string {
+	_fingerprints.RLock()
+	_, ok := _fingerprints.m[fp]
+	n := len(_fingerprints.m)
+	_fingerprints.RUnlock()
+	if ok {
+		return fp
+	}
+	if n >= max {
+		return _otherFingerprint
+	}
+	_fingerprints.Lock()
+	if len(_fingerprints.m) < max {
+		_fingerprints.m[fp] = struct{}{}
+	} else if _, ok = _fingerprints.m[fp]; !ok {
+		fp = _otherFingerprint
+	}
+	_fingerprints.Unlock()
+	return fp
+}
@@ -0,0 +1,74 @@
+package sql
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFingerprint(t *testing.T) {
+	cases := map[string]string{
+		"SELECT id, name FROM user WHERE id=?":                          "select id, name from user where id = ?",
+		"select  id,name\nfrom `user` where id = 10 -- comment":         "select id, name from user where id = ?",
+		"SELECT * FROM user WHERE name='kr''atos' AND mid IN (1, 2, 3)": "select * from user where name = ? and mid in(?+)",
+		"SELECT * FROM user WHERE mid IN (?,?) /* hint */":              "select * from user where mid in(?+)",
+		"INSERT INTO user (id, name) VALUES (1, 'a'), (2, \"b\")":       "insert into user(id, name) values(?+)",
+		"SELECT COUNT(*) FROM user WHERE ctime >= ? AND u.mid<>-1.5":    "select count(*) from user where ctime >= ? and u.mid <> - ?",
+	}
+	for query, fp := range cases {
+		assert.Equal(t, fp, Fingerprint(query), query)
+	}
+}
+
+func TestArgNames(t *testing.T) {
+	assert.Equal(t, []string{"name", "password", "arg2"}, parse("SELECT id FROM user WHERE u.name=? AND `password` = ? LIMIT ?").argNames)
+	assert.Equal(t, []string{"id", "password", "id", "password"}, parse("INSERT INTO user (id, `password`) VALUES (?, ?), (?, ?)").argNames)
+}
+
+func TestStatementCache(t *testing.T) {
+	cached := func(query string) bool {
+		_statements.Lock()
+		defer _statements.Unlock()
+		_, ok := _statements.m[query]
+		return ok
+	}
+	parse("SELECT * FROM cache WHERE id=10")
+	assert.False(t, cached("SELECT * FROM cache WHERE id=10"), "query with literals should not be cached")
+	first := "SELECT * FROM cache WHERE id=?"
+	parse(first)
+	assert.True(t, cached(first))
+	for i := 0; i < _maxStatementCache; i++ {
+		parse(fmt.Sprintf("SELECT * FROM cache_%d WHERE id=?", i))
+	}
+	assert.False(t, cached(first), "the least recently used query should be evicted")
+	_statements.Lock()
+	assert.Equal(t, _maxStatementCache, _statements.lru.Len())
+	assert.Len(t, _statements.m, _maxStatementCache)
+	_statements.Unlock()
+}
+
+func TestLabel(t *testing.T) {
+	assert.Equal(t, "label_a", label("label_a", len(_fingerprints.m)+1))
+	assert.Equal(t, _otherFingerprint, label("label_b", len(_fingerprints.m)))
+	assert.Equal(t, "label_a", label("label_a", 1))
+}
+
+func TestAudit(t *testing.T) {
+	db := newFakeDB(t)
+	db.write.audit = newAuditor(1)
+	var audits []*Audit
+	db.SetAuditHandler(func(c context.Context, a *Audit) {
+		audits = append(audits, a)
+	})
+	query := "SELECT id FROM user WHERE id > ?"
+	_fakeResults[query] = _fakeResults["SELECT id FROM user"]
+	rows, err := db.Query(context.Background(), query, 1)
+	assert.Nil(t, err)
+	rows.Close()
+	assert.Len(t, audits, 1)
+	assert.Equal(t, "select id from user where id > ?", audits[0].Fingerprint)
+	assert.Equal(t, []string{"id"}, audits[0].ArgNames)
+	assert.Equal(t, int64(-1), audits[0].RowsAffected)
+}
@@ -34,4 +34,47 @@ var (
 		Help:      "mysql client connections current.",
 		Labels:    []string{"name", "addr", "state"},
 	})
+	_metricReplicaLag = metric.NewGaugeVec(&metric.GaugeVecOpts{
+		Namespace: namespace,
+		Subsystem: "replica",
+		Name:      "lag_seconds",
+		Help:      "mysql client replica replication lag(seconds), -1 means broken.",
+		Labels:    []string{"name", "addr"},
+	})
+	_metricPoolWait = metric.NewGaugeVec(&metric.GaugeVecOpts{
+		Namespace: namespace,
+		Subsystem: "pool",
+		Name:      "wait_count",
+		Help:      "mysql client pool total number of connections waited for.",
+		Labels:    []string{"name", "addr"},
+	})
+	_metricPoolWaitDur = metric.NewGaugeVec(&metric.GaugeVecOpts{
+		Namespace: namespace,
+		Subsystem: "pool",
+		Name:      "wait_duration_ms",
+		Help:      "mysql client pool total time blocked waiting for connections(ms).",
+		Labels:    []string{"name", "addr"},
+	})
+	_metricFingerprintDur = metric.NewHistogramVec(&metric.HistogramVecOpts{
+		Namespace: namespace,
+		Subsystem: "fingerprint",
+		Name:      "duration_ms",
+		Help:      "mysql client statements duration(ms) by fingerprint.",
+		Labels:    []string{"name", "fingerprint"},
+		Buckets:   []float64{5, 10, 25, 50, 100, 250, 500, 1000, 2500},
+	})
+	_metricFingerprintErr = metric.NewCounterVec(&metric.CounterVecOpts{
+		Namespace: namespace,
+		Subsystem: "fingerprint",
+		Name:      "error_total",
+		Help:      "mysql client statements error count by fingerprint.",
+		Labels:    []string{"name", "fingerprint", "error"},
+	})
+	_metricLeak = metric.NewCounterVec(&metric.CounterVecOpts{
+		Namespace: namespace,
+		Subsystem: "pool",
+		Name:      "leak_total",
+		Help:      "mysql client rows and transactions not closed within the leak threshold.",
+		Labels:    []string{"name", "addr", "kind"},
+	})
 )
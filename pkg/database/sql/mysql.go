@@ -11,6 +11,7 @@ import (
 
 // Config mysql config.
 type Config struct {
+	Driver       string          // mysql or postgres, default mysql.
 	DSN          string          // write data source name.
 	ReadDSN      []string        // read data source name.
 	Active       int             // pool
@@ -20,6 +21,26 @@ type Config struct {
 	ExecTimeout  time.Duration   // execute sql timeout
 	TranTimeout  time.Duration   // transaction sql timeout
 	Breaker      *breaker.Config // breaker
+	// MaxReplicaLag enables the replication lag check of ReadDSN, the read
+	// instances lag behind more than it are skipped.
+	MaxReplicaLag    time.Duration
+	LagCheckInterval time.Duration // lag check interval, default 1s.
+	// HeartbeatTable is the pt-heartbeat table (ts in UTC) to measure the lag,
+	// SHOW SLAVE STATUS is used if empty.
+	HeartbeatTable string
+	// StickyMaster is the duration the reads are sent to master after a write
+	// with the context returned by NewContext.
+	StickyMaster time.Duration
+	// StatInterval is the interval to export the pool statistics, default 10s.
+	StatInterval time.Duration
+	// LeakThreshold enables the leak detection, the Rows and Tx not closed
+	// within it are reported with the stacks where they are created.
+	LeakThreshold time.Duration
+	// MaxFingerprints caps the distinct fingerprints of the metrics, the
+	// others are labeled as other, default 500.
+	MaxFingerprints int
+	// AuditSample is the sample ratio(0~1) of the audit log, zero disables it.
+	AuditSample float64
 }
 
 // NewMySQL new db and retry connection when has error.
@@ -0,0 +1,44 @@
+package sql
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/djienet/kratos/pkg/database/internal/pool"
+)
+
+// Stats returns the connection pool statistics of the instances by address.
+func (db *DB) Stats() map[string]sql.DBStats {
+	stats := make(map[string]sql.DBStats, len(db.read)+1)
+	stats[db.write.addr] = db.write.Stats()
+	for _, rd := range db.read {
+		stats[rd.addr] = rd.Stats()
+	}
+	return stats
+}
+
+// statproc exports the pool statistics and reports the leaked Rows and Tx
+// of the instances periodically.
+func (db *DB) statproc(c context.Context, conf *Config) {
+	pool.StatProc(c, time.Duration(conf.StatInterval), func() {
+		db.write.stat()
+		for _, rd := range db.read {
+			rd.stat()
+		}
+	})
+}
+
+func (db *conn) stat() {
+	s := db.Stats()
+	_metricConnCurrent.Set(float64(s.OpenConnections), db.addr, db.addr, "open")
+	_metricConnCurrent.Set(float64(s.InUse), db.addr, db.addr, "in_use")
+	_metricConnCurrent.Set(float64(s.Idle), db.addr, db.addr, "idle")
+	_metricPoolWait.Set(float64(s.WaitCount), db.addr, db.addr)
+	_metricPoolWaitDur.Set(float64(s.WaitDuration/time.Millisecond), db.addr, db.addr)
+	db.leak.Check(db.addr)
+}
+
+func newLeakDetector(threshold time.Duration) *pool.LeakDetector {
+	return pool.NewLeakDetector(_family, threshold, _metricLeak)
+}
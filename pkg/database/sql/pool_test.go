@@ -0,0 +1,37 @@
+package sql
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLeakDetector(t *testing.T) {
+	db := newFakeDB(t)
+	db.write.leak = newLeakDetector(time.Millisecond)
+
+	rows, err := db.Query(context.Background(), "SELECT id FROM user")
+	assert.Nil(t, err)
+	closed, err := db.Query(context.Background(), "SELECT id FROM user")
+	assert.Nil(t, err)
+	closed.Close()
+	drained, err := db.Query(context.Background(), "SELECT id FROM user")
+	assert.Nil(t, err)
+	for drained.Next() {
+	}
+
+	time.Sleep(5 * time.Millisecond)
+	assert.Equal(t, 1, db.write.leak.Check("fake"))
+	// reported only once
+	assert.Equal(t, 0, db.write.leak.Check("fake"))
+	rows.Close()
+}
+
+func TestStats(t *testing.T) {
+	db := newFakeDB(t)
+	stats := db.Stats()
+	assert.Contains(t, stats, "fake")
+	db.write.stat()
+}
@@ -0,0 +1,129 @@
+package sql
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/djienet/kratos/pkg/ecode"
+	"github.com/djienet/kratos/pkg/log"
+
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+)
+
+// NewPostgres new postgres db and retry connection when has error, the ?
+// placeholders of the queries are rewritten to $n, use ?? for a literal ?.
+func NewPostgres(c *Config) (db *DB) {
+	if c.QueryTimeout == 0 || c.ExecTimeout == 0 || c.TranTimeout == 0 {
+		panic("postgres must be set query/execute/transction timeout")
+	}
+	c.Driver = DriverPostgres
+	db, err := Open(c)
+	if err != nil {
+		log.Error("open postgres error(%v)", err)
+		panic(err)
+	}
+	return
+}
+
+// parsePostgresAddr parses the addr of both the url and the key/value dsn.
+func parsePostgresAddr(dsn string) (addr string) {
+	host, port := "localhost", "5432"
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		u, err := url.Parse(dsn)
+		if err != nil {
+			return ""
+		}
+		if u.Hostname() != "" {
+			host = u.Hostname()
+		}
+		if u.Port() != "" {
+			port = u.Port()
+		}
+		return net.JoinHostPort(host, port)
+	}
+	for _, kv := range strings.Fields(dsn) {
+		i := strings.IndexByte(kv, '=')
+		if i < 0 {
+			continue
+		}
+		switch v := strings.Trim(kv[i+1:], "'"); kv[:i] {
+		case "host":
+			host = v
+		case "port":
+			port = v
+		}
+	}
+	return net.JoinHostPort(host, port)
+}
+
+// rebindDollar rewrites the ? placeholders to $1, $2..., the ? in quotes and
+// comments are kept and ?? is unescaped to ?.
+func rebindDollar(query string) string {
+	if strings.IndexByte(query, '?') < 0 {
+		return query
+	}
+	var (
+		b strings.Builder
+		n int
+	)
+	b.Grow(len(query) + 8)
+	for i := 0; i < len(query); i++ {
+		ch := query[i]
+		switch {
+		case ch == '\'' || ch == '"':
+			j := quoted(query, i)
+			b.WriteString(query[i:j])
+			i = j - 1
+		case ch == '-' && strings.HasPrefix(query[i:], "--"):
+			j := strings.IndexByte(query[i:], '\n')
+			if j < 0 {
+				j = len(query) - i
+			}
+			b.WriteString(query[i : i+j])
+			i += j - 1
+		case ch == '/' && strings.HasPrefix(query[i:], "/*"):
+			j := strings.Index(query[i+2:], "*/")
+			if j < 0 {
+				j = len(query) - i - 4
+			}
+			b.WriteString(query[i : i+j+4])
+			i += j + 3
+		case ch == '?' && strings.HasPrefix(query[i:], "??"):
+			b.WriteByte('?')
+			i++
+		case ch == '?':
+			n++
+			fmt.Fprintf(&b, "$%d", n)
+		default:
+			b.WriteByte(ch)
+		}
+	}
+	return b.String()
+}
+
+// translatePostgres maps the serialization failures and deadlocks to ecodes.
+func translatePostgres(err error) error {
+	e, ok := err.(*pq.Error)
+	if !ok {
+		return err
+	}
+	switch e.Code {
+	case "40001": // serialization_failure
+		return errors.Wrap(ecode.SerializationFailure, e.Message)
+	case "40P01": // deadlock_detected
+		return errors.Wrap(ecode.Deadlock, e.Message)
+	}
+	return err
+}
+
+// postgresLagQuery returns the query of the replication lag in seconds, NULL
+// means the replication is broken.
+func postgresLagQuery(table string) string {
+	if table != "" {
+		return fmt.Sprintf("SELECT EXTRACT(EPOCH FROM (NOW() AT TIME ZONE 'UTC') - MAX(ts)) FROM %s", table)
+	}
+	return "SELECT CASE WHEN pg_is_in_recovery() THEN EXTRACT(EPOCH FROM NOW() - pg_last_xact_replay_timestamp()) ELSE 0 END"
+}
@@ -0,0 +1,195 @@
+package sql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/djienet/kratos/pkg/log"
+
+	"github.com/pkg/errors"
+)
+
+const _defaultLagCheckInterval = time.Second
+
+type masterKey struct{}
+
+// masterPin is the deadline until which the reads are sent to master.
+type masterPin struct {
+	until int64
+}
+
+// NewContext returns a context which records the writes, the reads with it
+// are sent to master for Config.StickyMaster after a successful write.
+// It is called once per request in a middleware, e.g. of blademaster:
+//
+//	engine.Use(func(c *bm.Context) {
+//		c.Context = sql.NewContext(c.Context)
+//	})
+//
+// or of warden:
+//
+//	server.Use(func(c context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+//		return handler(sql.NewContext(c), req)
+//	})
+func NewContext(c context.Context) context.Context {
+	return context.WithValue(c, masterKey{}, new(masterPin))
+}
+
+// WithMaster returns a context whose reads are always sent to master.
+func WithMaster(c context.Context) context.Context {
+	return context.WithValue(c, masterKey{}, &masterPin{until: math.MaxInt64})
+}
+
+func pinned(c context.Context) bool {
+	p, ok := c.Value(masterKey{}).(*masterPin)
+	return ok && time.Now().UnixNano() < atomic.LoadInt64(&p.until)
+}
+
+func markWrite(c context.Context, sticky time.Duration) {
+	if sticky <= 0 {
+		return
+	}
+	p, ok := c.Value(masterKey{}).(*masterPin)
+	if !ok {
+		return
+	}
+	until := time.Now().Add(sticky).UnixNano()
+	for {
+		old := atomic.LoadInt64(&p.until)
+		if old >= until || atomic.CompareAndSwapInt64(&p.until, old, until) {
+			return
+		}
+	}
+}
+
+// lagproc measures the replication lag of the read instances periodically,
+// the instances lag behind more than MaxReplicaLag are skipped by reads.
+func (db *DB) lagproc(c context.Context, conf *Config) {
+	interval := time.Duration(conf.LagCheckInterval)
+	if interval <= 0 {
+		interval = _defaultLagCheckInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		for _, rd := range db.read {
+			rd.checkLag(c, conf)
+		}
+		if c.Err() != nil {
+			return
+		}
+		select {
+		case <-ticker.C:
+		case <-c.Done():
+			return
+		}
+	}
+}
+
+// checkLag measures the replication lag of the instance, the last state is
+// kept if it fails, so that an instance is not skipped by reads because the
+// lag can't be checked, e.g. without the privilege. The error is logged once
+// until the check recovers.
+func (db *conn) checkLag(c context.Context, conf *Config) {
+	lag, err := db.replicationLag(c, conf.HeartbeatTable)
+	if err != nil {
+		if db.lagErrs++; db.lagErrs == 1 && c.Err() == nil {
+			log.Error("%s replica(%s) check lag error(%v), keep lagging(%t)", _family, db.addr, err, db.isLagging())
+		}
+		return
+	}
+	if db.lagErrs > 0 {
+		log.Info("%s replica(%s) check lag recovered after %d errors", _family, db.addr, db.lagErrs)
+		db.lagErrs = 0
+	}
+	db.setLag(lag, time.Duration(conf.MaxReplicaLag))
+}
+
+// replicationLag returns the replication lag of the instance, -1 means the
+// replication is broken.
+func (db *conn) replicationLag(c context.Context, table string) (lag time.Duration, err error) {
+	_, c, cancel := db.conf.QueryTimeout.Shrink(c)
+	defer cancel()
+	if db.dialect != nil && db.dialect.lagQuery != nil {
+		var sec sql.NullFloat64
+		query := db.dialect.lagQuery(table)
+		if err = db.QueryRowContext(c, query).Scan(&sec); err != nil {
+			return 0, errors.Wrapf(err, "query:%s", query)
+		}
+		if !sec.Valid {
+			return -1, nil
+		}
+		return time.Duration(sec.Float64 * float64(time.Second)), nil
+	}
+	if table != "" {
+		var sec sql.NullFloat64
+		query := fmt.Sprintf("SELECT TIMESTAMPDIFF(MICROSECOND, MAX(ts), UTC_TIMESTAMP(6)) / 1000000 FROM %s", table)
+		if err = db.QueryRowContext(c, query).Scan(&sec); err != nil {
+			return 0, errors.Wrapf(err, "query:%s", query)
+		}
+		if !sec.Valid {
+			return -1, nil
+		}
+		return time.Duration(sec.Float64 * float64(time.Second)), nil
+	}
+	rows, err := db.QueryContext(c, "SHOW SLAVE STATUS")
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	defer rows.Close()
+	cols, err := rows.Columns()
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	if !rows.Next() {
+		// not a replica.
+		return 0, errors.WithStack(rows.Err())
+	}
+	vals := make([]sql.RawBytes, len(cols))
+	dest := make([]interface{}, len(cols))
+	for i := range vals {
+		dest[i] = &vals[i]
+	}
+	if err = rows.Scan(dest...); err != nil {
+		return 0, errors.WithStack(err)
+	}
+	return secondsBehindMaster(cols, vals)
+}
+
+func secondsBehindMaster(cols []string, vals []sql.RawBytes) (time.Duration, error) {
+	for i, col := range cols {
+		if col != "Seconds_Behind_Master" {
+			continue
+		}
+		if vals[i] == nil {
+			// NULL means the replication threads are not running.
+			return -1, nil
+		}
+		sec, err := strconv.ParseInt(string(vals[i]), 10, 64)
+		if err != nil {
+			return 0, errors.WithStack(err)
+		}
+		return time.Duration(sec) * time.Second, nil
+	}
+	return 0, errors.New("sql: Seconds_Behind_Master not found in slave status")
+}
+
+func (db *conn) setLag(lag, max time.Duration) {
+	var lagging int32
+	if lag < 0 || lag > max {
+		lagging = 1
+	}
+	if old := atomic.SwapInt32(&db.lagging, lagging); old != lagging {
+		log.Warn("%s replica(%s) lag(%v) lagging(%t)", _family, db.addr, lag, lagging == 1)
+	}
+	_metricReplicaLag.Set(lag.Seconds(), db.addr, db.addr)
+}
+
+func (db *conn) isLagging() bool {
+	return atomic.LoadInt32(&db.lagging) == 1
+}
@@ -0,0 +1,76 @@
+package sql
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	xtime "github.com/djienet/kratos/pkg/time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStickyMaster(t *testing.T) {
+	c := context.Background()
+	markWrite(c, time.Second)
+	assert.False(t, pinned(c))
+
+	c = NewContext(c)
+	assert.False(t, pinned(c))
+	markWrite(c, 0)
+	assert.False(t, pinned(c))
+	markWrite(c, 50*time.Millisecond)
+	assert.True(t, pinned(c))
+	// a shorter sticky duration doesn't shorten the pin.
+	markWrite(c, time.Millisecond)
+	time.Sleep(10 * time.Millisecond)
+	assert.True(t, pinned(c))
+	time.Sleep(50 * time.Millisecond)
+	assert.False(t, pinned(c))
+
+	c = WithMaster(context.Background())
+	markWrite(c, time.Millisecond)
+	assert.True(t, pinned(c))
+}
+
+func TestSecondsBehindMaster(t *testing.T) {
+	cols := []string{"Slave_IO_State", "Master_Host", "Seconds_Behind_Master"}
+	lag, err := secondsBehindMaster(cols, []sql.RawBytes{[]byte("Waiting"), []byte("127.0.0.1"), []byte("3")})
+	assert.Nil(t, err)
+	assert.Equal(t, 3*time.Second, lag)
+
+	lag, err = secondsBehindMaster(cols, []sql.RawBytes{[]byte(""), []byte("127.0.0.1"), nil})
+	assert.Nil(t, err)
+	assert.Equal(t, time.Duration(-1), lag)
+
+	_, err = secondsBehindMaster(cols[:2], []sql.RawBytes{nil, nil})
+	assert.NotNil(t, err)
+}
+
+func TestSetLag(t *testing.T) {
+	db := &conn{addr: "127.0.0.1:3306"}
+	db.setLag(time.Second, 2*time.Second)
+	assert.False(t, db.isLagging())
+	db.setLag(3*time.Second, 2*time.Second)
+	assert.True(t, db.isLagging())
+	db.setLag(-1, 2*time.Second)
+	assert.True(t, db.isLagging())
+	db.setLag(0, 2*time.Second)
+	assert.False(t, db.isLagging())
+}
+
+func TestCheckLag(t *testing.T) {
+	d, err := sql.Open("sql_tx", "")
+	assert.Nil(t, err)
+	conf := &Config{MaxReplicaLag: xtime.Duration(time.Second)}
+	// the tx driver fails all the queries.
+	db := &conn{DB: d, conf: conf, addr: "replica"}
+	db.checkLag(context.Background(), conf)
+	assert.False(t, db.isLagging())
+	assert.Equal(t, 1, db.lagErrs)
+	db.setLag(3*time.Second, time.Second)
+	db.checkLag(context.Background(), conf)
+	assert.True(t, db.isLagging())
+	assert.Equal(t, 2, db.lagErrs)
+}
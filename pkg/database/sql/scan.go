@@ -0,0 +1,248 @@
+package sql
+
+import (
+	"context"
+	"database/sql"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	_scannerType = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+	_timeType    = reflect.TypeOf(time.Time{})
+
+	// _fields caches the column to field index mapping of struct types.
+	_fields sync.Map
+)
+
+// QueryStructs executes a query on the read instances and scans all the rows
+// into dest, which must be a pointer to a slice of structs, struct pointers or
+// scalars. Columns are mapped to the fields by the db tag, or the snake case
+// of the field name without tag, the fields of embedded structs are promoted.
+func (db *DB) QueryStructs(c context.Context, dest interface{}, query string, args ...interface{}) (err error) {
+	rows, err := db.Query(c, query, args...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	if err = scanAll(rows.Rows, dest); err != nil {
+		err = errors.Wrapf(err, "query:%s, args:%+v", query, args)
+	}
+	return
+}
+
+// QueryStruct executes a query on the read instances and scans the first row
+// into dest, which must be a pointer to a struct or scalar. ErrNoRows is
+// returned if the query selects no rows.
+func (db *DB) QueryStruct(c context.Context, dest interface{}, query string, args ...interface{}) (err error) {
+	rows, err := db.Query(c, query, args...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	if err = scanOne(rows.Rows, dest); err != nil && err != ErrNoRows {
+		err = errors.Wrapf(err, "query:%s, args:%+v", query, args)
+	}
+	return
+}
+
+// QueryStructs executes a query in the transaction and scans all the rows
+// into dest like DB.QueryStructs.
+func (tx *Tx) QueryStructs(dest interface{}, query string, args ...interface{}) (err error) {
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	if err = scanAll(rows.Rows, dest); err != nil {
+		err = errors.Wrapf(err, "query:%s, args:%+v", query, args)
+	}
+	return
+}
+
+// QueryStruct executes a query in the transaction and scans the first row
+// into dest like DB.QueryStruct.
+func (tx *Tx) QueryStruct(dest interface{}, query string, args ...interface{}) (err error) {
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	if err = scanOne(rows.Rows, dest); err != nil && err != ErrNoRows {
+		err = errors.Wrapf(err, "query:%s, args:%+v", query, args)
+	}
+	return
+}
+
+func scanAll(rows *sql.Rows, dest interface{}) (err error) {
+	v := reflect.ValueOf(dest)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Slice {
+		return errors.Errorf("sql: dest must be a pointer to slice, got %T", dest)
+	}
+	slice := v.Elem()
+	typ := slice.Type().Elem()
+	base, isPtr := typ, typ.Kind() == reflect.Ptr
+	if isPtr {
+		base = typ.Elem()
+	}
+	cols, err := rows.Columns()
+	if err != nil {
+		return
+	}
+	targets, err := targetsOf(base, cols)
+	if err != nil {
+		return
+	}
+	slice.Set(slice.Slice(0, 0))
+	for rows.Next() {
+		e := reflect.New(base)
+		if err = rows.Scan(targets(e.Elem())...); err != nil {
+			return
+		}
+		if isPtr {
+			slice.Set(reflect.Append(slice, e))
+		} else {
+			slice.Set(reflect.Append(slice, e.Elem()))
+		}
+	}
+	return rows.Err()
+}
+
+func scanOne(rows *sql.Rows, dest interface{}) (err error) {
+	v := reflect.ValueOf(dest)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return errors.Errorf("sql: dest must be a non-nil pointer, got %T", dest)
+	}
+	cols, err := rows.Columns()
+	if err != nil {
+		return
+	}
+	targets, err := targetsOf(v.Elem().Type(), cols)
+	if err != nil {
+		return
+	}
+	if !rows.Next() {
+		if err = rows.Err(); err == nil {
+			err = ErrNoRows
+		}
+		return
+	}
+	return rows.Scan(targets(v.Elem())...)
+}
+
+func isScalar(t reflect.Type) bool {
+	return t.Kind() != reflect.Struct || t == _timeType || reflect.PtrTo(t).Implements(_scannerType)
+}
+
+// targetsOf returns the func which returns the scan targets of the columns in v.
+func targetsOf(t reflect.Type, cols []string) (func(v reflect.Value) []interface{}, error) {
+	if isScalar(t) {
+		if len(cols) != 1 {
+			return nil, errors.Errorf("sql: scan %d columns into scalar %s", len(cols), t)
+		}
+		return func(v reflect.Value) []interface{} {
+			return []interface{}{v.Addr().Interface()}
+		}, nil
+	}
+	fields := fieldsOf(t)
+	indexes := make([][]int, len(cols))
+	for i, col := range cols {
+		index, ok := fields[col]
+		if !ok {
+			return nil, errors.Errorf("sql: no field for column %s in %s", col, t)
+		}
+		indexes[i] = index
+	}
+	return func(v reflect.Value) []interface{} {
+		targets := make([]interface{}, len(indexes))
+		for i, index := range indexes {
+			targets[i] = fieldByIndex(v, index).Addr().Interface()
+		}
+		return targets
+	}, nil
+}
+
+// fieldsOf returns the column to field index mapping of struct type t.
+func fieldsOf(t reflect.Type) map[string][]int {
+	if fields, ok := _fields.Load(t); ok {
+		return fields.(map[string][]int)
+	}
+	fields := make(map[string][]int)
+	walkFields(t, nil, fields)
+	_fields.Store(t, fields)
+	return fields
+}
+
+func walkFields(t reflect.Type, index []int, fields map[string][]int) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("db")
+		if tag == "-" {
+			continue
+		}
+		idx := make([]int, len(index)+1)
+		copy(idx, index)
+		idx[len(index)] = i
+		if f.Anonymous && tag == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct && !isScalar(ft) {
+				// pointers to unexported structs can't be allocated.
+				if f.PkgPath == "" || f.Type.Kind() != reflect.Ptr {
+					walkFields(ft, idx, fields)
+				}
+				continue
+			}
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		name := tag
+		if name == "" {
+			name = snakeCase(f.Name)
+		}
+		// the shallower field wins like the promoted fields of go.
+		if old, ok := fields[name]; !ok || len(idx) < len(old) {
+			fields[name] = idx
+		}
+	}
+}
+
+// fieldByIndex returns the nested field of v, the nil embedded struct
+// pointers on the way are allocated.
+func fieldByIndex(v reflect.Value, index []int) reflect.Value {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v
+}
+
+// snakeCase converts CamelCase name to snake_case, e.g. UserID to user_id.
+func snakeCase(name string) string {
+	rs := []rune(name)
+	var b strings.Builder
+	for i, r := range rs {
+		if unicode.IsUpper(r) {
+			if i > 0 && (unicode.IsLower(rs[i-1]) || unicode.IsDigit(rs[i-1]) ||
+				(i+1 < len(rs) && unicode.IsLower(rs[i+1]) && unicode.IsUpper(rs[i-1]))) {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,134 @@
+package sql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/djienet/kratos/pkg/net/netutil/breaker"
+	xtime "github.com/djienet/kratos/pkg/time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeDriver returns the columns and values of _fakeResults by query.
+type fakeDriver struct{}
+
+type fakeConn struct{}
+
+type fakeStmt struct{ query string }
+
+type fakeRows struct {
+	cols []string
+	vals [][]driver.Value
+}
+
+var _fakeResults = map[string]*fakeRows{
+	"SELECT id, name, email, ctime FROM user": {
+		cols: []string{"id", "name", "email", "ctime"},
+		vals: [][]driver.Value{
+			{int64(1), "kratos", "kratos@bilibili.com", time.Unix(1, 0)},
+			{int64(2), "warden", nil, time.Unix(2, 0)},
+		},
+	},
+	"SELECT id FROM user": {
+		cols: []string{"id"},
+		vals: [][]driver.Value{{int64(1)}, {int64(2)}},
+	},
+	"SELECT id, age FROM user": {
+		cols: []string{"id", "age"},
+	},
+}
+
+func init() {
+	sql.Register("sql_fake", fakeDriver{})
+}
+
+func (fakeDriver) Open(string) (driver.Conn, error) { return fakeConn{}, nil }
+
+func (fakeConn) Prepare(query string) (driver.Stmt, error) { return &fakeStmt{query: query}, nil }
+func (fakeConn) Close() error                              { return nil }
+func (fakeConn) Begin() (driver.Tx, error)                 { return nil, driver.ErrSkip }
+
+func (s *fakeStmt) Close() error                                    { return nil }
+func (s *fakeStmt) NumInput() int                                   { return -1 }
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) { return nil, driver.ErrSkip }
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	rs := _fakeResults[s.query]
+	return &fakeRows{cols: rs.cols, vals: rs.vals}, nil
+}
+
+func (r *fakeRows) Columns() []string { return r.cols }
+func (r *fakeRows) Close() error      { return nil }
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.vals) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.vals[0])
+	r.vals = r.vals[1:]
+	return nil
+}
+
+type scanBase struct {
+	ID int64 `db:"id"`
+}
+
+type ScanExtra struct {
+	Email sql.NullString
+}
+
+type scanUser struct {
+	scanBase
+	*ScanExtra
+	Name   string
+	Ctime  time.Time
+	Ignore string `db:"-"`
+}
+
+func newFakeDB(t *testing.T) *DB {
+	d, err := sql.Open("sql_fake", "")
+	assert.Nil(t, err)
+	conf := &Config{QueryTimeout: xtime.Duration(time.Second)}
+	w := &conn{DB: d, breaker: breaker.NewGroup(nil).Get("fake"), conf: conf, addr: "fake"}
+	return &DB{write: w, master: &DB{write: w}}
+}
+
+func TestQueryStructs(t *testing.T) {
+	db := newFakeDB(t)
+	var users []*scanUser
+	assert.Nil(t, db.QueryStructs(context.Background(), &users, "SELECT id, name, email, ctime FROM user"))
+	assert.Len(t, users, 2)
+	assert.Equal(t, int64(1), users[0].ID)
+	assert.Equal(t, "kratos", users[0].Name)
+	assert.Equal(t, "kratos@bilibili.com", users[0].Email.String)
+	assert.False(t, users[1].Email.Valid)
+	assert.Equal(t, int64(2), users[1].Ctime.Unix())
+
+	var values []scanUser
+	assert.Nil(t, db.QueryStructs(context.Background(), &values, "SELECT id, name, email, ctime FROM user"))
+	assert.Len(t, values, 2)
+
+	var ids []int64
+	assert.Nil(t, db.QueryStructs(context.Background(), &ids, "SELECT id FROM user"))
+	assert.Equal(t, []int64{1, 2}, ids)
+
+	assert.NotNil(t, db.QueryStructs(context.Background(), &users, "SELECT id, age FROM user"))
+	assert.NotNil(t, db.QueryStructs(context.Background(), users, "SELECT id FROM user"))
+}
+
+func TestQueryStruct(t *testing.T) {
+	db := newFakeDB(t)
+	u := new(scanUser)
+	assert.Nil(t, db.QueryStruct(context.Background(), u, "SELECT id, name, email, ctime FROM user"))
+	assert.Equal(t, "kratos", u.Name)
+
+	var id int64
+	assert.Nil(t, db.QueryStruct(context.Background(), &id, "SELECT id FROM user"))
+	assert.Equal(t, int64(1), id)
+
+	_fakeResults["SELECT id FROM user WHERE id=0"] = &fakeRows{cols: []string{"id"}}
+	assert.Equal(t, ErrNoRows, db.QueryStruct(context.Background(), &id, "SELECT id FROM user WHERE id=0"))
+}
@@ -0,0 +1,251 @@
+package sql
+
+import (
+	"context"
+	"fmt"
+	"hash/crc32"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/djienet/kratos/pkg/log"
+	"github.com/djienet/kratos/pkg/sync/errgroup"
+
+	"github.com/pkg/errors"
+)
+
+const _defaultTableFormat = "%s_%02d"
+
+// ShardConfig sharded mysql config.
+type ShardConfig struct {
+	Shards []*Config // one config per database shard.
+	// Tables is the number of tables per shard for table-level sharding,
+	// 0 or 1 means no table sharding.
+	Tables int
+	// TableFormat formats the sharded table name by the table name and the
+	// global table index, default "%s_%02d".
+	TableFormat string
+}
+
+// Sharding returns the slot of key in [0, slots), slots is the number of
+// shards times the tables per shard.
+type Sharding func(key int64, slots int) int
+
+// ModSharding shards key by key % slots.
+func ModSharding(key int64, slots int) int {
+	slot := int(key % int64(slots))
+	if slot < 0 {
+		slot += slots
+	}
+	return slot
+}
+
+// RangeSharding returns a sharding which puts the keys in [bounds[i-1], bounds[i])
+// to slot i, the keys not less than the last bound go to the last slot.
+func RangeSharding(bounds ...int64) Sharding {
+	return func(key int64, slots int) int {
+		slot := sort.Search(len(bounds), func(i int) bool { return key < bounds[i] })
+		if slot >= slots {
+			slot = slots - 1
+		}
+		return slot
+	}
+}
+
+// HashSharding returns a consistent hash sharding with replicas virtual nodes
+// per slot, only about 1/slots of the keys move when a slot is added.
+func HashSharding(replicas int) Sharding {
+	var rings sync.Map
+	return func(key int64, slots int) int {
+		v, ok := rings.Load(slots)
+		if !ok {
+			v, _ = rings.LoadOrStore(slots, newHashRing(slots, replicas))
+		}
+		return v.(*hashRing).get(key)
+	}
+}
+
+type hashRing struct {
+	hashes []uint32
+	slots  map[uint32]int
+}
+
+func newHashRing(slots, replicas int) *hashRing {
+	r := &hashRing{slots: make(map[uint32]int, slots*replicas)}
+	for slot := 0; slot < slots; slot++ {
+		for i := 0; i < replicas; i++ {
+			h := crc32.ChecksumIEEE([]byte(fmt.Sprintf("%d-%d", slot, i)))
+			r.hashes = append(r.hashes, h)
+			r.slots[h] = slot
+		}
+	}
+	sort.Slice(r.hashes, func(i, j int) bool { return r.hashes[i] < r.hashes[j] })
+	return r
+}
+
+func (r *hashRing) get(key int64) int {
+	h := crc32.ChecksumIEEE([]byte(strconv.FormatInt(key, 10)))
+	i := sort.Search(len(r.hashes), func(i int) bool { return r.hashes[i] >= h })
+	if i == len(r.hashes) {
+		i = 0
+	}
+	return r.slots[r.hashes[i]]
+}
+
+// Sharded routes the keys to the database shards and tables.
+type Sharded struct {
+	dbs      []*DB
+	tables   int
+	format   string
+	sharding Sharding
+}
+
+// NewSharded new sharded db and panic when has error.
+func NewSharded(c *ShardConfig, sharding Sharding) (s *Sharded) {
+	s, err := OpenSharded(c, sharding)
+	if err != nil {
+		log.Error("open sharded mysql error(%v)", err)
+		panic(err)
+	}
+	return
+}
+
+// OpenSharded opens the database of every shard, the metrics and breakers are
+// per shard instance like DB.
+func OpenSharded(c *ShardConfig, sharding Sharding) (s *Sharded, err error) {
+	if len(c.Shards) == 0 {
+		return nil, errors.New("sql: no shards")
+	}
+	s = &Sharded{tables: c.Tables, format: c.TableFormat, sharding: sharding}
+	if s.tables < 1 {
+		s.tables = 1
+	}
+	if s.format == "" {
+		s.format = _defaultTableFormat
+	}
+	for _, conf := range c.Shards {
+		var db *DB
+		if db, err = Open(conf); err != nil {
+			s.Close()
+			return nil, err
+		}
+		s.dbs = append(s.dbs, db)
+	}
+	return
+}
+
+func (s *Sharded) slot(key int64) int {
+	return s.sharding(key, len(s.dbs)*s.tables)
+}
+
+// ForKey returns the db of the shard key belongs to.
+func (s *Sharded) ForKey(key int64) *DB {
+	return s.dbs[s.slot(key)/s.tables]
+}
+
+// Shards returns the dbs of all shards.
+func (s *Sharded) Shards() []*DB {
+	return s.dbs
+}
+
+// Table returns the sharded table name of key.
+func (s *Sharded) Table(table string, key int64) string {
+	return s.table(table, s.slot(key))
+}
+
+func (s *Sharded) table(table string, slot int) string {
+	if s.tables <= 1 {
+		return table
+	}
+	return fmt.Sprintf(s.format, table, slot)
+}
+
+// Rewrite replaces the {table} placeholders of query with the sharded table
+// names of key, e.g. "SELECT name FROM {user} WHERE id=?" to
+// "SELECT name FROM user_07 WHERE id=?". Only the braces around an identifier
+// are placeholders, the braces in the quoted strings and comments (e.g. the
+// json literals) are kept as is.
+func (s *Sharded) Rewrite(query string, key int64) string {
+	return s.rewrite(query, s.slot(key))
+}
+
+func (s *Sharded) rewrite(query string, slot int) string {
+	if strings.IndexByte(query, '{') < 0 {
+		return query
+	}
+	var b strings.Builder
+	b.Grow(len(query) + 8)
+	for i := 0; i < len(query); i++ {
+		if j := skipLiteral(query, i); j > i {
+			b.WriteString(query[i:j])
+			i = j - 1
+			continue
+		}
+		if j := placeholder(query, i); j > i {
+			b.WriteString(s.table(query[i+1:j-1], slot))
+			i = j - 1
+			continue
+		}
+		b.WriteByte(query[i])
+	}
+	return b.String()
+}
+
+// placeholder returns the end of the {identifier} starting at i of query, or
+// i if there is none.
+func placeholder(query string, i int) int {
+	if query[i] != '{' || i+1 >= len(query) || !isNameStart(query[i+1]) {
+		return i
+	}
+	for j := i + 2; j < len(query); j++ {
+		switch ch := query[j]; {
+		case ch == '}':
+			return j + 1
+		case !isNameChar(ch):
+			return i
+		}
+	}
+	return i
+}
+
+// QueryAll executes the query on every table of every shard concurrently,
+// the {table} placeholders are rewritten per table. fn is called serially
+// with the rows of each table, and all queries are canceled once an error
+// occurs.
+func (s *Sharded) QueryAll(c context.Context, fn func(rows *Rows) error, query string, args ...interface{}) error {
+	var mu sync.Mutex
+	g := errgroup.WithCancel(c)
+	plain := s.rewrite(query, 0)
+	for slot := 0; slot < len(s.dbs)*s.tables; slot++ {
+		db, q := s.dbs[slot/s.tables], plain
+		if s.tables > 1 {
+			// the table names only differ per slot with the table sharding.
+			q = s.rewrite(query, slot)
+		}
+		g.Go(func(ctx context.Context) (err error) {
+			rows, err := db.Query(ctx, q, args...)
+			if err != nil {
+				return
+			}
+			defer rows.Close()
+			mu.Lock()
+			defer mu.Unlock()
+			if err = fn(rows); err == nil {
+				err = rows.Err()
+			}
+			return
+		})
+	}
+	return g.Wait()
+}
+
+// Close closes the dbs of all shards.
+func (s *Sharded) Close() (err error) {
+	for _, db := range s.dbs {
+		if e := db.Close(); e != nil {
+			err = e
+		}
+	}
+	return
+}
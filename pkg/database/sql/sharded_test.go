@@ -0,0 +1,100 @@
+package sql
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSharding(t *testing.T) {
+	assert.Equal(t, 3, ModSharding(7, 4))
+	assert.Equal(t, 1, ModSharding(-7, 4))
+
+	rs := RangeSharding(100, 200)
+	assert.Equal(t, 0, rs(99, 3))
+	assert.Equal(t, 1, rs(100, 3))
+	assert.Equal(t, 2, rs(1000, 3))
+	assert.Equal(t, 1, rs(1000, 2))
+
+	hs := HashSharding(100)
+	counts := make([]int, 4)
+	moved := 0
+	for key := int64(0); key < 10000; key++ {
+		slot := hs(key, 4)
+		assert.Equal(t, slot, hs(key, 4))
+		counts[slot]++
+		if hs(key, 5) != slot {
+			moved++
+		}
+	}
+	for _, n := range counts {
+		assert.True(t, n > 1500, "unbalanced slots %v", counts)
+	}
+	assert.True(t, moved < 3500, "too many keys moved %d", moved)
+}
+
+func newTestSharded(t *testing.T, tables int) *Sharded {
+	return &Sharded{
+		dbs:      []*DB{newFakeDB(t), newFakeDB(t)},
+		tables:   tables,
+		format:   _defaultTableFormat,
+		sharding: ModSharding,
+	}
+}
+
+func TestShardedRoute(t *testing.T) {
+	s := newTestSharded(t, 1)
+	assert.Equal(t, s.dbs[1], s.ForKey(3))
+	assert.Equal(t, "user", s.Table("user", 3))
+	assert.Equal(t, "SELECT name FROM user WHERE id=?", s.Rewrite("SELECT name FROM {user} WHERE id=?", 3))
+
+	s = newTestSharded(t, 4)
+	assert.Equal(t, s.dbs[1], s.ForKey(5))
+	assert.Equal(t, s.dbs[0], s.ForKey(11))
+	assert.Equal(t, "user_05", s.Table("user", 5))
+	assert.Equal(t, "SELECT u.name FROM user_05 u JOIN info_05 i ON u.id=i.id WHERE u.id=?",
+		s.Rewrite("SELECT u.name FROM {user} u JOIN {info} i ON u.id=i.id WHERE u.id=?", 5))
+}
+
+func TestShardedRewriteLiteral(t *testing.T) {
+	for _, tables := range []int{1, 4} {
+		s := newTestSharded(t, tables)
+		table := s.Table("user", 5)
+		for query, want := range map[string]string{
+			"SELECT name FROM user WHERE id=?":                        "SELECT name FROM user WHERE id=?",
+			`UPDATE {user} SET attrs='{"a":{b}}' WHERE id=?`:          `UPDATE ` + table + ` SET attrs='{"a":{b}}' WHERE id=?`,
+			"SELECT name FROM {user} -- {info}\nWHERE id=?":           "SELECT name FROM " + table + " -- {info}\nWHERE id=?",
+			"SELECT name FROM {user} /* {info} */ WHERE note=\"{x}\"": "SELECT name FROM " + table + " /* {info} */ WHERE note=\"{x}\"",
+			"SELECT '{1,2}'::int[], {user}.id FROM {user}":            "SELECT '{1,2}'::int[], " + table + ".id FROM " + table,
+			"SELECT { user}, {1}, {a-b}, {user FROM t":                "SELECT { user}, {1}, {a-b}, {user FROM t",
+		} {
+			assert.Equal(t, want, s.Rewrite(query, 5), "tables %d", tables)
+		}
+	}
+}
+
+func TestQueryAll(t *testing.T) {
+	s := newTestSharded(t, 2)
+	for slot := 0; slot < 4; slot++ {
+		_fakeResults[fmt.Sprintf("SELECT id FROM user_%02d", slot)] = &fakeRows{
+			cols: []string{"id"},
+			vals: [][]driver.Value{{int64(slot)}, {int64(slot + 4)}},
+		}
+	}
+	var ids []int64
+	err := s.QueryAll(context.Background(), func(rows *Rows) error {
+		for rows.Next() {
+			var id int64
+			if err := rows.Scan(&id); err != nil {
+				return err
+			}
+			ids = append(ids, id)
+		}
+		return nil
+	}, "SELECT id FROM {user}")
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []int64{0, 1, 2, 3, 4, 5, 6, 7}, ids)
+}
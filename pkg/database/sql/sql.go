@@ -7,6 +7,7 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/djienet/kratos/pkg/database/internal/pool"
 	"github.com/djienet/kratos/pkg/ecode"
 	"github.com/djienet/kratos/pkg/log"
 	"github.com/djienet/kratos/pkg/net/netutil/breaker"
@@ -40,6 +41,7 @@ type DB struct {
 	read   []*conn
 	idx    int64
 	master *DB
+	cancel func()
 }
 
 // conn database connection
@@ -48,15 +50,28 @@ type conn struct {
 	breaker breaker.Breaker
 	conf    *Config
 	addr    string
+	// lagging is set when the replication lag of a read instance exceeds
+	// Config.MaxReplicaLag.
+	lagging int32
+	// lagErrs is the consecutive errors of the lag check, the last state is
+	// kept on errors, e.g. without the REPLICATION CLIENT privilege.
+	lagErrs int
+	leak    *pool.LeakDetector
+	// audit is shared by the write and read instances.
+	audit   *auditor
+	dialect *dialect
 }
 
 // Tx transaction.
 type Tx struct {
-	db     *conn
-	tx     *sql.Tx
-	t      trace.Trace
-	c      context.Context
-	cancel func()
+	db      *conn
+	tx      *sql.Tx
+	t       trace.Trace
+	c       context.Context
+	cancel  func()
+	untrack func()
+	// savepoint is the sequence of the nested transactions.
+	savepoint int
 }
 
 // Row row.
@@ -84,11 +99,14 @@ func (r *Row) Scan(dest ...interface{}) (err error) {
 	if err != nil {
 		return
 	}
-	err = r.Row.Scan(dest...)
+	err = r.db.translate(r.Row.Scan(dest...))
 	if r.cancel != nil {
 		r.cancel()
 	}
 	r.db.onBreaker(&err)
+	if err != nil && err != ErrNoRows {
+		r.db.recordErr(r.query, err)
+	}
 	if err != ErrNoRows {
 		err = errors.Wrapf(err, "query %s args %+v", r.query, r.args)
 	}
@@ -98,7 +116,20 @@ func (r *Row) Scan(dest ...interface{}) (err error) {
 // Rows rows.
 type Rows struct {
 	*sql.Rows
-	cancel func()
+	cancel  func()
+	untrack func()
+}
+
+// Next prepares the next result row for reading with the Scan method.
+func (rs *Rows) Next() bool {
+	if rs.Rows.Next() {
+		return true
+	}
+	// the rows are closed automatically.
+	if rs.untrack != nil {
+		rs.untrack()
+	}
+	return false
 }
 
 // Close closes the Rows, preventing further enumeration. If Next is called
@@ -110,6 +141,9 @@ func (rs *Rows) Close() (err error) {
 	if rs.cancel != nil {
 		rs.cancel()
 	}
+	if rs.untrack != nil {
+		rs.untrack()
+	}
 	return
 }
 
@@ -127,33 +161,44 @@ type Stmt struct {
 // name and connection information.
 func Open(c *Config) (*DB, error) {
 	db := new(DB)
-	d, err := connect(c, c.DSN)
+	dl, err := dialectOf(c)
+	if err != nil {
+		return nil, err
+	}
+	d, err := connect(c, dl.name, c.DSN)
 	if err != nil {
 		return nil, err
 	}
-	addr := parseDSNAddr(c.DSN)
+	addr := dl.addr(c.DSN)
 	brkGroup := breaker.NewGroup(c.Breaker)
 	brk := brkGroup.Get(addr)
-	w := &conn{DB: d, breaker: brk, conf: c, addr: addr}
+	audit := newAuditor(c.AuditSample)
+	w := &conn{DB: d, breaker: brk, conf: c, addr: addr, leak: newLeakDetector(time.Duration(c.LeakThreshold)), audit: audit, dialect: dl}
 	rs := make([]*conn, 0, len(c.ReadDSN))
 	for _, rd := range c.ReadDSN {
-		d, err := connect(c, rd)
+		d, err := connect(c, dl.name, rd)
 		if err != nil {
 			return nil, err
 		}
-		addr = parseDSNAddr(rd)
+		addr = dl.addr(rd)
 		brk := brkGroup.Get(addr)
-		r := &conn{DB: d, breaker: brk, conf: c, addr: addr}
+		r := &conn{DB: d, breaker: brk, conf: c, addr: addr, leak: newLeakDetector(time.Duration(c.LeakThreshold)), audit: audit, dialect: dl}
 		rs = append(rs, r)
 	}
 	db.write = w
 	db.read = rs
 	db.master = &DB{write: db.write}
+	ctx, cancel := context.WithCancel(context.Background())
+	db.cancel = cancel
+	go db.statproc(ctx, c)
+	if c.MaxReplicaLag > 0 && len(db.read) > 0 {
+		go db.lagproc(ctx, c)
+	}
 	return db, nil
 }
 
-func connect(c *Config, dataSourceName string) (*sql.DB, error) {
-	d, err := sql.Open("mysql", dataSourceName)
+func connect(c *Config, driverName, dataSourceName string) (*sql.DB, error) {
+	d, err := sql.Open(driverName, dataSourceName)
 	if err != nil {
 		err = errors.WithStack(err)
 		return nil, err
@@ -166,7 +211,7 @@ func connect(c *Config, dataSourceName string) (*sql.DB, error) {
 
 // Begin starts a transaction. The isolation level is dependent on the driver.
 func (db *DB) Begin(c context.Context) (tx *Tx, err error) {
-	return db.write.begin(c)
+	return db.write.begin(c, nil)
 }
 
 // Exec executes a query without returning any rows.
@@ -194,10 +239,16 @@ func (db *DB) Prepared(query string) (stmt *Stmt) {
 // Query executes a query that returns rows, typically a SELECT. The args are
 // for any placeholder parameters in the query.
 func (db *DB) Query(c context.Context, query string, args ...interface{}) (rows *Rows, err error) {
-	idx := db.readIndex()
-	for i := range db.read {
-		if rows, err = db.read[(idx+i)%len(db.read)].query(c, query, args...); !ecode.EqualError(ecode.ServiceUnavailable, err) {
-			return
+	if !pinned(c) {
+		idx := db.readIndex()
+		for i := range db.read {
+			rd := db.read[(idx+i)%len(db.read)]
+			if rd.isLagging() {
+				continue
+			}
+			if rows, err = rd.query(c, query, args...); !ecode.EqualError(ecode.ServiceUnavailable, err) {
+				return
+			}
 		}
 	}
 	return db.write.query(c, query, args...)
@@ -207,10 +258,16 @@ func (db *DB) Query(c context.Context, query string, args ...interface{}) (rows
 // QueryRow always returns a non-nil value. Errors are deferred until Row's
 // Scan method is called.
 func (db *DB) QueryRow(c context.Context, query string, args ...interface{}) *Row {
-	idx := db.readIndex()
-	for i := range db.read {
-		if row := db.read[(idx+i)%len(db.read)].queryRow(c, query, args...); !ecode.EqualError(ecode.ServiceUnavailable, row.err) {
-			return row
+	if !pinned(c) {
+		idx := db.readIndex()
+		for i := range db.read {
+			rd := db.read[(idx+i)%len(db.read)]
+			if rd.isLagging() {
+				continue
+			}
+			if row := rd.queryRow(c, query, args...); !ecode.EqualError(ecode.ServiceUnavailable, row.err) {
+				return row
+			}
 		}
 	}
 	return db.write.queryRow(c, query, args...)
@@ -226,6 +283,9 @@ func (db *DB) readIndex() int {
 
 // Close closes the write and read database, releasing any open resources.
 func (db *DB) Close() (err error) {
+	if db.cancel != nil {
+		db.cancel()
+	}
 	if e := db.write.Close(); e != nil {
 		err = errors.WithStack(e)
 	}
@@ -268,7 +328,7 @@ func (db *conn) onBreaker(err *error) {
 	}
 }
 
-func (db *conn) begin(c context.Context) (tx *Tx, err error) {
+func (db *conn) begin(c context.Context, opts *sql.TxOptions) (tx *Tx, err error) {
 	now := time.Now()
 	defer slowLog("Begin", now)
 	t, ok := trace.FromContext(c)
@@ -286,14 +346,14 @@ func (db *conn) begin(c context.Context) (tx *Tx, err error) {
 		return
 	}
 	_, c, cancel := db.conf.TranTimeout.Shrink(c)
-	rtx, err := db.BeginTx(c, nil)
+	rtx, err := db.BeginTx(c, opts)
 	_metricReqDur.Observe(int64(time.Since(now)/time.Millisecond), db.addr, db.addr, "begin")
 	if err != nil {
 		err = errors.WithStack(err)
 		cancel()
 		return
 	}
-	tx = &Tx{tx: rtx, t: t, db: db, c: c, cancel: cancel}
+	tx = &Tx{tx: rtx, t: t, db: db, c: c, cancel: cancel, untrack: db.leak.Track("tx", "")}
 	return
 }
 
@@ -310,13 +370,17 @@ func (db *conn) exec(c context.Context, query string, args ...interface{}) (res
 		return
 	}
 	_, c, cancel := db.conf.ExecTimeout.Shrink(c)
-	res, err = db.ExecContext(c, query, args...)
+	res, err = db.ExecContext(c, db.rebind(query), args...)
+	err = db.translate(err)
 	cancel()
 	db.onBreaker(&err)
 	_metricReqDur.Observe(int64(time.Since(now)/time.Millisecond), db.addr, db.addr, "exec")
+	db.record(c, "exec", query, args, now, res, err)
 	if err != nil {
 		err = errors.Wrapf(err, "exec:%s, args:%+v", query, args)
+		return
 	}
+	markWrite(c, time.Duration(db.conf.StickyMaster))
 	return
 }
 
@@ -345,7 +409,7 @@ func (db *conn) ping(c context.Context) (err error) {
 
 func (db *conn) prepare(query string) (*Stmt, error) {
 	defer slowLog(fmt.Sprintf("Prepare query(%s)", query), time.Now())
-	stmt, err := db.Prepare(query)
+	stmt, err := db.DB.Prepare(db.rebind(query))
 	if err != nil {
 		err = errors.Wrapf(err, "prepare %s", query)
 		return nil, err
@@ -358,14 +422,14 @@ func (db *conn) prepare(query string) (*Stmt, error) {
 func (db *conn) prepared(query string) (stmt *Stmt) {
 	defer slowLog(fmt.Sprintf("Prepared query(%s)", query), time.Now())
 	stmt = &Stmt{query: query, db: db}
-	s, err := db.Prepare(query)
+	s, err := db.DB.Prepare(db.rebind(query))
 	if err == nil {
 		stmt.stmt.Store(s)
 		return
 	}
 	go func() {
 		for {
-			s, err := db.Prepare(query)
+			s, err := db.DB.Prepare(db.rebind(query))
 			if err != nil {
 				time.Sleep(time.Second)
 				continue
@@ -390,15 +454,17 @@ func (db *conn) query(c context.Context, query string, args ...interface{}) (row
 		return
 	}
 	_, c, cancel := db.conf.QueryTimeout.Shrink(c)
-	rs, err := db.DB.QueryContext(c, query, args...)
+	rs, err := db.DB.QueryContext(c, db.rebind(query), args...)
+	err = db.translate(err)
 	db.onBreaker(&err)
 	_metricReqDur.Observe(int64(time.Since(now)/time.Millisecond), db.addr, db.addr, "query")
+	db.record(c, "query", query, args, now, nil, err)
 	if err != nil {
 		err = errors.Wrapf(err, "query:%s, args:%+v", query, args)
 		cancel()
 		return
 	}
-	rows = &Rows{Rows: rs, cancel: cancel}
+	rows = &Rows{Rows: rs, cancel: cancel, untrack: db.leak.Track("rows", query)}
 	return
 }
 
@@ -415,8 +481,9 @@ func (db *conn) queryRow(c context.Context, query string, args ...interface{}) *
 		return &Row{db: db, t: t, err: err}
 	}
 	_, c, cancel := db.conf.QueryTimeout.Shrink(c)
-	r := db.DB.QueryRowContext(c, query, args...)
+	r := db.DB.QueryRowContext(c, db.rebind(query), args...)
 	_metricReqDur.Observe(int64(time.Since(now)/time.Millisecond), db.addr, db.addr, "queryrow")
+	db.record(c, "queryrow", query, args, now, nil, nil)
 	return &Row{db: db, Row: r, query: query, args: args, t: t, cancel: cancel}
 }
 
@@ -462,11 +529,17 @@ func (s *Stmt) Exec(c context.Context, args ...interface{}) (res sql.Result, err
 	}
 	_, c, cancel := s.db.conf.ExecTimeout.Shrink(c)
 	res, err = stmt.ExecContext(c, args...)
+	err = s.db.translate(err)
 	cancel()
 	s.db.onBreaker(&err)
 	_metricReqDur.Observe(int64(time.Since(now)/time.Millisecond), s.db.addr, s.db.addr, "stmt:exec")
+	s.db.record(c, "stmt:exec", s.query, args, now, res, err)
 	if err != nil {
 		err = errors.Wrapf(err, "exec:%s, args:%+v", s.query, args)
+		return
+	}
+	if !s.tx {
+		markWrite(c, time.Duration(s.db.conf.StickyMaster))
 	}
 	return
 }
@@ -500,14 +573,16 @@ func (s *Stmt) Query(c context.Context, args ...interface{}) (rows *Rows, err er
 	}
 	_, c, cancel := s.db.conf.QueryTimeout.Shrink(c)
 	rs, err := stmt.QueryContext(c, args...)
+	err = s.db.translate(err)
 	s.db.onBreaker(&err)
 	_metricReqDur.Observe(int64(time.Since(now)/time.Millisecond), s.db.addr, s.db.addr, "stmt:query")
+	s.db.record(c, "stmt:query", s.query, args, now, nil, err)
 	if err != nil {
 		err = errors.Wrapf(err, "query:%s, args:%+v", s.query, args)
 		cancel()
 		return
 	}
-	rows = &Rows{Rows: rs, cancel: cancel}
+	rows = &Rows{Rows: rs, cancel: cancel, untrack: s.db.leak.Track("rows", s.query)}
 	return
 }
 
@@ -545,20 +620,26 @@ func (s *Stmt) QueryRow(c context.Context, args ...interface{}) (row *Row) {
 	row.Row = stmt.QueryRowContext(c, args...)
 	row.cancel = cancel
 	_metricReqDur.Observe(int64(time.Since(now)/time.Millisecond), s.db.addr, s.db.addr, "stmt:queryrow")
+	s.db.record(c, "stmt:queryrow", s.query, args, now, nil, nil)
 	return
 }
 
 // Commit commits the transaction.
 func (tx *Tx) Commit() (err error) {
-	err = tx.tx.Commit()
+	err = tx.db.translate(tx.tx.Commit())
 	tx.cancel()
+	if tx.untrack != nil {
+		tx.untrack()
+	}
 	tx.db.onBreaker(&err)
 	if tx.t != nil {
 		tx.t.Finish(&err)
 	}
 	if err != nil {
 		err = errors.WithStack(err)
+		return
 	}
+	markWrite(tx.c, time.Duration(tx.db.conf.StickyMaster))
 	return
 }
 
@@ -566,6 +647,9 @@ func (tx *Tx) Commit() (err error) {
 func (tx *Tx) Rollback() (err error) {
 	err = tx.tx.Rollback()
 	tx.cancel()
+	if tx.untrack != nil {
+		tx.untrack()
+	}
 	tx.db.onBreaker(&err)
 	if tx.t != nil {
 		tx.t.Finish(&err)
@@ -577,23 +661,37 @@ func (tx *Tx) Rollback() (err error) {
 }
 
 // Exec executes a query that doesn't return rows. For example: an INSERT and
-// UPDATE.
+// UPDATE. It runs with the context of the transaction.
 func (tx *Tx) Exec(query string, args ...interface{}) (res sql.Result, err error) {
+	return tx.ExecContext(tx.c, query, args...)
+}
+
+// ExecContext is Exec with the context c of the statement, the statement is
+// still aborted with the transaction.
+func (tx *Tx) ExecContext(c context.Context, query string, args ...interface{}) (res sql.Result, err error) {
 	now := time.Now()
 	defer slowLog(fmt.Sprintf("Exec query(%s) args(%+v)", query, args), now)
 	if tx.t != nil {
 		tx.t.SetTag(trace.String(trace.TagAnnotation, fmt.Sprintf("exec %s", query)))
 	}
-	res, err = tx.tx.ExecContext(tx.c, query, args...)
+	res, err = tx.tx.ExecContext(c, tx.db.rebind(query), args...)
+	err = tx.db.translate(err)
 	_metricReqDur.Observe(int64(time.Since(now)/time.Millisecond), tx.db.addr, tx.db.addr, "tx:exec")
+	tx.db.record(c, "tx:exec", query, args, now, res, err)
 	if err != nil {
 		err = errors.Wrapf(err, "exec:%s, args:%+v", query, args)
 	}
 	return
 }
 
-// Query executes a query that returns rows, typically a SELECT.
+// Query executes a query that returns rows, typically a SELECT. It runs with
+// the context of the transaction.
 func (tx *Tx) Query(query string, args ...interface{}) (rows *Rows, err error) {
+	return tx.QueryContext(tx.c, query, args...)
+}
+
+// QueryContext is Query with the context c of the statement.
+func (tx *Tx) QueryContext(c context.Context, query string, args ...interface{}) (rows *Rows, err error) {
 	if tx.t != nil {
 		tx.t.SetTag(trace.String(trace.TagAnnotation, fmt.Sprintf("query %s", query)))
 	}
@@ -601,10 +699,12 @@ func (tx *Tx) Query(query string, args ...interface{}) (rows *Rows, err error) {
 	defer slowLog(fmt.Sprintf("Query query(%s) args(%+v)", query, args), now)
 	defer func() {
 		_metricReqDur.Observe(int64(time.Since(now)/time.Millisecond), tx.db.addr, tx.db.addr, "tx:query")
+		tx.db.record(c, "tx:query", query, args, now, nil, err)
 	}()
-	rs, err := tx.tx.QueryContext(tx.c, query, args...)
+	rs, err := tx.tx.QueryContext(c, tx.db.rebind(query), args...)
+	err = tx.db.translate(err)
 	if err == nil {
-		rows = &Rows{Rows: rs}
+		rows = &Rows{Rows: rs, untrack: tx.db.leak.Track("rows", query)}
 	} else {
 		err = errors.Wrapf(err, "query:%s, args:%+v", query, args)
 	}
@@ -613,8 +713,13 @@ func (tx *Tx) Query(query string, args ...interface{}) (rows *Rows, err error) {
 
 // QueryRow executes a query that is expected to return at most one row.
 // QueryRow always returns a non-nil value. Errors are deferred until Row's
-// Scan method is called.
+// Scan method is called. It runs with the context of the transaction.
 func (tx *Tx) QueryRow(query string, args ...interface{}) *Row {
+	return tx.QueryRowContext(tx.c, query, args...)
+}
+
+// QueryRowContext is QueryRow with the context c of the statement.
+func (tx *Tx) QueryRowContext(c context.Context, query string, args ...interface{}) *Row {
 	if tx.t != nil {
 		tx.t.SetTag(trace.String(trace.TagAnnotation, fmt.Sprintf("queryrow %s", query)))
 	}
@@ -622,8 +727,9 @@ func (tx *Tx) QueryRow(query string, args ...interface{}) *Row {
 	defer slowLog(fmt.Sprintf("QueryRow query(%s) args(%+v)", query, args), now)
 	defer func() {
 		_metricReqDur.Observe(int64(time.Since(now)/time.Millisecond), tx.db.addr, tx.db.addr, "tx:queryrow")
+		tx.db.record(c, "tx:queryrow", query, args, now, nil, nil)
 	}()
-	r := tx.tx.QueryRowContext(tx.c, query, args...)
+	r := tx.tx.QueryRowContext(c, tx.db.rebind(query), args...)
 	return &Row{Row: r, db: tx.db, query: query, args: args}
 }
 
@@ -648,7 +754,7 @@ func (tx *Tx) Prepare(query string) (*Stmt, error) {
 		tx.t.SetTag(trace.String(trace.TagAnnotation, fmt.Sprintf("prepare %s", query)))
 	}
 	defer slowLog(fmt.Sprintf("Prepare query(%s)", query), time.Now())
-	stmt, err := tx.tx.Prepare(query)
+	stmt, err := tx.tx.Prepare(tx.db.rebind(query))
 	if err != nil {
 		err = errors.Wrapf(err, "prepare %s", query)
 		return nil, err
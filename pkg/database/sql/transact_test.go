@@ -0,0 +1,206 @@
+package sql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/djienet/kratos/pkg/database/internal/transact"
+	"github.com/djienet/kratos/pkg/net/netutil"
+	"github.com/djienet/kratos/pkg/net/netutil/breaker"
+	xtime "github.com/djienet/kratos/pkg/time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryable(t *testing.T) {
+	deadlock := &mysql.MySQLError{Number: 1213, Message: "Deadlock found when trying to get lock"}
+	assert.True(t, retryable(deadlock))
+	assert.True(t, retryable(errors.Wrap(deadlock, "exec")))
+	assert.False(t, retryable(&mysql.MySQLError{Number: 1062, Message: "Duplicate entry"}))
+	assert.False(t, retryable(ErrNoRows))
+	assert.False(t, retryable(nil))
+}
+
+func TestTxOptions(t *testing.T) {
+	o := &transact.Options{}
+	for _, opt := range []TxOption{Isolation(sql.LevelSerializable), ReadOnly(), Retry(5, nil)} {
+		opt(o)
+	}
+	assert.Equal(t, sql.LevelSerializable, o.Isolation)
+	assert.True(t, o.ReadOnly)
+	assert.Equal(t, 5, o.Retries)
+}
+
+// txDriver records the statements and transactions, the statements in fails
+// fail with deadlock for the times.
+type txDriver struct {
+	sync.Mutex
+	stmts  []string
+	fails  map[string]int
+	values []interface{}
+}
+
+type txConn struct{ d *txDriver }
+
+type ctxKey struct{}
+
+var _txDriver = &txDriver{}
+
+func init() {
+	sql.Register("sql_tx", _txDriver)
+}
+
+func (d *txDriver) Open(string) (driver.Conn, error) { return &txConn{d: d}, nil }
+
+func (d *txDriver) reset(fails map[string]int) {
+	d.Lock()
+	d.stmts, d.fails, d.values = nil, fails, nil
+	d.Unlock()
+}
+
+func (d *txDriver) log(stmt string) {
+	d.Lock()
+	d.stmts = append(d.stmts, stmt)
+	d.Unlock()
+}
+
+func (d *txDriver) statements() string {
+	d.Lock()
+	defer d.Unlock()
+	return strings.Join(d.stmts, ";")
+}
+
+func (c *txConn) Prepare(query string) (driver.Stmt, error) { return nil, driver.ErrSkip }
+func (c *txConn) Close() error                              { return nil }
+func (c *txConn) Begin() (driver.Tx, error) {
+	c.d.log("BEGIN")
+	return c, nil
+}
+func (c *txConn) Commit() error {
+	c.d.log("COMMIT")
+	return nil
+}
+func (c *txConn) Rollback() error {
+	c.d.log("ROLLBACK")
+	return nil
+}
+
+func (c *txConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	c.d.Lock()
+	defer c.d.Unlock()
+	c.d.stmts = append(c.d.stmts, query)
+	c.d.values = append(c.d.values, ctx.Value(ctxKey{}))
+	if c.d.fails[query] > 0 {
+		c.d.fails[query]--
+		return nil, &mysql.MySQLError{Number: 1213, Message: "Deadlock found when trying to get lock"}
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func newTxDB(t *testing.T, fails map[string]int) *DB {
+	_txDriver.reset(fails)
+	d, err := sql.Open("sql_tx", "")
+	assert.Nil(t, err)
+	conf := &Config{TranTimeout: xtime.Duration(time.Second)}
+	w := &conn{DB: d, breaker: breaker.NewGroup(nil).Get("tx"), conf: conf, addr: "tx"}
+	return &DB{write: w, master: &DB{write: w}}
+}
+
+func TestTransactCommit(t *testing.T) {
+	db := newTxDB(t, nil)
+	err := db.Transact(context.Background(), func(tx *Tx) error {
+		_, err := tx.Exec("UPDATE a")
+		return err
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "BEGIN;UPDATE a;COMMIT", _txDriver.statements())
+}
+
+func TestTransactRollback(t *testing.T) {
+	db := newTxDB(t, nil)
+	want := errors.New("fn error")
+	err := db.Transact(context.Background(), func(tx *Tx) error {
+		tx.Exec("UPDATE a")
+		return want
+	})
+	assert.Equal(t, want, err)
+	assert.Equal(t, "BEGIN;UPDATE a;ROLLBACK", _txDriver.statements())
+}
+
+func TestTransactRetry(t *testing.T) {
+	backoff := &netutil.BackoffConfig{MaxDelay: time.Millisecond, BaseDelay: time.Millisecond, Factor: 1}
+	db := newTxDB(t, map[string]int{"UPDATE a": 2})
+	var attempts int
+	err := db.Transact(context.Background(), func(tx *Tx) error {
+		attempts++
+		_, err := tx.Exec("UPDATE a")
+		return err
+	}, Retry(3, backoff))
+	assert.Nil(t, err)
+	assert.Equal(t, 3, attempts)
+	assert.Equal(t, "BEGIN;UPDATE a;ROLLBACK;BEGIN;UPDATE a;ROLLBACK;BEGIN;UPDATE a;COMMIT", _txDriver.statements())
+
+	db = newTxDB(t, map[string]int{"UPDATE a": 2})
+	err = db.Transact(context.Background(), func(tx *Tx) error {
+		_, err := tx.Exec("UPDATE a")
+		return err
+	}, Retry(1, backoff))
+	assert.True(t, retryable(err))
+	assert.Equal(t, "BEGIN;UPDATE a;ROLLBACK;BEGIN;UPDATE a;ROLLBACK", _txDriver.statements())
+}
+
+func TestTransactPanic(t *testing.T) {
+	db := newTxDB(t, nil)
+	assert.Panics(t, func() {
+		db.Transact(context.Background(), func(tx *Tx) error {
+			tx.Exec("UPDATE a")
+			panic("fn panic")
+		})
+	})
+	assert.Equal(t, "BEGIN;UPDATE a;ROLLBACK", _txDriver.statements())
+}
+
+func TestSavepoint(t *testing.T) {
+	db := newTxDB(t, nil)
+	err := db.Transact(context.Background(), func(tx *Tx) error {
+		assert.NotNil(t, tx.Transact(func(tx *Tx) error {
+			tx.Exec("UPDATE b")
+			return errors.New("nested error")
+		}))
+		assert.Panics(t, func() {
+			tx.Transact(func(tx *Tx) error {
+				panic("nested panic")
+			})
+		})
+		return tx.Transact(func(tx *Tx) error {
+			_, err := tx.Exec("UPDATE c")
+			return err
+		})
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "BEGIN;"+
+		"SAVEPOINT kratos_sp_1;UPDATE b;ROLLBACK TO SAVEPOINT kratos_sp_1;"+
+		"SAVEPOINT kratos_sp_2;ROLLBACK TO SAVEPOINT kratos_sp_2;"+
+		"SAVEPOINT kratos_sp_3;UPDATE c;RELEASE SAVEPOINT kratos_sp_3;COMMIT", _txDriver.statements())
+}
+
+func TestTxContext(t *testing.T) {
+	db := newTxDB(t, nil)
+	c := context.WithValue(context.Background(), ctxKey{}, "transact")
+	err := db.Transact(c, func(tx *Tx) error {
+		if _, err := tx.Exec("UPDATE a"); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(context.WithValue(c, ctxKey{}, "statement"), "UPDATE b")
+		return err
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{"transact", "statement"}, _txDriver.values)
+}
@@ -0,0 +1,84 @@
+package tidb
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/djienet/kratos/pkg/log"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/pkg/errors"
+)
+
+const _healthCheckInterval = time.Second
+
+// nodeError reports whether err means the node is unhealthy, only the
+// network and driver errors are. The errors returned by the tidb server itself
+// and the context errors, e.g. a short deadline of the caller, are not.
+func nodeError(err error) bool {
+	err = errors.Cause(err)
+	if err == nil || err == ErrNoRows || err == ErrTxDone || contextError(err) {
+		return false
+	}
+	if _, ok := err.(*mysql.MySQLError); ok {
+		return false
+	}
+	return true
+}
+
+func contextError(err error) bool {
+	err = errors.Cause(err)
+	return err == context.Canceled || err == context.DeadlineExceeded
+}
+
+// report records the result of a request, the node is evicted after
+// EvictErrors consecutive node errors.
+func (db *conn) report(err error) {
+	if db.conf.EvictErrors <= 0 {
+		return
+	}
+	if !nodeError(err) {
+		atomic.StoreInt32(&db.errs, 0)
+		return
+	}
+	if atomic.AddInt32(&db.errs, 1) >= int32(db.conf.EvictErrors) && atomic.CompareAndSwapInt32(&db.evicted, 0, 1) {
+		_metricNodeEvict.Inc(db.addr, db.addr)
+		log.Error("tidb: node(%s) evicted after %d errors, last error(%v)", db.addr, db.conf.EvictErrors, err)
+	}
+}
+
+func (db *conn) isEvicted() bool {
+	return atomic.LoadInt32(&db.evicted) == 1
+}
+
+// healthproc pings the evicted nodes and restores them once they recover,
+// the nodes removed by discovery are closed by nodeproc.
+func (db *DB) healthproc(c context.Context) {
+	ticker := time.NewTicker(_healthCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-c.Done():
+			return
+		}
+		db.mutex.RLock()
+		conns := db.conns
+		db.mutex.RUnlock()
+		for _, cn := range conns {
+			if !cn.isEvicted() {
+				continue
+			}
+			ctx, cancel := context.WithTimeout(c, time.Duration(db.conf.QueryTimeout))
+			err := cn.PingContext(ctx)
+			cancel()
+			// the ping timed out is not a recovery.
+			if err == nil || !nodeError(err) && !contextError(err) {
+				atomic.StoreInt32(&cn.errs, 0)
+				atomic.StoreInt32(&cn.evicted, 0)
+				log.Info("tidb: node(%s) recovered", cn.addr)
+			}
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package tidb
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	xtime "github.com/djienet/kratos/pkg/time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNodeError(t *testing.T) {
+	assert.False(t, nodeError(nil))
+	assert.False(t, nodeError(ErrNoRows))
+	assert.False(t, nodeError(context.Canceled))
+	assert.False(t, nodeError(&mysql.MySQLError{Number: 1062}))
+	assert.True(t, nodeError(errTxDown))
+	assert.False(t, nodeError(context.DeadlineExceeded))
+	assert.False(t, nodeError(errors.WithStack(context.DeadlineExceeded)))
+}
+
+func TestEvictRecover(t *testing.T) {
+	_txDriver.reset(nil)
+	conf := &Config{
+		QueryTimeout: xtime.Duration(time.Second),
+		ExecTimeout:  xtime.Duration(time.Second),
+		EvictErrors:  2,
+	}
+	a, b := newTxConn(t, conf, "evict_a"), newTxConn(t, conf, "evict_b")
+	db := &DB{conf: conf, conns: []*conn{a, b}}
+	_txDriver.setDown("evict_a", true)
+	c := context.Background()
+	_, err := a.exec(c, "UPDATE a")
+	assert.NotNil(t, err)
+	assert.False(t, a.isEvicted())
+	// the mysql errors of the server do not count.
+	a.report(&mysql.MySQLError{Number: 1062})
+	_, err = a.exec(c, "UPDATE a")
+	assert.NotNil(t, err)
+	assert.False(t, a.isEvicted())
+	_, err = a.exec(c, "UPDATE a")
+	assert.NotNil(t, err)
+	assert.True(t, a.isEvicted())
+	for i := 0; i < 4; i++ {
+		assert.Equal(t, b, db.conn())
+	}
+
+	ctx, cancel := context.WithCancel(c)
+	defer cancel()
+	go db.healthproc(ctx)
+	time.Sleep(_healthCheckInterval + 200*time.Millisecond)
+	assert.True(t, a.isEvicted(), "recovered while down")
+	_txDriver.setDown("evict_a", false)
+	deadline := time.Now().Add(3 * _healthCheckInterval)
+	for a.isEvicted() && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+	}
+	assert.False(t, a.isEvicted())
+	_, err = db.conn().exec(c, "UPDATE a")
+	assert.Nil(t, err)
+}
@@ -34,4 +34,32 @@ var (
 		Help:      "tidb client connections current.",
 		Labels:    []string{"name", "addr", "state"},
 	})
+	_metricNodeEvict = metric.NewCounterVec(&metric.CounterVecOpts{
+		Namespace: namespace,
+		Subsystem: "nodes",
+		Name:      "evicted_total",
+		Help:      "tidb client nodes evicted total count.",
+		Labels:    []string{"name", "addr"},
+	})
+	_metricPoolWait = metric.NewGaugeVec(&metric.GaugeVecOpts{
+		Namespace: namespace,
+		Subsystem: "pool",
+		Name:      "wait_count",
+		Help:      "tidb client pool total number of connections waited for.",
+		Labels:    []string{"name", "addr"},
+	})
+	_metricPoolWaitDur = metric.NewGaugeVec(&metric.GaugeVecOpts{
+		Namespace: namespace,
+		Subsystem: "pool",
+		Name:      "wait_duration_ms",
+		Help:      "tidb client pool total time blocked waiting for connections(ms).",
+		Labels:    []string{"name", "addr"},
+	})
+	_metricLeak = metric.NewCounterVec(&metric.CounterVecOpts{
+		Namespace: namespace,
+		Subsystem: "pool",
+		Name:      "leak_total",
+		Help:      "tidb client rows and transactions not closed within the leak threshold.",
+		Labels:    []string{"name", "addr", "kind"},
+	})
 )
@@ -0,0 +1,48 @@
+package tidb
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/djienet/kratos/pkg/database/internal/pool"
+)
+
+// Stats returns the connection pool statistics of the nodes by address.
+func (db *DB) Stats() map[string]sql.DBStats {
+	db.mutex.RLock()
+	conns := db.conns
+	db.mutex.RUnlock()
+	stats := make(map[string]sql.DBStats, len(conns))
+	for _, cn := range conns {
+		stats[cn.addr] = cn.Stats()
+	}
+	return stats
+}
+
+// statproc exports the pool statistics and reports the leaked Rows and Tx
+// of the nodes periodically.
+func (db *DB) statproc(c context.Context, conf *Config) {
+	pool.StatProc(c, time.Duration(conf.StatInterval), func() {
+		db.mutex.RLock()
+		conns := db.conns
+		db.mutex.RUnlock()
+		for _, cn := range conns {
+			cn.stat()
+		}
+	})
+}
+
+func (db *conn) stat() {
+	s := db.Stats()
+	_metricConnCurrent.Set(float64(s.OpenConnections), db.addr, db.addr, "open")
+	_metricConnCurrent.Set(float64(s.InUse), db.addr, db.addr, "in_use")
+	_metricConnCurrent.Set(float64(s.Idle), db.addr, db.addr, "idle")
+	_metricPoolWait.Set(float64(s.WaitCount), db.addr, db.addr)
+	_metricPoolWaitDur.Set(float64(s.WaitDuration/time.Millisecond), db.addr, db.addr)
+	db.leak.Check(db.addr)
+}
+
+func newLeakDetector(threshold time.Duration) *pool.LeakDetector {
+	return pool.NewLeakDetector(_family, threshold, _metricLeak)
+}
@@ -0,0 +1,58 @@
+package tidb
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/pkg/errors"
+)
+
+// replica read modes of tidb_replica_read.
+const (
+	ReplicaReadLeader            = "leader"
+	ReplicaReadFollower          = "follower"
+	ReplicaReadLeaderAndFollower = "leader-and-follower"
+)
+
+// sessionDSN sets the session variables of the config to the dsn, the mysql
+// driver executes them when a connection is established.
+func sessionDSN(c *Config, dsn string) (string, error) {
+	if c.ReplicaRead == "" && c.ReadStaleness == 0 {
+		return dsn, nil
+	}
+	cfg, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	if cfg.Params == nil {
+		cfg.Params = make(map[string]string)
+	}
+	if c.ReplicaRead != "" {
+		switch c.ReplicaRead {
+		case ReplicaReadLeader, ReplicaReadFollower, ReplicaReadLeaderAndFollower:
+		default:
+			return "", errors.Errorf("tidb: invalid replica read %s", c.ReplicaRead)
+		}
+		cfg.Params["tidb_replica_read"] = "'" + c.ReplicaRead + "'"
+	}
+	if c.ReadStaleness != 0 {
+		sec := int64(time.Duration(c.ReadStaleness) / time.Second)
+		if sec <= 0 {
+			return "", errors.Errorf("tidb: read staleness %v less than 1s", time.Duration(c.ReadStaleness))
+		}
+		cfg.Params["tidb_read_staleness"] = fmt.Sprintf("'-%d'", sec)
+	}
+	return cfg.FormatDSN(), nil
+}
+
+// AsOfTimestamp returns the stale read clause of a table which reads the data
+// of staleness ago, e.g.
+//
+//	db.Query(c, "SELECT id, name FROM user "+tidb.AsOfTimestamp(5*time.Second)+" WHERE mid=?", mid)
+//
+// Stale reads are served by the nearest replica without checking the leader,
+// use it for the analytics queries which tolerate stale data.
+func AsOfTimestamp(staleness time.Duration) string {
+	return fmt.Sprintf("AS OF TIMESTAMP NOW(3) - INTERVAL %d MICROSECOND", staleness/time.Microsecond)
+}
@@ -0,0 +1,41 @@
+package tidb
+
+import (
+	"testing"
+	"time"
+
+	xtime "github.com/djienet/kratos/pkg/time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSessionDSN(t *testing.T) {
+	dsn := "test:test@tcp(127.0.0.1:4000)/test?timeout=1s"
+	got, err := sessionDSN(&Config{}, dsn)
+	assert.Nil(t, err)
+	assert.Equal(t, dsn, got)
+
+	got, err = sessionDSN(&Config{ReplicaRead: ReplicaReadFollower, ReadStaleness: xtime.Duration(5 * time.Second)}, dsn)
+	assert.Nil(t, err)
+	cfg, err := mysql.ParseDSN(got)
+	assert.Nil(t, err)
+	assert.Equal(t, "127.0.0.1:4000", cfg.Addr)
+	assert.Equal(t, time.Second, cfg.Timeout)
+	assert.Equal(t, "'follower'", cfg.Params["tidb_replica_read"])
+	assert.Equal(t, "'-5'", cfg.Params["tidb_read_staleness"])
+
+	for _, c := range []*Config{
+		{ReplicaRead: "closest"},
+		{ReadStaleness: xtime.Duration(500 * time.Millisecond)},
+	} {
+		_, err = sessionDSN(c, dsn)
+		assert.NotNil(t, err)
+	}
+	_, err = sessionDSN(&Config{ReplicaRead: ReplicaReadLeader}, "test@tcp(127.0.0.1:4000")
+	assert.NotNil(t, err)
+}
+
+func TestAsOfTimestamp(t *testing.T) {
+	assert.Equal(t, "AS OF TIMESTAMP NOW(3) - INTERVAL 1500000 MICROSECOND", AsOfTimestamp(1500*time.Millisecond))
+}
@@ -8,6 +8,8 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/djienet/kratos/pkg/database/internal/pool"
+	"github.com/djienet/kratos/pkg/database/internal/transact"
 	"github.com/djienet/kratos/pkg/log"
 	"github.com/djienet/kratos/pkg/naming"
 	"github.com/djienet/kratos/pkg/net/netutil/breaker"
@@ -42,6 +44,7 @@ type DB struct {
 	appid        string
 	mutex        sync.RWMutex
 	breakerGroup *breaker.Group
+	cancel       func()
 }
 
 // conn database connection
@@ -50,15 +53,23 @@ type conn struct {
 	breaker breaker.Breaker
 	conf    *Config
 	addr    string
+	// errs is the consecutive node errors, the node is evicted when it
+	// reaches Config.EvictErrors until the health check passes.
+	errs    int32
+	evicted int32
+	leak    *pool.LeakDetector
 }
 
 // Tx transaction.
 type Tx struct {
-	db     *conn
-	tx     *sql.Tx
-	t      trace.Trace
-	c      context.Context
-	cancel func()
+	db      *conn
+	tx      *sql.Tx
+	t       trace.Trace
+	c       context.Context
+	cancel  func()
+	untrack func()
+	// savepoint is the sequence of the nested transactions.
+	savepoint int
 }
 
 // Row row.
@@ -100,7 +111,20 @@ func (r *Row) Scan(dest ...interface{}) (err error) {
 // Rows rows.
 type Rows struct {
 	*sql.Rows
-	cancel func()
+	cancel  func()
+	untrack func()
+}
+
+// Next prepares the next result row for reading with the Scan method.
+func (rs *Rows) Next() bool {
+	if rs.Rows.Next() {
+		return true
+	}
+	// the rows are closed automatically.
+	if rs.untrack != nil {
+		rs.untrack()
+	}
+	return false
 }
 
 // Close closes the Rows, preventing further enumeration. If Next is called
@@ -112,6 +136,9 @@ func (rs *Rows) Close() (err error) {
 	if rs.cancel != nil {
 		rs.cancel()
 	}
+	if rs.untrack != nil {
+		rs.untrack()
+	}
 	return
 }
 
@@ -160,6 +187,12 @@ func Open(c *Config) (db *DB, err error) {
 		cs = append(cs, r)
 	}
 	db.conns = cs
+	ctx, cancel := context.WithCancel(context.Background())
+	db.cancel = cancel
+	go db.statproc(ctx, c)
+	if c.EvictErrors > 0 {
+		go db.healthproc(ctx)
+	}
 	return
 }
 
@@ -170,11 +203,15 @@ func (db *DB) connectDSN(dsn string) (c *conn, err error) {
 	}
 	addr := parseDSNAddr(dsn)
 	brk := db.breakerGroup.Get(addr)
-	c = &conn{DB: d, breaker: brk, conf: db.conf, addr: addr}
+	c = &conn{DB: d, breaker: brk, conf: db.conf, addr: addr, leak: newLeakDetector(time.Duration(db.conf.LeakThreshold))}
 	return
 }
 
 func connect(c *Config, dataSourceName string) (*sql.DB, error) {
+	dataSourceName, err := sessionDSN(c, dataSourceName)
+	if err != nil {
+		return nil, err
+	}
 	d, err := sql.Open("mysql", dataSourceName)
 	if err != nil {
 		err = errors.WithStack(err)
@@ -186,22 +223,42 @@ func connect(c *Config, dataSourceName string) (*sql.DB, error) {
 	return d, nil
 }
 
+// conn returns the next node which is not evicted, or any node if all the
+// nodes are evicted.
 func (db *DB) conn() (c *conn) {
 	db.mutex.RLock()
-	c = db.conns[db.index()]
+	idx := db.index()
+	c = db.conns[idx]
+	for i := 1; i < len(db.conns) && c.isEvicted(); i++ {
+		if cn := db.conns[(idx+i)%len(db.conns)]; !cn.isEvicted() {
+			c = cn
+		}
+	}
 	db.mutex.RUnlock()
 	return
 }
 
 // Begin starts a transaction. The isolation level is dependent on the driver.
 func (db *DB) Begin(c context.Context) (tx *Tx, err error) {
-	return db.conn().begin(c)
+	return db.conn().begin(c, nil)
 }
 
 // Exec executes a query without returning any rows.
 // The args are for any placeholder parameters in the query.
+// It is retried ConflictRetries times with backoff on write conflict and deadlock.
 func (db *DB) Exec(c context.Context, query string, args ...interface{}) (res sql.Result, err error) {
-	return db.conn().exec(c, query, args...)
+	for attempt := 0; ; attempt++ {
+		cn := db.conn()
+		if res, err = cn.exec(c, query, args...); err == nil || attempt >= db.conf.ConflictRetries || !retryable(err) {
+			return
+		}
+		_metricReqErr.Inc(cn.addr, cn.addr, "exec", "retry")
+		select {
+		case <-time.After(transact.DefaultBackoff.Backoff(attempt)):
+		case <-c.Done():
+			return
+		}
+	}
 }
 
 // Prepare creates a prepared statement for later queries or executions.
@@ -250,6 +307,9 @@ func (db *DB) index() int {
 
 // Close closes the databases, releasing any open resources.
 func (db *DB) Close() (err error) {
+	if db.cancel != nil {
+		db.cancel()
+	}
 	db.mutex.RLock()
 	defer db.mutex.RUnlock()
 	for _, d := range db.conns {
@@ -270,6 +330,9 @@ func (db *DB) Ping(c context.Context) (err error) {
 }
 
 func (db *conn) onBreaker(err *error) {
+	if err != nil {
+		db.report(*err)
+	}
 	if err != nil && *err != nil && *err != sql.ErrNoRows && *err != sql.ErrTxDone {
 		db.breaker.MarkFailed()
 	} else {
@@ -277,7 +340,7 @@ func (db *conn) onBreaker(err *error) {
 	}
 }
 
-func (db *conn) begin(c context.Context) (tx *Tx, err error) {
+func (db *conn) begin(c context.Context, opts *sql.TxOptions) (tx *Tx, err error) {
 	now := time.Now()
 	defer slowLog(fmt.Sprintf("Begin addr: %s", db.addr), now)
 	t, ok := trace.FromContext(c)
@@ -295,14 +358,14 @@ func (db *conn) begin(c context.Context) (tx *Tx, err error) {
 		return
 	}
 	_, c, cancel := db.conf.TranTimeout.Shrink(c)
-	rtx, err := db.BeginTx(c, nil)
+	rtx, err := db.BeginTx(c, opts)
 	_metricReqDur.Observe(int64(time.Since(now)/time.Millisecond), db.addr, db.addr, "begin")
 	if err != nil {
 		err = errors.WithStack(err)
 		cancel()
 		return
 	}
-	tx = &Tx{tx: rtx, t: t, db: db, c: c, cancel: cancel}
+	tx = &Tx{tx: rtx, t: t, db: db, c: c, cancel: cancel, untrack: db.leak.Track("tx", "")}
 	return
 }
 
@@ -396,7 +459,7 @@ func (db *conn) query(c context.Context, query string, args ...interface{}) (row
 		cancel()
 		return
 	}
-	rows = &Rows{Rows: rs, cancel: cancel}
+	rows = &Rows{Rows: rs, cancel: cancel, untrack: db.leak.Track("rows", query)}
 	return
 }
 
@@ -505,7 +568,7 @@ func (s *Stmt) Query(c context.Context, args ...interface{}) (rows *Rows, err er
 		cancel()
 		return
 	}
-	rows = &Rows{Rows: rs, cancel: cancel}
+	rows = &Rows{Rows: rs, cancel: cancel, untrack: s.db.leak.Track("rows", s.query)}
 	return
 }
 
@@ -593,6 +656,9 @@ func (s *Stmts) Close() (err error) {
 func (tx *Tx) Commit() (err error) {
 	err = tx.tx.Commit()
 	tx.cancel()
+	if tx.untrack != nil {
+		tx.untrack()
+	}
 	tx.db.onBreaker(&err)
 	if tx.t != nil {
 		tx.t.Finish(&err)
@@ -607,6 +673,9 @@ func (tx *Tx) Commit() (err error) {
 func (tx *Tx) Rollback() (err error) {
 	err = tx.tx.Rollback()
 	tx.cancel()
+	if tx.untrack != nil {
+		tx.untrack()
+	}
 	tx.db.onBreaker(&err)
 	if tx.t != nil {
 		tx.t.Finish(&err)
@@ -618,14 +687,20 @@ func (tx *Tx) Rollback() (err error) {
 }
 
 // Exec executes a query that doesn't return rows. For example: an INSERT and
-// UPDATE.
+// UPDATE. It runs with the context of the transaction.
 func (tx *Tx) Exec(query string, args ...interface{}) (res sql.Result, err error) {
+	return tx.ExecContext(tx.c, query, args...)
+}
+
+// ExecContext is Exec with the context c of the statement, the statement is
+// still aborted with the transaction.
+func (tx *Tx) ExecContext(c context.Context, query string, args ...interface{}) (res sql.Result, err error) {
 	now := time.Now()
 	defer slowLog(fmt.Sprintf("Exec addr: %s query(%s) args(%+v)", tx.db.addr, query, args), now)
 	if tx.t != nil {
 		tx.t.SetTag(trace.String(trace.TagAnnotation, fmt.Sprintf("exec %s", query)))
 	}
-	res, err = tx.tx.ExecContext(tx.c, query, args...)
+	res, err = tx.tx.ExecContext(c, query, args...)
 	_metricReqDur.Observe(int64(time.Since(now)/time.Millisecond), tx.db.addr, tx.db.addr, "tx:exec")
 	if err != nil {
 		err = errors.Wrapf(err, "addr: %s exec:%s, args:%+v", tx.db.addr, query, args)
@@ -633,8 +708,14 @@ func (tx *Tx) Exec(query string, args ...interface{}) (res sql.Result, err error
 	return
 }
 
-// Query executes a query that returns rows, typically a SELECT.
+// Query executes a query that returns rows, typically a SELECT. It runs with
+// the context of the transaction.
 func (tx *Tx) Query(query string, args ...interface{}) (rows *Rows, err error) {
+	return tx.QueryContext(tx.c, query, args...)
+}
+
+// QueryContext is Query with the context c of the statement.
+func (tx *Tx) QueryContext(c context.Context, query string, args ...interface{}) (rows *Rows, err error) {
 	if tx.t != nil {
 		tx.t.SetTag(trace.String(trace.TagAnnotation, fmt.Sprintf("query %s", query)))
 	}
@@ -643,9 +724,9 @@ func (tx *Tx) Query(query string, args ...interface{}) (rows *Rows, err error) {
 	defer func() {
 		_metricReqDur.Observe(int64(time.Since(now)/time.Millisecond), tx.db.addr, tx.db.addr, "tx:query")
 	}()
-	rs, err := tx.tx.QueryContext(tx.c, query, args...)
+	rs, err := tx.tx.QueryContext(c, query, args...)
 	if err == nil {
-		rows = &Rows{Rows: rs}
+		rows = &Rows{Rows: rs, untrack: tx.db.leak.Track("rows", query)}
 	} else {
 		err = errors.Wrapf(err, "addr: %s, query:%s, args:%+v", tx.db.addr, query, args)
 	}
@@ -654,8 +735,13 @@ func (tx *Tx) Query(query string, args ...interface{}) (rows *Rows, err error) {
 
 // QueryRow executes a query that is expected to return at most one row.
 // QueryRow always returns a non-nil value. Errors are deferred until Row's
-// Scan method is called.
+// Scan method is called. It runs with the context of the transaction.
 func (tx *Tx) QueryRow(query string, args ...interface{}) *Row {
+	return tx.QueryRowContext(tx.c, query, args...)
+}
+
+// QueryRowContext is QueryRow with the context c of the statement.
+func (tx *Tx) QueryRowContext(c context.Context, query string, args ...interface{}) *Row {
 	if tx.t != nil {
 		tx.t.SetTag(trace.String(trace.TagAnnotation, fmt.Sprintf("queryrow %s", query)))
 	}
@@ -664,7 +750,7 @@ func (tx *Tx) QueryRow(query string, args ...interface{}) *Row {
 	defer func() {
 		_metricReqDur.Observe(int64(time.Since(now)/time.Millisecond), tx.db.addr, tx.db.addr, "tx:queryrow")
 	}()
-	r := tx.tx.QueryRowContext(tx.c, query, args...)
+	r := tx.tx.QueryRowContext(c, query, args...)
 	return &Row{Row: r, db: tx.db, query: query, args: args}
 }
 
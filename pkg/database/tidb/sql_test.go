@@ -0,0 +1,55 @@
+package tidb
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	xtime "github.com/djienet/kratos/pkg/time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+)
+
+// counter returns the value of the counter name with labels.
+func counter(t *testing.T, name string, labels map[string]string) float64 {
+	mfs, err := prometheus.DefaultGatherer.Gather()
+	assert.Nil(t, err)
+	for _, mf := range mfs {
+		if mf.GetName() != name {
+			continue
+		}
+	next:
+		for _, m := range mf.GetMetric() {
+			for _, lp := range m.GetLabel() {
+				if v, ok := labels[lp.GetName()]; ok && v != lp.GetValue() {
+					continue next
+				}
+			}
+			return m.GetCounter().GetValue()
+		}
+	}
+	return 0
+}
+
+func TestExecRetry(t *testing.T) {
+	labels := map[string]string{"name": "retry", "addr": "retry", "command": "exec", "error": "retry"}
+	retries := counter(t, "tidb_client_requests_error_total", labels)
+	_txDriver.reset(map[string][]uint16{"UPDATE a": {9007, 1213}})
+	conf := &Config{ExecTimeout: xtime.Duration(time.Second), ConflictRetries: 2}
+	db := &DB{conf: conf, conns: []*conn{newTxConn(t, conf, "retry")}}
+	_, err := db.Exec(context.Background(), "UPDATE a")
+	assert.Nil(t, err)
+	assert.Equal(t, "UPDATE a;UPDATE a;UPDATE a", _txDriver.statements())
+	assert.Equal(t, retries+2, counter(t, "tidb_client_requests_error_total", labels))
+
+	_txDriver.reset(map[string][]uint16{"UPDATE a": {9007, 9007, 9007}})
+	_, err = db.Exec(context.Background(), "UPDATE a")
+	assert.NotNil(t, err)
+	assert.Equal(t, "UPDATE a;UPDATE a;UPDATE a", _txDriver.statements())
+
+	_txDriver.reset(map[string][]uint16{"UPDATE a": {1062}})
+	_, err = db.Exec(context.Background(), "UPDATE a")
+	assert.NotNil(t, err)
+	assert.Equal(t, "UPDATE a", _txDriver.statements())
+}
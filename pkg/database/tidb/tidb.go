@@ -19,6 +19,24 @@ type Config struct {
 	ExecTimeout  time.Duration   // execute sql timeout
 	TranTimeout  time.Duration   // transaction sql timeout
 	Breaker      *breaker.Config // breaker
+	// ReplicaRead is the tidb_replica_read of sessions: leader, follower or
+	// leader-and-follower, the follower reads are still strongly consistent.
+	ReplicaRead string
+	// ReadStaleness is the tidb_read_staleness of sessions, the reads out of
+	// transactions return the data of ReadStaleness ago. Only use it for the
+	// analytics databases which tolerate stale data.
+	ReadStaleness time.Duration
+	// ConflictRetries is the retries of Exec on write conflict and deadlock,
+	// it is also the default retries of Transact if not zero.
+	ConflictRetries int
+	// EvictErrors is the consecutive connection errors after which a node is
+	// evicted until its health check passes, zero means never evict.
+	EvictErrors int
+	// StatInterval is the interval to export the pool statistics, default 10s.
+	StatInterval time.Duration
+	// LeakThreshold enables the leak detection, the Rows and Tx not closed
+	// within it are reported with the stacks where they are created.
+	LeakThreshold time.Duration
 }
 
 // NewTiDB new db and retry connection when has error.
@@ -0,0 +1,80 @@
+package tidb
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/djienet/kratos/pkg/database/internal/transact"
+	"github.com/djienet/kratos/pkg/net/netutil"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/pkg/errors"
+)
+
+// _retryableErrors is the mysql error numbers a transaction can be retried on.
+var _retryableErrors = map[uint16]bool{
+	1213: true, // ER_LOCK_DEADLOCK
+	9007: true, // write conflict
+}
+
+// TxOption is the option of Transact.
+type TxOption = transact.Option
+
+// Isolation sets the isolation level of the transaction.
+func Isolation(level sql.IsolationLevel) TxOption {
+	return transact.Isolation(level)
+}
+
+// ReadOnly makes the transaction read only.
+func ReadOnly() TxOption {
+	return transact.ReadOnly()
+}
+
+// Retry sets the max retries on retryable errors and the backoff between
+// two attempts, retries is 3 by default.
+func Retry(retries int, backoff netutil.Backoff) TxOption {
+	return transact.Retry(retries, backoff)
+}
+
+// Transact runs fn in a transaction, the transaction is
+// committed if fn returns nil, otherwise it is rolled back, also when fn
+// panics. The whole transaction is retried with backoff on deadlock and write conflict, so fn
+// must be safe to run again. The statements of tx run with c bounded by
+// TranTimeout unless their Context variants are used.
+func (db *DB) Transact(c context.Context, fn func(tx *Tx) error, opts ...TxOption) error {
+	if db.conf.ConflictRetries > 0 {
+		opts = append([]TxOption{Retry(db.conf.ConflictRetries, nil)}, opts...)
+	}
+	return transact.Run(c, opts, func(attempt int, o *sql.TxOptions) error {
+		return db.conn().transact(c, attempt, fn, o)
+	}, retryable)
+}
+
+func (db *conn) transact(c context.Context, attempt int, fn func(tx *Tx) error, opts *sql.TxOptions) error {
+	return transact.Attempt(c, _family, db.addr, attempt, func(c context.Context) (transact.Tx, error) {
+		tx, err := db.begin(c, opts)
+		if err != nil {
+			return nil, err
+		}
+		return tx, nil
+	}, func(tx transact.Tx) error {
+		return fn(tx.(*Tx))
+	})
+}
+
+// Transact runs fn in a nested transaction of tx by savepoint, the changes of
+// fn are rolled back to the savepoint if fn returns an error or panics.
+func (tx *Tx) Transact(fn func(tx *Tx) error) error {
+	tx.savepoint++
+	return transact.Savepoint(tx.savepoint, func(query string) error {
+		_, err := tx.Exec(query)
+		return err
+	}, func() error {
+		return fn(tx)
+	})
+}
+
+func retryable(err error) bool {
+	e, ok := errors.Cause(err).(*mysql.MySQLError)
+	return ok && _retryableErrors[e.Number]
+}
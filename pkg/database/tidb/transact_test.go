@@ -0,0 +1,209 @@
+package tidb
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/djienet/kratos/pkg/net/netutil"
+	"github.com/djienet/kratos/pkg/net/netutil/breaker"
+	xtime "github.com/djienet/kratos/pkg/time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+// txDriver records the statements and transactions, the statements in fails
+// fail with the mysql errors of the numbers in turn, and the requests to the
+// addrs in down fail with a network error.
+type txDriver struct {
+	sync.Mutex
+	stmts  []string
+	fails  map[string][]uint16
+	values []interface{}
+	down   map[string]bool
+}
+
+type txConn struct {
+	d    *txDriver
+	addr string
+}
+
+var errTxDown = errors.New("connection refused")
+
+type ctxKey struct{}
+
+var _txDriver = &txDriver{}
+
+func init() {
+	sql.Register("tidb_tx", _txDriver)
+}
+
+func (d *txDriver) Open(addr string) (driver.Conn, error) { return &txConn{d: d, addr: addr}, nil }
+
+func (d *txDriver) reset(fails map[string][]uint16) {
+	d.Lock()
+	d.stmts, d.fails, d.values, d.down = nil, fails, nil, make(map[string]bool)
+	d.Unlock()
+}
+
+func (d *txDriver) setDown(addr string, down bool) {
+	d.Lock()
+	d.down[addr] = down
+	d.Unlock()
+}
+
+func (d *txDriver) log(stmt string) {
+	d.Lock()
+	d.stmts = append(d.stmts, stmt)
+	d.Unlock()
+}
+
+func (d *txDriver) statements() string {
+	d.Lock()
+	defer d.Unlock()
+	return strings.Join(d.stmts, ";")
+}
+
+func (c *txConn) Prepare(query string) (driver.Stmt, error) { return nil, driver.ErrSkip }
+func (c *txConn) Close() error                              { return nil }
+func (c *txConn) Begin() (driver.Tx, error) {
+	c.d.log("BEGIN")
+	return c, nil
+}
+func (c *txConn) Commit() error {
+	c.d.log("COMMIT")
+	return nil
+}
+func (c *txConn) Rollback() error {
+	c.d.log("ROLLBACK")
+	return nil
+}
+
+func (c *txConn) Ping(ctx context.Context) error {
+	c.d.Lock()
+	defer c.d.Unlock()
+	if c.d.down[c.addr] {
+		return errTxDown
+	}
+	return nil
+}
+
+func (c *txConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	c.d.Lock()
+	defer c.d.Unlock()
+	if c.d.down[c.addr] {
+		return nil, errTxDown
+	}
+	c.d.stmts = append(c.d.stmts, query)
+	c.d.values = append(c.d.values, ctx.Value(ctxKey{}))
+	if fails := c.d.fails[query]; len(fails) > 0 {
+		c.d.fails[query] = fails[1:]
+		return nil, &mysql.MySQLError{Number: fails[0], Message: "fail"}
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func newTxConn(t *testing.T, conf *Config, addr string) *conn {
+	d, err := sql.Open("tidb_tx", addr)
+	assert.Nil(t, err)
+	return &conn{DB: d, breaker: breaker.NewGroup(nil).Get(addr), conf: conf, addr: addr}
+}
+
+func newTxDB(t *testing.T, fails map[string][]uint16) *DB {
+	_txDriver.reset(fails)
+	conf := &Config{TranTimeout: xtime.Duration(time.Second), ExecTimeout: xtime.Duration(time.Second)}
+	return &DB{conf: conf, conns: []*conn{newTxConn(t, conf, "tx")}}
+}
+
+var _testBackoff = &netutil.BackoffConfig{MaxDelay: time.Millisecond, BaseDelay: time.Millisecond, Factor: 1}
+
+func TestTransactCommit(t *testing.T) {
+	db := newTxDB(t, nil)
+	err := db.Transact(context.Background(), func(tx *Tx) error {
+		_, err := tx.Exec("UPDATE a")
+		return err
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "BEGIN;UPDATE a;COMMIT", _txDriver.statements())
+}
+
+func TestTransactRollback(t *testing.T) {
+	db := newTxDB(t, nil)
+	want := errors.New("fn error")
+	err := db.Transact(context.Background(), func(tx *Tx) error {
+		tx.Exec("UPDATE a")
+		return want
+	})
+	assert.Equal(t, want, err)
+	assert.Equal(t, "BEGIN;UPDATE a;ROLLBACK", _txDriver.statements())
+}
+
+func TestTransactRetry(t *testing.T) {
+	db := newTxDB(t, map[string][]uint16{"UPDATE a": {9007, 1213}})
+	var attempts int
+	err := db.Transact(context.Background(), func(tx *Tx) error {
+		attempts++
+		_, err := tx.Exec("UPDATE a")
+		return err
+	}, Retry(3, _testBackoff))
+	assert.Nil(t, err)
+	assert.Equal(t, 3, attempts)
+	assert.Equal(t, "BEGIN;UPDATE a;ROLLBACK;BEGIN;UPDATE a;ROLLBACK;BEGIN;UPDATE a;COMMIT", _txDriver.statements())
+
+	db = newTxDB(t, map[string][]uint16{"UPDATE a": {1062}})
+	err = db.Transact(context.Background(), func(tx *Tx) error {
+		_, err := tx.Exec("UPDATE a")
+		return err
+	}, Retry(3, _testBackoff))
+	assert.NotNil(t, err)
+	assert.Equal(t, "BEGIN;UPDATE a;ROLLBACK", _txDriver.statements())
+}
+
+func TestTransactPanic(t *testing.T) {
+	db := newTxDB(t, nil)
+	assert.Panics(t, func() {
+		db.Transact(context.Background(), func(tx *Tx) error {
+			tx.Exec("UPDATE a")
+			panic("fn panic")
+		})
+	})
+	assert.Equal(t, "BEGIN;UPDATE a;ROLLBACK", _txDriver.statements())
+}
+
+func TestSavepoint(t *testing.T) {
+	db := newTxDB(t, nil)
+	err := db.Transact(context.Background(), func(tx *Tx) error {
+		assert.NotNil(t, tx.Transact(func(tx *Tx) error {
+			tx.Exec("UPDATE b")
+			return errors.New("nested error")
+		}))
+		return tx.Transact(func(tx *Tx) error {
+			_, err := tx.Exec("UPDATE c")
+			return err
+		})
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "BEGIN;"+
+		"SAVEPOINT kratos_sp_1;UPDATE b;ROLLBACK TO SAVEPOINT kratos_sp_1;"+
+		"SAVEPOINT kratos_sp_2;UPDATE c;RELEASE SAVEPOINT kratos_sp_2;COMMIT", _txDriver.statements())
+}
+
+func TestTxContext(t *testing.T) {
+	db := newTxDB(t, nil)
+	c := context.WithValue(context.Background(), ctxKey{}, "transact")
+	err := db.Transact(c, func(tx *Tx) error {
+		if _, err := tx.Exec("UPDATE a"); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(context.WithValue(c, ctxKey{}, "statement"), "UPDATE b")
+		return err
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{"transact", "statement"}, _txDriver.values)
+}
@@ -12,9 +12,13 @@ var (
 	NothingFound       = add(-404) // 啥都木有
 	MethodNotAllowed   = add(-405) // 不支持该方法
 	Conflict           = add(-409) // 冲突
+	MessageTooLarge    = add(-413) // 消息体过大
 	Canceled           = add(-498) // 客户端取消请求
 	ServerErr          = add(-500) // 服务器错误
 	ServiceUnavailable = add(-503) // 过载保护,服务暂不可用
 	Deadline           = add(-504) // 服务调用超时
 	LimitExceed        = add(-509) // 超出限制
+
+	Deadlock             = add(-540) // 数据库死锁
+	SerializationFailure = add(-541) // 数据库事务序列化失败
 )
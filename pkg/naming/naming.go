@@ -12,6 +12,12 @@ const (
 	MetaColor   = "color"
 )
 
+// instance status
+const (
+	StatusUP      = 1
+	StatusWaiting = 2
+)
+
 // Instance represents a server the client connects to.
 type Instance struct {
 	// Region is region.
@@ -104,63 +104,79 @@ func Subset(defaultSize int) BuildOpt {
 	}}
 }
 
+// ScheduleZones picks the instances of the zones in proportion to weights.
+// The zone with the fewest instances per weight keeps all of them (at most
+// size if size > 0), the others are subset to keep the ratio of the weights,
+// zones without instances or a positive weight are skipped.
+func ScheduleZones(inss map[string][]*Instance, weights map[string]int64, size int, subset func([]*Instance, int) []*Instance) map[string][]*Instance {
+	type Zone struct {
+		inss   []*Instance
+		weight int64
+		name   string
+		score  float64
+	}
+	if subset == nil {
+		subset = defulatSubset
+	}
+	var (
+		zones []*Zone
+		min   *Zone
+	)
+	for name, weight := range weights {
+		if weight <= 0 || len(inss[name]) == 0 {
+			continue
+		}
+		z := &Zone{
+			inss:   inss[name],
+			weight: weight,
+			name:   name,
+			score:  float64(len(inss[name])) / float64(weight),
+		}
+		if min == nil || z.score < min.score {
+			min = z
+		}
+		zones = append(zones, z)
+	}
+	res := make(map[string][]*Instance, len(zones))
+	if min == nil {
+		return res
+	}
+	if size > 0 && len(min.inss) > size {
+		min.score = float64(size) / float64(min.weight)
+	}
+	for _, z := range zones {
+		nums := int(min.score * float64(z.weight))
+		if nums == 0 {
+			nums = 1
+		}
+		if nums < len(z.inss) {
+			z.inss = subset(z.inss, nums)
+		}
+		res[z.name] = z.inss
+	}
+	return res
+}
+
 // ScheduleNode ScheduleNode option.
 func ScheduleNode(clientZone string) BuildOpt {
 	return &funcOpt{f: func(opt *BuildOptions) {
 		opt.ClientZone = clientZone
 		opt.Scheduler = func(app *InstancesInfo) (instances []*Instance) {
-			type Zone struct {
-				inss   []*Instance
-				weight int64
-				name   string
-				score  float64
-			}
-			var zones []*Zone
-
 			if app.Scheduler != nil {
 				si, err := json.Marshal(app.Scheduler)
 				if err == nil {
 					log.Info("schedule info: %s", string(si))
 				}
-				if strategy, ok := app.Scheduler.Clients[clientZone]; ok {
-					var min *Zone
+				if strategy, ok := app.Scheduler.Clients[clientZone]; ok && strategy != nil {
+					weights := make(map[string]int64, len(strategy.Zones))
 					for name, zone := range strategy.Zones {
-						inss := app.Instances[name]
-						if len(inss) == 0 {
-							continue
-						}
-						z := &Zone{
-							inss:   inss,
-							weight: zone.Weight,
-							name:   name,
-							score:  float64(len(inss)) / float64(zone.Weight),
-						}
-						if min == nil || z.score < min.score {
-							min = z
+						if zone != nil {
+							weights[name] = zone.Weight
 						}
-						zones = append(zones, z)
 					}
-					if opt.SubsetSize != 0 && len(min.inss) > opt.SubsetSize {
-						min.score = float64(opt.SubsetSize) / float64(min.weight)
+					for _, inss := range ScheduleZones(app.Instances, weights, opt.SubsetSize, opt.Subset) {
+						instances = append(instances, inss...)
 					}
-					for _, z := range zones {
-						nums := int(min.score * float64(z.weight))
-						if nums == 0 {
-							nums = 1
-						}
-						if nums < len(z.inss) {
-							if opt.Subset != nil {
-								z.inss = opt.Subset(z.inss, nums)
-							} else {
-								z.inss = defulatSubset(z.inss, nums)
-							}
-						}
-					}
-				}
-			}
-			for _, zone := range zones {
-				for _, ins := range zone.inss {
-					instances = append(instances, ins)
 				}
 			}
 			//如果没有拿到节点，则选择直接获取
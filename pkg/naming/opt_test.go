@@ -297,3 +297,23 @@ func compareAddr(inss []*Instance, c map[string]int) (err error) {
 	}
 	return
 }
+
+func Test_ScheduleEmpty(t *testing.T) {
+	app := &InstancesInfo{
+		Instances: map[string][]*Instance{"sh003": []*Instance{&Instance{
+			Zone:  "sh003",
+			Addrs: []string{"grpc://127.0.0.1:9000"},
+		}}},
+		Scheduler: &Scheduler{map[string]*ZoneStrategy{"sh001": &ZoneStrategy{
+			Zones: map[string]*Strategy{
+				"sh001": &Strategy{10},
+				"sh002": &Strategy{20},
+			},
+		}}},
+	}
+	var opt BuildOptions
+	ScheduleNode("sh001").Apply(&opt)
+	if err := compareAddr(opt.Scheduler(app), map[string]int{"sh003": 1}); err != nil {
+		t.Fatalf(err.Error())
+	}
+}
@@ -12,6 +12,7 @@ import (
 	"net/url"
 	"os"
 	"runtime"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -24,6 +25,7 @@ import (
 	xtime "github.com/djienet/kratos/pkg/time"
 	"github.com/gogo/protobuf/proto"
 	pkgerr "github.com/pkg/errors"
+	"golang.org/x/sync/singleflight"
 )
 
 const (
@@ -49,6 +51,9 @@ type ClientConfig struct {
 	Breaker   *breaker.Config
 	URL       map[string]*ClientConfig
 	Host      map[string]*ClientConfig
+	// SingleFlight merges identical in-flight requests, which are keyed by
+	// method, url, headers, outgoing metadata and body, can be set per url or host.
+	SingleFlight bool
 }
 
 // Client is http client.
@@ -62,6 +67,7 @@ type Client struct {
 	hostConf map[string]*ClientConfig
 	mutex    sync.RWMutex
 	breaker  *breaker.Group
+	sf       singleflight.Group
 }
 
 // NewClient new a http client.
@@ -214,18 +220,62 @@ func (client *Client) RESTfulPost(c context.Context, uri, ip string, params url.
 // Raw sends an HTTP request and returns bytes response
 func (client *Client) Raw(c context.Context, req *xhttp.Request, v ...string) (bs []byte, err error) {
 	var (
-		ok      bool
-		code    string
-		cancel  func()
-		resp    *xhttp.Response
-		config  *ClientConfig
-		timeout time.Duration
-		uri     = fmt.Sprintf("%s://%s%s", req.URL.Scheme, req.Host, req.URL.Path)
+		ok     bool
+		config *ClientConfig
+		uri    = fmt.Sprintf("%s://%s%s", req.URL.Scheme, req.Host, req.URL.Path)
 	)
 	// NOTE fix prom & config uri key.
 	if len(v) == 1 {
 		uri = v[0]
 	}
+	// get config
+	// 1.url config 2.host config 3.default
+	client.mutex.RLock()
+	if config, ok = client.urlConf[uri]; !ok {
+		if config, ok = client.hostConf[req.Host]; !ok {
+			config = client.conf
+		}
+	}
+	client.mutex.RUnlock()
+	if !config.SingleFlight {
+		return client.raw(c, req, uri, config)
+	}
+	key, ok := singleFlightKey(c, req)
+	if !ok {
+		return client.raw(c, req, uri, config)
+	}
+	var executed bool
+	// the shared request runs on a context detached from the caller and bounded
+	// by the client timeout, every caller waits for it until its own context is done.
+	ch := client.sf.DoChan(key, func() (interface{}, error) {
+		executed = true
+		return client.raw(metadata.Detach(c), req, uri, config)
+	})
+	select {
+	case res := <-ch:
+		if executed {
+			_metricClientSingleFlight.Inc(uri, req.Method, "executed")
+		} else {
+			_metricClientSingleFlight.Inc(uri, req.Method, "merged")
+		}
+		if err = res.Err; err != nil {
+			return
+		}
+		// the callers get a clone of the response.
+		bs = append([]byte(nil), res.Val.([]byte)...)
+	case <-c.Done():
+		err = pkgerr.Wrapf(c.Err(), "host:%s, url:%s", req.URL.Host, realURL(req))
+	}
+	return
+}
+
+func (client *Client) raw(c context.Context, req *xhttp.Request, uri string, config *ClientConfig) (bs []byte, err error) {
+	var (
+		code    string
+		cancel  func()
+		resp    *xhttp.Response
+		timeout time.Duration
+	)
 	// breaker
 	brk := client.breaker.Get(uri)
 	if err = brk.Allow(); err != nil {
@@ -242,15 +292,6 @@ func (client *Client) Raw(c context.Context, req *xhttp.Request, v ...string) (b
 			_metricClientReqCodeTotal.Inc(uri, req.Method, code)
 		}
 	}()
-	// get config
-	// 1.url config 2.host config 3.default
-	client.mutex.RLock()
-	if config, ok = client.urlConf[uri]; !ok {
-		if config, ok = client.hostConf[req.Host]; !ok {
-			config = client.conf
-		}
-	}
-	client.mutex.RUnlock()
 	// timeout
 	deliver := true
 	timeout = time.Duration(config.Timeout)
@@ -341,6 +382,49 @@ func (client *Client) onBreaker(breaker breaker.Breaker, err *error) {
 	}
 }
 
+// singleFlightKey returns the key of request, the request body is read
+// by GetBody, ok is false if the body can not be read again.
+func singleFlightKey(c context.Context, req *xhttp.Request) (key string, ok bool) {
+	buf := new(bytes.Buffer)
+	buf.WriteString(req.Method)
+	buf.WriteString(req.URL.String())
+	// the outgoing metadata is sent as headers by raw.
+	var md []string
+	metadata.Range(c,
+		func(key string, value interface{}) {
+			md = append(md, fmt.Sprintf("%s=%v", key, value))
+		},
+		metadata.IsOutgoingKey)
+	sort.Strings(md)
+	for _, kv := range md {
+		buf.WriteString(kv)
+	}
+	names := make([]string, 0, len(req.Header))
+	for name := range req.Header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		buf.WriteString(name)
+		buf.WriteString(strings.Join(req.Header[name], ","))
+	}
+	if req.Body != nil && req.Body != xhttp.NoBody {
+		if req.GetBody == nil {
+			return
+		}
+		body, err := req.GetBody()
+		if err != nil {
+			return
+		}
+		_, err = buf.ReadFrom(body)
+		body.Close()
+		if err != nil {
+			return
+		}
+	}
+	return buf.String(), true
+}
+
 // realUrl return url with http://host/params.
 func realURL(req *xhttp.Request) string {
 	if req.Method == xhttp.MethodGet {
@@ -0,0 +1,88 @@
+package blademaster
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	xtime "github.com/djienet/kratos/pkg/time"
+)
+
+func TestClientSingleFlight(t *testing.T) {
+	var calls int64
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&calls, 1)
+		time.Sleep(100 * time.Millisecond)
+		w.Write([]byte(`{"code":0,"message":"` + r.FormValue("name") + `"}`))
+	}))
+	defer svr.Close()
+
+	client := NewClient(&ClientConfig{
+		Dial:         xtime.Duration(time.Second),
+		Timeout:      xtime.Duration(time.Second),
+		SingleFlight: true,
+	})
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var res struct {
+				Code    int    `json:"code"`
+				Message string `json:"message"`
+			}
+			params := url.Values{"name": []string{"sf"}}
+			if err := client.Post(context.Background(), svr.URL, "", params, &res); err != nil {
+				t.Errorf("client.Post error(%v)", err)
+				return
+			}
+			if res.Message != "sf" {
+				t.Errorf("response message should be sf, got %s", res.Message)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := atomic.LoadInt64(&calls); n >= 10 {
+		t.Fatalf("identical requests should be merged, calls(%d)", n)
+	}
+}
+
+func TestClientSingleFlightCanceled(t *testing.T) {
+	var calls int64
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&calls, 1)
+		time.Sleep(100 * time.Millisecond)
+		w.Write([]byte(`{"code":0,"message":"sf"}`))
+	}))
+	defer svr.Close()
+
+	client := NewClient(&ClientConfig{
+		Dial:         xtime.Duration(time.Second),
+		Timeout:      xtime.Duration(time.Second),
+		SingleFlight: true,
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	leader := make(chan error, 1)
+	go func() {
+		leader <- client.Get(ctx, svr.URL, "", nil, nil)
+	}()
+	time.Sleep(5 * time.Millisecond)
+	var res struct {
+		Message string `json:"message"`
+	}
+	if err := client.Get(context.Background(), svr.URL, "", nil, &res); err != nil || res.Message != "sf" {
+		t.Fatalf("the waiter should not fail with the leader, message(%s) error(%v)", res.Message, err)
+	}
+	if err := <-leader; err == nil {
+		t.Fatal("the leader should fail by its own deadline")
+	}
+	if n := atomic.LoadInt64(&calls); n != 1 {
+		t.Fatalf("the waiter should be merged, calls(%d)", n)
+	}
+}
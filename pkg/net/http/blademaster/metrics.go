@@ -45,6 +45,13 @@ var (
 		Help:      "http client requests code count.",
 		Labels:    []string{"path", "method", "code"},
 	})
+	_metricClientSingleFlight = metric.NewCounterVec(&metric.CounterVecOpts{
+		Namespace: clientNamespace,
+		Subsystem: "singleflight",
+		Name:      "total",
+		Help:      "http client singleflight requests count, state is executed or merged.",
+		Labels:    []string{"path", "method", "state"},
+	})
 
 	_metricsRequestionTotal = metric.NewCounterVec(&metric.CounterVecOpts{
 		Subsystem: "http",
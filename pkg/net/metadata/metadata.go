@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"strconv"
+	"time"
 
 	"github.com/pkg/errors"
 )
@@ -117,6 +118,22 @@ func WithContext(c context.Context) context.Context {
 	return context.Background()
 }
 
+// detachedContext keeps the values of the context but not its deadline and
+// cancellation.
+type detachedContext struct {
+	context.Context
+}
+
+func (detachedContext) Deadline() (deadline time.Time, ok bool) { return }
+func (detachedContext) Done() <-chan struct{}                   { return nil }
+func (detachedContext) Err() error                              { return nil }
+
+// Detach return no deadline context and retain all the values of c, e.g.
+// the metadata and trace, for the work shared by several callers.
+func Detach(c context.Context) context.Context {
+	return detachedContext{c}
+}
+
 // Bool get boolean from metadata in context use strconv.Parse.
 func Bool(ctx context.Context, key string) bool {
 	md, ok := ctx.Value(mdKey{}).(MD)
@@ -147,3 +147,15 @@ func TestRange(t *testing.T) {
 		}
 	}
 }
+
+func TestDetach(t *testing.T) {
+	c, cancel := context.WithCancel(NewContext(context.Background(), Pairs(Color, "red", Trace, "trace")))
+	cancel()
+	ctx := Detach(c)
+	assert.Nil(t, ctx.Err())
+	assert.Nil(t, ctx.Done())
+	_, ok := ctx.Deadline()
+	assert.False(t, ok)
+	assert.Equal(t, "red", String(ctx, Color))
+	assert.Equal(t, "trace", String(ctx, Trace))
+}
@@ -0,0 +1,29 @@
+package outlier
+
+import "github.com/djienet/kratos/pkg/stat/metric"
+
+const namespace = "grpc_client"
+
+var (
+	_metricEjectTotal = metric.NewCounterVec(&metric.CounterVecOpts{
+		Namespace: namespace,
+		Subsystem: "outlier",
+		Name:      "ejections_total",
+		Help:      "grpc client outlier ejections total.",
+		Labels:    []string{"name", "addr", "reason"},
+	})
+	_metricEjectOverflow = metric.NewCounterVec(&metric.CounterVecOpts{
+		Namespace: namespace,
+		Subsystem: "outlier",
+		Name:      "ejections_overflow_total",
+		Help:      "grpc client outlier ejections skipped by max ejection percent.",
+		Labels:    []string{"name", "reason"},
+	})
+	_metricEjected = metric.NewGaugeVec(&metric.GaugeVecOpts{
+		Namespace: namespace,
+		Subsystem: "outlier",
+		Name:      "ejected",
+		Help:      "grpc client outlier hosts ejected currently.",
+		Labels:    []string{"name"},
+	})
+)
@@ -0,0 +1,286 @@
+package outlier
+
+import (
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/djienet/kratos/pkg/log"
+	xtime "github.com/djienet/kratos/pkg/time"
+)
+
+// Config outlier detection config.
+type Config struct {
+	SwitchOff bool // outlier detection switch, default on.
+
+	// ConsecutiveErrors is the number of consecutive errors before a host is ejected.
+	ConsecutiveErrors int64
+	// Interval is the time between two success rate analysis.
+	Interval xtime.Duration
+	// BaseEjectionTime is doubled every time the same host is ejected again,
+	// until MaxEjectionTime.
+	BaseEjectionTime xtime.Duration
+	MaxEjectionTime  xtime.Duration
+	// MaxEjectionPercent is the max percent of hosts can be ejected at the same time,
+	// one host can always be ejected if there are more than one hosts.
+	MaxEjectionPercent int64
+
+	// success rate analysis only runs when there are at least SuccessRateMinimumHosts
+	// hosts with SuccessRateRequestVolume requests in the interval, a host is ejected
+	// if its success rate is lower than mean - stdev * SuccessRateStdevFactor.
+	SuccessRateMinimumHosts  int
+	SuccessRateRequestVolume int64
+	SuccessRateStdevFactor   float64
+}
+
+func (conf *Config) fix() {
+	if conf.ConsecutiveErrors == 0 {
+		conf.ConsecutiveErrors = 5
+	}
+	if conf.Interval == 0 {
+		conf.Interval = xtime.Duration(10 * time.Second)
+	}
+	if conf.BaseEjectionTime == 0 {
+		conf.BaseEjectionTime = xtime.Duration(30 * time.Second)
+	}
+	if conf.MaxEjectionTime == 0 {
+		conf.MaxEjectionTime = xtime.Duration(300 * time.Second)
+	}
+	if conf.MaxEjectionPercent == 0 {
+		conf.MaxEjectionPercent = 10
+	}
+	if conf.SuccessRateMinimumHosts == 0 {
+		conf.SuccessRateMinimumHosts = 5
+	}
+	if conf.SuccessRateRequestVolume == 0 {
+		conf.SuccessRateRequestVolume = 100
+	}
+	if conf.SuccessRateStdevFactor == 0 {
+		conf.SuccessRateStdevFactor = 1.9
+	}
+}
+
+const (
+	_reasonConsecutive = "consecutive_errors"
+	_reasonSuccessRate = "success_rate"
+
+	// ejections not reported for _hostIdle are removed from the registry, which
+	// is swept at most once every _hostSweep.
+	_hostIdle  = int64(time.Hour)
+	_hostSweep = int64(time.Minute)
+)
+
+var (
+	_mu   sync.RWMutex
+	_conf = &Config{
+		ConsecutiveErrors:        5,
+		Interval:                 xtime.Duration(10 * time.Second),
+		BaseEjectionTime:         xtime.Duration(30 * time.Second),
+		MaxEjectionTime:          xtime.Duration(300 * time.Second),
+		MaxEjectionPercent:       10,
+		SuccessRateMinimumHosts:  5,
+		SuccessRateRequestVolume: 100,
+		SuccessRateStdevFactor:   1.9,
+	}
+
+	_ejections = struct {
+		sync.Mutex
+		m       map[string]*ejection
+		sweepAt int64
+	}{m: make(map[string]*ejection)}
+)
+
+// Init init global outlier detection config, it takes effect on the
+// detectors created afterwards.
+func Init(conf *Config) {
+	if conf == nil {
+		return
+	}
+	conf.fix()
+	_mu.Lock()
+	_conf = conf
+	_mu.Unlock()
+}
+
+// Host is the outlier state of a backend address in a detector. The request
+// counters belong to the detector, while the ejection is shared by the hosts
+// of the same address, so it survives the rebuilding of pickers.
+type Host struct {
+	consecutive int64
+	success     int64
+	total       int64
+
+	addr string
+	*ejection
+}
+
+type ejection struct {
+	// ejections is the multiplier of the ejection time.
+	ejections    int64
+	ejectedUntil int64
+	lastReport   int64
+}
+
+func ejectionOf(addr string) *ejection {
+	now := time.Now().UnixNano()
+	_ejections.Lock()
+	defer _ejections.Unlock()
+	e, ok := _ejections.m[addr]
+	if !ok {
+		e = &ejection{lastReport: now}
+		_ejections.m[addr] = e
+	}
+	if now-_ejections.sweepAt < _hostSweep {
+		return e
+	}
+	_ejections.sweepAt = now
+	for a, o := range _ejections.m {
+		if now-atomic.LoadInt64(&o.lastReport) > _hostIdle && !o.ejected(now) && o != e {
+			delete(_ejections.m, a)
+		}
+	}
+	return e
+}
+
+func (e *ejection) ejected(now int64) bool {
+	return now < atomic.LoadInt64(&e.ejectedUntil)
+}
+
+// Detector detects and ejects the outlier hosts of a picker.
+type Detector struct {
+	conf  *Config
+	name  string
+	hosts []*Host
+
+	analyzeAt int64
+	mu        sync.Mutex
+}
+
+// New new a detector with the global config, name is used in logs and metrics.
+func New(name string) *Detector {
+	_mu.RLock()
+	conf := _conf
+	_mu.RUnlock()
+	return &Detector{
+		conf:      conf,
+		name:      name,
+		analyzeAt: time.Now().UnixNano(),
+	}
+}
+
+// Add adds the host of addr to the detector.
+func (d *Detector) Add(addr string) *Host {
+	h := &Host{addr: addr, ejection: ejectionOf(addr)}
+	d.hosts = append(d.hosts, h)
+	return h
+}
+
+// Ejected reports whether the host is ejected now.
+func (d *Detector) Ejected(h *Host) bool {
+	if d.conf.SwitchOff {
+		return false
+	}
+	return h.ejected(time.Now().UnixNano())
+}
+
+// Report reports the result of a request sent to the host.
+func (d *Detector) Report(h *Host, success bool) {
+	if d.conf.SwitchOff {
+		return
+	}
+	now := time.Now().UnixNano()
+	atomic.StoreInt64(&h.lastReport, now)
+	atomic.AddInt64(&h.total, 1)
+	if success {
+		atomic.AddInt64(&h.success, 1)
+		atomic.StoreInt64(&h.consecutive, 0)
+	} else if atomic.AddInt64(&h.consecutive, 1) >= d.conf.ConsecutiveErrors {
+		d.mu.Lock()
+		d.eject(h, now, _reasonConsecutive)
+		d.mu.Unlock()
+	}
+	at := atomic.LoadInt64(&d.analyzeAt)
+	if now-at >= int64(d.conf.Interval) && atomic.CompareAndSwapInt64(&d.analyzeAt, at, now) {
+		d.analyze(now)
+	}
+}
+
+// eject must be called with d.mu held.
+func (d *Detector) eject(h *Host, now int64, reason string) {
+	if h.ejected(now) {
+		return
+	}
+	var ejected int64
+	for _, o := range d.hosts {
+		if o.ejected(now) {
+			ejected++
+		}
+	}
+	max := int64(len(d.hosts)) * d.conf.MaxEjectionPercent / 100
+	if max < 1 && len(d.hosts) > 1 {
+		max = 1
+	}
+	if ejected >= max {
+		_metricEjectOverflow.Inc(d.name, reason)
+		return
+	}
+	n := atomic.AddInt64(&h.ejections, 1)
+	if n > 16 {
+		n = 16
+	}
+	dur := int64(d.conf.BaseEjectionTime) << uint(n-1)
+	if dur > int64(d.conf.MaxEjectionTime) {
+		dur = int64(d.conf.MaxEjectionTime)
+	}
+	atomic.StoreInt64(&h.ejectedUntil, now+dur)
+	atomic.StoreInt64(&h.consecutive, 0)
+	_metricEjectTotal.Inc(d.name, h.addr, reason)
+	_metricEjected.Set(float64(ejected+1), d.name)
+	log.Warn("outlier: %s host(%s) ejected for %v, reason(%s) ejections(%d)", d.name, h.addr, time.Duration(dur), reason, n)
+}
+
+func (d *Detector) analyze(now int64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var (
+		hosts   []*Host
+		rates   []float64
+		sum     float64
+		ejected int
+	)
+	for _, h := range d.hosts {
+		total := atomic.SwapInt64(&h.total, 0)
+		success := atomic.SwapInt64(&h.success, 0)
+		if h.ejected(now) {
+			ejected++
+			continue
+		}
+		// decrease the ejection multiplier of the hosts which keep healthy.
+		if total == success && atomic.LoadInt64(&h.ejections) > 0 {
+			atomic.AddInt64(&h.ejections, -1)
+		}
+		if total >= d.conf.SuccessRateRequestVolume {
+			rate := float64(success) / float64(total)
+			hosts = append(hosts, h)
+			rates = append(rates, rate)
+			sum += rate
+		}
+	}
+	_metricEjected.Set(float64(ejected), d.name)
+	if len(rates) < d.conf.SuccessRateMinimumHosts {
+		return
+	}
+	mean := sum / float64(len(rates))
+	var variance float64
+	for _, rate := range rates {
+		variance += (rate - mean) * (rate - mean)
+	}
+	stdev := math.Sqrt(variance / float64(len(rates)))
+	threshold := mean - stdev*d.conf.SuccessRateStdevFactor
+	for i, rate := range rates {
+		if rate < threshold {
+			d.eject(hosts[i], now, _reasonSuccessRate)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package outlier
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	xtime "github.com/djienet/kratos/pkg/time"
+)
+
+func newTestDetector(name string, n int) (d *Detector, hosts []*Host) {
+	d = New(name)
+	for i := 0; i < n; i++ {
+		addr := fmt.Sprintf("%s_%d", name, i)
+		// ejections are global, drop the states of the former runs.
+		_ejections.Lock()
+		delete(_ejections.m, addr)
+		_ejections.Unlock()
+		hosts = append(hosts, d.Add(addr))
+	}
+	return
+}
+
+func TestConsecutiveErrors(t *testing.T) {
+	d, hosts := newTestDetector("consecutive", 10)
+	for i := 0; i < 4; i++ {
+		d.Report(hosts[0], false)
+	}
+	if d.Ejected(hosts[0]) {
+		t.Fatalf("host should not be ejected before %d consecutive errors", d.conf.ConsecutiveErrors)
+	}
+	d.Report(hosts[0], true)
+	for i := 0; i < 4; i++ {
+		d.Report(hosts[0], false)
+	}
+	if d.Ejected(hosts[0]) {
+		t.Fatal("consecutive errors should be reset by success")
+	}
+	d.Report(hosts[0], false)
+	if !d.Ejected(hosts[0]) {
+		t.Fatal("host should be ejected")
+	}
+	// max ejection percent 10% of 10 hosts
+	for i := 0; i < 5; i++ {
+		d.Report(hosts[1], false)
+	}
+	if d.Ejected(hosts[1]) {
+		t.Fatal("host should not be ejected over max ejection percent")
+	}
+}
+
+func TestEjectionTime(t *testing.T) {
+	d, hosts := newTestDetector("ejection", 2)
+	d.conf = &Config{
+		ConsecutiveErrors:  1,
+		Interval:           xtime.Duration(time.Hour),
+		BaseEjectionTime:   xtime.Duration(50 * time.Millisecond),
+		MaxEjectionTime:    xtime.Duration(120 * time.Millisecond),
+		MaxEjectionPercent: 10,
+	}
+	d.Report(hosts[0], false)
+	if !d.Ejected(hosts[0]) {
+		t.Fatal("host should be ejected")
+	}
+	// eject again at the end of each ejection.
+	now := hosts[0].ejectedUntil
+	for i, want := range []time.Duration{100 * time.Millisecond, 120 * time.Millisecond, 120 * time.Millisecond} {
+		d.mu.Lock()
+		d.eject(hosts[0], now, _reasonConsecutive)
+		d.mu.Unlock()
+		if got := time.Duration(hosts[0].ejectedUntil - now); got != want {
+			t.Fatalf("ejection(%d) want %v, got %v", i+2, want, got)
+		}
+		now = hosts[0].ejectedUntil
+	}
+}
+
+func TestHostSweep(t *testing.T) {
+	e := ejectionOf("sweep_idle")
+	atomic.StoreInt64(&e.lastReport, time.Now().UnixNano()-_hostIdle-1)
+	_ejections.Lock()
+	_ejections.sweepAt = 0
+	_ejections.Unlock()
+	ejectionOf("sweep_new")
+	_ejections.Lock()
+	_, ok := _ejections.m["sweep_idle"]
+	_ejections.Unlock()
+	if ok {
+		t.Fatal("idle host should be swept")
+	}
+}
+
+func TestSuccessRate(t *testing.T) {
+	d, hosts := newTestDetector("success_rate", 10)
+	d.conf = &Config{
+		ConsecutiveErrors:        1000,
+		Interval:                 xtime.Duration(time.Hour),
+		BaseEjectionTime:         xtime.Duration(time.Minute),
+		MaxEjectionTime:          xtime.Duration(time.Minute),
+		MaxEjectionPercent:       10,
+		SuccessRateMinimumHosts:  5,
+		SuccessRateRequestVolume: 100,
+		SuccessRateStdevFactor:   1.9,
+	}
+	for i, h := range hosts {
+		for j := 0; j < 100; j++ {
+			// the first host fails half of the requests
+			d.Report(h, i != 0 || j%2 == 0)
+		}
+	}
+	d.analyze(time.Now().UnixNano())
+	if !d.Ejected(hosts[0]) {
+		t.Fatal("host with low success rate should be ejected")
+	}
+	for _, h := range hosts[1:] {
+		if d.Ejected(h) {
+			t.Fatalf("host(%s) should not be ejected", h.addr)
+		}
+	}
+}
+
+func TestSharedAddr(t *testing.T) {
+	d1, hosts1 := newTestDetector("shared", 10)
+	d1.conf = &Config{
+		ConsecutiveErrors:        1000,
+		Interval:                 xtime.Duration(time.Hour),
+		BaseEjectionTime:         xtime.Duration(time.Minute),
+		MaxEjectionTime:          xtime.Duration(time.Minute),
+		MaxEjectionPercent:       10,
+		SuccessRateMinimumHosts:  5,
+		SuccessRateRequestVolume: 100,
+		SuccessRateStdevFactor:   1.9,
+	}
+	// another picker of the same addrs analyzes before d1.
+	d2 := New("shared")
+	for _, h := range hosts1 {
+		d2.Add(h.addr)
+	}
+	for i, h := range hosts1 {
+		for j := 0; j < 100; j++ {
+			d1.Report(h, i != 0 || j%2 == 0)
+		}
+	}
+	d2.analyze(time.Now().UnixNano())
+	d1.analyze(time.Now().UnixNano())
+	if !d1.Ejected(hosts1[0]) {
+		t.Fatal("host with low success rate should be ejected")
+	}
+	// the ejection is shared by the hosts of the same addr.
+	if !d2.Ejected(d2.Add(hosts1[0].addr)) {
+		t.Fatal("ejection should be shared by the detectors")
+	}
+}
+
+func TestSwitchOff(t *testing.T) {
+	d, hosts := newTestDetector("switch_off", 10)
+	d.conf = &Config{SwitchOff: true}
+	for i := 0; i < 10; i++ {
+		d.Report(hosts[0], false)
+	}
+	if d.Ejected(hosts[0]) {
+		t.Fatal("host should not be ejected when switch off")
+	}
+}
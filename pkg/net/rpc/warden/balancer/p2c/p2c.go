@@ -13,6 +13,7 @@ import (
 
 	"github.com/djienet/kratos/pkg/log"
 	nmd "github.com/djienet/kratos/pkg/net/metadata"
+	"github.com/djienet/kratos/pkg/net/rpc/warden/balancer/outlier"
 	wmd "github.com/djienet/kratos/pkg/net/rpc/warden/internal/metadata"
 
 	"google.golang.org/grpc/balancer"
@@ -51,6 +52,7 @@ type subConn struct {
 	conn balancer.SubConn
 	addr resolver.Address
 	meta wmd.MD
+	host *outlier.Host
 
 	//client statistic data
 	lag      uint64
@@ -112,6 +114,10 @@ func (*p2cPickerBuilder) Build(readySCs map[resolver.Address]balancer.SubConn) b
 		colors: make(map[string]*p2cPicker),
 		r:      rand.New(rand.NewSource(time.Now().UnixNano())),
 	}
+	for addr := range readySCs {
+		p.outlier = outlier.New(addr.ServerName)
+		break
+	}
 	for addr, sc := range readySCs {
 		meta, ok := addr.Metadata.(wmd.MD)
 		if !ok {
@@ -130,15 +136,20 @@ func (*p2cPickerBuilder) Build(readySCs map[resolver.Address]balancer.SubConn) b
 			inflight: 1,
 		}
 		if meta.Color == "" {
+			subc.host = p.outlier.Add(addr.Addr)
 			p.subConns = append(p.subConns, subc)
 			continue
 		}
 		// if color not empty, use color picker
 		cp, ok := p.colors[meta.Color]
 		if !ok {
-			cp = &p2cPicker{r: rand.New(rand.NewSource(time.Now().UnixNano()))}
+			cp = &p2cPicker{
+				r:       rand.New(rand.NewSource(time.Now().UnixNano())),
+				outlier: outlier.New(addr.ServerName + "#" + meta.Color),
+			}
 			p.colors[meta.Color] = cp
 		}
+		subc.host = cp.outlier.Add(addr.Addr)
 		cp.subConns = append(cp.subConns, subc)
 	}
 	return p
@@ -150,6 +161,7 @@ type p2cPicker struct {
 	// selection from it and return the selected SubConn.
 	subConns []*subConn
 	colors   map[string]*p2cPicker
+	outlier  *outlier.Detector
 	logTs    int64
 	r        *rand.Rand
 	lk       sync.Mutex
@@ -180,13 +192,18 @@ func (p *p2cPicker) prePick() (nodeA *subConn, nodeB *subConn) {
 			b = b + 1
 		}
 		nodeA, nodeB = p.subConns[a], p.subConns[b]
-		if nodeA.valid() || nodeB.valid() {
+		if p.available(nodeA) || p.available(nodeB) {
 			break
 		}
 	}
 	return
 }
 
+// available reports whether the node is valid and not ejected by outlier detection.
+func (p *p2cPicker) available(sc *subConn) bool {
+	return sc.valid() && !p.outlier.Ejected(sc.host)
+}
+
 func (p *p2cPicker) pick(ctx context.Context, opts balancer.PickInfo) (balancer.SubConn, func(balancer.DoneInfo), error) {
 	var pc, upc *subConn
 	start := time.Now().UnixNano()
@@ -197,8 +214,13 @@ func (p *p2cPicker) pick(ctx context.Context, opts balancer.PickInfo) (balancer.
 		pc = p.subConns[0]
 	} else {
 		nodeA, nodeB := p.prePick()
+		ejectedA, ejectedB := p.outlier.Ejected(nodeA.host), p.outlier.Ejected(nodeB.host)
 		// meta.Weight为服务发布者在disocvery中设置的权重
-		if nodeA.load()*nodeB.health()*nodeB.meta.Weight > nodeB.load()*nodeA.health()*nodeA.meta.Weight {
+		if ejectedA && !ejectedB {
+			pc, upc = nodeB, nodeA
+		} else if ejectedB && !ejectedA {
+			pc, upc = nodeA, nodeB
+		} else if nodeA.load()*nodeB.health()*nodeB.meta.Weight > nodeB.load()*nodeA.health()*nodeA.meta.Weight {
 			pc, upc = nodeB, nodeA
 		} else {
 			pc, upc = nodeA, nodeB
@@ -206,8 +228,9 @@ func (p *p2cPicker) pick(ctx context.Context, opts balancer.PickInfo) (balancer.
 		// 如果选中的节点，在forceGap期间内没有被选中一次，那么强制一次
 		// 利用强制的机会，来触发成功率、延迟的衰减
 		// 原子锁conn.pick保证并发安全，放行一次
+		// 被摘除的节点不参与强制选择
 		pick := atomic.LoadInt64(&upc.pick)
-		if start-pick > forceGap && atomic.CompareAndSwapInt64(&upc.pick, pick, start) {
+		if start-pick > forceGap && !p.outlier.Ejected(upc.host) && atomic.CompareAndSwapInt64(&upc.pick, pick, start) {
 			pc = upc
 		}
 	}
@@ -249,6 +272,7 @@ func (p *p2cPicker) pick(ctx context.Context, opts balancer.PickInfo) (balancer.
 				}
 			}
 		}
+		p.outlier.Report(pc.host, success != 0)
 		oldSuc := atomic.LoadUint64(&pc.success)
 		success = uint64(float64(oldSuc)*w + float64(success)*(1.0-w))
 		atomic.StoreUint64(&pc.success, success)
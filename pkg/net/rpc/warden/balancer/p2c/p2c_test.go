@@ -194,6 +194,35 @@ func TestBalancerPick(t *testing.T) {
 
 }
 
+func TestOutlierPick(t *testing.T) {
+	scs := map[resolver.Address]balancer.SubConn{}
+	for i := 0; i < 3; i++ {
+		addr := resolver.Address{
+			Addr:       fmt.Sprintf("outlier_%d", i),
+			ServerName: "outlier.test",
+			Metadata:   wmeta.MD{Weight: 10},
+		}
+		scs[addr] = &testSubConn{addr: addr}
+	}
+	picker := (&p2cPickerBuilder{}).Build(scs)
+	err := status.Errorf(codes.Unavailable, "unavailable")
+	for i := 0; i < 100; i++ {
+		conn, done, _ := picker.Pick(context.Background(), balancer.PickInfo{})
+		if conn.(*testSubConn).addr.Addr == "outlier_0" {
+			done(balancer.DoneInfo{Err: err})
+			continue
+		}
+		done(balancer.DoneInfo{})
+	}
+	for i := 0; i < 100; i++ {
+		conn, done, _ := picker.Pick(context.Background(), balancer.PickInfo{})
+		if addr := conn.(*testSubConn).addr.Addr; addr == "outlier_0" {
+			t.Fatalf("the ejected subconn(%s) should not be picked", addr)
+		}
+		done(balancer.DoneInfo{})
+	}
+}
+
 func Benchmark_Wrr(b *testing.B) {
 	scs := map[resolver.Address]balancer.SubConn{}
 	for i := 0; i < 50; i++ {
@@ -11,6 +11,7 @@ import (
 	"github.com/djienet/kratos/pkg/conf/env"
 	"github.com/djienet/kratos/pkg/log"
 	nmd "github.com/djienet/kratos/pkg/net/metadata"
+	"github.com/djienet/kratos/pkg/net/rpc/warden/balancer/outlier"
 	wmeta "github.com/djienet/kratos/pkg/net/rpc/warden/internal/metadata"
 	"github.com/djienet/kratos/pkg/stat/metric"
 	"google.golang.org/grpc"
@@ -52,6 +53,7 @@ type subConn struct {
 	conn balancer.SubConn
 	addr resolver.Address
 	meta wmeta.MD
+	host *outlier.Host
 
 	err     metric.RollingCounter
 	latency metric.RollingGauge
@@ -140,6 +142,10 @@ func (*wrrPickerBuilder) Build(readySCs map[resolver.Address]balancer.SubConn) b
 	p := &wrrPicker{
 		colors: make(map[string]*wrrPicker),
 	}
+	for addr := range readySCs {
+		p.outlier = outlier.New(addr.ServerName)
+		break
+	}
 	for addr, sc := range readySCs {
 		meta, ok := addr.Metadata.(wmeta.MD)
 		if !ok {
@@ -167,15 +173,17 @@ func (*wrrPickerBuilder) Build(readySCs map[resolver.Address]balancer.SubConn) b
 			si: serverInfo{cpu: 500, success: math.Float64bits(1)},
 		}
 		if meta.Color == "" {
+			subc.host = p.outlier.Add(addr.Addr)
 			p.subConns = append(p.subConns, subc)
 			continue
 		}
 		// if color not empty, use color picker
 		cp, ok := p.colors[meta.Color]
 		if !ok {
-			cp = &wrrPicker{}
+			cp = &wrrPicker{outlier: outlier.New(addr.ServerName + "#" + meta.Color)}
 			p.colors[meta.Color] = cp
 		}
+		subc.host = cp.outlier.Add(addr.Addr)
 		cp.subConns = append(cp.subConns, subc)
 	}
 	return p
@@ -187,6 +195,7 @@ type wrrPicker struct {
 	// selection from it and return the selected SubConn.
 	subConns []*subConn
 	colors   map[string]*wrrPicker
+	outlier  *outlier.Detector
 	updateAt int64
 
 	mu sync.Mutex
@@ -216,7 +225,18 @@ func (p *wrrPicker) pick(ctx context.Context, opts balancer.PickInfo) (balancer.
 	}
 	p.mu.Lock()
 	// nginx wrr load balancing algorithm: http://blog.csdn.net/zhangskd/article/details/50194069
+	// the hosts ejected by outlier detection are skipped unless all of them are ejected.
+	all := true
+	for _, sc := range p.subConns {
+		if !p.outlier.Ejected(sc.host) {
+			all = false
+			break
+		}
+	}
 	for _, sc := range p.subConns {
+		if !all && p.outlier.Ejected(sc.host) {
+			continue
+		}
 		totalWeight += sc.ewt
 		sc.cwt += sc.ewt
 		if conn == nil || conn.cwt < sc.cwt {
@@ -243,6 +263,7 @@ func (p *wrrPicker) pick(ctx context.Context, opts balancer.PickInfo) (balancer.
 			}
 		}
 		conn.err.Add(ev)
+		p.outlier.Report(conn.host, ev == 0)
 
 		now := time.Now()
 		conn.latency.Add(now.Sub(start).Nanoseconds() / 1e5)
@@ -19,14 +19,16 @@ import (
 	"github.com/djienet/kratos/pkg/naming"
 	nmd "github.com/djienet/kratos/pkg/net/metadata"
 	"github.com/djienet/kratos/pkg/net/netutil/breaker"
+	"github.com/djienet/kratos/pkg/net/rpc/warden/balancer/outlier"
 	"github.com/djienet/kratos/pkg/net/rpc/warden/balancer/p2c"
-	"github.com/djienet/kratos/pkg/net/rpc/warden/internal/status"
 	"github.com/djienet/kratos/pkg/net/trace"
 	xtime "github.com/djienet/kratos/pkg/time"
 
 	"github.com/pkg/errors"
+	"golang.org/x/sync/singleflight"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/encoding"
 	"google.golang.org/grpc/keepalive"
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/peer"
@@ -69,10 +71,19 @@ type ClientConfig struct {
 	Clusters               []string
 	Zone                   string
 	Subset                 int
+	SpillRatio             float64 // spill over to other zones when healthy ratio of local zones is below it
+	SingleFlight           bool    // merge identical in-flight requests, can be set per method
 	NonBlock               bool
 	KeepAliveInterval      xtime.Duration
 	KeepAliveTimeout       xtime.Duration
 	KeepAliveWithoutStream bool
+	// compression and message size limits, those of method config fall back to client config if not set.
+	Compressor     string // name of registered compressor, e.g. gzip
+	MaxSendMsgSize int
+	MaxRecvMsgSize int
+	// Outlier is the outlier detection config of the balancers, it is global
+	// and takes effect on the pickers built afterwards.
+	Outlier *outlier.Config
 }
 
 // Client is the framework's client side instance, it contains the ctx, opt and interceptors.
@@ -84,6 +95,7 @@ type Client struct {
 
 	opts     []grpc.DialOption
 	handlers []grpc.UnaryClientInterceptor
+	sf       singleflight.Group
 }
 
 // TimeoutCallOption timeout option.
@@ -138,6 +150,7 @@ func (c *Client) handle() grpc.UnaryClientInterceptor {
 				break
 			}
 		}
+		opts = append(opts, c.callOptions(conf)...)
 		if timeOpt != nil && timeOpt.Timeout > 0 {
 			ctx, cancel = context.WithTimeout(nmd.WithContext(ctx), timeOpt.Timeout)
 		} else {
@@ -161,7 +174,7 @@ func (c *Client) handle() grpc.UnaryClientInterceptor {
 		opts = append(opts, grpc.Peer(&p))
 		if err = invoker(ctx, method, req, reply, cc, opts...); err != nil {
 			gst, _ := gstatus.FromError(err)
-			ec = status.ToEcode(gst)
+			ec = toEcode(gst)
 			err = errors.WithMessage(ec, gst.Message())
 		}
 		if p.Addr != nil {
@@ -174,6 +187,33 @@ func (c *Client) handle() grpc.UnaryClientInterceptor {
 	}
 }
 
+// callOptions returns the compression and message size call options of conf.
+func (c *Client) callOptions(conf *ClientConfig) (opts []grpc.CallOption) {
+	c.mutex.RLock()
+	global := c.conf
+	c.mutex.RUnlock()
+	compressor, maxSend, maxRecv := conf.Compressor, conf.MaxSendMsgSize, conf.MaxRecvMsgSize
+	if compressor == "" {
+		compressor = global.Compressor
+	}
+	if maxSend <= 0 {
+		maxSend = global.MaxSendMsgSize
+	}
+	if maxRecv <= 0 {
+		maxRecv = global.MaxRecvMsgSize
+	}
+	if compressor != "" {
+		opts = append(opts, grpc.UseCompressor(compressor))
+	}
+	if maxSend > 0 {
+		opts = append(opts, grpc.MaxCallSendMsgSize(maxSend))
+	}
+	if maxRecv > 0 {
+		opts = append(opts, grpc.MaxCallRecvMsgSize(maxRecv))
+	}
+	return
+}
+
 func onBreaker(breaker breaker.Breaker, err *error) {
 	if err != nil && *err != nil {
 		if ecode.EqualError(ecode.ServerErr, *err) || ecode.EqualError(ecode.ServiceUnavailable, *err) || ecode.EqualError(ecode.Deadline, *err) || ecode.EqualError(ecode.LimitExceed, *err) {
@@ -231,8 +271,17 @@ func (c *Client) SetConfig(conf *ClientConfig) (err error) {
 	if conf.KeepAliveTimeout <= 0 {
 		conf.KeepAliveTimeout = xtime.Duration(time.Second * 20)
 	}
+	if conf.Compressor != "" && encoding.GetCompressor(conf.Compressor) == nil {
+		return errors.Errorf("warden: compressor(%s) not registered", conf.Compressor)
+	}
+	for method, mc := range conf.Method {
+		if mc != nil && mc.Compressor != "" && encoding.GetCompressor(mc.Compressor) == nil {
+			return errors.Errorf("warden: compressor(%s) of method(%s) not registered", mc.Compressor, method)
+		}
+	}
 
 	// FIXME(maojian) check Method dial/timeout
+	outlier.Init(conf.Outlier)
 	c.mutex.Lock()
 	c.conf = conf
 	if c.breaker == nil {
@@ -281,12 +330,19 @@ func (c *Client) dial(ctx context.Context, target string, opts ...grpc.DialOptio
 		PermitWithoutStream: !c.conf.KeepAliveWithoutStream,
 	}))
 	dialOptions = append(dialOptions, opts...)
+	// NOTE: the stats handler must be the last, grpc keeps only one.
+	statsHs, dialOptions, err := extractStatsDialOption(dialOptions)
+	if err != nil {
+		return
+	}
+	dialOptions = append(dialOptions, grpc.WithStatsHandler(append(statsHandlers{&payloadStats{client: true}}, statsHs...)))
 
 	// init default handler
 	var handlers []grpc.UnaryClientInterceptor
 	handlers = append(handlers, c.recovery())
 	handlers = append(handlers, clientLogging(dialOptions...))
 	handlers = append(handlers, c.handlers...)
+	handlers = append(handlers, c.singleFlight())
 	// NOTE: c.handle must be a last interceptor.
 	handlers = append(handlers, c.handle())
 
@@ -310,6 +366,9 @@ func (c *Client) dial(ctx context.Context, target string, opts ...grpc.DialOptio
 		if v.Get("subset") == "" && c.conf.Subset > 0 {
 			v.Add("subset", strconv.FormatInt(int64(c.conf.Subset), 10))
 		}
+		if v.Get("spill") == "" && c.conf.SpillRatio > 0 {
+			v.Add("spill", strconv.FormatFloat(c.conf.SpillRatio, 'f', -1, 64))
+		}
 		u.RawQuery = v.Encode()
 		// 比较_grpcTarget中的appid是否等于u.path中的appid，并替换成mock的地址
 		for _, t := range _grpcTarget {
@@ -84,6 +84,11 @@ func FromError(svrErr error) (gst *status.Status) {
 		gst, _ = gRPCStatusFromEcode(ecode.Deadline)
 	default:
 		gst, _ = status.FromError(svrErr)
+		// a raw ResourceExhausted is a limit of the service, it carries the
+		// ecode details to be told from the message size limits of grpc.
+		if gst.Code() == codes.ResourceExhausted && len(gst.Details()) == 0 {
+			gst, _ = gRPCStatusFromEcode(ecode.Error(ecode.LimitExceed, gst.Message()))
+		}
 	}
 	return
 }
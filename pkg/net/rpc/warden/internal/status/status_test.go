@@ -87,6 +87,13 @@ func TestFromError(t *testing.T) {
 		assert.Equal(t, codes.Unknown, gst.Code())
 		assert.Equal(t, "-504", gst.Message())
 	})
+	t.Run("input raw ResourceExhausted", func(t *testing.T) {
+		gst := FromError(status.Error(codes.ResourceExhausted, "limit"))
+
+		assert.Equal(t, codes.Unknown, gst.Code())
+		assert.Len(t, gst.Details(), 1)
+		assert.Equal(t, ecode.LimitExceed.Code(), ToEcode(gst).Code())
+	})
 	t.Run("input ecode.Status", func(t *testing.T) {
 		m := &timestamp.Timestamp{Seconds: time.Now().Unix()}
 		err, _ := ecode.Error(ecode.Unauthorized, "unauthorized").WithDetails(m)
@@ -38,4 +38,25 @@ var (
 		Help:      "grpc client requests code count.",
 		Labels:    []string{"method", "code"},
 	})
+	_metricClientSingleFlight = metric.NewCounterVec(&metric.CounterVecOpts{
+		Namespace: clientNamespace,
+		Subsystem: "singleflight",
+		Name:      "total",
+		Help:      "grpc client singleflight requests count, state is executed or merged.",
+		Labels:    []string{"method", "state"},
+	})
+	_metricServerPayloadBytes = metric.NewCounterVec(&metric.CounterVecOpts{
+		Namespace: serverNamespace,
+		Subsystem: "payload",
+		Name:      "bytes_total",
+		Help:      "grpc server payload bytes, kind is compressed(on wire) or uncompressed.",
+		Labels:    []string{"method", "direction", "kind"},
+	})
+	_metricClientPayloadBytes = metric.NewCounterVec(&metric.CounterVecOpts{
+		Namespace: clientNamespace,
+		Subsystem: "payload",
+		Name:      "bytes_total",
+		Help:      "grpc client payload bytes, kind is compressed(on wire) or uncompressed.",
+		Labels:    []string{"method", "direction", "kind"},
+	})
 )
@@ -0,0 +1,213 @@
+package warden
+
+import (
+	"context"
+	"reflect"
+	"unsafe"
+
+	"github.com/djienet/kratos/pkg/ecode"
+	"github.com/djienet/kratos/pkg/net/rpc/warden/internal/status"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/stats"
+	gstatus "google.golang.org/grpc/status"
+)
+
+type methodKey struct{}
+
+// payloadStats is a grpc stats handler that counts the compressed (on wire)
+// and uncompressed bytes of payloads per method.
+type payloadStats struct {
+	client bool
+}
+
+func (s *payloadStats) TagRPC(ctx context.Context, info *stats.RPCTagInfo) context.Context {
+	return context.WithValue(ctx, methodKey{}, info.FullMethodName)
+}
+
+func (s *payloadStats) HandleRPC(ctx context.Context, rs stats.RPCStats) {
+	var (
+		direction       string
+		length, wireLen int
+	)
+	switch p := rs.(type) {
+	case *stats.InPayload:
+		direction, length, wireLen = "in", p.Length, p.WireLength
+	case *stats.OutPayload:
+		direction, length, wireLen = "out", p.Length, p.WireLength
+	default:
+		return
+	}
+	method, _ := ctx.Value(methodKey{}).(string)
+	vec := _metricServerPayloadBytes
+	if s.client {
+		vec = _metricClientPayloadBytes
+	}
+	vec.Add(float64(length), method, direction, "uncompressed")
+	if wireLen > 0 {
+		vec.Add(float64(wireLen), method, direction, "compressed")
+	}
+}
+
+func (s *payloadStats) TagConn(ctx context.Context, info *stats.ConnTagInfo) context.Context {
+	return ctx
+}
+
+func (s *payloadStats) HandleConn(context.Context, stats.ConnStats) {}
+
+// statsHandlers chains stats handlers, grpc keeps only the last one set by
+// the options.
+type statsHandlers []stats.Handler
+
+func (hs statsHandlers) TagRPC(ctx context.Context, info *stats.RPCTagInfo) context.Context {
+	for _, h := range hs {
+		ctx = h.TagRPC(ctx, info)
+	}
+	return ctx
+}
+
+func (hs statsHandlers) HandleRPC(ctx context.Context, rs stats.RPCStats) {
+	for _, h := range hs {
+		h.HandleRPC(ctx, rs)
+	}
+}
+
+func (hs statsHandlers) TagConn(ctx context.Context, info *stats.ConnTagInfo) context.Context {
+	for _, h := range hs {
+		ctx = h.TagConn(ctx, info)
+	}
+	return ctx
+}
+
+func (hs statsHandlers) HandleConn(ctx context.Context, cs stats.ConnStats) {
+	for _, h := range hs {
+		h.HandleConn(ctx, cs)
+	}
+}
+
+type statsDialOption struct {
+	grpc.EmptyDialOption
+	handler stats.Handler
+}
+
+type statsServerOption struct {
+	grpc.EmptyServerOption
+	handler stats.Handler
+}
+
+// WithStatsHandler adds a stats handler to the client, it is chained with
+// the payload metrics like grpc.WithStatsHandler.
+func WithStatsHandler(h stats.Handler) grpc.DialOption {
+	return statsDialOption{handler: h}
+}
+
+// StatsHandler adds a stats handler to the server, it is chained with the
+// payload metrics like grpc.StatsHandler.
+func StatsHandler(h stats.Handler) grpc.ServerOption {
+	return statsServerOption{handler: h}
+}
+
+// _grpcStatsDial and _grpcStatsServer are the functions of the options made by
+// grpc.WithStatsHandler and grpc.StatsHandler, grpc keeps only the handler of
+// the last one, so they are taken out of the options and chained with the
+// payload metrics.
+var (
+	_grpcStatsDial   = optionFunc(grpc.WithStatsHandler(nil))
+	_grpcStatsServer = optionFunc(grpc.StatsHandler(nil))
+)
+
+// optionFunc returns the function of a grpc option made by a function, the
+// invalid value if opt is not.
+func optionFunc(opt interface{}) (f reflect.Value) {
+	v := reflect.ValueOf(opt)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return
+	}
+	if v = v.Elem(); v.Kind() != reflect.Struct || v.NumField() != 1 || v.Field(0).Kind() != reflect.Func {
+		return
+	}
+	return v.Field(0)
+}
+
+// grpcStatsHandler returns the handler of opt if it is made by the grpc stats
+// option whose function is fn, path is the field of the handler in the grpc
+// options. err is not nil if the handler can't be taken out.
+func grpcStatsHandler(opt interface{}, fn reflect.Value, path ...string) (h stats.Handler, ok bool, err error) {
+	f := optionFunc(opt)
+	// the closures of a function share the code pointer.
+	if !f.IsValid() || !fn.IsValid() || f.Pointer() != fn.Pointer() {
+		return
+	}
+	ok = true
+	defer func() {
+		if r := recover(); r != nil {
+			err = errors.Errorf("warden: can't take the stats handler out of the grpc option: %v", r)
+		}
+	}()
+	// the function is unexported, call it on new grpc options by its address.
+	f = reflect.NewAt(f.Type(), unsafe.Pointer(f.UnsafeAddr())).Elem()
+	o := reflect.New(f.Type().In(0).Elem())
+	f.Call([]reflect.Value{o})
+	v := o.Elem()
+	for _, name := range path {
+		if v = v.FieldByName(name); !v.IsValid() {
+			return nil, ok, errors.Errorf("warden: can't take the stats handler out of the grpc option: no field %s", name)
+		}
+	}
+	h, _ = reflect.NewAt(v.Type(), unsafe.Pointer(v.UnsafeAddr())).Elem().Interface().(stats.Handler)
+	return
+}
+
+// extractStatsDialOption returns the stats handlers of opts and the others
+// options.
+func extractStatsDialOption(opts []grpc.DialOption) (hs statsHandlers, others []grpc.DialOption, err error) {
+	for _, opt := range opts {
+		if statsOpt, ok := opt.(statsDialOption); ok {
+			hs = append(hs, statsOpt.handler)
+			continue
+		}
+		h, ok, err := grpcStatsHandler(opt, _grpcStatsDial, "copts", "StatsHandler")
+		if err != nil {
+			return nil, nil, err
+		}
+		if !ok {
+			others = append(others, opt)
+		} else if h != nil {
+			hs = append(hs, h)
+		}
+	}
+	return
+}
+
+// extractStatsServerOption returns the stats handlers of opts and the others
+// options.
+func extractStatsServerOption(opts []grpc.ServerOption) (hs statsHandlers, others []grpc.ServerOption, err error) {
+	for _, opt := range opts {
+		if statsOpt, ok := opt.(statsServerOption); ok {
+			hs = append(hs, statsOpt.handler)
+			continue
+		}
+		h, ok, err := grpcStatsHandler(opt, _grpcStatsServer, "statsHandler")
+		if err != nil {
+			return nil, nil, err
+		}
+		if !ok {
+			others = append(others, opt)
+		} else if h != nil {
+			hs = append(hs, h)
+		}
+	}
+	return
+}
+
+// toEcode converts grpc status to ecode, the ResourceExhausted errors without
+// ecode details are raised by grpc itself on message size limits, they are
+// converted to ecode.MessageTooLarge instead of ecode.LimitExceed.
+func toEcode(gst *gstatus.Status) ecode.Codes {
+	if gst.Code() == codes.ResourceExhausted && len(gst.Details()) == 0 {
+		return ecode.MessageTooLarge
+	}
+	return status.ToEcode(gst)
+}
@@ -0,0 +1,213 @@
+package warden_test
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/djienet/kratos/pkg/ecode"
+	"github.com/djienet/kratos/pkg/net/rpc/warden"
+	pb "github.com/djienet/kratos/pkg/net/rpc/warden/internal/proto/testproto"
+	"github.com/djienet/kratos/pkg/net/rpc/warden/wardentest"
+	xtime "github.com/djienet/kratos/pkg/time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/stats"
+	gstatus "google.golang.org/grpc/status"
+)
+
+type echoServer struct{}
+
+func (s *echoServer) SayHello(ctx context.Context, in *pb.HelloRequest) (*pb.HelloReply, error) {
+	return &pb.HelloReply{Message: in.Name, Success: true}, nil
+}
+
+func (s *echoServer) StreamHello(ss pb.Greeter_StreamHelloServer) error {
+	return nil
+}
+
+func TestMsgSizeAndCompressor(t *testing.T) {
+	s := wardentest.NewServer(&warden.ServerConfig{
+		Timeout:        xtime.Duration(time.Second),
+		MaxRecvMsgSize: 4096,
+	})
+	pb.RegisterGreeterServer(s.Server.Server(), &echoServer{})
+	s.Start()
+	defer s.Close()
+
+	conf := &warden.ClientConfig{
+		Dial:           xtime.Duration(time.Second),
+		Timeout:        xtime.Duration(time.Second),
+		Compressor:     "gzip",
+		MaxRecvMsgSize: 2500,
+		Method: map[string]*warden.ClientConfig{
+			"/testproto.Greeter/SayHello": {Timeout: xtime.Duration(time.Second)},
+		},
+	}
+	conn, err := s.Dial(context.Background(), s.Client(conf))
+	if err != nil {
+		t.Fatalf("dial error(%v)", err)
+	}
+	defer conn.Close()
+	cli := pb.NewGreeterClient(conn)
+
+	name := strings.Repeat("a", 2000)
+	reply, err := cli.SayHello(context.Background(), &pb.HelloRequest{Name: name})
+	if err != nil || reply.Message != name {
+		t.Fatalf("gzip request should succeed, error(%v)", err)
+	}
+	// request exceeds the server limit
+	if _, err = cli.SayHello(context.Background(), &pb.HelloRequest{Name: strings.Repeat("a", 6000)}); !ecode.EqualError(ecode.MessageTooLarge, err) {
+		t.Fatalf("error should be ecode.MessageTooLarge, got %v", err)
+	}
+	// response exceeds the client limit
+	if _, err = cli.SayHello(context.Background(), &pb.HelloRequest{Name: strings.Repeat("a", 3000)}); !ecode.EqualError(ecode.MessageTooLarge, err) {
+		t.Fatalf("error should be ecode.MessageTooLarge, got %v", err)
+	}
+
+	conf = &warden.ClientConfig{
+		Dial:           xtime.Duration(time.Second),
+		Timeout:        xtime.Duration(time.Second),
+		MaxSendMsgSize: 1024,
+	}
+	conn2, err := s.Dial(context.Background(), s.Client(conf))
+	if err != nil {
+		t.Fatalf("dial error(%v)", err)
+	}
+	defer conn2.Close()
+	cli = pb.NewGreeterClient(conn2)
+	if _, err = cli.SayHello(context.Background(), &pb.HelloRequest{Name: strings.Repeat("a", 2048)}); !ecode.EqualError(ecode.MessageTooLarge, err) {
+		t.Fatalf("error should be ecode.MessageTooLarge, got %v", err)
+	}
+}
+
+func TestUnknownCompressor(t *testing.T) {
+	c := warden.NewClient(nil)
+	if err := c.SetConfig(&warden.ClientConfig{Compressor: "unknown"}); err == nil {
+		t.Fatal("unknown compressor should return error")
+	}
+}
+
+type countStats struct {
+	payloads int64
+}
+
+func (s *countStats) TagRPC(ctx context.Context, info *stats.RPCTagInfo) context.Context {
+	return ctx
+}
+
+func (s *countStats) HandleRPC(ctx context.Context, rs stats.RPCStats) {
+	if _, ok := rs.(*stats.InPayload); ok {
+		atomic.AddInt64(&s.payloads, 1)
+	}
+}
+
+func (s *countStats) TagConn(ctx context.Context, info *stats.ConnTagInfo) context.Context {
+	return ctx
+}
+
+func (s *countStats) HandleConn(context.Context, stats.ConnStats) {}
+
+func payloadBytes(t *testing.T, name string) (sum float64) {
+	mfs, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, mf := range mfs {
+		if mf.GetName() == name {
+			for _, m := range mf.GetMetric() {
+				sum += m.GetCounter().GetValue()
+			}
+		}
+	}
+	return
+}
+
+func TestStatsHandler(t *testing.T) {
+	svrStats, cliStats := &countStats{}, &countStats{}
+	s := wardentest.NewServer(&warden.ServerConfig{Timeout: xtime.Duration(time.Second)}, warden.StatsHandler(svrStats))
+	pb.RegisterGreeterServer(s.Server.Server(), &echoServer{})
+	s.Start()
+	defer s.Close()
+
+	svrBytes, cliBytes := payloadBytes(t, "grpc_server_payload_bytes_total"), payloadBytes(t, "grpc_client_payload_bytes_total")
+	conf := &warden.ClientConfig{Dial: xtime.Duration(time.Second), Timeout: xtime.Duration(time.Second)}
+	conn, err := s.Dial(context.Background(), s.Client(conf), warden.WithStatsHandler(cliStats))
+	if err != nil {
+		t.Fatalf("dial error(%v)", err)
+	}
+	defer conn.Close()
+	if _, err = pb.NewGreeterClient(conn).SayHello(context.Background(), &pb.HelloRequest{Name: "stats"}); err != nil {
+		t.Fatal(err)
+	}
+	if atomic.LoadInt64(&svrStats.payloads) != 1 || atomic.LoadInt64(&cliStats.payloads) != 1 {
+		t.Fatalf("stats handlers got server(%d) client(%d) payloads, want 1", svrStats.payloads, cliStats.payloads)
+	}
+	if payloadBytes(t, "grpc_server_payload_bytes_total") <= svrBytes || payloadBytes(t, "grpc_client_payload_bytes_total") <= cliBytes {
+		t.Fatal("payload metrics not reported with stats handlers")
+	}
+}
+
+func TestGRPCStatsHandler(t *testing.T) {
+	svrStats, cliStats := &countStats{}, &countStats{}
+	s := wardentest.NewServer(&warden.ServerConfig{Timeout: xtime.Duration(time.Second)}, grpc.StatsHandler(svrStats))
+	pb.RegisterGreeterServer(s.Server.Server(), &echoServer{})
+	s.Start()
+	defer s.Close()
+
+	svrBytes, cliBytes := payloadBytes(t, "grpc_server_payload_bytes_total"), payloadBytes(t, "grpc_client_payload_bytes_total")
+	conf := &warden.ClientConfig{Dial: xtime.Duration(time.Second), Timeout: xtime.Duration(time.Second)}
+	conn, err := s.Dial(context.Background(), s.Client(conf), grpc.WithStatsHandler(cliStats))
+	if err != nil {
+		t.Fatalf("dial error(%v)", err)
+	}
+	defer conn.Close()
+	if _, err = pb.NewGreeterClient(conn).SayHello(context.Background(), &pb.HelloRequest{Name: "stats"}); err != nil {
+		t.Fatal(err)
+	}
+	if atomic.LoadInt64(&svrStats.payloads) != 1 || atomic.LoadInt64(&cliStats.payloads) != 1 {
+		t.Fatalf("grpc stats handlers got server(%d) client(%d) payloads, want 1", svrStats.payloads, cliStats.payloads)
+	}
+	if payloadBytes(t, "grpc_server_payload_bytes_total") <= svrBytes || payloadBytes(t, "grpc_client_payload_bytes_total") <= cliBytes {
+		t.Fatal("payload metrics not reported with grpc stats handlers")
+	}
+}
+
+func TestResourceExhaustedEcode(t *testing.T) {
+	s := wardentest.NewServer(&warden.ServerConfig{Timeout: xtime.Duration(time.Second)})
+	pb.RegisterGreeterServer(s.Server.Server(), &limitServer{})
+	s.Start()
+	defer s.Close()
+
+	conf := &warden.ClientConfig{Dial: xtime.Duration(time.Second), Timeout: xtime.Duration(time.Second)}
+	conn, err := s.Dial(context.Background(), s.Client(conf))
+	if err != nil {
+		t.Fatalf("dial error(%v)", err)
+	}
+	defer conn.Close()
+	cli := pb.NewGreeterClient(conn)
+	if _, err = cli.SayHello(context.Background(), &pb.HelloRequest{Name: "limit"}); !ecode.EqualError(ecode.LimitExceed, err) {
+		t.Fatalf("error should be ecode.LimitExceed, got %v", err)
+	}
+	// a raw ResourceExhausted of the handler is a limit, not a message size limit.
+	if _, err = cli.SayHello(context.Background(), &pb.HelloRequest{Name: "exhausted"}); !ecode.EqualError(ecode.LimitExceed, err) {
+		t.Fatalf("error should be ecode.LimitExceed, got %v", err)
+	}
+}
+
+type limitServer struct{}
+
+func (s *limitServer) SayHello(ctx context.Context, in *pb.HelloRequest) (*pb.HelloReply, error) {
+	if in.Name == "limit" {
+		return nil, ecode.LimitExceed
+	}
+	return nil, gstatus.Error(codes.ResourceExhausted, "exhausted")
+}
+
+func (s *limitServer) StreamHello(ss pb.Greeter_StreamHelloServer) error {
+	return nil
+}
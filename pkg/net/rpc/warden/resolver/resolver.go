@@ -53,6 +53,7 @@ type Builder struct {
 func (b *Builder) Build(target resolver.Target, cc resolver.ClientConn, opts resolver.BuildOptions) (resolver.Resolver, error) {
 	var zone = env.Zone
 	ss := int64(50)
+	spill := float64(0)
 	clusters := map[string]struct{}{}
 	str := strings.SplitN(target.Endpoint, "?", 2)
 	if len(str) == 0 {
@@ -73,13 +74,27 @@ func (b *Builder) Build(target resolver.Target, cc resolver.ClientConn, opts res
 				}
 
 			}
+			if sp, ok := m["spill"]; ok {
+				if t, err := strconv.ParseFloat(sp[0], 64); err == nil {
+					spill = t
+				}
+			}
 		}
 	}
+	// NOTE: zone scheduling and subset are done by resolver itself, see schedule.
+	opt := new(naming.BuildOptions)
+	naming.Subset(int(ss)).Apply(opt)
 	r := &Resolver{
-		nr:   b.Builder.Build(str[0], naming.Filter(Scheme, clusters), naming.ScheduleNode(zone), naming.Subset(int(ss))),
-		cc:   cc,
-		quit: make(chan struct{}, 1),
-		zone: zone,
+		nr:         b.Builder.Build(str[0], naming.Filter(Scheme, clusters)),
+		cc:         cc,
+		quit:       make(chan struct{}, 1),
+		done:       make(chan struct{}),
+		target:     str[0],
+		clusters:   clusters,
+		zone:       zone,
+		subsetSize: ss,
+		subset:     opt.Subset,
+		spill:      spill,
 	}
 	go r.updateproc()
 	return r, nil
@@ -91,17 +106,24 @@ type Resolver struct {
 	nr   naming.Resolver
 	cc   resolver.ClientConn
 	quit chan struct{}
+	done chan struct{}
 
+	target     string
 	clusters   map[string]struct{}
 	zone       string
 	subsetSize int64
+	subset     func([]*naming.Instance, int) []*naming.Instance
+	spill      float64
 }
 
-// Close is a noop for Resolver.
+// Close stops watching the target and removes its subset from the debug endpoint.
 func (r *Resolver) Close() {
 	select {
 	case r.quit <- struct{}{}:
 		r.nr.Close()
+		// wait updateproc exiting, or it may store the subset again.
+		<-r.done
+		r.deleteSubset()
 	default:
 	}
 }
@@ -111,6 +133,7 @@ func (r *Resolver) ResolveNow(o resolver.ResolveNowOptions) {
 }
 
 func (r *Resolver) updateproc() {
+	defer close(r.done)
 	event := r.nr.Watch()
 	for {
 		select {
@@ -122,12 +145,12 @@ func (r *Resolver) updateproc() {
 			}
 		}
 		if ins, ok := r.nr.Fetch(context.Background()); ok {
-			instances, _ := ins.Instances[r.zone]
+			instances, sub := r.schedule(ins)
 			if len(instances) == 0 {
-				for _, value := range ins.Instances {
-					instances = append(instances, value...)
-				}
+				log.Warn("resolver: target(%s) zone(%s) no healthy instance found", r.target, r.zone)
+				continue
 			}
+			r.storeSubset(sub)
 			r.newAddress(instances)
 		}
 	}
@@ -143,15 +166,8 @@ func (r *Resolver) newAddress(instances []*naming.Instance) {
 		if weight, _ = strconv.ParseInt(ins.Metadata[naming.MetaWeight], 10, 64); weight <= 0 {
 			weight = 10
 		}
-		var rpc string
-		for _, a := range ins.Addrs {
-			u, err := url.Parse(a)
-			if err == nil && u.Scheme == Scheme {
-				rpc = u.Host
-			}
-		}
 		addr := resolver.Address{
-			Addr:       rpc,
+			Addr:       rpcAddr(ins),
 			Type:       resolver.Backend,
 			ServerName: ins.AppID,
 			Metadata:   wmeta.MD{Weight: uint64(weight), Color: ins.Metadata[naming.MetaColor]},
@@ -0,0 +1,189 @@
+package resolver
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/djienet/kratos/pkg/naming"
+)
+
+// DebugPath is the path of the debug endpoint which shows the chosen subset per target.
+const DebugPath = "/debug/warden/resolver"
+
+var _subsets = struct {
+	sync.RWMutex
+	m map[*Resolver]*ZoneSubset
+}{m: make(map[*Resolver]*ZoneSubset)}
+
+// ZoneSubset is the subset chosen by a resolver after zone scheduling.
+type ZoneSubset struct {
+	Target string `json:"target"`
+	Zone   string `json:"zone"`
+	// Capacity is the ratio of healthy instances in the primary zones.
+	Capacity float64 `json:"capacity"`
+	// Spill reports whether instances of other zones were added.
+	Spill bool `json:"spill"`
+	// Zones is the chosen rpc addresses grouped by zone.
+	Zones map[string][]string `json:"zones"`
+	Mtime int64               `json:"mtime"`
+}
+
+// Subsets returns the subsets chosen by all alive resolvers, sorted by target.
+func Subsets() (subs []*ZoneSubset) {
+	_subsets.RLock()
+	for _, sub := range _subsets.m {
+		subs = append(subs, sub)
+	}
+	_subsets.RUnlock()
+	sort.Slice(subs, func(i, j int) bool {
+		return subs[i].Target < subs[j].Target
+	})
+	return
+}
+
+// RegisterDebugHandler registers DebugHandler on mux at DebugPath.
+func RegisterDebugHandler(mux *http.ServeMux) {
+	mux.HandleFunc(DebugPath, DebugHandler)
+}
+
+// DebugHandler writes the subsets chosen by all alive resolvers as json.
+func DebugHandler(w http.ResponseWriter, r *http.Request) {
+	subs := Subsets()
+	if target := r.URL.Query().Get("target"); target != "" {
+		var matched []*ZoneSubset
+		for _, sub := range subs {
+			if sub.Target == target {
+				matched = append(matched, sub)
+			}
+		}
+		subs = matched
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(subs)
+}
+
+func (r *Resolver) storeSubset(sub *ZoneSubset) {
+	_subsets.Lock()
+	_subsets.m[r] = sub
+	_subsets.Unlock()
+}
+
+func (r *Resolver) deleteSubset() {
+	_subsets.Lock()
+	delete(_subsets.m, r)
+	_subsets.Unlock()
+}
+
+func healthy(inss []*naming.Instance) (res []*naming.Instance) {
+	for _, ins := range inss {
+		if ins.Status != naming.StatusWaiting {
+			res = append(res, ins)
+		}
+	}
+	return
+}
+
+func rpcAddr(ins *naming.Instance) (rpc string) {
+	for _, a := range ins.Addrs {
+		u, err := url.Parse(a)
+		if err == nil && u.Scheme == Scheme {
+			rpc = u.Host
+		}
+	}
+	return
+}
+
+// schedule picks instances following the zone weights of Scheduler.Clients[zone].
+// The zones in the strategy (or the client zone if no strategy) are primary,
+// instances of other zones are only added when the healthy capacity of the
+// primary zones drops below the spill ratio.
+func (r *Resolver) schedule(info *naming.InstancesInfo) (instances []*naming.Instance, sub *ZoneSubset) {
+	weights := make(map[string]int64)
+	if info.Scheduler != nil {
+		if strategy, ok := info.Scheduler.Clients[r.zone]; ok && strategy != nil {
+			for name, z := range strategy.Zones {
+				if z != nil && z.Weight > 0 {
+					weights[name] = z.Weight
+				}
+			}
+		}
+	}
+	if len(weights) == 0 {
+		weights[r.zone] = 1
+	}
+	var total, alive int
+	inss := make(map[string][]*naming.Instance, len(weights))
+	for name := range weights {
+		total += len(info.Instances[name])
+		inss[name] = healthy(info.Instances[name])
+		alive += len(inss[name])
+	}
+	sub = &ZoneSubset{
+		Target: r.target,
+		Zone:   r.zone,
+		Zones:  make(map[string][]string),
+		Mtime:  time.Now().Unix(),
+	}
+	if total > 0 {
+		sub.Capacity = float64(alive) / float64(total)
+	}
+	zones := naming.ScheduleZones(inss, weights, int(r.subsetSize), r.subset)
+	names := make([]string, 0, len(zones))
+	for name := range zones {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		instances = append(instances, zones[name]...)
+		sub.add(name, zones[name])
+	}
+	if alive > 0 && sub.Capacity >= r.spill {
+		return
+	}
+	// spill over: fill the missing capacity with healthy instances of other zones.
+	need := total - alive
+	if len(instances) == 0 {
+		need = math.MaxInt32
+		if r.subsetSize > 0 {
+			need = int(r.subsetSize)
+		}
+	}
+	names = names[:0]
+	for name := range info.Instances {
+		if _, ok := weights[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	var spills []*naming.Instance
+	spillZones := make(map[*naming.Instance]string)
+	for _, name := range names {
+		for _, ins := range healthy(info.Instances[name]) {
+			spills = append(spills, ins)
+			spillZones[ins] = name
+		}
+	}
+	if len(spills) == 0 || need <= 0 {
+		return
+	}
+	if need < len(spills) {
+		spills = r.subset(spills, need)
+	}
+	sub.Spill = true
+	for _, ins := range spills {
+		instances = append(instances, ins)
+		sub.add(spillZones[ins], []*naming.Instance{ins})
+	}
+	return
+}
+
+func (s *ZoneSubset) add(zone string, inss []*naming.Instance) {
+	for _, ins := range inss {
+		s.Zones[zone] = append(s.Zones[zone], rpcAddr(ins))
+	}
+}
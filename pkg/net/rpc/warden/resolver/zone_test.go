@@ -0,0 +1,153 @@
+package resolver
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/djienet/kratos/pkg/naming"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/resolver"
+)
+
+func newTestResolver(zone string, subset int64, spill float64) *Resolver {
+	opt := new(naming.BuildOptions)
+	naming.Subset(int(subset)).Apply(opt)
+	return &Resolver{
+		target:     "main.test",
+		zone:       zone,
+		subsetSize: subset,
+		subset:     opt.Subset,
+		spill:      spill,
+	}
+}
+
+func newTestInstances(zone string, n, waiting int) (inss []*naming.Instance) {
+	for i := 0; i < n; i++ {
+		ins := &naming.Instance{
+			Zone:     zone,
+			Hostname: fmt.Sprintf("%s-%d", zone, i),
+			Addrs:    []string{fmt.Sprintf("grpc://%s-%d:9000", zone, i)},
+			Status:   naming.StatusUP,
+		}
+		if i < waiting {
+			ins.Status = naming.StatusWaiting
+		}
+		inss = append(inss, ins)
+	}
+	return
+}
+
+func TestScheduleLocalZone(t *testing.T) {
+	r := newTestResolver("sh001", 50, 0.5)
+	info := &naming.InstancesInfo{Instances: map[string][]*naming.Instance{
+		"sh001": newTestInstances("sh001", 4, 1),
+		"sh002": newTestInstances("sh002", 4, 0),
+	}}
+	inss, sub := r.schedule(info)
+	assert.Len(t, inss, 3)
+	assert.False(t, sub.Spill)
+	assert.Equal(t, 0.75, sub.Capacity)
+	assert.Len(t, sub.Zones["sh001"], 3)
+}
+
+func TestScheduleSpill(t *testing.T) {
+	r := newTestResolver("sh001", 50, 0.5)
+	info := &naming.InstancesInfo{Instances: map[string][]*naming.Instance{
+		"sh001": newTestInstances("sh001", 4, 3),
+		"sh002": newTestInstances("sh002", 10, 0),
+	}}
+	inss, sub := r.schedule(info)
+	assert.True(t, sub.Spill)
+	assert.Len(t, sub.Zones["sh001"], 1)
+	assert.Len(t, sub.Zones["sh002"], 3)
+	assert.Len(t, inss, 4)
+
+	info.Instances["sh001"] = newTestInstances("sh001", 4, 4)
+	inss, sub = r.schedule(info)
+	assert.True(t, sub.Spill)
+	assert.Len(t, inss, 10)
+}
+
+func TestScheduleWeights(t *testing.T) {
+	r := newTestResolver("sh001", 10, 0)
+	info := &naming.InstancesInfo{
+		Instances: map[string][]*naming.Instance{
+			"sh001": newTestInstances("sh001", 20, 0),
+			"sh002": newTestInstances("sh002", 20, 0),
+			"sh003": newTestInstances("sh003", 20, 0),
+		},
+		Scheduler: &naming.Scheduler{Clients: map[string]*naming.ZoneStrategy{
+			"sh001": {Zones: map[string]*naming.Strategy{
+				"sh001": {Weight: 2},
+				"sh002": {Weight: 1},
+			}},
+		}},
+	}
+	inss, sub := r.schedule(info)
+	assert.False(t, sub.Spill)
+	assert.Len(t, sub.Zones["sh001"], 10)
+	assert.Len(t, sub.Zones["sh002"], 5)
+	assert.Len(t, sub.Zones["sh003"], 0)
+	assert.Len(t, inss, 15)
+}
+
+func TestDebugHandler(t *testing.T) {
+	r := newTestResolver("sh001", 50, 0)
+	_, sub := r.schedule(&naming.InstancesInfo{Instances: map[string][]*naming.Instance{
+		"sh001": newTestInstances("sh001", 2, 0),
+	}})
+	r.storeSubset(sub)
+	defer r.deleteSubset()
+
+	w := httptest.NewRecorder()
+	DebugHandler(w, httptest.NewRequest("GET", DebugPath+"?target=main.test", nil))
+	assert.Equal(t, 200, w.Code)
+	assert.True(t, strings.Contains(w.Body.String(), "sh001-1:9000"))
+}
+
+type testNaming struct {
+	event chan struct{}
+	info  *naming.InstancesInfo
+}
+
+func (n *testNaming) Fetch(context.Context) (*naming.InstancesInfo, bool) { return n.info, true }
+func (n *testNaming) Watch() <-chan struct{}                              { return n.event }
+func (n *testNaming) Close() error                                        { return nil }
+
+type testClientConn struct {
+	resolver.ClientConn
+	addrs chan []resolver.Address
+}
+
+func (cc *testClientConn) NewAddress(addrs []resolver.Address) { cc.addrs <- addrs }
+
+func TestCloseDeleteSubset(t *testing.T) {
+	nr := &testNaming{
+		event: make(chan struct{}, 1),
+		info: &naming.InstancesInfo{Instances: map[string][]*naming.Instance{
+			"sh001": newTestInstances("sh001", 2, 0),
+		}},
+	}
+	cc := &testClientConn{addrs: make(chan []resolver.Address)}
+	r := newTestResolver("sh001", 50, 0)
+	r.nr, r.cc = nr, cc
+	r.quit, r.done = make(chan struct{}, 1), make(chan struct{})
+	go r.updateproc()
+	nr.event <- struct{}{}
+	assert.Len(t, <-cc.addrs, 2)
+	// an update pending in updateproc while closing.
+	nr.event <- struct{}{}
+	go func() {
+		for range cc.addrs {
+		}
+	}()
+	r.Close()
+	close(cc.addrs)
+	for _, sub := range Subsets() {
+		assert.NotEqual(t, r.target, sub.Target)
+	}
+}
@@ -69,6 +69,10 @@ type ServerConfig struct {
 	// LogFlag to control log behaviour. e.g. LogFlag: warden.LogFlagDisableLog.
 	// Disable: 1 DisableArgs: 2 DisableInfo: 4
 	LogFlag int8 `dsn:"query.logFlag"`
+	// MaxRecvMsgSize is the max message size in bytes the server can receive, default 4MB.
+	MaxRecvMsgSize int `dsn:"query.maxRecvMsgSize"`
+	// MaxSendMsgSize is the max message size in bytes the server can send, default math.MaxInt32.
+	MaxSendMsgSize int `dsn:"query.maxSendMsgSize"`
 }
 
 // Server is the framework's server side instance, it contains the GrpcServer, interceptor and interceptors.
@@ -185,7 +189,17 @@ func NewServer(conf *ServerConfig, opt ...grpc.ServerOption) (s *Server) {
 		Timeout:               time.Duration(s.conf.KeepAliveTimeout),
 		MaxConnectionAge:      time.Duration(s.conf.MaxLifeTime),
 	})
-	opt = append(opt, keepParam, grpc.UnaryInterceptor(s.interceptor))
+	handlers, opt, err := extractStatsServerOption(opt)
+	if err != nil {
+		panic(err)
+	}
+	opt = append(opt, keepParam, grpc.UnaryInterceptor(s.interceptor), grpc.StatsHandler(append(statsHandlers{&payloadStats{}}, handlers...)))
+	if s.conf.MaxRecvMsgSize > 0 {
+		opt = append(opt, grpc.MaxRecvMsgSize(s.conf.MaxRecvMsgSize))
+	}
+	if s.conf.MaxSendMsgSize > 0 {
+		opt = append(opt, grpc.MaxSendMsgSize(s.conf.MaxSendMsgSize))
+	}
 	s.server = grpc.NewServer(opt...)
 	s.Use(s.recovery(), s.handle(), serverLogging(conf.LogFlag), s.stats(), s.validate())
 	s.Use(ratelimiter.New(nil).Limit())
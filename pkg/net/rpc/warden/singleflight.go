@@ -0,0 +1,113 @@
+package warden
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/djienet/kratos/pkg/ecode"
+	nmd "github.com/djienet/kratos/pkg/net/metadata"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/grpc/encoding/proto"
+	"google.golang.org/grpc/metadata"
+)
+
+// singleFlight return a client interceptor that merges identical in-flight requests,
+// which are keyed by target, method, outgoing metadata and the marshalled request.
+// The shared call runs on a context detached from the callers and bounded by the
+// client timeout, every caller waits for it until its own context is done and gets
+// a clone of the response, it is enabled by ClientConfig.SingleFlight.
+func (c *Client) singleFlight() grpc.UnaryClientInterceptor {
+	codec := encoding.GetCodec(proto.Name)
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) (err error) {
+		var (
+			ok   bool
+			conf *ClientConfig
+		)
+		c.mutex.RLock()
+		if conf, ok = c.conf.Method[method]; !ok {
+			conf = c.conf
+		}
+		c.mutex.RUnlock()
+		if !conf.SingleFlight {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+		bs, err := codec.Marshal(req)
+		if err != nil {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+		timeout := time.Duration(conf.Timeout)
+		for _, opt := range opts {
+			if timeOpt, ok := opt.(*TimeoutCallOption); ok && timeOpt.Timeout > 0 {
+				timeout = timeOpt.Timeout
+			}
+		}
+		var executed bool
+		ch := c.sf.DoChan(singleFlightKey(ctx, cc.Target(), method, bs), func() (interface{}, error) {
+			executed = true
+			sctx, cancel := context.WithTimeout(nmd.Detach(ctx), timeout)
+			defer cancel()
+			// the caller may return before the call, which uses its own request and reply.
+			sreq := reflect.New(reflect.TypeOf(req).Elem()).Interface()
+			if err := codec.Unmarshal(bs, sreq); err != nil {
+				return nil, err
+			}
+			sreply := reflect.New(reflect.TypeOf(reply).Elem()).Interface()
+			if err := invoker(sctx, method, sreq, sreply, cc, opts...); err != nil {
+				return nil, err
+			}
+			return codec.Marshal(sreply)
+		})
+		select {
+		case res := <-ch:
+			if executed {
+				_metricClientSingleFlight.Inc(method, "executed")
+			} else {
+				_metricClientSingleFlight.Inc(method, "merged")
+			}
+			if res.Err != nil {
+				return res.Err
+			}
+			return codec.Unmarshal(res.Val.([]byte), reply)
+		case <-ctx.Done():
+			if ctx.Err() == context.Canceled {
+				return ecode.Canceled
+			}
+			return ecode.Deadline
+		}
+	}
+}
+
+// singleFlightKey returns the key of the request, the callers with different
+// outgoing metadata, e.g. the identity or auth, are not merged.
+func singleFlightKey(ctx context.Context, target, method string, req []byte) string {
+	var md []string
+	nmd.Range(ctx,
+		func(key string, value interface{}) {
+			if valstr, ok := value.(string); ok {
+				md = append(md, key+"="+valstr)
+			}
+		},
+		nmd.IsOutgoingKey)
+	if gmd, ok := metadata.FromOutgoingContext(ctx); ok {
+		for key, vals := range gmd {
+			md = append(md, key+":"+strings.Join(vals, ","))
+		}
+	}
+	sort.Strings(md)
+	var b strings.Builder
+	b.WriteString(target)
+	b.WriteByte(0)
+	b.WriteString(method)
+	for _, kv := range md {
+		b.WriteByte(0)
+		b.WriteString(kv)
+	}
+	b.WriteByte(0)
+	b.Write(req)
+	return b.String()
+}
@@ -0,0 +1,171 @@
+package warden_test
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/djienet/kratos/pkg/ecode"
+	"github.com/djienet/kratos/pkg/net/rpc/warden"
+	pb "github.com/djienet/kratos/pkg/net/rpc/warden/internal/proto/testproto"
+	"github.com/djienet/kratos/pkg/net/rpc/warden/wardentest"
+	xtime "github.com/djienet/kratos/pkg/time"
+
+	"google.golang.org/grpc/metadata"
+)
+
+type sfServer struct {
+	calls int64
+}
+
+func (s *sfServer) SayHello(ctx context.Context, in *pb.HelloRequest) (*pb.HelloReply, error) {
+	atomic.AddInt64(&s.calls, 1)
+	time.Sleep(100 * time.Millisecond)
+	msg := "Hello " + in.Name
+	if md, ok := metadata.FromIncomingContext(ctx); ok && len(md.Get("mid")) > 0 {
+		msg += " " + md.Get("mid")[0]
+	}
+	return &pb.HelloReply{Message: msg, Success: true}, nil
+}
+
+func (s *sfServer) StreamHello(ss pb.Greeter_StreamHelloServer) error {
+	return nil
+}
+
+func TestSingleFlight(t *testing.T) {
+	svr := &sfServer{}
+	s := wardentest.NewServer(nil)
+	pb.RegisterGreeterServer(s.Server.Server(), svr)
+	s.Start()
+	defer s.Close()
+
+	conf := &warden.ClientConfig{
+		Dial:         xtime.Duration(time.Second),
+		Timeout:      xtime.Duration(time.Second),
+		SingleFlight: true,
+	}
+	conn, err := s.Dial(context.Background(), s.Client(conf))
+	if err != nil {
+		t.Fatalf("dial error(%v)", err)
+	}
+	defer conn.Close()
+	cli := pb.NewGreeterClient(conn)
+
+	var wg sync.WaitGroup
+	replies := make([]*pb.HelloReply, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			reply, err := cli.SayHello(context.Background(), &pb.HelloRequest{Name: "sf"})
+			if err != nil {
+				t.Errorf("SayHello error(%v)", err)
+				return
+			}
+			replies[i] = reply
+		}(i)
+	}
+	wg.Wait()
+	if calls := atomic.LoadInt64(&svr.calls); calls >= 10 {
+		t.Fatalf("identical requests should be merged, calls(%d)", calls)
+	}
+	for i, reply := range replies {
+		if reply == nil || reply.Message != "Hello sf" {
+			t.Fatalf("reply(%d) should be Hello sf, got %v", i, reply)
+		}
+		for _, other := range replies[i+1:] {
+			if reply == other {
+				t.Fatal("merged callers should get a clone of the response")
+			}
+		}
+	}
+
+	conf.Method = map[string]*warden.ClientConfig{"/testproto.Greeter/SayHello": {Timeout: xtime.Duration(time.Second)}}
+	atomic.StoreInt64(&svr.calls, 0)
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cli.SayHello(context.Background(), &pb.HelloRequest{Name: "sf"})
+		}()
+	}
+	wg.Wait()
+	if calls := atomic.LoadInt64(&svr.calls); calls != 5 {
+		t.Fatalf("singleflight should be disabled by method config, calls(%d)", calls)
+	}
+}
+
+func newSingleFlightClient(t *testing.T, svr *sfServer) (pb.GreeterClient, func()) {
+	s := wardentest.NewServer(nil)
+	pb.RegisterGreeterServer(s.Server.Server(), svr)
+	s.Start()
+	conf := &warden.ClientConfig{
+		Dial:         xtime.Duration(time.Second),
+		Timeout:      xtime.Duration(time.Second),
+		SingleFlight: true,
+	}
+	conn, err := s.Dial(context.Background(), s.Client(conf))
+	if err != nil {
+		s.Close()
+		t.Fatalf("dial error(%v)", err)
+	}
+	return pb.NewGreeterClient(conn), func() {
+		conn.Close()
+		s.Close()
+	}
+}
+
+func TestSingleFlightMetadata(t *testing.T) {
+	svr := &sfServer{}
+	cli, closeFn := newSingleFlightClient(t, svr)
+	defer closeFn()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			mid := []string{"1", "2"}[i%2]
+			ctx := metadata.AppendToOutgoingContext(context.Background(), "mid", mid)
+			reply, err := cli.SayHello(ctx, &pb.HelloRequest{Name: "sf"})
+			if err != nil {
+				t.Errorf("SayHello error(%v)", err)
+				return
+			}
+			if reply.Message != "Hello sf "+mid {
+				t.Errorf("caller of mid(%s) got the reply %q", mid, reply.Message)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if calls := atomic.LoadInt64(&svr.calls); calls < 2 {
+		t.Fatalf("requests with different metadata should not be merged, calls(%d)", calls)
+	}
+}
+
+func TestSingleFlightLeaderCanceled(t *testing.T) {
+	svr := &sfServer{}
+	cli, closeFn := newSingleFlightClient(t, svr)
+	defer closeFn()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	leader := make(chan error, 1)
+	go func() {
+		_, err := cli.SayHello(ctx, &pb.HelloRequest{Name: "sf"})
+		leader <- err
+	}()
+	time.Sleep(5 * time.Millisecond)
+	reply, err := cli.SayHello(context.Background(), &pb.HelloRequest{Name: "sf"})
+	if err != nil || reply.Message != "Hello sf" {
+		t.Fatalf("the waiter should not fail with the leader, reply(%v) error(%v)", reply, err)
+	}
+	if err = <-leader; !ecode.EqualError(ecode.Deadline, err) {
+		t.Fatalf("the leader should fail by its own deadline, got %v", err)
+	}
+	if calls := atomic.LoadInt64(&svr.calls); calls != 1 {
+		t.Fatalf("the waiter should be merged, calls(%d)", calls)
+	}
+}
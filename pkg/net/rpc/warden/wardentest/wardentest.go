@@ -0,0 +1,110 @@
+package wardentest
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/djienet/kratos/pkg/net/criticality"
+	nmd "github.com/djienet/kratos/pkg/net/metadata"
+	"github.com/djienet/kratos/pkg/net/rpc/warden"
+	xtime "github.com/djienet/kratos/pkg/time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+const (
+	// _bufSize is the buffer size of the in-memory connection.
+	_bufSize = 1024 * 1024
+	// _target is the placeholder target, the address is ignored by the bufconn dialer.
+	_target = "passthrough:///wardentest"
+)
+
+var (
+	_defaultSerConf = &warden.ServerConfig{
+		Timeout: xtime.Duration(time.Second),
+	}
+	_defaultCliConf = &warden.ClientConfig{
+		Dial:    xtime.Duration(time.Second),
+		Timeout: xtime.Duration(time.Second),
+	}
+)
+
+// Server is a warden server listening on an in-memory bufconn listener,
+// all interceptors of warden.Server and warden.Client still run in calls.
+type Server struct {
+	*warden.Server
+	lis *bufconn.Listener
+}
+
+// NewServer returns a warden server on an in-memory listener.
+// conf can be nil, the default timeout is one second.
+func NewServer(conf *warden.ServerConfig, opt ...grpc.ServerOption) *Server {
+	if conf == nil {
+		conf = _defaultSerConf
+	}
+	return &Server{
+		Server: warden.NewServer(conf, opt...),
+		lis:    bufconn.Listen(_bufSize),
+	}
+}
+
+// Start serves the registered services in a new goroutine.
+func (s *Server) Start() *Server {
+	go s.Serve(s.lis)
+	return s
+}
+
+// DialOption returns the grpc dial option which dials to the in-memory listener.
+func (s *Server) DialOption() grpc.DialOption {
+	return grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+		return s.lis.Dial()
+	})
+}
+
+// Client returns a warden client wired to the server.
+// conf can be nil, the default dial and call timeout are one second.
+func (s *Server) Client(conf *warden.ClientConfig, opt ...grpc.DialOption) *warden.Client {
+	if conf == nil {
+		conf = _defaultCliConf
+	}
+	opt = append(opt, s.DialOption())
+	return warden.NewClient(conf, opt...)
+}
+
+// Dial creates a client connection to the server by the warden client.
+// if c is nil, a client with default config is used.
+func (s *Server) Dial(ctx context.Context, c *warden.Client, opts ...grpc.DialOption) (*grpc.ClientConn, error) {
+	if c == nil {
+		c = s.Client(nil)
+	}
+	opts = append(opts, s.DialOption())
+	return c.Dial(ctx, _target, opts...)
+}
+
+// Close stops the server and closes the listener.
+func (s *Server) Close() error {
+	s.Server.Server().Stop()
+	return s.lis.Close()
+}
+
+// WithMetadata returns a new context with the key-value pairs merged into
+// its metadata, the outgoing keys are propagated to server by warden client.
+func WithMetadata(ctx context.Context, kv ...interface{}) context.Context {
+	md := nmd.Pairs(kv...)
+	if old, ok := nmd.FromContext(ctx); ok {
+		md = nmd.Join(old, md)
+	}
+	return nmd.NewContext(ctx, md)
+}
+
+// WithCriticality returns a new context with the criticality injected.
+func WithCriticality(ctx context.Context, c criticality.Criticality) context.Context {
+	return WithMetadata(ctx, nmd.Criticality, string(c))
+}
+
+// WithColor returns a new context with the color injected.
+func WithColor(ctx context.Context, color string) context.Context {
+	return WithMetadata(ctx, nmd.Color, color)
+}
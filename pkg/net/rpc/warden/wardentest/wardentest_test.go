@@ -0,0 +1,69 @@
+package wardentest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/djienet/kratos/pkg/ecode"
+	"github.com/djienet/kratos/pkg/net/criticality"
+	nmd "github.com/djienet/kratos/pkg/net/metadata"
+	pb "github.com/djienet/kratos/pkg/net/rpc/warden/internal/proto/testproto"
+	"github.com/djienet/kratos/pkg/net/trace"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type helloServer struct{}
+
+func (s *helloServer) SayHello(ctx context.Context, in *pb.HelloRequest) (*pb.HelloReply, error) {
+	if _, ok := trace.FromContext(ctx); !ok {
+		return nil, ecode.ServerErr
+	}
+	switch in.Name {
+	case "ecode":
+		return nil, ecode.AccessDenied
+	case "criticality":
+		return &pb.HelloReply{Message: nmd.String(ctx, nmd.Criticality), Success: true}, nil
+	case "color":
+		return &pb.HelloReply{Message: nmd.String(ctx, nmd.Color), Success: true}, nil
+	}
+	return &pb.HelloReply{Message: "Hello " + in.Name, Success: true}, nil
+}
+
+func (s *helloServer) StreamHello(ss pb.Greeter_StreamHelloServer) error {
+	return nil
+}
+
+func TestServer(t *testing.T) {
+	s := NewServer(nil)
+	pb.RegisterGreeterServer(s.Server.Server(), &helloServer{})
+	s.Start()
+	defer s.Close()
+
+	conn, err := s.Dial(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("dial bufconn error(%v)", err)
+	}
+	defer conn.Close()
+	cli := pb.NewGreeterClient(conn)
+
+	reply, err := cli.SayHello(context.Background(), &pb.HelloRequest{Name: "warden"})
+	assert.Nil(t, err)
+	assert.Equal(t, "Hello warden", reply.Message)
+
+	_, err = cli.SayHello(context.Background(), &pb.HelloRequest{Name: "ecode"})
+	assert.True(t, ecode.EqualError(ecode.AccessDenied, err))
+
+	_, err = cli.SayHello(context.Background(), &pb.HelloRequest{Age: 1})
+	assert.True(t, ecode.EqualError(ecode.RequestErr, err))
+
+	ctx := WithCriticality(context.Background(), criticality.Sheddable)
+	reply, err = cli.SayHello(ctx, &pb.HelloRequest{Name: "criticality"})
+	assert.Nil(t, err)
+	assert.Equal(t, string(criticality.Sheddable), reply.Message)
+
+	ctx = WithColor(ctx, "red")
+	reply, err = cli.SayHello(ctx, &pb.HelloRequest{Name: "color"})
+	assert.Nil(t, err)
+	assert.Equal(t, "red", reply.Message)
+}
@@ -16,6 +16,7 @@ package {{.PkgName}}
 import (
 	"context"
 	{{if .EnableBatch }}"sync"{{end}}
+	{{if .EnableXFetch }}"time"{{end}}
 NEWLINE
 	"github.com/djienet/kratos/pkg/cache"
 	{{if .EnableBatch }}"github.com/djienet/kratos/pkg/sync/errgroup"{{end}}
@@ -32,10 +32,12 @@ var (
 	ignores       = flag.String("ignores", "", "ignore params")
 	customMethod  = flag.String("custom_method", "", "自定义方法名 |分隔: 缓存|回源|增加缓存")
 	structName    = flag.String("struct_name", "dao", "struct name")
+	xfetch        = flag.String("xfetch", "", "beta of probabilistic early refresh")
+	expire        = flag.String("expire", "", "cache expire in seconds")
 
 	numberTypes    = []string{"int", "int8", "int16", "int32", "int64", "float32", "float64", "uint", "uint8", "uint16", "uint32", "uint64"}
 	simpleTypes    = []string{"int", "int8", "int16", "int32", "int64", "float32", "float64", "uint", "uint8", "uint16", "uint32", "uint64", "bool", "string", "[]byte"}
-	optionNames    = []string{"singleflight", "nullcache", "check_null_code", "batch", "max_group", "sync", "paging", "ignores", "batch_err", "custom_method", "cache_err", "struct_name"}
+	optionNames    = []string{"singleflight", "nullcache", "check_null_code", "batch", "max_group", "sync", "paging", "ignores", "batch_err", "custom_method", "cache_err", "struct_name", "xfetch", "expire"}
 	optionNamesMap = map[string]bool{}
 	interfaceName  string
 )
@@ -59,6 +61,8 @@ func resetFlag() {
 	*ignores = ""
 	*customMethod = ""
 	*structName = "dao"
+	*xfetch = ""
+	*expire = ""
 }
 
 // options options
@@ -100,6 +104,9 @@ type options struct {
 	StructName         string
 	hasDec             bool
 	UseBTS             bool
+	EnableXFetch       bool
+	XFetchBeta         string
+	Expire             string
 }
 
 func getOptions(opt *options, comment string) {
@@ -134,6 +141,9 @@ func getOptions(opt *options, comment string) {
 	opt.CustomMethod = *customMethod
 	opt.CacheErrContinue = *cacheErr == "continue"
 	opt.StructName = *structName
+	opt.EnableXFetch = *xfetch != ""
+	opt.XFetchBeta = *xfetch
+	opt.Expire = *expire
 }
 
 func processList(s *pkg.Source, list *ast.Field) (opt options) {
@@ -370,6 +380,20 @@ func (option *options) Check() {
 			log.Fatalf("%s: -check_null_code=%s 错误 会有无意义的赋值\n", option.name, option.CheckNullCode)
 		}
 	}
+	if option.EnableXFetch {
+		if option.template == _noneTpl {
+			log.Fatalf("%s: -xfetch只能用在单key和多key模板中\n", option.name)
+		}
+		if !strings.HasPrefix(option.valueType, "*") {
+			log.Fatalf("%s: -xfetch的值类型需为指针类型 并嵌入cache.XFetch\n", option.name)
+		}
+		if beta, err := strconv.ParseFloat(option.XFetchBeta, 64); err != nil || beta <= 0 {
+			log.Fatalf("%s: -xfetch=%s 错误 需为正数\n", option.name, option.XFetchBeta)
+		}
+		if option.Expire == "" {
+			log.Fatalf("%s: 开启-xfetch时需要-expire参数\n", option.name)
+		}
+	}
 }
 
 func genHeader(opts []*options) (src string) {
@@ -386,6 +410,9 @@ func genHeader(opts []*options) (src string) {
 		if opt.EnableBatch {
 			option.EnableBatch = true
 		}
+		if opt.EnableXFetch {
+			option.EnableXFetch = true
+		}
 		if len(opt.importPackages) > 0 {
 			for _, pkg := range opt.importPackages {
 				if !packagesMap[pkg] {
@@ -450,6 +477,8 @@ func genBody(opts []*options) (res string) {
 		src = strings.Replace(src, "GROUPSIZE", strconv.Itoa(option.GroupSize), -1)
 		src = strings.Replace(src, "MAXGROUP", strconv.Itoa(option.MaxGroup), -1)
 		src = strings.Replace(src, "SFNUM", strconv.Itoa(sfnum), -1)
+		src = strings.Replace(src, "XFETCHBETA", option.XFetchBeta, -1)
+		src = strings.Replace(src, "EXPIRE", option.Expire, -1)
 		t := template.Must(template.New("cache").Parse(src))
 		var buffer bytes.Buffer
 		err := t.Execute(&buffer, option)
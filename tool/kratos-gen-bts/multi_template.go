@@ -31,6 +31,44 @@ func (d *{{.StructName}}) NAME(c context.Context, {{.IDName}} []KEY{{.ExtraArgsT
 		}
 	}
 	cache.MetricHits.Add(float64(len({{.IDName}}) - len(miss)), "bts:NAME")
+	{{if .EnableXFetch}}
+	var early []KEY
+	for k, v := range res {
+		if v != nil && v.XFetchRefresh(XFETCHBETA) {
+			early = append(early, k)
+		}
+	}
+	if len(early) > 0 {
+		cache.MetricRefreshes.Add(float64(len(early)), "bts:NAME")
+		d.cache.Do(c, func(c context.Context) {
+			start := time.Now()
+			data, err := RAWFUNC(c, early {{.ExtraRawArgs}})
+			if err != nil {
+				return
+			}
+			if data == nil {
+				data = make(map[KEY]VALUE, len(early))
+			}
+			{{if .EnableNullCache}}
+			for _, key := range early {
+				if data[key] == nil {
+					data[key] = {{.NullCache}}
+				}
+			}
+			{{end}}
+			ttl, cost := time.Duration(EXPIRE)*time.Second, time.Since(start)
+			for k, v := range data {
+				if v == nil {
+					continue
+				}
+				e := *v
+				e.SetXFetch(cost, ttl)
+				data[k] = &e
+			}
+			ADDCACHEFUNC(c, data {{.ExtraAddCacheArgs}})
+		})
+	}
+	{{end}}
 	{{if .EnableNullCache}}
 	for k, v := range res {
 		{{if .SimpleValue}} if v == {{.NullCache}} { {{else}} if {{.CheckNullCode}} { {{end}}
@@ -47,6 +85,9 @@ func (d *{{.StructName}}) NAME(c context.Context, {{.IDName}} []KEY{{.ExtraArgsT
 	{{else}}
 	var missData map[KEY]VALUE
 	{{end}}
+	{{if .EnableXFetch}}
+	start := time.Now()
+	{{end}}
 	{{if .EnableSingleFlight}}
 		var rr interface{}
 		sf := d.cacheSFNAME({{.IDName}} {{.ExtraArgs}})
@@ -118,6 +159,20 @@ func (d *{{.StructName}}) NAME(c context.Context, {{.IDName}} []KEY{{.ExtraArgsT
 	if !addCache {
 		return
 	}
+	{{if .EnableXFetch}}
+	// the values may be shared by singleflight, so the copies are cached.
+	ttl, cost := time.Duration(EXPIRE)*time.Second, time.Since(start)
+	earlyData := make(map[KEY]VALUE, len(missData))
+	for k, v := range missData {
+		if v == nil {
+			continue
+		}
+		e := *v
+		e.SetXFetch(cost, ttl)
+		earlyData[k] = &e
+	}
+	missData = earlyData
+	{{end}}
 	{{if .Sync}}
 	ADDCACHEFUNC(c, missData {{.ExtraAddCacheArgs}})
 	{{else}}
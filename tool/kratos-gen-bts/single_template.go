@@ -26,11 +26,41 @@ func (d *{{.StructName}}) NAME(c context.Context, {{.IDName}} KEY{{.ExtraArgsTyp
 	if res != {{.ZeroValue}} {
 	{{end}}
 	cache.MetricHits.Inc("bts:NAME")
+	{{if .EnableXFetch}}
+		if res.XFetchRefresh(XFETCHBETA) {
+			cache.MetricRefreshes.Inc("bts:NAME")
+			d.cache.Do(c, func(c context.Context) {
+				start := time.Now()
+				{{if .EnablePaging}}
+				_, miss, err := RAWFUNC(c, {{.IDName}} {{.ExtraRawArgs}})
+				{{else}}
+				miss, err := RAWFUNC(c, {{.IDName}} {{.ExtraRawArgs}})
+				{{end}}
+				if err != nil {
+					return
+				}
+				{{if .EnableNullCache}}
+				if miss == nil {
+					miss = {{.NullCache}}
+				}
+				{{end}}
+				if miss != nil {
+					early := *miss
+					early.SetXFetch(time.Since(start), time.Duration(EXPIRE)*time.Second)
+					miss = &early
+				}
+				ADDCACHEFUNC(c, {{.IDName}}, miss {{.ExtraAddCacheArgs}})
+			})
+		}
+	{{end}}
 		return
 	}
 	{{if .EnablePaging}}
 	var miss VALUE
 	{{end}}
+	{{if .EnableXFetch}}
+	start := time.Now()
+	{{end}}
 	{{if .EnableSingleFlight}}
 		var rr interface{}
 		sf := d.cacheSFNAME({{.IDName}} {{.ExtraArgs}})
@@ -78,6 +108,14 @@ func (d *{{.StructName}}) NAME(c context.Context, {{.IDName}} KEY{{.ExtraArgsTyp
 	if !addCache {
 		return
 	}
+	{{if .EnableXFetch}}
+	// the value may be shared by singleflight, so the copy is cached.
+	if miss != nil {
+		early := *miss
+		early.SetXFetch(time.Since(start), time.Duration(EXPIRE)*time.Second)
+		miss = &early
+	}
+	{{end}}
 	{{if .Sync}}
 		ADDCACHEFUNC(c, {{.IDName}}, miss {{.ExtraAddCacheArgs}})
 	{{else}}
@@ -14,6 +14,10 @@
 		Demo1(c context.Context, key int64, pn int, ps int) (*Demo, error)
 		// bts: -nullcache=&Demo{ID:-1} -check_null_code=$.ID==-1
 		None(c context.Context) (*Demo, error)
+		// bts: -xfetch=1 -expire=d.demoExpire -nullcache=&Demo{ID:-1} -check_null_code=$!=nil&&$.ID==-1
+		EarlyDemo(c context.Context, key int64) (*Demo, error)
+		// bts: -xfetch=1 -expire=d.demoExpire -nullcache=&Demo{ID:-1} -check_null_code=$!=nil&&$.ID==-1
+		EarlyDemos(c context.Context, keys []int64) (map[int64]*Demo, error)
 	}
 */
 
@@ -22,6 +26,7 @@ package testdata
 import (
 	"context"
 	"sync"
+	"time"
 
 	"github.com/djienet/kratos/pkg/cache"
 	"github.com/djienet/kratos/pkg/sync/errgroup"
@@ -281,3 +286,164 @@ func (d *dao) None(c context.Context) (res *Demo, err error) {
 	})
 	return
 }
+
+// EarlyDemo get data from cache if miss will call source method, then add to cache.
+func (d *dao) EarlyDemo(c context.Context, key int64) (res *Demo, err error) {
+	addCache := true
+	res, err = d.CacheEarlyDemo(c, key)
+	if err != nil {
+		addCache = false
+		err = nil
+	}
+	defer func() {
+		if res != nil && res.ID == -1 {
+			res = nil
+		}
+	}()
+	if res != nil {
+		cache.MetricHits.Inc("bts:EarlyDemo")
+		if res.XFetchRefresh(1) {
+			cache.MetricRefreshes.Inc("bts:EarlyDemo")
+			d.cache.Do(c, func(c context.Context) {
+				start := time.Now()
+				miss, err := d.RawEarlyDemo(c, key)
+				if err != nil {
+					return
+				}
+				if miss == nil {
+					miss = &Demo{ID: -1}
+				}
+				if miss != nil {
+					early := *miss
+					early.SetXFetch(time.Since(start), time.Duration(d.demoExpire)*time.Second)
+					miss = &early
+				}
+				d.AddCacheEarlyDemo(c, key, miss)
+			})
+		}
+		return
+	}
+	start := time.Now()
+	cache.MetricMisses.Inc("bts:EarlyDemo")
+	res, err = d.RawEarlyDemo(c, key)
+	if err != nil {
+		return
+	}
+	miss := res
+	if miss == nil {
+		miss = &Demo{ID: -1}
+	}
+	if !addCache {
+		return
+	}
+	// the value may be shared by singleflight, so the copy is cached.
+	if miss != nil {
+		early := *miss
+		early.SetXFetch(time.Since(start), time.Duration(d.demoExpire)*time.Second)
+		miss = &early
+	}
+	d.cache.Do(c, func(c context.Context) {
+		d.AddCacheEarlyDemo(c, key, miss)
+	})
+	return
+}
+
+// EarlyDemos get data from cache if miss will call source method, then add to cache.
+func (d *dao) EarlyDemos(c context.Context, keys []int64) (res map[int64]*Demo, err error) {
+	if len(keys) == 0 {
+		return
+	}
+	addCache := true
+	if res, err = d.CacheEarlyDemos(c, keys); err != nil {
+		addCache = false
+		res = nil
+		err = nil
+	}
+	var miss []int64
+	for _, key := range keys {
+		if (res == nil) || (res[key] == nil) {
+			miss = append(miss, key)
+		}
+	}
+	cache.MetricHits.Add(float64(len(keys)-len(miss)), "bts:EarlyDemos")
+	var early []int64
+	for k, v := range res {
+		if v != nil && v.XFetchRefresh(1) {
+			early = append(early, k)
+		}
+	}
+	if len(early) > 0 {
+		cache.MetricRefreshes.Add(float64(len(early)), "bts:EarlyDemos")
+		d.cache.Do(c, func(c context.Context) {
+			start := time.Now()
+			data, err := d.RawEarlyDemos(c, early)
+			if err != nil {
+				return
+			}
+			if data == nil {
+				data = make(map[int64]*Demo, len(early))
+			}
+			for _, key := range early {
+				if data[key] == nil {
+					data[key] = &Demo{ID: -1}
+				}
+			}
+			ttl, cost := time.Duration(d.demoExpire)*time.Second, time.Since(start)
+			for k, v := range data {
+				if v == nil {
+					continue
+				}
+				e := *v
+				e.SetXFetch(cost, ttl)
+				data[k] = &e
+			}
+			d.AddCacheEarlyDemos(c, data)
+		})
+	}
+	for k, v := range res {
+		if v != nil && v.ID == -1 {
+			delete(res, k)
+		}
+	}
+	missLen := len(miss)
+	if missLen == 0 {
+		return
+	}
+	var missData map[int64]*Demo
+	start := time.Now()
+	cache.MetricMisses.Add(float64(len(miss)), "bts:EarlyDemos")
+	missData, err = d.RawEarlyDemos(c, miss)
+	if res == nil {
+		res = make(map[int64]*Demo, len(keys))
+	}
+	for k, v := range missData {
+		res[k] = v
+	}
+	if err != nil {
+		return
+	}
+	for _, key := range miss {
+		if res[key] == nil {
+			missData[key] = &Demo{ID: -1}
+		}
+	}
+	if !addCache {
+		return
+	}
+	// the values may be shared by singleflight, so the copies are cached.
+	ttl, cost := time.Duration(d.demoExpire)*time.Second, time.Since(start)
+	earlyData := make(map[int64]*Demo, len(missData))
+	for k, v := range missData {
+		if v == nil {
+			continue
+		}
+		e := *v
+		e.SetXFetch(cost, ttl)
+		earlyData[k] = &e
+	}
+	missData = earlyData
+	d.cache.Do(c, func(c context.Context) {
+		d.AddCacheEarlyDemos(c, missData)
+	})
+	return
+}
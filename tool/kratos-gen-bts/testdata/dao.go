@@ -3,6 +3,7 @@ package testdata
 import (
 	"context"
 
+	"github.com/djienet/kratos/pkg/cache"
 	"github.com/djienet/kratos/pkg/sync/pipeline/fanout"
 )
 
@@ -10,16 +11,18 @@ import (
 type Demo struct {
 	ID    int64
 	Title string
+	cache.XFetch
 }
 
 // Dao .
 type dao struct {
-	cache *fanout.Fanout
+	cache      *fanout.Fanout
+	demoExpire int32
 }
 
 // New .
 func New() *dao {
-	return &dao{cache: fanout.New("cache")}
+	return &dao{cache: fanout.New("cache"), demoExpire: 3600}
 }
 
 //go:generate kratos tool genbts
@@ -34,4 +37,8 @@ type _bts interface {
 	Demo1(c context.Context, key int64, pn int, ps int) (*Demo, error)
 	// bts: -nullcache=&Demo{ID:-1} -check_null_code=$.ID==-1
 	None(c context.Context) (*Demo, error)
+	// bts: -xfetch=1 -expire=d.demoExpire -nullcache=&Demo{ID:-1} -check_null_code=$!=nil&&$.ID==-1
+	EarlyDemo(c context.Context, key int64) (*Demo, error)
+	// bts: -xfetch=1 -expire=d.demoExpire -nullcache=&Demo{ID:-1} -check_null_code=$!=nil&&$.ID==-1
+	EarlyDemos(c context.Context, keys []int64) (map[int64]*Demo, error)
 }
@@ -0,0 +1,79 @@
+package testdata
+
+import (
+	"context"
+	"sync"
+)
+
+// mock test
+var (
+	_earlyMu    sync.Mutex
+	_earlyCache = map[int64]*Demo{}
+	_earlyRaws  int
+)
+
+func earlyRaws() int {
+	_earlyMu.Lock()
+	defer _earlyMu.Unlock()
+	return _earlyRaws
+}
+
+func earlyCached(key int64) *Demo {
+	_earlyMu.Lock()
+	defer _earlyMu.Unlock()
+	return _earlyCache[key]
+}
+
+// CacheEarlyDemo .
+func (d *dao) CacheEarlyDemo(c context.Context, key int64) (*Demo, error) {
+	return earlyCached(key), nil
+}
+
+// RawEarlyDemo .
+func (d *dao) RawEarlyDemo(c context.Context, key int64) (*Demo, error) {
+	_earlyMu.Lock()
+	defer _earlyMu.Unlock()
+	_earlyRaws++
+	if key < 0 {
+		return nil, nil
+	}
+	return &Demo{ID: key, Title: "raw"}, nil
+}
+
+// AddCacheEarlyDemo .
+func (d *dao) AddCacheEarlyDemo(c context.Context, key int64, value *Demo) error {
+	_earlyMu.Lock()
+	defer _earlyMu.Unlock()
+	_earlyCache[key] = value
+	return nil
+}
+
+// CacheEarlyDemos .
+func (d *dao) CacheEarlyDemos(c context.Context, keys []int64) (map[int64]*Demo, error) {
+	res := make(map[int64]*Demo)
+	for _, key := range keys {
+		if v := earlyCached(key); v != nil {
+			res[key] = v
+		}
+	}
+	return res, nil
+}
+
+// RawEarlyDemos .
+func (d *dao) RawEarlyDemos(c context.Context, keys []int64) (map[int64]*Demo, error) {
+	res := make(map[int64]*Demo)
+	for _, key := range keys {
+		if v, _ := d.RawEarlyDemo(c, key); v != nil {
+			res[key] = v
+		}
+	}
+	return res, nil
+}
+
+// AddCacheEarlyDemos .
+func (d *dao) AddCacheEarlyDemos(c context.Context, values map[int64]*Demo) error {
+	for k, v := range values {
+		d.AddCacheEarlyDemo(c, k, v)
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package testdata
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func resetEarly() {
+	_earlyMu.Lock()
+	_earlyCache = map[int64]*Demo{}
+	_earlyRaws = 0
+	_earlyMu.Unlock()
+}
+
+func waitEarlyRaws(t *testing.T, n int) {
+	for deadline := time.Now().Add(time.Second); earlyRaws() < n; {
+		if time.Now().After(deadline) {
+			t.Fatalf("want %d raw calls, got %d", n, earlyRaws())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestEarlyCache(t *testing.T) {
+	resetEarly()
+	d := New()
+	// miss, the value is cached with the expiry and the cost.
+	res, err := d.EarlyDemo(context.TODO(), 1)
+	if err != nil || res.ID != 1 {
+		t.Fatalf("unexpected res %v err %v", res, err)
+	}
+	waitEarlyRaws(t, 1)
+	var cached *Demo
+	for deadline := time.Now().Add(time.Second); cached == nil && time.Now().Before(deadline); {
+		cached = earlyCached(1)
+		time.Sleep(time.Millisecond)
+	}
+	if cached == nil || cached.XFetchExpiry == 0 || cached == res {
+		t.Fatalf("want a cached copy with the expiry, got %+v", cached)
+	}
+	// far from the expiry, no refresh.
+	for i := 0; i < 100; i++ {
+		if res, err = d.EarlyDemo(context.TODO(), 1); err != nil || res.ID != 1 {
+			t.Fatalf("unexpected res %v err %v", res, err)
+		}
+	}
+	if n := earlyRaws(); n != 1 {
+		t.Fatalf("want no refresh, got %d raw calls", n)
+	}
+	// expired, the cached value is returned and refreshed in background.
+	cached.Title = "stale"
+	cached.SetXFetch(time.Second, 0)
+	if res, err = d.EarlyDemo(context.TODO(), 1); err != nil || res.Title != "stale" {
+		t.Fatalf("want the stale value, got %v err %v", res, err)
+	}
+	waitEarlyRaws(t, 2)
+	// the null cache is refreshed too.
+	if res, err = d.EarlyDemo(context.TODO(), -1); err != nil || res != nil {
+		t.Fatalf("want nil, got %v err %v", res, err)
+	}
+	waitEarlyRaws(t, 3)
+}
+
+func TestEarlyMultiCache(t *testing.T) {
+	resetEarly()
+	d := New()
+	keys := []int64{11, 12, 13}
+	res, err := d.EarlyDemos(context.TODO(), keys)
+	if err != nil || len(res) != 3 {
+		t.Fatalf("unexpected res %v err %v", res, err)
+	}
+	waitEarlyRaws(t, 3)
+	for deadline := time.Now().Add(time.Second); earlyCached(13) == nil; {
+		if time.Now().After(deadline) {
+			t.Fatal("values not cached")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	n := earlyRaws()
+	earlyCached(12).SetXFetch(time.Second, 0)
+	if res, err = d.EarlyDemos(context.TODO(), keys); err != nil || len(res) != 3 {
+		t.Fatalf("unexpected res %v err %v", res, err)
+	}
+	// only the expired key is refreshed.
+	waitEarlyRaws(t, n+1)
+	time.Sleep(10 * time.Millisecond)
+	if got := earlyRaws(); got != n+1 {
+		t.Fatalf("want %d raw calls, got %d", n+1, got)
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+var _headerTemplate = `
+// Code generated by kratos tool genredis. DO NOT EDIT.
+
+NEWLINE
+/* 
+  Package {{.PkgName}} is a generated redis cache package.
+  It is generated from:
+  ARGS
+*/
+NEWLINE
+
+package {{.PkgName}}
+
+import (
+	"context"
+	"fmt"
+	{{if .UseStrConv}}"strconv"{{end}}
+NEWLINE
+	{{if .UseRedis }}"github.com/djienet/kratos/pkg/cache/redis"{{end}}
+	"github.com/djienet/kratos/pkg/log"
+	{{.ImportPackage}}
+)
+
+var _ _redis
+`
+
+// _encodeTemplate encodes val into bs.
+var _encodeTemplate = `
+	{{if .SimpleValue}}
+		bs := {{.ConvertValue2Bytes}}
+	{{else}}
+		var bs []byte
+		if bs, err = redis.NewCodec({{.Encode}}).Encode(val); err != nil {
+			log.Errorv(c, log.KV("NAME", fmt.Sprintf("%+v", err)), log.KV("key", key))
+			return
+		}
+	{{end}}
+`
+
+// _decodeTemplate decodes bs into v.
+var _decodeTemplate = `
+	{{if .GetDirectValue}}
+		v := VALUE(bs)
+	{{else if .GetSimpleValue}}
+		r, err := {{.ConvertBytes2Value}}
+		if err != nil {
+			log.Errorv(c, log.KV("NAME", fmt.Sprintf("%+v", err)), log.KV("key", key))
+			return res, err
+		}
+		v := VALUE(r)
+	{{else}}
+		{{if .PointType}}
+			v := &{{.OriginValueType}}{}
+			if err = redis.NewCodec({{.Encode}}).Decode(bs, v); err != nil {
+		{{else}}
+			var v VALUE
+			if err = redis.NewCodec({{.Encode}}).Decode(bs, &v); err != nil {
+		{{end}}
+			log.Errorv(c, log.KV("NAME", fmt.Sprintf("%+v", err)), log.KV("key", key))
+			return
+		}
+	{{end}}
+`
+
+// _expireTemplate gets the expire of val.
+var _expireTemplate = `
+	expire := {{.ExpireCode}}
+	{{if .EnableNullCode}}
+		if {{.CheckNullCode}} {
+			expire = {{.ExpireNullCode}}
+		}
+	{{end}}
+`
@@ -0,0 +1,156 @@
+package main
+
+var _multiGetTemplate = `
+// NAME {{or .Comment "get data from redis"}} 
+func (d *{{.StructName}}) NAME(c context.Context, ids []KEY {{.ExtraArgsType}}) (res map[KEY]VALUE, err error) {
+	l := len(ids)
+	if l == 0 {
+		return
+	}
+	{{if .EnableBatch}}
+		batch := GROUPSIZE
+	{{else}}
+		batch := l
+	{{end}}
+	{{if .UseHash}}
+		key := {{.KeyMethod}}({{.HashKeyArgs}})
+	{{end}}
+	p := d.redis.Pipeline()
+	keys := make([]string, 0, l)
+	for i := 0; i < l; i += batch {
+		j := i + batch
+		if j > l {
+			j = l
+		}
+		args := make([]interface{}, 0, j-i+1)
+		{{if .UseHash}}
+			args = append(args, key)
+		{{end}}
+		for _, id := range ids[i:j] {
+			{{if .UseHash}}
+				k := {{.FieldMethod}}(id)
+			{{else}}
+				k := {{.KeyMethod}}(id{{.ExtraArgs}})
+			{{end}}
+			keys = append(keys, k)
+			args = append(args, k)
+		}
+		p.Send("{{if .UseHash}}HMGET{{else}}MGET{{end}}", args...)
+	}
+	rs, err := p.Exec(c)
+	if err != nil {
+		log.Errorv(c, log.KV("NAME", fmt.Sprintf("%+v", err)), log.KV("keys", keys))
+		return
+	}
+	var idx int
+	for rs.Next() {
+		var replies [][]byte
+		if replies, err = redis.ByteSlices(rs.Scan()); err != nil {
+			log.Errorv(c, log.KV("NAME", fmt.Sprintf("%+v", err)), log.KV("keys", keys))
+			return
+		}
+		for _, bs := range replies {
+			id := ids[idx]
+			{{if not .UseHash}}
+				key := keys[idx]
+			{{end}}
+			idx++
+			if bs == nil {
+				continue
+			}
+` + _decodeTemplate + `
+			if res == nil {
+				res = make(map[KEY]VALUE, l)
+			}
+			res[id] = v
+		}
+	}
+	return
+}
+`
+
+var _multiSetTemplate = `
+// NAME {{or .Comment "Set data to redis"}} 
+func (d *{{.StructName}}) NAME(c context.Context, values map[KEY]VALUE {{.ExtraArgsType}}) (err error) {
+	if len(values) == 0 {
+		return
+	}
+	p := d.redis.Pipeline()
+	exec := func() (err error) {
+		rs, err := p.Exec(c)
+		if err != nil {
+			return
+		}
+		for rs.Next() {
+			if _, err = rs.Scan(); err != nil {
+				return
+			}
+		}
+		return
+	}
+	{{if .UseHash}}
+		key := {{.KeyMethod}}({{.HashKeyArgs}})
+	{{end}}
+	{{if .EnableBatch}}
+		var n int
+	{{end}}
+	for id, val := range values {
+		{{if .PointType}}
+			if val == nil {
+				continue
+			}
+		{{end}}
+		{{if not .UseHash}}
+			key := {{.KeyMethod}}(id{{.ExtraArgs}})
+		{{end}}
+` + _encodeTemplate + `
+		{{if .UseHash}}
+			p.Send("{{.SetCommand}}", key, {{.FieldMethod}}(id), bs)
+		{{else}}
+` + _expireTemplate + `
+			p.Send("SET", key, bs, "EX", expire{{.SetOption}})
+		{{end}}
+		{{if .EnableBatch}}
+			if n++; n%GROUPSIZE == 0 {
+				if err = exec(); err != nil {
+					log.Errorv(c, log.KV("NAME", fmt.Sprintf("%+v", err)))
+					return
+				}
+			}
+		{{end}}
+	}
+	{{if .UseHash}}
+		p.Send("EXPIRE", key, {{.ExpireCode}})
+	{{end}}
+	if err = exec(); err != nil {
+		log.Errorv(c, log.KV("NAME", fmt.Sprintf("%+v", err)))
+		return
+	}
+	return
+}
+`
+
+var _multiDelTemplate = `
+// NAME {{or .Comment "delete data from redis"}} 
+func (d *{{.StructName}}) NAME(c context.Context, ids []KEY {{.ExtraArgsType}}) (err error) {
+	if len(ids) == 0 {
+		return
+	}
+	args := make([]interface{}, 0, len(ids)+1)
+	{{if .UseHash}}
+		args = append(args, {{.KeyMethod}}({{.HashKeyArgs}}))
+	{{end}}
+	for _, id := range ids {
+		{{if .UseHash}}
+			args = append(args, {{.FieldMethod}}(id))
+		{{else}}
+			args = append(args, {{.KeyMethod}}(id{{.ExtraArgs}}))
+		{{end}}
+	}
+	if _, err = d.redis.Do(c, "{{if .UseHash}}HDEL{{else}}DEL{{end}}", args...); err != nil {
+		log.Errorv(c, log.KV("NAME", fmt.Sprintf("%+v", err)), log.KV("keys", args))
+		return
+	}
+	return
+}
+`
@@ -0,0 +1,55 @@
+package main
+
+var _noneGetTemplate = `
+// NAME {{or .Comment "get data from redis"}} 
+func (d *{{.StructName}}) NAME(c context.Context) (res VALUE, err error) {
+	key := {{.KeyMethod}}()
+	bs, err := redis.Bytes(d.redis.Do(c, "GET", key))
+	if err != nil {
+		if err == redis.ErrNil {
+			err = nil
+			return
+		}
+		log.Errorv(c, log.KV("NAME", fmt.Sprintf("%+v", err)), log.KV("key", key))
+		return
+	}
+` + _decodeTemplate + `
+	res = v
+	return
+}
+`
+
+var _noneSetTemplate = `
+// NAME {{or .Comment "Set data to redis"}} 
+func (d *{{.StructName}}) NAME(c context.Context, val VALUE) (err error) {
+	{{if .PointType}}
+      if val == nil {
+        return 
+      }
+	{{end}}
+	{{if .LenType}}
+      if len(val) == 0 {
+        return 
+      }
+	{{end}}
+	key := {{.KeyMethod}}()
+` + _encodeTemplate + _expireTemplate + `
+	if _, err = d.redis.Do(c, "SET", key, bs, "EX", expire{{.SetOption}}); err != nil {
+		log.Errorv(c, log.KV("NAME", fmt.Sprintf("%+v", err)), log.KV("key", key))
+		return
+	}
+	return
+}
+`
+
+var _noneDelTemplate = `
+// NAME {{or .Comment "delete data from redis"}} 
+func (d *{{.StructName}}) NAME(c context.Context) (err error) {
+	key := {{.KeyMethod}}()
+	if _, err = d.redis.Do(c, "DEL", key); err != nil {
+		log.Errorv(c, log.KV("NAME", fmt.Sprintf("%+v", err)), log.KV("key", key))
+		return
+	}
+	return
+}
+`
@@ -0,0 +1,85 @@
+package main
+
+var _singleGetTemplate = `
+// NAME {{or .Comment "get data from redis"}} 
+func (d *{{.StructName}}) NAME(c context.Context, id KEY {{.ExtraArgsType}}) (res VALUE, err error) {
+	{{if .UseHash}}
+		key := {{.KeyMethod}}({{.HashKeyArgs}})
+		bs, err := redis.Bytes(d.redis.Do(c, "HGET", key, {{.FieldMethod}}(id)))
+	{{else}}
+		key := {{.KeyMethod}}(id{{.ExtraArgs}})
+		bs, err := redis.Bytes(d.redis.Do(c, "GET", key))
+	{{end}}
+	if err != nil {
+		if err == redis.ErrNil {
+			err = nil
+			return
+		}
+		log.Errorv(c, log.KV("NAME", fmt.Sprintf("%+v", err)), log.KV("key", key))
+		return
+	}
+` + _decodeTemplate + `
+	res = v
+	return
+}
+`
+
+var _singleSetTemplate = `
+// NAME {{or .Comment "Set data to redis"}} 
+func (d *{{.StructName}}) NAME(c context.Context, id KEY, val VALUE {{.ExtraArgsType}}) (err error) {
+	{{if .PointType}}
+      if val == nil {
+        return 
+      }
+	{{end}}
+	{{if .LenType}}
+      if len(val) == 0 {
+        return 
+      }
+	{{end}}
+	{{if .UseHash}}
+		key := {{.KeyMethod}}({{.HashKeyArgs}})
+	{{else}}
+		key := {{.KeyMethod}}(id{{.ExtraArgs}})
+	{{end}}
+` + _encodeTemplate + _expireTemplate + `
+	{{if .UseHash}}
+		p := d.redis.Pipeline()
+		p.Send("{{.SetCommand}}", key, {{.FieldMethod}}(id), bs)
+		p.Send("EXPIRE", key, expire)
+		var rs *redis.Replies
+		if rs, err = p.Exec(c); err == nil {
+			for rs.Next() {
+				if _, err = rs.Scan(); err != nil {
+					break
+				}
+			}
+		}
+	{{else}}
+		_, err = d.redis.Do(c, "SET", key, bs, "EX", expire{{.SetOption}})
+	{{end}}
+	if err != nil {
+		log.Errorv(c, log.KV("NAME", fmt.Sprintf("%+v", err)), log.KV("key", key))
+		return
+	}
+	return
+}
+`
+
+var _singleDelTemplate = `
+// NAME {{or .Comment "delete data from redis"}} 
+func (d *{{.StructName}}) NAME(c context.Context, id KEY {{.ExtraArgsType}}) (err error) {
+	{{if .UseHash}}
+		key := {{.KeyMethod}}({{.HashKeyArgs}})
+		_, err = d.redis.Do(c, "HDEL", key, {{.FieldMethod}}(id))
+	{{else}}
+		key := {{.KeyMethod}}(id{{.ExtraArgs}})
+		_, err = d.redis.Do(c, "DEL", key)
+	{{end}}
+	if err != nil {
+		log.Errorv(c, log.KV("NAME", fmt.Sprintf("%+v", err)), log.KV("key", key))
+		return
+	}
+	return
+}
+`
@@ -0,0 +1,124 @@
+package testdata
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/djienet/kratos/pkg/cache/redis"
+	"github.com/djienet/kratos/pkg/container/pool"
+	xtime "github.com/djienet/kratos/pkg/time"
+)
+
+// Demo test struct
+type Demo struct {
+	ID    int64
+	Title string
+}
+
+// Dao .
+type dao struct {
+	redis      *redis.Redis
+	demoExpire int32
+}
+
+// New new dao
+func New() (d *dao) {
+	cfg := &redis.Config{
+		Config: &pool.Config{
+			Active:      10,
+			Idle:        5,
+			IdleTimeout: xtime.Duration(time.Second),
+		},
+		Name:         "test",
+		Proto:        "tcp",
+		Addr:         "127.0.0.1:6379",
+		DialTimeout:  xtime.Duration(time.Second),
+		ReadTimeout:  xtime.Duration(time.Second),
+		WriteTimeout: xtime.Duration(time.Second),
+	}
+	d = &dao{
+		redis:      redis.NewRedis(cfg),
+		demoExpire: int32(5),
+	}
+	return
+}
+
+//go:generate kratos tool genredis
+type _redis interface {
+	// redis: -key=demoKey
+	CacheDemos(c context.Context, keys []int64) (map[int64]*Demo, error)
+	// redis: -key=demoKey
+	CacheDemo(c context.Context, key int64) (*Demo, error)
+	// redis: -key=keyMid -encode=gob
+	CacheDemo1(c context.Context, key int64, mid int64) (*Demo, error)
+	// redis: -key=noneKey -encode=json|gzip
+	CacheNone(c context.Context) (*Demo, error)
+	// redis: -key=demoKey
+	CacheString(c context.Context, key int64) (string, error)
+	// redis: -key=countKey
+	CacheCounts(c context.Context, keys []int64) (map[int64]int64, error)
+	// redis: -key=demoHashKey -field=demoField
+	CacheHashDemos(c context.Context, keys []int64, tp int64) (map[int64]*Demo, error)
+	// redis: -key=demoHashKey -field=demoField
+	CacheHashDemo(c context.Context, key int64, tp int64) (*Demo, error)
+
+	// redis: -key=demoKey -expire=d.demoExpire -encode=json -batch=2
+	AddCacheDemos(c context.Context, values map[int64]*Demo) error
+	// redis: -key=demo2Key -expire=d.demoExpire -encode=json
+	AddCacheDemos2(c context.Context, values map[int64]*Demo, tp int64) error
+	// 这里也支持自定义注释 会替换默认的注释
+	// redis: -key=demoKey -expire=d.demoExpire -encode=json -check_null_code=$.ID==-1 -null_expire=1
+	AddCacheDemo(c context.Context, key int64, value *Demo) error
+	// redis: -key=keyMid -expire=d.demoExpire -encode=gob
+	AddCacheDemo1(c context.Context, key int64, value *Demo, mid int64) error
+	// redis: -key=noneKey -expire=d.demoExpire -encode=json|gzip
+	AddCacheNone(c context.Context, value *Demo) error
+	// redis: -key=demoKey -expire=d.demoExpire
+	AddCacheString(c context.Context, key int64, value string) error
+	// redis: -key=countKey -expire=d.demoExpire -type=only_add
+	AddCacheCounts(c context.Context, values map[int64]int64) error
+	// redis: -key=demoHashKey -field=demoField -expire=d.demoExpire
+	AddCacheHashDemos(c context.Context, values map[int64]*Demo, tp int64) error
+	// redis: -key=demoHashKey -field=demoField -expire=d.demoExpire
+	AddCacheHashDemo(c context.Context, key int64, value *Demo, tp int64) error
+
+	// redis: -key=demoKey
+	DelCacheDemos(c context.Context, keys []int64) error
+	// redis: -key=demoKey
+	DelCacheDemo(c context.Context, key int64) error
+	// redis: -key=keyMid
+	DelCacheDemo1(c context.Context, key int64, mid int64) error
+	// redis: -key=noneKey
+	DelCacheNone(c context.Context) error
+	// redis: -key=demoHashKey -field=demoField
+	DelCacheHashDemos(c context.Context, keys []int64, tp int64) error
+}
+
+func demoKey(id int64) string {
+	return fmt.Sprintf("art_%d", id)
+}
+
+func demo2Key(id, tp int64) string {
+	return fmt.Sprintf("art_%d_%d", id, tp)
+}
+
+func keyMid(id, mid int64) string {
+	return fmt.Sprintf("art_%d_%d", id, mid)
+}
+
+func noneKey() string {
+	return "none"
+}
+
+func countKey(id int64) string {
+	return fmt.Sprintf("cnt_%d", id)
+}
+
+func demoHashKey(tp int64) string {
+	return fmt.Sprintf("arts_%d", tp)
+}
+
+func demoField(id int64) string {
+	return fmt.Sprint(id)
+}
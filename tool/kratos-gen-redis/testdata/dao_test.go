@@ -0,0 +1,125 @@
+package testdata
+
+import (
+	"context"
+	"os"
+	"testing"
+)
+
+var d *dao
+
+func TestMain(m *testing.M) {
+	d = New()
+	// the tests need a redis at 127.0.0.1:6379.
+	if _, err := d.redis.Do(context.TODO(), "PING"); err != nil {
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+func TestDemo(t *testing.T) {
+	c := context.TODO()
+	art := &Demo{ID: 1, Title: "title"}
+	if err := d.AddCacheDemo(c, art.ID, art); err != nil {
+		t.Fatalf("err should be nil, get: %v", err)
+	}
+	art1, err := d.CacheDemo(c, art.ID)
+	if err != nil {
+		t.Fatalf("err should be nil, get: %v", err)
+	}
+	if (art1.ID != art.ID) || (art.Title != art1.Title) {
+		t.Fatal("art not equal")
+	}
+	if err = d.DelCacheDemo(c, art.ID); err != nil {
+		t.Fatalf("err should be nil, get: %v", err)
+	}
+	if art1, err = d.CacheDemo(c, art.ID); (art1 != nil) || (err != nil) {
+		t.Fatalf("art %v, err: %v", art1, err)
+	}
+}
+
+func TestNone(t *testing.T) {
+	c := context.TODO()
+	art := &Demo{ID: 1, Title: "title"}
+	if err := d.AddCacheNone(c, art); err != nil {
+		t.Fatalf("err should be nil, get: %v", err)
+	}
+	art1, err := d.CacheNone(c)
+	if err != nil {
+		t.Fatalf("err should be nil, get: %v", err)
+	}
+	if (art1.ID != art.ID) || (art.Title != art1.Title) {
+		t.Fatal("art not equal")
+	}
+	if err = d.DelCacheNone(c); err != nil {
+		t.Fatalf("err should be nil, get: %v", err)
+	}
+	if art1, err = d.CacheNone(c); (art1 != nil) || (err != nil) {
+		t.Fatalf("art %v, err: %v", art1, err)
+	}
+}
+
+func TestDemos(t *testing.T) {
+	c := context.TODO()
+	art1 := &Demo{ID: 1, Title: "title"}
+	art2 := &Demo{ID: 2, Title: "title"}
+	art3 := &Demo{ID: 3, Title: "title"}
+	if err := d.AddCacheDemos(c, map[int64]*Demo{1: art1, 2: art2, 3: art3}); err != nil {
+		t.Fatalf("err should be nil, get: %v", err)
+	}
+	arts, err := d.CacheDemos(c, []int64{art1.ID, art2.ID, art3.ID, 4})
+	if err != nil {
+		t.Fatalf("err should be nil, get: %v", err)
+	}
+	if len(arts) != 3 || arts[2].Title != "title" {
+		t.Fatalf("unexpected arts %v", arts)
+	}
+	if err = d.DelCacheDemos(c, []int64{art1.ID, art2.ID, art3.ID}); err != nil {
+		t.Fatalf("err should be nil, get: %v", err)
+	}
+	if arts, err = d.CacheDemos(c, []int64{art1.ID, art2.ID}); (arts != nil) || (err != nil) {
+		t.Fatalf("arts %v, err: %v", arts, err)
+	}
+}
+
+func TestHashDemos(t *testing.T) {
+	c := context.TODO()
+	art1 := &Demo{ID: 1, Title: "title"}
+	art2 := &Demo{ID: 2, Title: "title"}
+	if err := d.AddCacheHashDemos(c, map[int64]*Demo{1: art1, 2: art2}, 1); err != nil {
+		t.Fatalf("err should be nil, get: %v", err)
+	}
+	arts, err := d.CacheHashDemos(c, []int64{art1.ID, art2.ID, 3}, 1)
+	if err != nil {
+		t.Fatalf("err should be nil, get: %v", err)
+	}
+	if len(arts) != 2 || arts[1].Title != "title" {
+		t.Fatalf("unexpected arts %v", arts)
+	}
+	if err = d.DelCacheHashDemos(c, []int64{art1.ID}, 1); err != nil {
+		t.Fatalf("err should be nil, get: %v", err)
+	}
+	art, err := d.CacheHashDemo(c, art1.ID, 1)
+	if (art != nil) || (err != nil) {
+		t.Fatalf("art %v, err: %v", art, err)
+	}
+}
+
+func TestCounts(t *testing.T) {
+	c := context.TODO()
+	d.redis.Do(c, "DEL", countKey(1), countKey(2))
+	if err := d.AddCacheCounts(c, map[int64]int64{1: 10}); err != nil {
+		t.Fatalf("err should be nil, get: %v", err)
+	}
+	// only_add does not overwrite.
+	if err := d.AddCacheCounts(c, map[int64]int64{1: 11, 2: 20}); err != nil {
+		t.Fatalf("err should be nil, get: %v", err)
+	}
+	counts, err := d.CacheCounts(c, []int64{1, 2})
+	if err != nil {
+		t.Fatalf("err should be nil, get: %v", err)
+	}
+	if counts[1] != 10 || counts[2] != 20 {
+		t.Fatalf("unexpected counts %v", counts)
+	}
+}
@@ -39,6 +39,7 @@ func main() {
 			Action:          toolAction,
 			SkipFlagParsing: true,
 		},
+		migrateCommand,
 		{
 			Name:    "version",
 			Aliases: []string{"v"},
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+
+	"github.com/djienet/kratos/pkg/database/migrate"
+
+	"github.com/BurntSushi/toml"
+	"github.com/urfave/cli/v2"
+)
+
+var migrateFlags = []cli.Flag{
+	&cli.StringFlag{
+		Name:  "dsn",
+		Usage: "mysql dsn, default the dsn of [Client] in --conf",
+	},
+	&cli.StringFlag{
+		Name:  "conf",
+		Value: "configs/db.toml",
+		Usage: "db config file",
+	},
+	&cli.StringFlag{
+		Name:  "dir",
+		Value: "migrations",
+		Usage: "migration files directory",
+	},
+	&cli.StringFlag{
+		Name:  "table",
+		Value: "schema_migrations",
+		Usage: "migration history table",
+	},
+}
+
+var migrateCommand = &cli.Command{
+	Name:  "migrate",
+	Usage: "kratos migrate up|down|status|new",
+	Subcommands: []*cli.Command{
+		{
+			Name:   "up",
+			Usage:  "执行未执行的迁移",
+			Flags:  append([]cli.Flag{&cli.IntFlag{Name: "n", Usage: "最多执行n个，默认全部"}}, migrateFlags...),
+			Action: migrateUpAction,
+		},
+		{
+			Name:   "down",
+			Usage:  "回滚最近执行的迁移",
+			Flags:  append([]cli.Flag{&cli.IntFlag{Name: "n", Value: 1, Usage: "回滚n个"}}, migrateFlags...),
+			Action: migrateDownAction,
+		},
+		{
+			Name:   "status",
+			Usage:  "查看迁移状态",
+			Flags:  migrateFlags,
+			Action: migrateStatusAction,
+		},
+		{
+			Name:      "new",
+			Usage:     "创建新的迁移文件",
+			ArgsUsage: "name",
+			Flags:     migrateFlags,
+			Action:    migrateNewAction,
+		},
+	},
+}
+
+func newMigrator(c *cli.Context) (*migrate.Migrator, func(), error) {
+	dsn := c.String("dsn")
+	if dsn == "" {
+		var conf struct {
+			Client struct {
+				DSN string
+			}
+		}
+		if _, err := toml.DecodeFile(c.String("conf"), &conf); err != nil {
+			return nil, nil, fmt.Errorf("read dsn from %s error: %v", c.String("conf"), err)
+		}
+		if dsn = conf.Client.DSN; dsn == "" {
+			return nil, nil, fmt.Errorf("no dsn found in %s", c.String("conf"))
+		}
+	}
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		return nil, nil, err
+	}
+	m := migrate.New(db, migrate.Dir(c.String("dir")), &migrate.Config{Table: c.String("table")})
+	return m, func() { db.Close() }, nil
+}
+
+func migrateUpAction(c *cli.Context) error {
+	m, closeDB, err := newMigrator(c)
+	if err != nil {
+		return err
+	}
+	defer closeDB()
+	applied, err := m.Up(context.Background(), c.Int("n"))
+	for _, mg := range applied {
+		fmt.Printf("up: %d %s\n", mg.Version, mg.Name)
+	}
+	if err == nil && len(applied) == 0 {
+		fmt.Println("no pending migrations.")
+	}
+	return err
+}
+
+func migrateDownAction(c *cli.Context) error {
+	m, closeDB, err := newMigrator(c)
+	if err != nil {
+		return err
+	}
+	defer closeDB()
+	reverted, err := m.Down(context.Background(), c.Int("n"))
+	for _, mg := range reverted {
+		fmt.Printf("down: %d %s\n", mg.Version, mg.Name)
+	}
+	return err
+}
+
+func migrateStatusAction(c *cli.Context) error {
+	m, closeDB, err := newMigrator(c)
+	if err != nil {
+		return err
+	}
+	defer closeDB()
+	ss, err := m.Status(context.Background())
+	if err != nil {
+		return err
+	}
+	for _, s := range ss {
+		state := "pending"
+		if s.Applied {
+			state = "applied at " + s.AppliedAt.Format("2006-01-02 15:04:05")
+		}
+		if s.Modified {
+			state += " (modified)"
+		}
+		if s.Missing {
+			state += " (missing)"
+		}
+		fmt.Printf("%d\t%s\t%s\n", s.Version, s.Name, state)
+	}
+	return nil
+}
+
+func migrateNewAction(c *cli.Context) error {
+	if c.NArg() == 0 {
+		return errors.New("usage: kratos migrate new name")
+	}
+	up, down, err := migrate.Create(c.String("dir"), c.Args().First())
+	if err != nil {
+		return err
+	}
+	fmt.Printf("created: %s\ncreated: %s\n", filepath.Clean(up), filepath.Clean(down))
+	return nil
+}
@@ -40,6 +40,15 @@ var toolIndexs = []*Tool{
 		Platform:  []string{"darwin", "linux", "windows"},
 		Author:    "kratos",
 	},
+	{
+		Name:      "genredis",
+		Alias:     "kratos-gen-redis",
+		BuildTime: time.Date(2026, 10, 19, 0, 0, 0, 0, time.Local),
+		Install:   "go get -u github.com/djienet/kratos/tool/kratos-gen-redis@" + Version,
+		Summary:   "redis缓存代码生成",
+		Platform:  []string{"darwin", "linux", "windows"},
+		Author:    "kratos",
+	},
 	{
 		Name:         "genproject",
 		Alias:        "kratos-gen-project",